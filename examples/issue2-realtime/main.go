@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
@@ -30,7 +31,7 @@ func main() {
 	}
 
 	// Create realtime connection
-	err := client.Realtime.Connect()
+	err := client.Realtime.Connect(context.Background())
 
 	if err != nil {
 		log.Fatalf("Could not connect to /cep/realtime. %s", err)
@@ -14,7 +14,7 @@ func main() {
 	// C8Y_HOST, C8Y_TENANT, C8Y_USER, C8Y_PASSWORD
 	client := c8y.NewClientFromEnvironment(nil, false)
 
-	err := client.Realtime.Connect()
+	err := client.Realtime.Connect(context.Background())
 
 	if err != nil {
 		log.Fatalf("Could not connect to /cep/realtime. %s", err)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
@@ -14,7 +15,7 @@ func main() {
 	client := c8y.NewClientFromEnvironment(nil, false)
 
 	// Create realtime connection
-	err := client.Realtime.Connect()
+	err := client.Realtime.Connect(context.Background())
 
 	if err != nil {
 		log.Fatalf("Could not connect to /cep/realtime. %s", err)
@@ -12,6 +12,12 @@ const charset = "abcdefghijklmnopqrstuvwxyz" +
 
 var seededRand = rand.New(rand.NewSource(time.Now().UnixNano()))
 
+// SetSeed sets the seed used to generate random strings, so that the same values
+// are generated on each run (e.g. when replaying recorded requests)
+func SetSeed(seed int64) {
+	seededRand = rand.New(rand.NewSource(seed))
+}
+
 func stringWithCharset(length int, charset string) string {
 	b := make([]byte, length)
 	for i := range b {
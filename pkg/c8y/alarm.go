@@ -2,6 +2,7 @@ package c8y
 
 import (
 	"context"
+	"iter"
 
 	"github.com/tidwall/gjson"
 )
@@ -100,6 +101,7 @@ type AlarmCollection struct {
 func (s *AlarmService) GetAlarm(ctx context.Context, ID string) (*Alarm, *Response, error) {
 	data := new(Alarm)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Alarm.GetAlarm",
 		Method:       "GET",
 		Path:         "alarm/alarms/" + ID,
 		ResponseData: data,
@@ -111,6 +113,7 @@ func (s *AlarmService) GetAlarm(ctx context.Context, ID string) (*Alarm, *Respon
 func (s *AlarmService) GetAlarms(ctx context.Context, opt *AlarmCollectionOptions) (*AlarmCollection, *Response, error) {
 	data := new(AlarmCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Alarm.GetAlarms",
 		Method:       "GET",
 		Path:         "alarm/alarms",
 		Query:        opt,
@@ -119,10 +122,22 @@ func (s *AlarmService) GetAlarms(ctx context.Context, opt *AlarmCollectionOption
 	return data, resp, err
 }
 
+// IterAlarms returns an iterator over all alarms matching the given options. Pages are fetched
+// lazily by following the .next links. See Paginate for more details
+func (s *AlarmService) IterAlarms(ctx context.Context, opt *AlarmCollectionOptions, limits PaginateLimits) iter.Seq2[Alarm, error] {
+	return Paginate[Alarm](ctx, s.client, RequestOptions{
+		Operation: "Alarm.IterAlarms",
+		Method:    "GET",
+		Path:      "alarm/alarms",
+		Query:     opt,
+	}, "alarms", limits)
+}
+
 // Create creates a new alarm object
 func (s *AlarmService) Create(ctx context.Context, body interface{}) (*Alarm, *Response, error) {
 	data := new(Alarm)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Alarm.Create",
 		Method:       "POST",
 		Path:         "alarm/alarms",
 		Body:         body,
@@ -143,10 +158,11 @@ func (s *AlarmService) BulkUpdateAlarms(ctx context.Context, status string, opts
 		"status": status,
 	}
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: "PUT",
-		Path:   "alarm/alarms",
-		Query:  opts,
-		Body:   body,
+		Operation: "Alarm.BulkUpdateAlarms",
+		Method:    "PUT",
+		Path:      "alarm/alarms",
+		Query:     opts,
+		Body:      body,
 	})
 	return resp, err
 }
@@ -168,6 +184,7 @@ type AlarmUpdateProperties struct {
 func (s *AlarmService) Update(ctx context.Context, ID string, body AlarmUpdateProperties) (*Alarm, *Response, error) {
 	data := new(Alarm)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Alarm.Update",
 		Method:       "PUT",
 		Path:         "alarm/alarms/" + ID,
 		ResponseData: data,
@@ -179,9 +196,10 @@ func (s *AlarmService) Update(ctx context.Context, ID string, body AlarmUpdatePr
 // DeleteAlarms removes a list of alarms using the specified search options
 func (s *AlarmService) DeleteAlarms(ctx context.Context, opt *AlarmCollectionOptions) (*Response, error) {
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "alarm/alarms",
-		Query:  opt,
+		Operation: "Alarm.DeleteAlarms",
+		Method:    "DELETE",
+		Path:      "alarm/alarms",
+		Query:     opt,
 	})
 	return resp, err
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"iter"
 	"os"
 
 	"github.com/tidwall/gjson"
@@ -122,6 +123,7 @@ type ServiceUser struct {
 func (s *ApplicationService) getApplicationData(ctx context.Context, partialURL string, opt *ApplicationOptions) (*ApplicationCollection, *Response, error) {
 	data := new(ApplicationCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Application.getApplicationData",
 		Method:       "GET",
 		Path:         partialURL,
 		Query:        opt,
@@ -153,6 +155,7 @@ func (s *ApplicationService) GetApplicationsByTenant(ctx context.Context, tenant
 func (s *ApplicationService) GetApplication(ctx context.Context, ID string) (*Application, *Response, error) {
 	data := new(Application)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Application.GetApplication",
 		Method:       "GET",
 		Path:         "application/applications/" + ID,
 		ResponseData: data,
@@ -165,10 +168,22 @@ func (s *ApplicationService) GetApplications(ctx context.Context, opt *Applicati
 	return s.getApplicationData(ctx, "/application/applications", opt)
 }
 
+// IterApplications returns an iterator over all applications matching the given options. Pages are fetched
+// lazily by following the .next links. See Paginate for more details
+func (s *ApplicationService) IterApplications(ctx context.Context, opt *ApplicationOptions, limits PaginateLimits) iter.Seq2[Application, error] {
+	return Paginate[Application](ctx, s.client, RequestOptions{
+		Operation: "Application.IterApplications",
+		Method:    "GET",
+		Path:      "application/applications",
+		Query:     opt,
+	}, "applications", limits)
+}
+
 // Create adds a new application to Cumulocity
 func (s *ApplicationService) Create(ctx context.Context, body *Application) (*Application, *Response, error) {
 	data := new(Application)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Application.Create",
 		Method:       "POST",
 		Path:         "application/applications",
 		Body:         body,
@@ -184,6 +199,7 @@ func (s *ApplicationService) Create(ctx context.Context, body *Application) (*Ap
 func (s *ApplicationService) Copy(ctx context.Context, ID string) (*Application, *Response, error) {
 	data := new(Application)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Application.Copy",
 		Method:       "POST",
 		Path:         "application/applications/" + ID + "/clone",
 		ResponseData: data,
@@ -195,6 +211,7 @@ func (s *ApplicationService) Copy(ctx context.Context, ID string) (*Application,
 func (s *ApplicationService) Update(ctx context.Context, ID string, body *Application) (*Application, *Response, error) {
 	data := new(Application)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Application.Update",
 		Method:       "PUT",
 		Path:         "application/applications/" + ID,
 		Body:         body,
@@ -206,8 +223,9 @@ func (s *ApplicationService) Update(ctx context.Context, ID string, body *Applic
 // Delete removes an existing application
 func (s *ApplicationService) Delete(ctx context.Context, ID string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "application/applications/" + ID,
+		Operation: "Application.Delete",
+		Method:    "DELETE",
+		Path:      "application/applications/" + ID,
 	})
 }
 
@@ -219,6 +237,7 @@ func (s *ApplicationService) Delete(ctx context.Context, ID string) (*Response,
 func (s *ApplicationService) GetCurrentApplication(ctx context.Context) (*Application, *Response, error) {
 	data := new(Application)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Application.GetCurrentApplication",
 		Method:       "GET",
 		Path:         "application/currentApplication",
 		ResponseData: data,
@@ -237,6 +256,7 @@ type ApplicationUser struct {
 func (s *ApplicationService) GetApplicationUser(ctx context.Context, ID string) (*ApplicationUser, *Response, error) {
 	data := new(ApplicationUser)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Application.GetApplicationUser",
 		Method:       "GET",
 		Path:         "application/applications/" + ID + "/bootstrapUser",
 		ResponseData: data,
@@ -248,6 +268,7 @@ func (s *ApplicationService) GetApplicationUser(ctx context.Context, ID string)
 func (s *ApplicationService) UpdateCurrentApplication(ctx context.Context, ID string, body *Application) (*Application, *Response, error) {
 	data := new(Application)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Application.UpdateCurrentApplication",
 		Method:       "PUT",
 		Path:         "application/currentApplication",
 		Body:         body,
@@ -261,6 +282,7 @@ func (s *ApplicationService) UpdateCurrentApplication(ctx context.Context, ID st
 func (s *ApplicationService) GetCurrentApplicationSubscriptions(ctx context.Context) (*ApplicationSubscriptions, *Response, error) {
 	data := new(ApplicationSubscriptions)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Application.GetCurrentApplicationSubscriptions",
 		Method:       "GET",
 		Path:         "application/currentApplication/subscriptions",
 		ResponseData: data,
@@ -288,9 +310,10 @@ func (s *ApplicationService) CreateBinary(ctx context.Context, filename string,
 	}
 
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method:   "POST",
-		Accept:   "application/json",
-		Path:     "/application/applications/" + ID + "/binaries",
-		FormData: values,
+		Operation: "Application.CreateBinary",
+		Method:    "POST",
+		Accept:    "application/json",
+		Path:      "/application/applications/" + ID + "/binaries",
+		FormData:  values,
 	})
 }
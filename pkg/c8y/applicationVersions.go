@@ -64,9 +64,10 @@ type ApplicationVersionsCollection struct {
 func (s *ApplicationVersionsService) GetVersionByTag(ctx context.Context, ID string, tag string) (*ApplicationVersion, *Response, error) {
 	data := new(ApplicationVersion)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: "GET",
-		Path:   "application/applications/" + ID + "/versions",
-		Accept: ContentTypeApplicationVersion,
+		Operation: "ApplicationVersions.GetVersionByTag",
+		Method:    "GET",
+		Path:      "application/applications/" + ID + "/versions",
+		Accept:    ContentTypeApplicationVersion,
 		Query: &versionOption{
 			Tag: tag,
 		},
@@ -79,9 +80,10 @@ func (s *ApplicationVersionsService) GetVersionByTag(ctx context.Context, ID str
 func (s *ApplicationVersionsService) GetVersionByName(ctx context.Context, ID string, version string) (*ApplicationVersion, *Response, error) {
 	data := new(ApplicationVersion)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: "GET",
-		Path:   "application/applications/" + ID + "/versions",
-		Accept: ContentTypeApplicationVersion,
+		Operation: "ApplicationVersions.GetVersionByName",
+		Method:    "GET",
+		Path:      "application/applications/" + ID + "/versions",
+		Accept:    ContentTypeApplicationVersion,
 		Query: &versionOption{
 			Version: version,
 		},
@@ -94,6 +96,7 @@ func (s *ApplicationVersionsService) GetVersionByName(ctx context.Context, ID st
 func (s *ApplicationVersionsService) GetVersions(ctx context.Context, ID string, opt *ApplicationVersionsOptions) (*ApplicationVersionsCollection, *Response, error) {
 	data := new(ApplicationVersionsCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "ApplicationVersions.GetVersions",
 		Method:       "GET",
 		Path:         "application/applications/" + ID + "/versions",
 		Query:        opt,
@@ -106,9 +109,10 @@ func (s *ApplicationVersionsService) GetVersions(ctx context.Context, ID string,
 func (s *ApplicationVersionsService) ReplaceTags(ctx context.Context, ID string, version string, tags []string) (*ApplicationVersion, *Response, error) {
 	data := new(ApplicationVersion)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: "PUT",
-		Path:   "application/applications/" + ID + "/versions/" + version,
-		Accept: ContentTypeApplicationVersion,
+		Operation: "ApplicationVersions.ReplaceTags",
+		Method:    "PUT",
+		Path:      "application/applications/" + ID + "/versions/" + version,
+		Accept:    ContentTypeApplicationVersion,
 		Body: &ApplicationVersion{
 			Tags: tags,
 		},
@@ -120,8 +124,9 @@ func (s *ApplicationVersionsService) ReplaceTags(ctx context.Context, ID string,
 // Delete removes an application version by the tag
 func (s *ApplicationVersionsService) DeleteVersionByTag(ctx context.Context, ID string, tag string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "application/applications/" + ID + "/versions",
+		Operation: "ApplicationVersions.DeleteVersionByTag",
+		Method:    "DELETE",
+		Path:      "application/applications/" + ID + "/versions",
 		Query: &versionOption{
 			Tag: tag,
 		},
@@ -136,8 +141,9 @@ type versionOption struct {
 // Delete removes an application version by the version name
 func (s *ApplicationVersionsService) DeleteVersionByName(ctx context.Context, ID string, version string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "application/applications/" + ID + "/versions",
+		Operation: "ApplicationVersions.DeleteVersionByName",
+		Method:    "DELETE",
+		Path:      "application/applications/" + ID + "/versions",
 		Query: &versionOption{
 			Version: version,
 		},
@@ -193,6 +199,7 @@ func (s *ApplicationVersionsService) CreateVersionFromReader(ctx context.Context
 	}
 	data := new(ApplicationVersion)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "ApplicationVersions.CreateVersionFromReader",
 		Method:       "POST",
 		Accept:       ContentTypeApplicationVersion,
 		Path:         "/application/applications/" + ID + "/versions",
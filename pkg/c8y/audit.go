@@ -2,6 +2,7 @@ package c8y
 
 import (
 	"context"
+	"iter"
 
 	"github.com/tidwall/gjson"
 )
@@ -58,6 +59,7 @@ type AuditRecordCollection struct {
 func (s *AuditService) GetAuditRecord(ctx context.Context, ID string) (*AuditRecord, *Response, error) {
 	data := new(AuditRecord)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Audit.GetAuditRecord",
 		Method:       "GET",
 		Path:         "audit/auditRecords/" + ID,
 		ResponseData: data,
@@ -69,6 +71,7 @@ func (s *AuditService) GetAuditRecord(ctx context.Context, ID string) (*AuditRec
 func (s *AuditService) GetAuditRecords(ctx context.Context, opt *AuditRecordCollectionOptions) (*AuditRecordCollection, *Response, error) {
 	data := new(AuditRecordCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Audit.GetAuditRecords",
 		Method:       "GET",
 		Path:         "audit/auditRecords",
 		Query:        opt,
@@ -77,10 +80,22 @@ func (s *AuditService) GetAuditRecords(ctx context.Context, opt *AuditRecordColl
 	return data, resp, err
 }
 
+// IterAuditRecords returns an iterator over all audit records matching the given options. Pages are fetched
+// lazily by following the .next links. See Paginate for more details
+func (s *AuditService) IterAuditRecords(ctx context.Context, opt *AuditRecordCollectionOptions, limits PaginateLimits) iter.Seq2[AuditRecord, error] {
+	return Paginate[AuditRecord](ctx, s.client, RequestOptions{
+		Operation: "Audit.IterAuditRecords",
+		Method:    "GET",
+		Path:      "audit/auditRecords",
+		Query:     opt,
+	}, "auditRecords", limits)
+}
+
 // Create creates a new alarm object
 func (s *AuditService) Create(ctx context.Context, body interface{}) (*AuditRecord, *Response, error) {
 	data := new(AuditRecord)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Audit.Create",
 		Method:       "POST",
 		Path:         "audit/auditRecords",
 		Body:         body,
@@ -92,9 +107,10 @@ func (s *AuditService) Create(ctx context.Context, body interface{}) (*AuditReco
 // DeleteAuditRecords removes a collection of audit records based on search options
 func (s *AuditService) DeleteAuditRecords(ctx context.Context, opt *AuditRecordCollectionOptions) (*Response, error) {
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "audit/auditRecords",
-		Query:  opt,
+		Operation: "Audit.DeleteAuditRecords",
+		Method:    "DELETE",
+		Path:      "audit/auditRecords",
+		Query:     opt,
 	})
 	return resp, err
 }
@@ -4,14 +4,14 @@ import (
 	"bufio"
 	"bytes"
 	"crypto/sha256"
-	"errors"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/tidwall/gjson"
@@ -49,37 +49,85 @@ func isCacheableResponse(res *http.Response) bool {
 	return res.StatusCode < 300
 }
 
-// CacheResponse produces a RoundTripper that caches HTTP responses to disk for a specified amount of time
+// CacheResponse produces a RoundTripper that caches HTTP responses for a specified amount of time.
+// The responses are stored on disk in the given directory unless a store is set in the options,
+// in which case the dir is ignored, and the store's settings control how long the entries are kept.
+// Cached responses are never used if the ttl is 0 and no store is set.
+//
+// Cached responses of a resource are not used after a write request (POST, PUT, PATCH or DELETE) to the same
+// resource has been sent through the client. See CacheOptions.HTTPSemantics to honour the Cache-Control headers
+//
+// The entries are encrypted if CacheOptions.EncryptionKey is set. Caching is disabled if the key is invalid
 func CacheResponse(ttl time.Duration, dir string, isCacheable Cacheable, options CacheOptions) ClientOption {
-	fs := fileStorage{
-		dir: dir,
-		ttl: ttl,
-		mu:  &sync.RWMutex{},
+	store := options.Store
+	if store == nil {
+		retention := ttl
+		if options.HTTPSemantics {
+			// Keep stale responses so that they can be revalidated
+			retention = ttl + options.getMaxStale(ttl)
+		}
+		store = NewFileCacheStore(FileCacheOptions{
+			Dir: dir,
+			TTL: retention,
+		})
+		if retention <= 0 {
+			// The responses in the directory expire immediately, so they are only written
+			options.Mode = StoreModeWrite
+		}
+	}
+	if len(options.EncryptionKey) > 0 {
+		encrypted, err := NewEncryptedCacheStore(store, options.EncryptionKey)
+		if err != nil {
+			Logger.Warnf("Disabling cache as the entries can't be encrypted. %s", err)
+			return func(tr http.RoundTripper) http.RoundTripper {
+				return tr
+			}
+		}
+		store = encrypted
 	}
 
 	return func(tr http.RoundTripper) http.RoundTripper {
-		return &funcTripper{roundTrip: func(req *http.Request) (*http.Response, error) {
+		return &cacheTransport{
+			next:          tr,
+			store:         store,
+			ttl:           ttl,
+			isCacheable:   isCacheable,
+			options:       options,
+			invalidations: newCacheInvalidations(),
+			createdAt:     time.Now(),
+		}
+	}
+}
 
-			if !isCacheable(req) {
-				return tr.RoundTrip(req)
-			}
+// parseCachedResponse parses the response of a cache entry
+func parseCachedResponse(entry *CacheEntry) (*http.Response, error) {
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(entry.Data)), nil)
+}
 
-			key, keyErr := cacheKey(req, options)
-			// Ignore read from cache in write only mode
-			if keyErr == nil && options.Mode != StoreModeWrite {
-				if res, err := fs.read(key); err == nil {
-					res.Request = req
-					return res, nil
-				}
-			}
+// setDefaultValidators sets the ETag and Last-Modified headers if they were not included in the original response
+func setDefaultValidators(res *http.Response, key string, storedAt time.Time) {
+	if res.Header.Get("ETag") == "" {
+		_, hash, _ := strings.Cut(key, "/")
+		res.Header.Set("ETag", hash)
+	}
+	if res.Header.Get("Last-Modified") == "" {
+		res.Header.Set("Last-Modified", storedAt.UTC().Format(TimeFormat))
+	}
+}
 
-			res, err := tr.RoundTrip(req)
-			if err == nil && keyErr == nil && isCacheableResponse(res) {
-				_ = fs.store(key, res)
-			}
-			return res, err
-		}}
+// dumpResponse serializes the response. The body of the response can still be read afterwards
+func dumpResponse(res *http.Response) ([]byte, error) {
+	var origBody io.ReadCloser
+	if res.Body != nil {
+		origBody, res.Body = copyStream(res.Body)
+		defer res.Body.Close()
+	}
+	buf := &bytes.Buffer{}
+	err := res.Write(buf)
+	if origBody != nil {
+		res.Body = origBody
 	}
+	return buf.Bytes(), err
 }
 
 func copyStream(r io.ReadCloser) (io.ReadCloser, io.ReadCloser) {
@@ -119,8 +167,74 @@ type CacheOptions struct {
 
 	// BodyKeys Only cache on specific json keys on the body
 	BodyKeys []string
+
+	// Store where the responses are cached. Defaults to a FileCacheStore
+	Store CacheStore
+
+	// HTTPSemantics honours the Cache-Control and Expires headers of the requests and responses. The ttl is only
+	// used for responses without any freshness information. Stale responses are revalidated using the
+	// If-None-Match and If-Modified-Since headers, so the body is only sent again if it has changed
+	HTTPSemantics bool
+
+	// StaleWhileRevalidate returns a stale response straight away, and revalidates it in the background.
+	// It is only used with HTTPSemantics, and only for responses which are at most MaxStale past their freshness
+	StaleWhileRevalidate bool
+
+	// MaxStale is how long a response is kept after it became stale so that it can be revalidated. Defaults to the ttl
+	MaxStale time.Duration
+
+	// DisableWriteInvalidation keeps using the cached responses of a resource after it has been changed through the client
+	DisableWriteInvalidation bool
+
+	// EncryptionKey encrypts the cached responses using AES-256-GCM with a key derived from this value.
+	// It should be a random value of at least 32 bytes. Entries stored with a different key are ignored
+	EncryptionKey []byte
+}
+
+func (o CacheOptions) getMaxStale(ttl time.Duration) time.Duration {
+	if o.MaxStale > 0 {
+		return o.MaxStale
+	}
+	return ttl
+}
+
+// cacheNamespaceSize is the length of the host and tenant parts of the namespace
+const cacheNamespaceSize = 8
+
+// cacheNamespace returns the namespace of the entries of the host and tenant, so that they can be purged. Only a
+// hash of the values is used, so the namespace does not reveal which host or tenant was used
+func cacheNamespace(host string, tenant string) string {
+	return cacheNamespaceHash(host) + cacheNamespaceHash(tenant)
+}
+
+func cacheNamespaceHash(value string) string {
+	digest := sha256.Sum256([]byte(strings.ToLower(value)))
+	return hex.EncodeToString(digest[:])[:cacheNamespaceSize]
+}
+
+// PurgeCache removes all cached responses of the host (e.g. "example.cumulocity.com" or
+// "https://example.cumulocity.com"), and returns the number of entries removed. If tenant is empty,
+// the responses of all tenants are removed, otherwise only the responses of the given tenant.
+// The tenant of a response is read from the Authorization header, or the Client.TenantName of the client which sent the
+// request if the header does not include it (e.g. cookie based sessions). Responses cached with CacheOptions.ExcludeHost
+// use an empty host, and the ones cached with CacheOptions.ExcludeAuth, or where the tenant is not known, use an
+// empty tenant. They are only removed when purging all tenants of the host
+func PurgeCache(store CacheStore, host string, tenant string) (int, error) {
+	if strings.Contains(host, "://") {
+		u, err := url.Parse(host)
+		if err != nil {
+			return 0, err
+		}
+		host = u.Host
+	}
+	if tenant == "" {
+		return store.Purge(cacheNamespaceHash(host))
+	}
+	return store.Purge(cacheNamespace(host, tenant))
 }
 
+// cacheKey returns the key of the request, in the form of "<namespace>/<hash>" where the namespace is derived
+// from the host and tenant
 func cacheKey(req *http.Request, opt CacheOptions) (string, error) {
 	h := sha256.New()
 	fmt.Fprintf(h, "%s:", req.Method)
@@ -164,103 +278,22 @@ func cacheKey(req *http.Request, opt CacheOptions) (string, error) {
 	}
 
 	digest := h.Sum(nil)
-	return fmt.Sprintf("%x", digest), nil
-}
-
-type fileStorage struct {
-	dir string
-	ttl time.Duration
-	mu  *sync.RWMutex
-}
-
-func (fs *fileStorage) filePath(key string) string {
-	if len(key) >= 6 {
-		return filepath.Join(fs.dir, key[0:2], key[2:4], key[4:])
-	}
-	return filepath.Join(fs.dir, key)
-}
-
-func (fs *fileStorage) read(key string) (*http.Response, error) {
-	cacheFile := fs.filePath(key)
-
-	fs.mu.RLock()
-	defer fs.mu.RUnlock()
-
-	f, err := os.Open(cacheFile)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	stat, err := f.Stat()
-	if err != nil {
-		return nil, err
-	}
-
-	age := time.Since(stat.ModTime())
-	if age > fs.ttl {
-		return nil, errors.New("cache expired")
-	}
-
-	Logger.Infof("Using cached response. file: %s, age: %s, ttl: %s", cacheFile, age, fs.ttl)
-
-	body := &bytes.Buffer{}
-	_, err = io.Copy(body, f)
-	if err != nil {
-		return nil, err
-	}
-
-	res, err := http.ReadResponse(bufio.NewReader(body), nil)
-	if err != nil {
-		return nil, err
-	}
-	if res.Header.Get("ETag") == "" {
-		res.Header.Set("ETag", key)
-	}
-	if res.Header.Get("Last-Modified") == "" {
-		res.Header.Set("Last-Modified", stat.ModTime().UTC().Format(TimeFormat))
-	}
-	return res, err
+	return fmt.Sprintf("%s/%x", cacheKeyNamespace(req, opt), digest), nil
 }
 
-func (fs *fileStorage) store(key string, res *http.Response) error {
-	cacheFile := fs.filePath(key)
-
-	err := os.MkdirAll(filepath.Dir(cacheFile), 0755)
-	if err != nil {
-		return err
-	}
-
-	// Write to a temp file first, then rename atomically to avoid leaving
-	// a corrupt/partial cache file if the write fails midway.
-	f, err := os.CreateTemp(filepath.Dir(cacheFile), "cache-*.tmp")
-	if err != nil {
-		return err
-	}
-	tmpName := f.Name()
-	defer func() {
-		f.Close()
-		// Clean up temp file on failure (rename clears it on success).
-		os.Remove(tmpName)
-	}()
-
-	var origBody io.ReadCloser
-	if res.Body != nil {
-		origBody, res.Body = copyStream(res.Body)
-		defer res.Body.Close()
-	}
-	err = res.Write(f)
-	if origBody != nil {
-		res.Body = origBody
-	}
-	if err != nil {
-		return err
+// cacheKeyNamespace returns the namespace of the request's cache entries
+func cacheKeyNamespace(req *http.Request, opt CacheOptions) string {
+	host := req.URL.Host
+	if opt.ExcludeHost {
+		host = ""
 	}
-	if err := f.Close(); err != nil {
-		return err
+	tenant := ""
+	if !opt.ExcludeAuth {
+		tenant = TenantFromAuthorization(req.Header.Get("Authorization"))
+		if tenant == "" {
+			// Cookie based sessions and basic auth without the tenant prefix
+			tenant = clientTenantFromContext(req.Context())
+		}
 	}
-
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
-	return os.Rename(tmpName, cacheFile)
+	return cacheNamespace(host, tenant)
 }
@@ -0,0 +1,100 @@
+package c8y
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// encryptedCacheVersion is the first byte of each encrypted entry, so that the format can be changed later
+const encryptedCacheVersion = 1
+
+// ErrCacheDecrypt is returned when a cache entry can't be decrypted, e.g. because it was stored using a different key
+var ErrCacheDecrypt = errors.New("failed to decrypt cache entry")
+
+// EncryptedCacheStore encrypts the entries of another store using AES-256-GCM. The cache key is used as
+// additional authenticated data, so an entry can't be swapped with the entry of another request
+type EncryptedCacheStore struct {
+	CacheStore
+	aead cipher.AEAD
+}
+
+// NewEncryptedCacheStore wraps the store so that the entries are encrypted before they are stored. The encryption
+// key is derived from the given secret, which should be random and at least 32 bytes long
+func NewEncryptedCacheStore(store CacheStore, secret []byte) (*EncryptedCacheStore, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("cache encryption key is empty")
+	}
+	key, err := hkdf.Key(sha256.New, secret, nil, "go-c8y cache encryption", 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedCacheStore{
+		CacheStore: store,
+		aead:       aead,
+	}, nil
+}
+
+// Get returns the decrypted entry. Entries which can't be decrypted are removed and treated as a cache miss
+func (s *EncryptedCacheStore) Get(key string) (*CacheEntry, error) {
+	entry, err := s.CacheStore.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.decrypt(key, entry.Data)
+	if err != nil {
+		Logger.Infof("Ignoring cache entry. key: %s, err: %s", key, err)
+		_ = s.CacheStore.Delete(key)
+		return nil, ErrCacheMiss
+	}
+	return &CacheEntry{
+		Data:     data,
+		StoredAt: entry.StoredAt,
+	}, nil
+}
+
+// Set encrypts and stores the entry
+func (s *EncryptedCacheStore) Set(key string, entry *CacheEntry) error {
+	data, err := s.encrypt(key, entry.Data)
+	if err != nil {
+		return err
+	}
+	return s.CacheStore.Set(key, &CacheEntry{
+		Data:     data,
+		StoredAt: entry.StoredAt,
+	})
+}
+
+func (s *EncryptedCacheStore) encrypt(key string, plaintext []byte) ([]byte, error) {
+	nonceSize := s.aead.NonceSize()
+	out := make([]byte, 1+nonceSize, 1+nonceSize+len(plaintext)+s.aead.Overhead())
+	out[0] = encryptedCacheVersion
+	if _, err := rand.Read(out[1:]); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(out, out[1:], plaintext, []byte(key)), nil
+}
+
+func (s *EncryptedCacheStore) decrypt(key string, data []byte) ([]byte, error) {
+	nonceSize := s.aead.NonceSize()
+	if len(data) < 1+nonceSize || data[0] != encryptedCacheVersion {
+		return nil, fmt.Errorf("%w. unsupported format", ErrCacheDecrypt)
+	}
+	plaintext, err := s.aead.Open(nil, data[1:1+nonceSize], data[1+nonceSize:], []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("%w. %w", ErrCacheDecrypt, err)
+	}
+	return plaintext, nil
+}
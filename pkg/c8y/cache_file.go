@@ -0,0 +1,379 @@
+package c8y
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// cacheTempPattern is the pattern of the temporary files used whilst writing an entry
+	cacheTempPattern = "cache-*.tmp"
+
+	// cacheNamespacesDir is the directory containing a sub directory for each namespace
+	cacheNamespacesDir = "namespaces"
+)
+
+// FileCacheOptions are the settings of the filesystem cache store
+type FileCacheOptions struct {
+	// Dir is the directory where the responses are stored. Defaults to go-c8y-cache in the temp directory
+	Dir string
+
+	// TTL is the maximum age of an entry. Entries don't expire if it is 0
+	TTL time.Duration
+
+	// MaxSize is the maximum total size of the entries in bytes. The oldest entries are evicted
+	// once the limit is reached. 0 means no limit
+	MaxSize int64
+}
+
+// FileCacheStore stores each response in a file. The store can be shared by multiple processes,
+// e.g. consecutive runs of a CLI tool
+type FileCacheStore struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+
+	mu           *sync.RWMutex
+	restrictOnce sync.Once
+
+	// usage of the directory, which is only scanned when it is first needed
+	scanned bool
+	entries int64
+	size    int64
+
+	counters cacheCounters
+}
+
+// NewFileCacheStore creates a filesystem cache store
+func NewFileCacheStore(options FileCacheOptions) *FileCacheStore {
+	if options.Dir == "" {
+		options.Dir = filepath.Join(os.TempDir(), "go-c8y-cache")
+	}
+	return &FileCacheStore{
+		dir:     options.Dir,
+		ttl:     options.TTL,
+		maxSize: options.MaxSize,
+		mu:      &sync.RWMutex{},
+	}
+}
+
+// filePath returns the path of the entry. Entries in a namespace are stored in the namespaces directory
+// so that they can be purged without walking the whole cache
+func (fs *FileCacheStore) filePath(key string) string {
+	dir := fs.dir
+	if namespace, name, found := strings.Cut(key, "/"); found {
+		dir = filepath.Join(fs.dir, cacheNamespacesDir, namespace)
+		key = name
+	}
+	if len(key) >= 6 {
+		return filepath.Join(dir, key[0:2], key[2:4], key[4:])
+	}
+	return filepath.Join(dir, key)
+}
+
+// ensureDir creates the directory of the cache file. The cache directory is only accessible by the current user
+func (fs *FileCacheStore) ensureDir(cacheFile string) error {
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0700); err != nil {
+		return err
+	}
+	fs.restrictOnce.Do(func() {
+		// The directory could have been created with wider permissions by a previous version
+		if err := os.Chmod(fs.dir, 0700); err != nil {
+			Logger.Warnf("Could not restrict the permissions of the cache directory. %s", err)
+		}
+	})
+	return nil
+}
+
+// Get reads the entry. The modification time of the file is used as the time the entry was stored
+func (fs *FileCacheStore) Get(key string) (*CacheEntry, error) {
+	cacheFile := fs.filePath(key)
+
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	stat, err := os.Stat(cacheFile)
+	if err != nil {
+		fs.counters.misses.Add(1)
+		return nil, ErrCacheMiss
+	}
+	if isExpired(stat.ModTime(), fs.ttl) {
+		fs.counters.misses.Add(1)
+		return nil, ErrCacheMiss
+	}
+
+	data, err := os.ReadFile(cacheFile)
+	if err != nil {
+		fs.counters.misses.Add(1)
+		return nil, err
+	}
+	fs.counters.hits.Add(1)
+	return &CacheEntry{
+		Data:     data,
+		StoredAt: stat.ModTime(),
+	}, nil
+}
+
+// Set writes the entry, and evicts the oldest entries if the store exceeds the maximum size
+func (fs *FileCacheStore) Set(key string, entry *CacheEntry) error {
+	cacheFile := fs.filePath(key)
+
+	if err := fs.ensureDir(cacheFile); err != nil {
+		return err
+	}
+
+	// Write to a temp file first, then rename atomically to avoid leaving
+	// a corrupt/partial cache file if the write fails midway.
+	f, err := os.CreateTemp(filepath.Dir(cacheFile), cacheTempPattern)
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	defer func() {
+		f.Close()
+		// Clean up temp file on failure (rename clears it on success).
+		os.Remove(tmpName)
+	}()
+
+	if _, err := f.Write(entry.Data); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if !entry.StoredAt.IsZero() {
+		_ = os.Chtimes(tmpName, entry.StoredAt, entry.StoredAt)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	previous, statErr := os.Stat(cacheFile)
+	if err := os.Rename(tmpName, cacheFile); err != nil {
+		return err
+	}
+	if fs.scanned {
+		if statErr == nil {
+			fs.entries--
+			fs.size -= previous.Size()
+		}
+		fs.entries++
+		fs.size += int64(len(entry.Data))
+	}
+
+	if fs.maxSize > 0 {
+		if err := fs.scanLocked(); err != nil {
+			return err
+		}
+		if fs.size > fs.maxSize {
+			_, err := fs.pruneLocked()
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes the entry
+func (fs *FileCacheStore) Delete(key string) error {
+	cacheFile := fs.filePath(key)
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	stat, err := os.Stat(cacheFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err := os.Remove(cacheFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if fs.scanned && err == nil {
+		fs.entries--
+		fs.size -= stat.Size()
+	}
+	return nil
+}
+
+// Prune removes the expired entries, then removes the oldest entries until the store is within the maximum size.
+// Temporary files left behind by interrupted writes are also removed
+func (fs *FileCacheStore) Prune() (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.pruneLocked()
+}
+
+// Purge removes the entries in the namespaces starting with the prefix
+func (fs *FileCacheStore) Purge(prefix string) (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	namespaces, err := os.ReadDir(filepath.Join(fs.dir, cacheNamespacesDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	removed := 0
+	for _, namespace := range namespaces {
+		if !namespace.IsDir() || !strings.HasPrefix(namespace.Name(), prefix) {
+			continue
+		}
+		path := filepath.Join(fs.dir, cacheNamespacesDir, namespace.Name())
+		var size int64
+		count := 0
+		_ = filepath.WalkDir(path, func(_ string, d os.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				if info, err := d.Info(); err == nil {
+					size += info.Size()
+				}
+				count++
+			}
+			return nil
+		})
+		if err := os.RemoveAll(path); err != nil {
+			return removed, err
+		}
+		removed += count
+		if fs.scanned {
+			fs.entries -= int64(count)
+			fs.size -= size
+		}
+	}
+	return removed, nil
+}
+
+// Stats returns the usage statistics. The directory is scanned the first time the size is needed
+func (fs *FileCacheStore) Stats() CacheStats {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.scanLocked(); err != nil {
+		Logger.Warnf("Could not scan cache directory. %s", err)
+	}
+	return fs.counters.stats(fs.entries, fs.size)
+}
+
+type cacheFileInfo struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// walkLocked returns the cache files. Temporary files from incomplete writes are returned separately
+func (fs *FileCacheStore) walkLocked() (files []cacheFileInfo, temporary []string, err error) {
+	err = filepath.WalkDir(fs.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if matched, _ := filepath.Match(cacheTempPattern, d.Name()); matched {
+			temporary = append(temporary, path)
+			return nil
+		}
+		files = append(files, cacheFileInfo{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	return
+}
+
+func (fs *FileCacheStore) scanLocked() error {
+	if fs.scanned {
+		return nil
+	}
+	files, _, err := fs.walkLocked()
+	if err != nil {
+		return err
+	}
+	fs.entries, fs.size = 0, 0
+	for _, file := range files {
+		fs.entries++
+		fs.size += file.size
+	}
+	fs.scanned = true
+	return nil
+}
+
+func (fs *FileCacheStore) pruneLocked() (int, error) {
+	files, temporary, err := fs.walkLocked()
+	if err != nil {
+		return 0, err
+	}
+
+	// Only remove temporary files which are not currently being written
+	for _, path := range temporary {
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > time.Hour {
+			os.Remove(path)
+		}
+	}
+
+	// Oldest first
+	slices.SortFunc(files, func(a, b cacheFileInfo) int {
+		return a.modTime.Compare(b.modTime)
+	})
+
+	var total int64
+	for _, file := range files {
+		total += file.size
+	}
+
+	removed := 0
+	remaining := files[:0]
+	for _, file := range files {
+		if isExpired(file.modTime, fs.ttl) || (fs.maxSize > 0 && total > fs.maxSize) {
+			if err := os.Remove(file.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return removed, err
+			}
+			total -= file.size
+			removed++
+			continue
+		}
+		remaining = append(remaining, file)
+	}
+	fs.removeEmptyDirs()
+
+	fs.entries = int64(len(remaining))
+	fs.size = total
+	fs.scanned = true
+	fs.counters.evictions.Add(int64(removed))
+	if removed > 0 {
+		Logger.Infof("Removed cache entries. dir: %s, removed: %d, entries: %d, size: %d", fs.dir, removed, fs.entries, fs.size)
+	}
+	return removed, nil
+}
+
+// removeEmptyDirs removes the empty sub directories, but not the cache directory itself
+func (fs *FileCacheStore) removeEmptyDirs() {
+	dirs := []string{}
+	_ = filepath.WalkDir(fs.dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && d.IsDir() && path != fs.dir {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	// Remove the deepest directories first
+	slices.SortFunc(dirs, func(a, b string) int {
+		return strings.Count(b, string(filepath.Separator)) - strings.Count(a, string(filepath.Separator))
+	})
+	for _, dir := range dirs {
+		// Remove fails if the directory is not empty
+		_ = os.Remove(dir)
+	}
+}
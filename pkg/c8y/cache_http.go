@@ -0,0 +1,444 @@
+package c8y
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCacheInvalidations is the number of invalidated resources which are remembered. Once it is reached,
+// all responses cached before then are treated as invalidated
+const maxCacheInvalidations = 10000
+
+// cacheTransport caches the responses of cacheable requests, and invalidates them when the resource is changed
+type cacheTransport struct {
+	next        http.RoundTripper
+	store       CacheStore
+	ttl         time.Duration
+	isCacheable Cacheable
+	options     CacheOptions
+
+	invalidations *cacheInvalidations
+
+	// createdAt is when the transport was created. Responses cached before then could have been invalidated
+	// by another client using the same store
+	createdAt time.Time
+
+	// revalidating contains the keys which are being revalidated in the background
+	revalidating sync.Map
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.isCacheable(req) {
+		return t.send(req)
+	}
+
+	requestDirectives := parseCacheControl(req.Header)
+	if t.options.HTTPSemantics && requestDirectives.has("no-store") {
+		return t.send(req)
+	}
+
+	key, keyErr := cacheKey(req, t.options)
+	if keyErr != nil {
+		return t.send(req)
+	}
+
+	// Ignore read from cache in write only mode
+	if t.options.Mode != StoreModeWrite {
+		if entry, err := t.store.Get(key); err == nil && !t.isInvalidated(req, entry.StoredAt) {
+			if cached, err := parseCachedResponse(entry); err == nil {
+				if !t.options.HTTPSemantics {
+					Logger.Infof("Using cached response. key: %s, age: %s", key, time.Since(entry.StoredAt))
+					return t.cachedResponse(req, cached, key, entry.StoredAt), nil
+				}
+				return t.useCachedResponse(req, requestDirectives, key, entry, cached)
+			}
+		}
+	}
+
+	res, err := t.send(req)
+	if err == nil {
+		t.storeResponse(req, key, res)
+	}
+	return res, err
+}
+
+// send sends the request. The cached responses of the resource are invalidated if the request changed it,
+// regardless of whether the request itself is cacheable (e.g. POST requests to a microservice)
+func (t *cacheTransport) send(req *http.Request) (*http.Response, error) {
+	res, err := t.next.RoundTrip(req)
+	if err == nil && isWriteRequest(req) && res.StatusCode < 400 && !t.options.DisableWriteInvalidation {
+		t.invalidate(req, time.Now())
+	}
+	return res, err
+}
+
+// invalidate invalidates the cached responses of the resource. A marker is also added to the store, so that
+// other clients using the same persistent store don't use the responses they cached before the change
+func (t *cacheTransport) invalidate(req *http.Request, at time.Time) {
+	resource := t.resource(req)
+	t.invalidations.invalidate(resource, at)
+
+	namespace := cacheKeyNamespace(req, t.options)
+	marker := &CacheEntry{Data: []byte(resource), StoredAt: at}
+	_ = t.store.Set(cacheInvalidationKey(namespace, cacheInvalidationSubtree, resource), marker)
+	if parent, _, found := cutLast(resource, "/"); found {
+		_ = t.store.Set(cacheInvalidationKey(namespace, cacheInvalidationExact, parent), marker)
+	}
+}
+
+// isInvalidated returns true if the resource of the request has been changed after the response was cached. The
+// markers in the store are only checked for responses cached before the transport was created, as any changes made
+// since then by this client are already known
+func (t *cacheTransport) isInvalidated(req *http.Request, storedAt time.Time) bool {
+	resource := t.resource(req)
+	if !storedAt.Before(t.createdAt) {
+		return t.invalidations.isInvalidated(resource, storedAt)
+	}
+	namespace := cacheKeyNamespace(req, t.options)
+	t.invalidations.load(t.store, namespace, cacheInvalidationExact, resource)
+	for current, found := resource, true; found; current, _, found = cutLast(current, "/") {
+		t.invalidations.load(t.store, namespace, cacheInvalidationSubtree, current)
+	}
+	return t.invalidations.isInvalidated(resource, storedAt)
+}
+
+// useCachedResponse returns the cached response if it is fresh, otherwise it is revalidated
+func (t *cacheTransport) useCachedResponse(req *http.Request, requestDirectives cacheControl, key string, entry *CacheEntry, cached *http.Response) (*http.Response, error) {
+	age := time.Since(entry.StoredAt)
+	lifetime := freshnessLifetime(cached, entry.StoredAt, t.ttl)
+	if maxAge, ok := requestDirectives.seconds("max-age"); ok {
+		lifetime = min(lifetime, maxAge)
+	}
+	if requestDirectives.has("no-cache") {
+		lifetime = 0
+	}
+
+	if age <= lifetime {
+		Logger.Infof("Using cached response. key: %s, age: %s, lifetime: %s", key, age, lifetime)
+		return t.cachedResponse(req, cached, key, entry.StoredAt), nil
+	}
+
+	if window := t.staleWhileRevalidate(cached); age <= lifetime+window && !requestDirectives.has("no-cache") && !hasBody(req) {
+		Logger.Infof("Using stale response whilst revalidating. key: %s, age: %s, lifetime: %s", key, age, lifetime)
+		t.revalidateInBackground(req, key, entry)
+		return t.cachedResponse(req, cached, key, entry.StoredAt), nil
+	}
+
+	return t.revalidate(req, key, entry, cached)
+}
+
+// revalidate sends the request with the validators of the cached response. The cached response is used if the
+// server responds with 304 Not Modified
+func (t *cacheTransport) revalidate(req *http.Request, key string, entry *CacheEntry, cached *http.Response) (*http.Response, error) {
+	etag := cached.Header.Get("ETag")
+	lastModified := cached.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		res, err := t.send(req)
+		if err == nil {
+			t.storeResponse(req, key, res)
+		}
+		return res, err
+	}
+
+	conditional := req.Clone(req.Context())
+	if etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	res, err := t.send(conditional)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusNotModified {
+		res.Request = req
+		t.storeResponse(req, key, res)
+		return res, nil
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	Logger.Infof("Cached response is still valid. key: %s", key)
+	storedAt := t.refresh(key, cached, res)
+	return t.cachedResponse(req, cached, key, storedAt), nil
+}
+
+func (t *cacheTransport) revalidateInBackground(req *http.Request, key string, entry *CacheEntry) {
+	if _, running := t.revalidating.LoadOrStore(key, true); running {
+		return
+	}
+	background := req.Clone(context.WithoutCancel(req.Context()))
+	go func() {
+		defer t.revalidating.Delete(key)
+		cached, err := parseCachedResponse(entry)
+		if err != nil {
+			return
+		}
+		res, err := t.revalidate(background, key, entry, cached)
+		if err != nil {
+			Logger.Infof("Failed to revalidate cached response. key: %s, err: %s", key, err)
+			return
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+}
+
+// refresh updates the cached response with the headers of the 304 response, and stores it again
+func (t *cacheTransport) refresh(key string, cached *http.Response, notModified *http.Response) time.Time {
+	for name, values := range notModified.Header {
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Length", "Transfer-Encoding", "Content-Encoding":
+			continue
+		}
+		cached.Header[name] = values
+	}
+
+	storedAt := time.Now()
+	if data, err := dumpResponse(cached); err == nil {
+		_ = t.store.Set(key, &CacheEntry{
+			Data:     data,
+			StoredAt: storedAt,
+		})
+	}
+	return storedAt
+}
+
+// storeResponse caches the response if allowed
+func (t *cacheTransport) storeResponse(req *http.Request, key string, res *http.Response) {
+	if !isCacheableResponse(res) {
+		return
+	}
+	if t.options.HTTPSemantics {
+		if parseCacheControl(req.Header).has("no-store") || parseCacheControl(res.Header).has("no-store") {
+			return
+		}
+	}
+	if data, err := dumpResponse(res); err == nil {
+		_ = t.store.Set(key, &CacheEntry{
+			Data:     data,
+			StoredAt: time.Now(),
+		})
+	}
+}
+
+func (t *cacheTransport) cachedResponse(req *http.Request, res *http.Response, key string, storedAt time.Time) *http.Response {
+	setDefaultValidators(res, key, storedAt)
+	res.Request = req
+	return res
+}
+
+// staleWhileRevalidate returns how long the stale response can be used whilst it is being revalidated
+func (t *cacheTransport) staleWhileRevalidate(cached *http.Response) time.Duration {
+	directives := parseCacheControl(cached.Header)
+	if directives.has("must-revalidate") || directives.has("no-cache") {
+		return 0
+	}
+	if window, ok := directives.seconds("stale-while-revalidate"); ok {
+		return window
+	}
+	if t.options.StaleWhileRevalidate {
+		return t.options.getMaxStale(t.ttl)
+	}
+	return 0
+}
+
+// resource returns the resource path used to invalidate the cached responses
+func (t *cacheTransport) resource(req *http.Request) string {
+	resource := path.Clean("/" + strings.TrimSuffix(req.URL.Path, "/"))
+	if t.options.ExcludeHost {
+		return resource
+	}
+	return req.URL.Host + resource
+}
+
+func isWriteRequest(req *http.Request) bool {
+	switch strings.ToUpper(req.Method) {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func hasBody(req *http.Request) bool {
+	return req.Body != nil && req.Body != http.NoBody
+}
+
+// freshnessLifetime returns how long the response is fresh for. The Cache-Control max-age directive takes
+// precedence over the Expires header. The ttl is used if the response does not include either
+func freshnessLifetime(res *http.Response, storedAt time.Time, ttl time.Duration) time.Duration {
+	directives := parseCacheControl(res.Header)
+	if directives.has("no-cache") {
+		return 0
+	}
+	if maxAge, ok := directives.seconds("max-age"); ok {
+		return maxAge
+	}
+	if expires := res.Header.Get("Expires"); expires != "" {
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			// Invalid dates, e.g. "0", mean the response has already expired
+			return 0
+		}
+		date := storedAt
+		if value, err := http.ParseTime(res.Header.Get("Date")); err == nil {
+			date = value
+		}
+		return max(0, expiresAt.Sub(date))
+	}
+	return ttl
+}
+
+// cacheControl are the directives of the Cache-Control header
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	directives := cacheControl{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, argument, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(argument), `"`)
+		}
+	}
+	return directives
+}
+
+func (c cacheControl) has(name string) bool {
+	_, ok := c[name]
+	return ok
+}
+
+func (c cacheControl) seconds(name string) (time.Duration, bool) {
+	value, ok := c[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// cacheInvalidations records when resources were changed through the client. A change to a resource invalidates
+// the cached responses of the resource and its sub resources (e.g. /inventory/managedObjects/1/childDevices), as well
+// as the collection it belongs to (e.g. /inventory/managedObjects)
+type cacheInvalidations struct {
+	mu sync.RWMutex
+
+	// subtree contains the resources whose responses, and the responses of their sub resources, are invalidated
+	subtree map[string]time.Time
+
+	// exact contains the collections whose responses are invalidated
+	exact map[string]time.Time
+
+	// before invalidates all responses cached before this time. It is set when too many resources have been invalidated
+	before time.Time
+
+	// loaded contains the keys of the markers which have already been read from the store
+	loaded map[string]struct{}
+}
+
+const (
+	cacheInvalidationSubtree = "subtree"
+	cacheInvalidationExact   = "exact"
+)
+
+// cacheInvalidationKey returns the key of the marker stored when a resource is changed
+func cacheInvalidationKey(namespace string, kind string, resource string) string {
+	return fmt.Sprintf("%s/%x", namespace, sha256.Sum256([]byte("invalidated:"+kind+":"+resource)))
+}
+
+func newCacheInvalidations() *cacheInvalidations {
+	return &cacheInvalidations{
+		subtree: make(map[string]time.Time),
+		exact:   make(map[string]time.Time),
+		loaded:  make(map[string]struct{}),
+	}
+}
+
+// load reads the marker of the resource from the store. Each marker is only read once
+func (c *cacheInvalidations) load(store CacheStore, namespace string, kind string, resource string) {
+	key := cacheInvalidationKey(namespace, kind, resource)
+	c.mu.RLock()
+	_, loaded := c.loaded[key]
+	c.mu.RUnlock()
+	if loaded {
+		return
+	}
+
+	marker, err := store.Get(key)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.loaded) >= maxCacheInvalidations {
+		clear(c.loaded)
+	}
+	c.loaded[key] = struct{}{}
+	if err != nil {
+		return
+	}
+	invalidated := c.subtree
+	if kind == cacheInvalidationExact {
+		invalidated = c.exact
+	}
+	if marker.StoredAt.After(invalidated[resource]) {
+		invalidated[resource] = marker.StoredAt
+	}
+}
+
+func (c *cacheInvalidations) invalidate(resource string, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.subtree)+len(c.exact) >= maxCacheInvalidations {
+		c.before = at
+		clear(c.subtree)
+		clear(c.exact)
+		return
+	}
+	c.subtree[resource] = at
+	if parent, _, found := cutLast(resource, "/"); found {
+		c.exact[parent] = at
+	}
+}
+
+// isInvalidated returns true if the resource (or a parent resource) has been changed after the response was cached
+func (c *cacheInvalidations) isInvalidated(resource string, storedAt time.Time) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if storedAt.Before(c.before) {
+		return true
+	}
+	if at, ok := c.exact[resource]; ok && storedAt.Before(at) {
+		return true
+	}
+	for current, found := resource, true; found; current, _, found = cutLast(current, "/") {
+		if at, ok := c.subtree[current]; ok && storedAt.Before(at) {
+			return true
+		}
+	}
+	return false
+}
+
+// cutLast slices s around the last instance of sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
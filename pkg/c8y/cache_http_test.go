@@ -0,0 +1,292 @@
+package c8y
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cacheTestServer counts the requests for each path, and returns the number of requests in the body
+type cacheTestServer struct {
+	mu       sync.Mutex
+	requests map[string]int
+	headers  []http.Header
+}
+
+func newCacheTestServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, *cacheTestServer) {
+	t.Helper()
+	state := &cacheTestServer{requests: map[string]int{}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state.mu.Lock()
+		state.requests[r.Method+" "+r.URL.Path]++
+		count := state.requests[r.Method+" "+r.URL.Path]
+		state.headers = append(state.headers, r.Header.Clone())
+		state.mu.Unlock()
+		if handler != nil {
+			handler(w, r)
+		}
+		if w.Header().Get("X-Status") == "" {
+			fmt.Fprintf(w, `{"path":%q,"count":%d}`, r.URL.Path, count)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, state
+}
+
+func (s *cacheTestServer) count(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[key]
+}
+
+func (s *cacheTestServer) lastHeader() http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.headers[len(s.headers)-1]
+}
+
+func cacheTestRequest(t *testing.T, client *http.Client, method, url string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	return res, string(body)
+}
+
+func newTestCachedClient(ttl time.Duration, options CacheOptions) *http.Client {
+	if options.Store == nil {
+		options.Store = NewMemoryCacheStore(MemoryCacheOptions{})
+	}
+	return NewCachedClient(&http.Client{Transport: http.DefaultTransport}, "", ttl, nil, options)
+}
+
+func TestCacheResponse_WriteInvalidation(t *testing.T) {
+	srv, state := newCacheTestServer(t, nil)
+	client := newTestCachedClient(time.Minute, CacheOptions{})
+
+	get := func(path string) {
+		cacheTestRequest(t, client, http.MethodGet, srv.URL+path)
+	}
+	get("/inventory/managedObjects/1")
+	get("/inventory/managedObjects/1/childDevices")
+	get("/inventory/managedObjects")
+	get("/inventory/managedObjects/2")
+	get("/inventory/managedObjects/1")
+	if got := state.count("GET /inventory/managedObjects/1"); got != 1 {
+		t.Fatalf("requests before update: got %d, want 1", got)
+	}
+
+	cacheTestRequest(t, client, http.MethodPut, srv.URL+"/inventory/managedObjects/1")
+
+	for _, path := range []string{"/inventory/managedObjects/1", "/inventory/managedObjects/1/childDevices", "/inventory/managedObjects", "/inventory/managedObjects/2"} {
+		get(path)
+		get(path)
+	}
+
+	tests := map[string]int{
+		// the resource, its sub resources and its collection are requested again
+		"GET /inventory/managedObjects/1":              2,
+		"GET /inventory/managedObjects/1/childDevices": 2,
+		"GET /inventory/managedObjects":                2,
+		// other resources are not affected
+		"GET /inventory/managedObjects/2": 1,
+	}
+	for key, want := range tests {
+		if got := state.count(key); got != want {
+			t.Errorf("%s: got %d requests, want %d", key, got, want)
+		}
+	}
+
+	// Invalidation can be disabled
+	srv, state = newCacheTestServer(t, nil)
+	client = newTestCachedClient(time.Minute, CacheOptions{DisableWriteInvalidation: true})
+	get("/inventory/managedObjects/1")
+	cacheTestRequest(t, client, http.MethodDelete, srv.URL+"/inventory/managedObjects/1")
+	get("/inventory/managedObjects/1")
+	if got := state.count("GET /inventory/managedObjects/1"); got != 1 {
+		t.Errorf("disabled invalidation: got %d requests, want 1", got)
+	}
+}
+
+func TestCacheResponse_CacheableWriteInvalidation(t *testing.T) {
+	srv, state := newCacheTestServer(t, nil)
+	client := NewCachedClient(&http.Client{Transport: http.DefaultTransport}, "", time.Minute, func(r *http.Request) bool {
+		return r.Method == http.MethodGet || strings.HasPrefix(r.URL.Path, "/service/")
+	}, CacheOptions{Store: NewMemoryCacheStore(MemoryCacheOptions{})})
+
+	cacheTestRequest(t, client, http.MethodGet, srv.URL+"/service/example/items/1")
+	cacheTestRequest(t, client, http.MethodPost, srv.URL+"/service/example/items/1")
+	cacheTestRequest(t, client, http.MethodGet, srv.URL+"/service/example/items/1")
+	if got := state.count("GET /service/example/items/1"); got != 2 {
+		t.Errorf("requests: got %d, want 2", got)
+	}
+}
+
+func TestCacheResponse_PersistentWriteInvalidation(t *testing.T) {
+	srv, state := newCacheTestServer(t, nil)
+	store := NewFileCacheStore(FileCacheOptions{Dir: t.TempDir()})
+	newClient := func() *http.Client {
+		return newTestCachedClient(time.Minute, CacheOptions{Store: store})
+	}
+
+	cacheTestRequest(t, newClient(), http.MethodGet, srv.URL+"/inventory/managedObjects/1")
+	cacheTestRequest(t, newClient(), http.MethodGet, srv.URL+"/inventory/managedObjects/2")
+	time.Sleep(10 * time.Millisecond)
+
+	// Another client sharing the store changes the resource
+	cacheTestRequest(t, newClient(), http.MethodDelete, srv.URL+"/inventory/managedObjects/1")
+
+	client := newClient()
+	for i := 0; i < 2; i++ {
+		cacheTestRequest(t, client, http.MethodGet, srv.URL+"/inventory/managedObjects/1")
+		cacheTestRequest(t, client, http.MethodGet, srv.URL+"/inventory/managedObjects/2")
+	}
+	tests := map[string]int{
+		"GET /inventory/managedObjects/1": 2,
+		"GET /inventory/managedObjects/2": 1,
+	}
+	for key, want := range tests {
+		if got := state.count(key); got != want {
+			t.Errorf("%s: got %d requests, want %d", key, got, want)
+		}
+	}
+}
+
+func TestCacheResponse_Revalidation(t *testing.T) {
+	srv, state := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.Header().Set("X-Status", "304")
+			w.WriteHeader(http.StatusNotModified)
+		}
+	})
+	client := newTestCachedClient(time.Minute, CacheOptions{HTTPSemantics: true})
+
+	_, first := cacheTestRequest(t, client, http.MethodGet, srv.URL+"/inventory/managedObjects/1")
+	res, second := cacheTestRequest(t, client, http.MethodGet, srv.URL+"/inventory/managedObjects/1")
+
+	if got := state.lastHeader().Get("If-None-Match"); got != `"v1"` {
+		t.Errorf("If-None-Match: got %q, want %q", got, `"v1"`)
+	}
+	if res.StatusCode != http.StatusOK || second != first {
+		t.Errorf("revalidated response: got %d %s, want the cached response %s", res.StatusCode, second, first)
+	}
+	if got := state.count("GET /inventory/managedObjects/1"); got != 2 {
+		t.Errorf("requests: got %d, want 2", got)
+	}
+}
+
+func TestCacheResponse_CacheControl(t *testing.T) {
+	srv, state := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/max-age":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/expired":
+			w.Header().Set("Expires", "0")
+		}
+	})
+	// responses without cache headers are not cached as the ttl is 0
+	client := newTestCachedClient(0, CacheOptions{HTTPSemantics: true})
+
+	for _, path := range []string{"/max-age", "/no-store", "/expired", "/default"} {
+		cacheTestRequest(t, client, http.MethodGet, srv.URL+path)
+		cacheTestRequest(t, client, http.MethodGet, srv.URL+path)
+	}
+	tests := map[string]int{
+		"GET /max-age":  1,
+		"GET /no-store": 2,
+		"GET /expired":  2,
+		"GET /default":  2,
+	}
+	for key, want := range tests {
+		if got := state.count(key); got != want {
+			t.Errorf("%s: got %d requests, want %d", key, got, want)
+		}
+	}
+
+	// The request can ask for a fresh response
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/max-age", nil)
+	req.Header.Set("Cache-Control", "no-cache")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got := state.count("GET /max-age"); got != 2 {
+		t.Errorf("request no-cache: got %d requests, want 2", got)
+	}
+}
+
+func TestCacheResponse_StaleWhileRevalidate(t *testing.T) {
+	srv, state := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=0")
+	})
+	client := newTestCachedClient(0, CacheOptions{
+		HTTPSemantics:        true,
+		StaleWhileRevalidate: true,
+		MaxStale:             time.Minute,
+	})
+
+	_, first := cacheTestRequest(t, client, http.MethodGet, srv.URL+"/inventory/managedObjects/1")
+	_, second := cacheTestRequest(t, client, http.MethodGet, srv.URL+"/inventory/managedObjects/1")
+	if second != first {
+		t.Errorf("stale response: got %s, want %s", second, first)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for state.count("GET /inventory/managedObjects/1") != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the background revalidation")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the revalidated response is used next
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		_, body := cacheTestRequest(t, client, http.MethodGet, srv.URL+"/inventory/managedObjects/1")
+		if body != first {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the revalidated response")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFreshnessLifetime(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	tests := map[string]struct {
+		header http.Header
+		want   time.Duration
+	}{
+		"default":         {http.Header{}, time.Minute},
+		"max-age":         {http.Header{"Cache-Control": {"max-age=10"}}, 10 * time.Second},
+		"no-cache":        {http.Header{"Cache-Control": {"no-cache, max-age=10"}}, 0},
+		"max-age precede": {http.Header{"Cache-Control": {"max-age=10"}, "Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, 10 * time.Second},
+		"expires":         {http.Header{"Date": {now.Format(http.TimeFormat)}, "Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, time.Hour},
+		"invalid expires": {http.Header{"Expires": {"0"}}, 0},
+	}
+	for name, test := range tests {
+		got := freshnessLifetime(&http.Response{Header: test.header}, now, time.Minute)
+		if got != test.want {
+			t.Errorf("%s: got %s, want %s", name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package c8y
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// kvCacheBucket is the bucket where the entries are stored
+var kvCacheBucket = []byte("responses")
+
+// kvTimestampSize is the size of the timestamp prefix of each value
+const kvTimestampSize = 8
+
+// KVCacheOptions are the settings of the key-value cache store
+type KVCacheOptions struct {
+	// TTL is the maximum age of an entry. Entries don't expire if it is 0
+	TTL time.Duration
+
+	// Timeout when waiting to open the database, as only one process can open it at a time. Defaults to 1 second
+	Timeout time.Duration
+}
+
+// KVCacheStore stores the responses in an embedded key-value database (bbolt). All entries are stored
+// in a single file, which avoids creating many small files when caching lots of responses
+type KVCacheStore struct {
+	db  *bolt.DB
+	ttl time.Duration
+
+	counters cacheCounters
+}
+
+// NewKVCacheStore opens (or creates) the database at the given path. The store must be closed
+// when it is no longer needed
+func NewKVCacheStore(path string, options KVCacheOptions) (*KVCacheStore, error) {
+	if options.Timeout <= 0 {
+		options.Timeout = time.Second
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: options.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(kvCacheBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &KVCacheStore{
+		db:  db,
+		ttl: options.TTL,
+	}, nil
+}
+
+// Close closes the database
+func (s *KVCacheStore) Close() error {
+	return s.db.Close()
+}
+
+func encodeKVEntry(entry *CacheEntry) []byte {
+	value := make([]byte, kvTimestampSize+len(entry.Data))
+	binary.BigEndian.PutUint64(value, uint64(entry.StoredAt.UnixNano()))
+	copy(value[kvTimestampSize:], entry.Data)
+	return value
+}
+
+func decodeKVEntry(value []byte) (*CacheEntry, error) {
+	if len(value) < kvTimestampSize {
+		return nil, errors.New("invalid cache entry")
+	}
+	return &CacheEntry{
+		StoredAt: time.Unix(0, int64(binary.BigEndian.Uint64(value))),
+		// The value is only valid during the transaction, so it needs to be copied
+		Data: append([]byte(nil), value[kvTimestampSize:]...),
+	}, nil
+}
+
+// Get returns the entry
+func (s *KVCacheStore) Get(key string) (*CacheEntry, error) {
+	var entry *CacheEntry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(kvCacheBucket).Get([]byte(key))
+		if value == nil {
+			return ErrCacheMiss
+		}
+		var err error
+		entry, err = decodeKVEntry(value)
+		return err
+	})
+	if err == nil && isExpired(entry.StoredAt, s.ttl) {
+		err = ErrCacheMiss
+	}
+	if err != nil {
+		s.counters.misses.Add(1)
+		return nil, err
+	}
+	s.counters.hits.Add(1)
+	return entry, nil
+}
+
+// Set adds or replaces the entry
+func (s *KVCacheStore) Set(key string, entry *CacheEntry) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(kvCacheBucket).Put([]byte(key), encodeKVEntry(entry))
+	})
+}
+
+// Delete removes the entry
+func (s *KVCacheStore) Delete(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(kvCacheBucket).Delete([]byte(key))
+	})
+}
+
+// Prune removes the expired entries. The database file does not shrink, however the space is reused
+func (s *KVCacheStore) Prune() (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(kvCacheBucket).Cursor()
+		for key, value := cursor.First(); key != nil; {
+			entry, err := decodeKVEntry(value)
+			if err != nil || isExpired(entry.StoredAt, s.ttl) {
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+				removed++
+				// The cursor moves to the next item after a delete
+				key, value = cursor.Seek(key)
+				continue
+			}
+			key, value = cursor.Next()
+		}
+		return nil
+	})
+	s.counters.evictions.Add(int64(removed))
+	return removed, err
+}
+
+// Purge removes the entries in the namespaces starting with the prefix
+func (s *KVCacheStore) Purge(prefix string) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(kvCacheBucket).Cursor()
+		// Keys are sorted, so all of the matching keys follow the prefix
+		for key, _ := cursor.Seek([]byte(prefix)); key != nil && bytes.HasPrefix(key, []byte(prefix)); {
+			if !inNamespace(string(key), prefix) {
+				key, _ = cursor.Next()
+				continue
+			}
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+			removed++
+			key, _ = cursor.Seek(key)
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// Stats returns the usage statistics
+func (s *KVCacheStore) Stats() CacheStats {
+	var entries, size int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(kvCacheBucket).ForEach(func(key, value []byte) error {
+			entries++
+			size += int64(len(value) - kvTimestampSize)
+			return nil
+		})
+	})
+	if err != nil {
+		Logger.Warnf("Could not read cache statistics. %s", err)
+	}
+	return s.counters.stats(entries, size)
+}
@@ -0,0 +1,241 @@
+package c8y
+
+import (
+	"container/list"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrCacheMiss is returned by a cache store when an entry does not exist or has expired
+var ErrCacheMiss = errors.New("cache miss")
+
+// CacheEntry is a cached HTTP response
+type CacheEntry struct {
+	// Data is the serialized HTTP response
+	Data []byte
+
+	// StoredAt is the time the response was cached
+	StoredAt time.Time
+}
+
+// CacheStore stores the cached responses. Implementations must be safe for concurrent use
+type CacheStore interface {
+	// Get returns the entry, or ErrCacheMiss if it does not exist or has expired
+	Get(key string) (*CacheEntry, error)
+
+	// Set adds or replaces the entry. Entries can be evicted to stay within the store's limits
+	Set(key string, entry *CacheEntry) error
+
+	// Delete removes the entry. It does not return an error if the entry does not exist
+	Delete(key string) error
+
+	// Prune removes the expired entries (and any entries exceeding the store's limits), and returns the
+	// number of entries removed
+	Prune() (int, error)
+
+	// Purge removes all entries in the namespaces starting with the prefix, and returns the number of entries
+	// removed. The namespace is the part of the key before the first "/", e.g. "namespace/name"
+	Purge(prefix string) (int, error)
+
+	// Stats returns the usage statistics of the store
+	Stats() CacheStats
+}
+
+// CacheStats are the usage statistics of a cache store
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+
+	// Evictions is the number of entries removed because they expired or the store was full
+	Evictions int64
+
+	// Entries is the current number of entries
+	Entries int64
+
+	// Size is the current total size of the entries in bytes
+	Size int64
+}
+
+// HitRatio returns the ratio of hits to lookups, or 0 if there have not been any lookups
+func (s CacheStats) HitRatio() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+// cacheCounters counts the cache lookups and evictions
+type cacheCounters struct {
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+func (c *cacheCounters) stats(entries, size int64) CacheStats {
+	return CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Entries:   entries,
+		Size:      size,
+	}
+}
+
+// inNamespace returns true if the key belongs to a namespace starting with the prefix
+func inNamespace(key string, prefix string) bool {
+	namespace, _, found := strings.Cut(key, "/")
+	return found && strings.HasPrefix(namespace, prefix)
+}
+
+// isExpired returns true if the entry is older than the ttl. Entries don't expire if the ttl is 0
+func isExpired(storedAt time.Time, ttl time.Duration) bool {
+	return ttl > 0 && time.Since(storedAt) > ttl
+}
+
+// MemoryCacheOptions are the limits of the in-memory cache store
+type MemoryCacheOptions struct {
+	// TTL is the maximum age of an entry. Entries don't expire if it is 0
+	TTL time.Duration
+
+	// MaxEntries is the maximum number of entries. 0 means no limit
+	MaxEntries int
+
+	// MaxSize is the maximum total size of the entries in bytes. 0 means no limit
+	MaxSize int64
+}
+
+// MemoryCacheStore stores the responses in memory. The least recently used entries are evicted once
+// one of the limits is reached
+type MemoryCacheStore struct {
+	options MemoryCacheOptions
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	order *list.List
+	size  int64
+
+	counters cacheCounters
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewMemoryCacheStore creates an in-memory LRU cache store
+func NewMemoryCacheStore(options MemoryCacheOptions) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		options: options,
+		items:   make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Get returns the entry and marks it as recently used
+func (s *MemoryCacheStore) Get(key string) (*CacheEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.items[key]
+	if !ok {
+		s.counters.misses.Add(1)
+		return nil, ErrCacheMiss
+	}
+	item := element.Value.(*memoryCacheItem)
+	if isExpired(item.entry.StoredAt, s.options.TTL) {
+		s.removeElement(element)
+		s.counters.evictions.Add(1)
+		s.counters.misses.Add(1)
+		return nil, ErrCacheMiss
+	}
+	s.order.MoveToFront(element)
+	s.counters.hits.Add(1)
+	return item.entry, nil
+}
+
+// Set adds the entry, and evicts the least recently used entries if the store is full.
+// Entries larger than MaxSize are not stored
+func (s *MemoryCacheStore) Set(key string, entry *CacheEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.items[key]; ok {
+		s.removeElement(element)
+	}
+	if s.options.MaxSize > 0 && int64(len(entry.Data)) > s.options.MaxSize {
+		return nil
+	}
+
+	s.items[key] = s.order.PushFront(&memoryCacheItem{key: key, entry: entry})
+	s.size += int64(len(entry.Data))
+
+	for s.isFull() {
+		s.removeElement(s.order.Back())
+		s.counters.evictions.Add(1)
+	}
+	return nil
+}
+
+func (s *MemoryCacheStore) isFull() bool {
+	return (s.options.MaxEntries > 0 && s.order.Len() > s.options.MaxEntries) ||
+		(s.options.MaxSize > 0 && s.size > s.options.MaxSize)
+}
+
+// Delete removes the entry
+func (s *MemoryCacheStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.items[key]; ok {
+		s.removeElement(element)
+	}
+	return nil
+}
+
+// Prune removes the expired entries
+func (s *MemoryCacheStore) Prune() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for element := s.order.Back(); element != nil; {
+		previous := element.Prev()
+		if isExpired(element.Value.(*memoryCacheItem).entry.StoredAt, s.options.TTL) {
+			s.removeElement(element)
+			removed++
+		}
+		element = previous
+	}
+	s.counters.evictions.Add(int64(removed))
+	return removed, nil
+}
+
+// Purge removes the entries in the namespaces starting with the prefix
+func (s *MemoryCacheStore) Purge(prefix string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for key, element := range s.items {
+		if inNamespace(key, prefix) {
+			s.removeElement(element)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Stats returns the usage statistics
+func (s *MemoryCacheStore) Stats() CacheStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counters.stats(int64(s.order.Len()), s.size)
+}
+
+func (s *MemoryCacheStore) removeElement(element *list.Element) {
+	item := s.order.Remove(element).(*memoryCacheItem)
+	delete(s.items, item.key)
+	s.size -= int64(len(item.entry.Data))
+}
@@ -0,0 +1,320 @@
+package c8y
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newCacheEntry(size int, storedAt time.Time) *CacheEntry {
+	return &CacheEntry{
+		Data:     bytes.Repeat([]byte("x"), size),
+		StoredAt: storedAt,
+	}
+}
+
+// testCacheStore checks the behaviour which is common to all stores
+func testCacheStore(t *testing.T, store CacheStore) {
+	t.Helper()
+	if _, err := store.Get("missing"); err != ErrCacheMiss {
+		t.Errorf("get missing: got %v, want %v", err, ErrCacheMiss)
+	}
+
+	entry := newCacheEntry(10, time.Now().Truncate(time.Second))
+	if err := store.Set("abcdef1234", entry); err != nil {
+		t.Fatalf("set: unexpected error: %v", err)
+	}
+	got, err := store.Get("abcdef1234")
+	if err != nil {
+		t.Fatalf("get: unexpected error: %v", err)
+	}
+	if !bytes.Equal(got.Data, entry.Data) || !got.StoredAt.Equal(entry.StoredAt) {
+		t.Errorf("get: got %+v, want %+v", got, entry)
+	}
+
+	// Expired entries are not returned and are removed when pruning
+	if err := store.Set("expired123", newCacheEntry(5, time.Now().Add(-2*time.Hour))); err != nil {
+		t.Fatalf("set: unexpected error: %v", err)
+	}
+	removed, err := store.Prune()
+	if err != nil || removed != 1 {
+		t.Errorf("prune: got %d (err=%v), want 1", removed, err)
+	}
+	if _, err := store.Get("expired123"); err != ErrCacheMiss {
+		t.Errorf("get expired: got %v, want %v", err, ErrCacheMiss)
+	}
+
+	if err := store.Delete("abcdef1234"); err != nil {
+		t.Errorf("delete: unexpected error: %v", err)
+	}
+	if err := store.Delete("abcdef1234"); err != nil {
+		t.Errorf("delete missing: unexpected error: %v", err)
+	}
+
+	stats := store.Stats()
+	if stats.Hits != 1 || stats.Misses != 2 || stats.Evictions < 1 || stats.Entries != 0 || stats.Size != 0 {
+		t.Errorf("stats: got %+v", stats)
+	}
+
+	// Entries can be purged by namespace prefix
+	for _, key := range []string{"aaaa1111/abcdef1", "aaaa2222/abcdef2", "bbbb1111/abcdef3", "abcdef4"} {
+		if err := store.Set(key, newCacheEntry(5, time.Now())); err != nil {
+			t.Fatalf("set %s: unexpected error: %v", key, err)
+		}
+	}
+	if removed, err := store.Purge("aaaa1111"); err != nil || removed != 1 {
+		t.Errorf("purge namespace: got %d (err=%v), want 1", removed, err)
+	}
+	if removed, err := store.Purge("aaaa"); err != nil || removed != 1 {
+		t.Errorf("purge prefix: got %d (err=%v), want 1", removed, err)
+	}
+	for key, want := range map[string]error{"aaaa1111/abcdef1": ErrCacheMiss, "aaaa2222/abcdef2": ErrCacheMiss, "bbbb1111/abcdef3": nil, "abcdef4": nil} {
+		if _, err := store.Get(key); err != want {
+			t.Errorf("get %s after purge: got %v, want %v", key, err, want)
+		}
+	}
+	if stats := store.Stats(); stats.Entries != 2 || stats.Size != 10 {
+		t.Errorf("stats after purge: got %+v", stats)
+	}
+}
+
+func TestMemoryCacheStore(t *testing.T) {
+	testCacheStore(t, NewMemoryCacheStore(MemoryCacheOptions{TTL: time.Hour}))
+}
+
+func TestFileCacheStore(t *testing.T) {
+	testCacheStore(t, NewFileCacheStore(FileCacheOptions{Dir: t.TempDir(), TTL: time.Hour}))
+}
+
+func TestKVCacheStore(t *testing.T) {
+	store, err := NewKVCacheStore(filepath.Join(t.TempDir(), "cache.db"), KVCacheOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer store.Close()
+	testCacheStore(t, store)
+}
+
+func TestMemoryCacheStore_LRU(t *testing.T) {
+	store := NewMemoryCacheStore(MemoryCacheOptions{MaxEntries: 2, MaxSize: 25})
+	now := time.Now()
+	store.Set("a", newCacheEntry(10, now))
+	store.Set("b", newCacheEntry(10, now))
+
+	// a is now the most recently used, so b is evicted
+	if _, err := store.Get("a"); err != nil {
+		t.Fatalf("get a: unexpected error: %v", err)
+	}
+	store.Set("c", newCacheEntry(10, now))
+	if _, err := store.Get("b"); err != ErrCacheMiss {
+		t.Errorf("get b: got %v, want %v", err, ErrCacheMiss)
+	}
+
+	// the size limit evicts a and c
+	store.Set("d", newCacheEntry(20, now))
+	stats := store.Stats()
+	if stats.Entries != 1 || stats.Size != 20 || stats.Evictions != 3 {
+		t.Errorf("stats: got %+v", stats)
+	}
+
+	// entries larger than the limit are not stored
+	store.Set("e", newCacheEntry(30, now))
+	if _, err := store.Get("e"); err != ErrCacheMiss {
+		t.Errorf("get e: got %v, want %v", err, ErrCacheMiss)
+	}
+}
+
+func TestFileCacheStore_MaxSize(t *testing.T) {
+	dir := t.TempDir()
+
+	// leave an entry from a previous run
+	previous := NewFileCacheStore(FileCacheOptions{Dir: dir})
+	previous.Set("000000old", newCacheEntry(10, time.Now().Add(-time.Minute)))
+
+	store := NewFileCacheStore(FileCacheOptions{Dir: dir, MaxSize: 25})
+	store.Set("111111new", newCacheEntry(10, time.Now().Add(-time.Second)))
+	if stats := store.Stats(); stats.Entries != 2 || stats.Size != 20 {
+		t.Errorf("stats: got %+v, want 2 entries", stats)
+	}
+
+	// the oldest entry is evicted
+	store.Set("222222newest", newCacheEntry(10, time.Now()))
+	if _, err := store.Get("000000old"); err != ErrCacheMiss {
+		t.Errorf("get old: got %v, want %v", err, ErrCacheMiss)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00")); !os.IsNotExist(err) {
+		t.Errorf("empty directories should be removed. err=%v", err)
+	}
+	stats := store.Stats()
+	if stats.Entries != 2 || stats.Size != 20 || stats.Evictions != 1 {
+		t.Errorf("stats: got %+v", stats)
+	}
+}
+
+func TestCacheResponse_Store(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count := atomic.AddInt32(&requests, 1)
+		fmt.Fprintf(w, `{"count":%d}`, count)
+	}))
+	defer srv.Close()
+
+	store := NewMemoryCacheStore(MemoryCacheOptions{TTL: time.Minute})
+	client := NewCachedClient(&http.Client{Transport: http.DefaultTransport}, "", 0, nil, CacheOptions{Store: store})
+
+	for i := 0; i < 3; i++ {
+		res, err := client.Get(srv.URL + "/inventory/managedObjects/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != `{"count":1}` {
+			t.Errorf("request %d: got %s, want the cached response", i, body)
+		}
+		if i > 0 && res.Header.Get("ETag") == "" {
+			t.Errorf("request %d: ETag should be set on cached responses", i)
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("requests: got %d, want 1", got)
+	}
+	if stats := store.Stats(); stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 || stats.HitRatio() < 0.6 {
+		t.Errorf("stats: got %+v", stats)
+	}
+}
+
+func TestCacheResponse_ZeroTTL(t *testing.T) {
+	srv, state := newCacheTestServer(t, nil)
+	client := NewCachedClient(&http.Client{Transport: http.DefaultTransport}, t.TempDir(), 0, nil, CacheOptions{})
+
+	for i := 0; i < 2; i++ {
+		if _, body := cacheTestRequest(t, client, http.MethodGet, srv.URL+"/inventory/managedObjects/1"); body != fmt.Sprintf(`{"path":"/inventory/managedObjects/1","count":%d}`, i+1) {
+			t.Errorf("request %d: got %s, want a response from the server", i, body)
+		}
+	}
+	if got := state.count("GET /inventory/managedObjects/1"); got != 2 {
+		t.Errorf("requests: got %d, want 2", got)
+	}
+}
+
+func TestFileCacheStore_Permissions(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	store := NewFileCacheStore(FileCacheOptions{Dir: dir})
+	if err := store.Set("ns/abcdef1234", newCacheEntry(10, time.Now())); err != nil {
+		t.Fatalf("set: unexpected error: %v", err)
+	}
+
+	tests := map[string]os.FileMode{
+		dir: 0700,
+		filepath.Dir(store.filePath("ns/abcdef1234")): 0700,
+		store.filePath("ns/abcdef1234"):               0600,
+	}
+	for path, want := range tests {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat %s: unexpected error: %v", path, err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s: got %o, want %o", path, got, want)
+		}
+	}
+}
+
+func TestEncryptedCacheStore(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte("k"), 32)
+	store, err := NewEncryptedCacheStore(NewFileCacheStore(FileCacheOptions{Dir: dir}), key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entry := &CacheEntry{Data: []byte("HTTP/1.1 200 OK\r\n\r\nsecret-value"), StoredAt: time.Now().Truncate(time.Second)}
+	if err := store.Set("ns/abcdef1234", entry); err != nil {
+		t.Fatalf("set: unexpected error: %v", err)
+	}
+	got, err := store.Get("ns/abcdef1234")
+	if err != nil || !bytes.Equal(got.Data, entry.Data) {
+		t.Fatalf("get: got %v (err=%v), want %s", got, err, entry.Data)
+	}
+
+	// The entry is not stored in plain text
+	contents, err := os.ReadFile(store.CacheStore.(*FileCacheStore).filePath("ns/abcdef1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(contents, []byte("secret-value")) {
+		t.Errorf("the cache file contains the plain text response")
+	}
+
+	// The entry can't be read using a different key, or under a different cache key
+	raw, _ := store.CacheStore.Get("ns/abcdef1234")
+	store.CacheStore.Set("ns/moved1234", raw)
+	if _, err := store.Get("ns/moved1234"); err != ErrCacheMiss {
+		t.Errorf("get moved entry: got %v, want %v", err, ErrCacheMiss)
+	}
+	other, _ := NewEncryptedCacheStore(NewFileCacheStore(FileCacheOptions{Dir: dir}), bytes.Repeat([]byte("o"), 32))
+	if _, err := other.Get("ns/abcdef1234"); err != ErrCacheMiss {
+		t.Errorf("get with other key: got %v, want %v", err, ErrCacheMiss)
+	}
+
+	if _, err := NewEncryptedCacheStore(store, nil); err == nil {
+		t.Errorf("empty key: expected an error")
+	}
+}
+
+func TestPurgeCache(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}))
+	defer srv.Close()
+
+	store := NewMemoryCacheStore(MemoryCacheOptions{})
+	client := NewCachedClient(&http.Client{Transport: http.DefaultTransport}, "", time.Minute, nil, CacheOptions{
+		Store:         store,
+		EncryptionKey: []byte("secret"),
+	})
+	for _, user := range []string{"t100/user", "t100/other", "t200/user"} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/inventory/managedObjects/1", nil)
+		req.SetBasicAuth(user, "password")
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+	}
+
+	// Cookie based session where the tenant is only known by the client
+	req, _ := http.NewRequestWithContext(withClientTenant(context.Background(), "t300"), http.MethodGet, srv.URL+"/inventory/managedObjects/1", nil)
+	req.AddCookie(&http.Cookie{Name: "authorization", Value: "token"})
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if removed, err := PurgeCache(store, srv.URL, "t300"); err != nil || removed != 1 {
+		t.Errorf("purge tenant of client: got %d (err=%v), want 1", removed, err)
+	}
+
+	if removed, err := PurgeCache(store, srv.URL, "t100"); err != nil || removed != 2 {
+		t.Errorf("purge tenant: got %d (err=%v), want 2", removed, err)
+	}
+	if removed, err := PurgeCache(store, "other.example.com", ""); err != nil || removed != 0 {
+		t.Errorf("purge other host: got %d (err=%v), want 0", removed, err)
+	}
+	if removed, err := PurgeCache(store, strings.TrimPrefix(srv.URL, "http://"), ""); err != nil || removed != 1 {
+		t.Errorf("purge host: got %d (err=%v), want 1", removed, err)
+	}
+}
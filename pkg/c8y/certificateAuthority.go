@@ -22,13 +22,14 @@ const ResourceCertificateAuthority = "certificate-authority"
 func (s *CertificateAuthorityService) Create(ctx context.Context, opts CertificateAuthorityOptions) (*Certificate, error) {
 	cert := new(Certificate)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "CertificateAuthority.Create",
 		Method:       http.MethodPost,
 		Path:         ResourceCertificateAuthority,
 		ResponseData: cert,
 	})
 	if err != nil {
 		// Don't treat a conflict as an error
-		if resp != nil && resp.StatusCode() == http.StatusConflict {
+		if errors.Is(err, ErrConflict) {
 			// Get existing certificate
 			existingCert, err := s.Get(WithDisabledDryRunContext(ctx))
 			if err != nil {
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -20,16 +21,16 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/go-querystring/query"
 	"github.com/reubenmiller/go-c8y/pkg/jsonUtilities"
 	"github.com/reubenmiller/go-c8y/pkg/logger"
+	"github.com/reubenmiller/go-c8y/pkg/telemetry"
 )
 
-var ErrNotFound = errors.New("item: not found")
-
 var MethodsWithBody = []string{
 	http.MethodDelete,
 	http.MethodPatch,
@@ -166,6 +167,18 @@ type Client struct {
 
 	requestOptions DefaultRequestOptions
 
+	// Default retry options. nil disables retries
+	retryOptions *RetryOptions
+
+	// Tracing and metrics. nil disables instrumentation
+	instrumentation *telemetry.Instrumentation
+
+	// OAI-Secure session which keeps the token refreshed. nil disables session management
+	session *Session
+
+	// Provider of the credentials used for each request. nil uses the Username, Password and Token fields
+	credentialsProvider CredentialsProvider
+
 	// Microservice bootstrap and service users
 	BootstrapUser ServiceUser
 	ServiceUsers  []ServiceUser
@@ -320,7 +333,9 @@ func (c *Client) NewRealtimeClientFromServiceUser(tenant string) *RealtimeClient
 	}
 	for _, user := range c.ServiceUsers {
 		if tenant == user.Tenant || tenant == "" {
-			return NewRealtimeClient(c.BaseURL.String(), nil, user.Tenant, user.Username, user.Password)
+			realtimeClient := NewRealtimeClient(c.BaseURL.String(), nil, user.Tenant, user.Username, user.Password)
+			realtimeClient.SetInstrumentation(c.getInstrumentation())
+			return realtimeClient
 		}
 	}
 	return nil
@@ -464,6 +479,15 @@ type ClientOptions struct {
 
 	// Show sensitive information in the logs
 	ShowSensitive bool
+
+	// Retry policy used for all requests. Retries are disabled if nil
+	Retry *RetryOptions
+
+	// Tracing and metrics for the REST and realtime clients. Instrumentation is disabled if nil
+	Instrumentation *telemetry.Instrumentation
+
+	// Provider of the credentials used for each request. Takes precedence over the Username, Password and Token
+	Credentials CredentialsProvider
 }
 
 // NewClient returns a new Cumulocity API client. If a nil httpClient is
@@ -497,6 +521,7 @@ func NewClientFromOptions(httpClient *http.Client, opts ClientOptions) *Client {
 	var realtimeClient *RealtimeClient
 	if opts.Realtime {
 		realtimeClient = NewRealtimeClient(fmtURL, nil, opts.Tenant, opts.Username, opts.Password)
+		realtimeClient.SetInstrumentation(opts.Instrumentation)
 	}
 
 	authType := opts.AuthType
@@ -522,6 +547,9 @@ func NewClientFromOptions(httpClient *http.Client, opts ClientOptions) *Client {
 		UseTenantInUsername: true,
 		AuthorizationType:   authType,
 		showSensitive:       opts.ShowSensitive,
+		retryOptions:        opts.Retry,
+		instrumentation:     opts.Instrumentation,
+		credentialsProvider: opts.Credentials,
 	}
 	c.common.client = c
 	c.Alarm = (*AlarmService)(&c.common)
@@ -611,13 +639,21 @@ func (c *Client) Noop() {
 
 // Parse a JWT claims
 func (c *Client) ParseToken(tokenString string) (*CumulocityTokenClaim, error) {
+	return parseTokenClaims(tokenString)
+}
+
+// parseTokenClaims parses the claims of a JWT without verifying the signature
+func parseTokenClaims(tokenString string) (*CumulocityTokenClaim, error) {
 	parts := strings.Split(tokenString, ".")
 	if len(parts) != 3 {
 		return nil, fmt.Errorf("invalid token. expected 3 fields")
 	}
-	raw, err := base64.RawStdEncoding.DecodeString(parts[1])
+	// JWTs use url encoding, however also accept standard encoding for compatibility
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
 	if err != nil {
-		return nil, err
+		if raw, err = base64.RawStdEncoding.DecodeString(parts[1]); err != nil {
+			return nil, err
+		}
 	}
 
 	claim := &CumulocityTokenClaim{}
@@ -674,6 +710,14 @@ func (c *Client) GetTenantName(ctx context.Context) string {
 	return tenant.Name
 }
 
+// requestTenant returns the tenant used by a request without sending any additional requests
+func (c *Client) requestTenant(req *http.Request) string {
+	if tenant := TenantFromAuthorization(req.Header.Get("Authorization")); tenant != "" {
+		return tenant
+	}
+	return c.TenantName
+}
+
 // NewAuthorizationContextFromRequest returns a new context with the Authorization token set which will override the Basic Auth in subsequent
 // REST requests
 func NewAuthorizationContextFromRequest(req *http.Request) context.Context {
@@ -724,6 +768,10 @@ type RequestValidator func(*http.Request) error
 
 // RequestOptions struct which contains the options to be used with the SendRequest function
 type RequestOptions struct {
+	// Operation is the name of the service method sending the request, e.g. Inventory.GetManagedObject.
+	// It is used as the span name, unless the context already sets an operation (see telemetry.WithOperation)
+	Operation string
+
 	Method         string
 	Host           string
 	Path           string
@@ -741,6 +789,9 @@ type RequestOptions struct {
 	ValidateFuncs  []RequestValidator
 	PrepareRequest func(*http.Request) (*http.Request, error)
 
+	// Retry options for this request only (takes precedence over the client and context options)
+	Retry *RetryOptions
+
 	PrepareRequestOnDryRun bool
 }
 
@@ -841,18 +892,21 @@ func (c *Client) SendRequest(ctx context.Context, options RequestOptions) (*Resp
 		if err != nil {
 			return nil, err
 		}
+		req = req.WithContext(ctx)
+		// Close the form values once all attempts have been sent, or if the request is not sent (e.g. dry run)
+		defer req.Body.(*multipartBody).closeValues()
 		if options.AuthFunc != nil {
 			if _, err := options.AuthFunc(req); err != nil {
 				return nil, err
 			}
-		} else {
-			c.SetAuthorization(req)
+		} else if _, err := c.SetAuthorization(req); err != nil {
+			return nil, err
 		}
 		c.SetHostHeader(req)
 	} else {
 		if options.AuthFunc == nil {
 			// Use default auth
-			req, err = c.NewRequest(options.Method, currentPath, currentQuery, options.Body)
+			req, err = c.NewRequestWithContext(ctx, options.Method, currentPath, currentQuery, options.Body)
 		} else {
 			req, err = c.NewRequestWithoutAuth(options.Method, currentPath, currentQuery, options.Body)
 			if err != nil {
@@ -984,6 +1038,10 @@ func (c *Client) SendRequest(ctx context.Context, options RequestOptions) (*Resp
 			return nil, err
 		}
 	}
+	if options.Retry != nil {
+		ctx = WithRetryContext(ctx, options.Retry)
+	}
+	ctx = withOperation(ctx, options.Operation)
 	resp, err := c.Do(ctx, req, options.ResponseData)
 
 	c.SetJSONItems(resp, options.ResponseData)
@@ -1081,6 +1139,12 @@ func (c *Client) SetJSONItems(resp *Response, v interface{}) error {
 
 // NewRequest returns a request with the required additional base url, authentication header, accept and user-agent.NewRequest
 func (c *Client) NewRequest(method, path string, query string, body interface{}) (*http.Request, error) {
+	return c.NewRequestWithContext(context.Background(), method, path, query, body)
+}
+
+// NewRequestWithContext returns a request like NewRequest, but with the given context. The context is also passed
+// to the credentials provider when setting the authorization
+func (c *Client) NewRequestWithContext(ctx context.Context, method, path string, query string, body interface{}) (*http.Request, error) {
 	if !strings.HasSuffix(c.BaseURL.Path, "/") {
 		return nil, fmt.Errorf("BaseURL must have a trailing slash, but %q does not", c.BaseURL)
 	}
@@ -1113,7 +1177,7 @@ func (c *Client) NewRequest(method, path string, query string, body interface{})
 			buf = NewStringReader(jsonBuf.String())
 		}
 	}
-	req, err := http.NewRequest(method, u.String(), buf)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), buf)
 	if err != nil {
 		return nil, err
 	}
@@ -1123,7 +1187,9 @@ func (c *Client) NewRequest(method, path string, query string, body interface{})
 		}
 	}
 
-	c.SetAuthorization(req)
+	if _, err := c.SetAuthorization(req); err != nil {
+		return nil, err
+	}
 	req.Header.Set("User-Agent", c.UserAgent)
 	req.Header.Set("X-APPLICATION", "go-client")
 	c.SetHostHeader(req)
@@ -1212,6 +1278,14 @@ func (c *Client) SetAuthorization(req *http.Request, authTypeFunc ...RequestAuth
 		return authTypeFunc[0](req)
 	}
 
+	if provider := c.getCredentialsProvider(); provider != nil && c.AuthorizationType != AuthTypeNone {
+		credentials, err := provider.Retrieve(req.Context())
+		if err != nil {
+			return false, fmt.Errorf("failed to retrieve credentials. %w", err)
+		}
+		return credentials.Apply(req)
+	}
+
 	authType := c.AuthorizationType
 	if authType == AuthTypeUnset {
 		if c.Token != "" {
@@ -1319,12 +1393,17 @@ func (c *Client) ClearToken() {
 }
 
 func (c *Client) addCookiesToRequest(req *http.Request) {
-	if c.Cookies == nil {
+	setCookieHeaders(req, c.Cookies)
+}
+
+// setCookieHeaders adds the cookies to the request. The XSRF-TOKEN cookie is sent as the X-XSRF-TOKEN header
+func setCookieHeaders(req *http.Request, cookies []*http.Cookie) {
+	if cookies == nil {
 		return
 	}
 
 	cookieValues := make([]string, 0)
-	for _, cookie := range c.Cookies {
+	for _, cookie := range cookies {
 		if cookie.Name == "XSRF-TOKEN" {
 			req.Header.Set("X-"+cookie.Name, cookie.Value)
 		} else {
@@ -1503,6 +1582,18 @@ func withContext(ctx context.Context, req *http.Request) *http.Request {
 // The provided ctx must be non-nil. If it is canceled or times out,
 // ctx.Err() will be returned.
 func (c *Client) Do(ctx context.Context, req *http.Request, v interface{}, middleware ...RequestMiddleware) (*Response, error) {
+	instrumentation := c.getInstrumentation()
+	if !instrumentation.Enabled() {
+		return c.do(ctx, req, v, middleware...)
+	}
+	return c.doInstrumented(ctx, instrumentation, req, v, middleware...)
+}
+
+func (c *Client) do(ctx context.Context, req *http.Request, v interface{}, middleware ...RequestMiddleware) (*Response, error) {
+	// Collect statistics from the transport layer, e.g. rate limiter
+	stats := &requestStats{}
+	ctx = withRequestStats(ctx, stats)
+	ctx = withClientTenant(ctx, c.TenantName)
 	req = withContext(ctx, req)
 
 	// Set local logger
@@ -1523,8 +1614,18 @@ func (c *Client) Do(ctx context.Context, req *http.Request, v interface{}, middl
 		req.Header.Set("Authorization", authToken.(string))
 	}
 
+	// Refresh the session token if it is about to expire
+	session := c.getSession()
+	if session != nil && req != nil {
+		session.authorize(ctx, req)
+	}
+
 	if req != nil {
-		localLogger.Infof("Sending request: %s %s", req.Method, c.HideSensitiveInformationIfActive(req.URL.String()))
+		logger.LogAttrs(localLogger, ctx, slog.LevelInfo, "Sending request",
+			slog.String("method", req.Method),
+			slog.String("path", c.HideSensitiveInformationIfActive(req.URL.Path)),
+			slog.String("url", c.HideSensitiveInformationIfActive(req.URL.String())),
+		)
 	}
 
 	// Log the body (if applicable)
@@ -1555,13 +1656,94 @@ func (c *Client) Do(ctx context.Context, req *http.Request, v interface{}, middl
 		}
 	}
 
-	start := time.Now()
-	resp, err := c.client.Do(req)
-	duration := time.Since(start)
+	retry := c.getRetryOptions(ctx)
+	if retry.Enabled() || session != nil {
+		bodyCloser, bodyErr := rewindableBody(req)
+		if bodyErr != nil {
+			return nil, bodyErr
+		}
+		if bodyCloser != nil {
+			defer bodyCloser.Close()
+		}
+	}
+
+	var resp *http.Response
+	var duration time.Duration
+	attempts := make([]RequestAttempt, 0, 1)
+	sessionRefreshed := false
+
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		resp, err = c.client.Do(req)
+		duration = time.Since(start)
+
+		// Refresh the session once if the token was rejected, e.g. it has been revoked or expired early
+		if err == nil && resp.StatusCode == http.StatusUnauthorized && session != nil && !sessionRefreshed && canRewindRequest(req) {
+			if staleToken := session.requestToken(req); staleToken != "" {
+				sessionRefreshed = true
+				next, rewindErr := rewindRequest(ctx, req)
+				if rewindErr != nil {
+					return nil, rewindErr
+				}
+				if refreshErr := session.refreshRequest(ctx, next, staleToken); refreshErr != nil {
+					localLogger.Infof("Failed to refresh the session after receiving 401. %s", refreshErr)
+				} else {
+					localLogger.Infof("Session token was rejected. Retrying the request with a new token")
+					attempts = append(attempts, RequestAttempt{Attempt: attempt, StatusCode: resp.StatusCode, Duration: duration})
+					drainBody(resp)
+					req = next
+					continue
+				}
+			}
+		}
+
+		current := RequestAttempt{
+			Attempt:  attempt,
+			Err:      err,
+			Duration: duration,
+		}
+		if resp != nil {
+			current.StatusCode = resp.StatusCode
+		}
+
+		delay, shouldRetry := retry.nextDelay(attempt, req, resp, err)
+		if shouldRetry && !canRewindRequest(req) {
+			localLogger.Infof("Request can not be retried. %s", ErrBodyNotRewindable)
+			shouldRetry = false
+		}
+		if shouldRetry {
+			current.Delay = delay
+		}
+		attempts = append(attempts, current)
+		if !shouldRetry {
+			break
+		}
+
+		if err != nil {
+			localLogger.Infof("Request failed (attempt %d/%d). Retrying in %s. %s", attempt, retry.MaxAttempts, delay, err)
+		} else {
+			localLogger.Infof("Received retryable status code %d (attempt %d/%d). Retrying in %s", resp.StatusCode, attempt, retry.MaxAttempts, delay)
+			drainBody(resp)
+		}
+
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			return nil, sleepErr
+		}
+
+		if req, err = rewindRequest(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+
 	if err != nil {
 		// If we got an error, and the context has been canceled,
 		// the context's error is probably more useful.
-		localLogger.Infof("ERROR: Request failed. %s", err)
+		logger.LogAttrs(localLogger, ctx, slog.LevelInfo, "Request failed",
+			slog.String("method", req.Method),
+			slog.String("path", c.HideSensitiveInformationIfActive(req.URL.Path)),
+			slog.Int("attempts", len(attempts)),
+			slog.Any("error", err),
+		)
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
@@ -1572,10 +1754,13 @@ func (c *Client) Do(ctx context.Context, req *http.Request, v interface{}, middl
 		if e, ok := err.(*url.Error); ok {
 			if url, parseErr := url.Parse(e.URL); parseErr == nil {
 				e.URL = sanitizeURL(url).String()
-				return nil, e
+				err = e
 			}
 		}
 
+		if len(attempts) > 1 {
+			return nil, fmt.Errorf("request failed after %d attempts: %w", len(attempts), err)
+		}
 		return nil, err
 	}
 
@@ -1588,12 +1773,25 @@ func (c *Client) Do(ctx context.Context, req *http.Request, v interface{}, middl
 	}
 
 	response := newResponse(resp, duration)
+	response.attempts = attempts
+	response.rateLimitWait = time.Duration(atomic.LoadInt64(&stats.rateLimitWait))
+
+	responseAttrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("path", c.HideSensitiveInformationIfActive(req.URL.Path)),
+		slog.Int("status", response.StatusCode()),
+		slog.String("tenant", c.HideSensitiveInformationIfActive(c.requestTenant(req))),
+		slog.Duration("duration", response.Duration()),
+	}
+	if len(attempts) > 1 {
+		responseAttrs = append(responseAttrs, slog.Int("attempts", len(attempts)))
+	}
 
 	err = CheckResponse(response, ctxCommonOptions)
 	if err != nil {
 		// even though there was an error, we still return the response
 		// in case the caller wants to inspect it further
-		localLogger.Infof("Invalid response received from server. %s", err)
+		logger.LogAttrs(localLogger, ctx, slog.LevelInfo, "Invalid response received from server", append(responseAttrs, slog.Any("error", err))...)
 		return response, err
 	}
 
@@ -1624,7 +1822,7 @@ func (c *Client) Do(ctx context.Context, req *http.Request, v interface{}, middl
 		response.body = buf
 	}
 
-	localLogger.Info(fmt.Sprintf("Status code: %v", response.StatusCode()))
+	logger.LogAttrs(localLogger, ctx, slog.LevelInfo, "Received response", responseAttrs...)
 
 	return response, err
 }
@@ -1675,6 +1873,9 @@ func (e *Error) Error() string {
 
 /*
 An ErrorResponse reports one or more errors caused by an API request.
+
+Use errors.Is to check the class of the error, e.g. errors.Is(err, ErrNotFound),
+or errors.As to access the details of the error.
 */
 type ErrorResponse struct {
 	Response  *Response `json:"-"`                 // HTTP response that caused this error
@@ -1683,17 +1884,17 @@ type ErrorResponse struct {
 	Info      string    `json:"info,omitempty"`    // URL to an error description on the Internet.
 
 	// Error details. Only available in DEBUG mode.
-	Details *struct {
-		ExceptionClass      string `json:"exceptionClass,omitempty"`
-		ExceptionMessage    string `json:"exceptionMessage,omitempty"`
-		ExceptionStackTrace string `json:"exceptionStackTrace,omitempty"`
-	} `json:"details,omitempty"`
+	Details *ErrorDetails `json:"details,omitempty"`
+
+	Method    string `json:"-"` // Request method
+	URL       string `json:"-"` // Request URL (sanitized)
+	RequestID string `json:"-"` // Request ID (if available)
 }
 
 func (r *ErrorResponse) Error() string {
 	return fmt.Sprintf("%v %v: %d %v %v",
-		r.Response.Response.Request.Method, sanitizeURL(r.Response.Response.Request.URL),
-		r.Response.StatusCode(), r.ErrorType, r.Message)
+		r.Method, r.URL,
+		r.StatusCode(), r.ErrorType, r.Message)
 }
 
 // CheckResponse checks the API response for errors, and returns them if
@@ -1702,6 +1903,8 @@ func (r *ErrorResponse) Error() string {
 // API error responses are expected to have either no response
 // body, or a JSON response body that maps to ErrorResponse. Any other
 // response body will be silently ignored.
+// The returned error is always an *ErrorResponse which can be matched
+// against the error classes, e.g. ErrNotFound, using errors.Is.
 func CheckResponse(r *Response, opt CommonOptions) error {
 	if r == nil {
 		return fmt.Errorf("response is nil")
@@ -1711,6 +1914,15 @@ func CheckResponse(r *Response, opt CommonOptions) error {
 	}
 
 	errorResponse := &ErrorResponse{Response: r}
+	if r.Response != nil {
+		errorResponse.RequestID = getRequestID(r.Response)
+		if req := r.Response.Request; req != nil {
+			errorResponse.Method = req.Method
+			if req.URL != nil {
+				errorResponse.URL = sanitizeURL(req.URL).String()
+			}
+		}
+	}
 	data, err := io.ReadAll(r.RawBody())
 
 	// Store copy of response as error messages are short anyway
@@ -1734,40 +1946,59 @@ func (c *Client) HideSensitiveInformationIfActive(message string) string {
 	if !hideSensitive {
 		return message
 	}
+	return RedactSensitiveInformation(message, c.SensitiveValues())
+}
 
-	if os.Getenv("USERNAME") != "" {
-		message = strings.ReplaceAll(message, os.Getenv("USERNAME"), "******")
-	}
-	if c.TenantName != "" {
-		message = strings.ReplaceAll(message, c.TenantName, "{tenant}")
-	}
-	if c.Username != "" {
-		message = strings.ReplaceAll(message, c.Username, "{username}")
-	}
-	if c.Password != "" {
-		message = strings.ReplaceAll(message, c.Password, "{password}")
-	}
-	if c.Token != "" {
-		message = strings.ReplaceAll(message, c.Token, "{token}")
-	}
+// SensitiveValue is a value which should be replaced by a placeholder when it is logged or stored
+type SensitiveValue struct {
+	// Placeholder used in place of the value, e.g. {tenant}
+	Placeholder string
 
+	// Value the sensitive value
+	Value string
+
+	// Secret is true if the value is a credential. Secrets are never restored from a placeholder
+	Secret bool
+}
+
+// SensitiveValues returns the sensitive values of the client which are hidden
+// by HideSensitiveInformationIfActive
+func (c *Client) SensitiveValues() []SensitiveValue {
+	values := []SensitiveValue{
+		{Placeholder: "******", Value: os.Getenv("USERNAME")},
+		{Placeholder: "{tenant}", Value: c.TenantName},
+		{Placeholder: "{username}", Value: c.Username},
+		{Placeholder: "{password}", Value: c.Password, Secret: true},
+		{Placeholder: "{token}", Value: c.Token, Secret: true},
+	}
 	if c.BaseURL != nil {
-		message = strings.ReplaceAll(message, strings.TrimRight(c.BaseURL.Host, "/"), "{host}")
+		values = append(values, SensitiveValue{Placeholder: "{host}", Value: strings.TrimRight(c.BaseURL.Host, "/")})
 	}
-	if c.Domain != "" {
-		message = strings.ReplaceAll(message, c.Domain, "{domain}")
+	values = append(values, SensitiveValue{Placeholder: "{domain}", Value: c.Domain})
+	return values
+}
+
+var (
+	basicAuthMatcher = regexp.MustCompile(`(Basic\s+)[A-Za-z0-9=]+`)
+	oauthMatcher     = regexp.MustCompile(`(authorization=)[^\s]+`)
+	xsrfTokenMatcher = regexp.MustCompile(`(?i)((X-)?Xsrf-Token:)\s*[^\s]+`)
+)
+
+// RedactSensitiveInformation replaces the sensitive values and any credentials
+// (e.g. Basic Auth values, OAuth2 and XSRF tokens) in a message
+func RedactSensitiveInformation(message string, values []SensitiveValue) string {
+	for _, v := range values {
+		if v.Value != "" {
+			message = strings.ReplaceAll(message, v.Value, v.Placeholder)
+		}
 	}
 
-	basicAuthMatcher := regexp.MustCompile(`(Basic\s+)[A-Za-z0-9=]+`)
 	message = basicAuthMatcher.ReplaceAllString(message, "$1 {base64 tenant/username:password}")
 
 	// bearerAuthMatcher := regexp.MustCompile(`(Bearer\s+)\S+`)
 	// message = bearerAuthMatcher.ReplaceAllString(message, "$1 {token}")
 
-	oauthMatcher := regexp.MustCompile(`(authorization=)[^\s]+`)
 	message = oauthMatcher.ReplaceAllString(message, "$1{OAuth2Token}")
-
-	xsrfTokenMatcher := regexp.MustCompile(`(?i)((X-)?Xsrf-Token:)\s*[^\s]+`)
 	message = xsrfTokenMatcher.ReplaceAllString(message, "$1 {xsrfToken}")
 
 	return message
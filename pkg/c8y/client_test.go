@@ -0,0 +1,44 @@
+package c8y
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/reubenmiller/go-c8y/pkg/logger"
+)
+
+func TestClient_ResponseLogHidesTenant(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"12345"}`))
+	}))
+	defer srv.Close()
+
+	buf := &bytes.Buffer{}
+	previous := Logger
+	Logger = logger.NewSlogLogger(slog.New(slog.NewTextHandler(buf, nil)))
+	defer func() { Logger = previous }()
+	t.Setenv(EnvVarLoggerHideSensitive, "true")
+
+	client := NewClient(nil, srv.URL, "t12345", "user", "pass", true)
+	if _, _, err := client.Inventory.GetManagedObject(context.Background(), "12345", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var response string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(line, `msg="Received response"`) {
+			response = line
+		}
+	}
+	if !strings.Contains(response, "tenant={tenant}") {
+		t.Errorf("response log should contain the masked tenant: got %q", response)
+	}
+	if strings.Contains(buf.String(), "t12345") {
+		t.Errorf("log should not contain the tenant: got %s", buf.String())
+	}
+}
@@ -16,4 +16,7 @@ type CommonOptions struct {
 
 	// OnResponse called on the response before the body is processed
 	OnResponse func(response *http.Response) io.Reader
+
+	// Retry options which override the client's retry options
+	Retry *RetryOptions
 }
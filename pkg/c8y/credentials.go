@@ -0,0 +1,318 @@
+package c8y
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reubenmiller/go-c8y/pkg/oauth/api"
+)
+
+// ErrNoCredentials is returned by a credentials provider which does not have any credentials
+var ErrNoCredentials = errors.New("no credentials found")
+
+// Credentials used to authorize a request. A token takes precedence over the username and password
+type Credentials struct {
+	Tenant   string `json:"tenant,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+
+	// Cookies sent along with the token, e.g. the XSRF-TOKEN cookie of an OAI-Secure session
+	Cookies []*http.Cookie `json:"-"`
+}
+
+// IsEmpty returns true if the credentials can not be used to authorize a request
+func (c Credentials) IsEmpty() bool {
+	return c.Token == "" && (c.Username == "" || c.Password == "")
+}
+
+// Apply sets the authorization header (and cookies) on the request
+func (c Credentials) Apply(req *http.Request) (bool, error) {
+	if c.Token != "" {
+		setCookieHeaders(req, c.Cookies)
+		return WithToken(c.Token)(req)
+	}
+	return WithTenantUsernamePassword(c.Tenant, c.Username, c.Password)(req)
+}
+
+// CredentialsProvider provides the credentials used to authorize each request.
+// Providers must be safe to use from multiple go routines
+type CredentialsProvider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+// CredentialsProviderFunc is an adapter to use a function as a credentials provider
+type CredentialsProviderFunc func(ctx context.Context) (Credentials, error)
+
+// Retrieve returns the credentials returned by the function
+func (f CredentialsProviderFunc) Retrieve(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// SetCredentialsProvider sets the provider which is used to authorize all requests which don't use
+// a request specific authorization. The provider takes precedence over the Username, Password and Token
+// fields. Use nil to remove the provider
+func (c *Client) SetCredentialsProvider(provider CredentialsProvider) {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	c.credentialsProvider = provider
+}
+
+func (c *Client) getCredentialsProvider() CredentialsProvider {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	return c.credentialsProvider
+}
+
+// Static credentials
+type staticCredentialsProvider struct {
+	credentials Credentials
+}
+
+// NewStaticCredentialsProvider returns a provider which always returns the given credentials
+func NewStaticCredentialsProvider(credentials Credentials) CredentialsProvider {
+	return &staticCredentialsProvider{credentials: credentials}
+}
+
+func (p *staticCredentialsProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	if p.credentials.IsEmpty() {
+		return Credentials{}, ErrNoCredentials
+	}
+	return p.credentials, nil
+}
+
+// Environment credentials
+type environmentCredentialsProvider struct{}
+
+// NewEnvironmentCredentialsProvider returns a provider which reads the credentials from the
+// C8Y_TOKEN, or C8Y_TENANT, C8Y_USER and C8Y_PASSWORD environment variables. The variables are read
+// for each request so changes are picked up immediately
+func NewEnvironmentCredentialsProvider() CredentialsProvider {
+	return &environmentCredentialsProvider{}
+}
+
+func (p *environmentCredentialsProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	tenant, username, password := GetServiceUserFromEnvironment()
+	credentials := Credentials{
+		Tenant:   tenant,
+		Username: username,
+		Password: password,
+		Token:    os.Getenv(EnvironmentToken),
+	}
+	if credentials.IsEmpty() {
+		return Credentials{}, fmt.Errorf("environment variables are not set. %w", ErrNoCredentials)
+	}
+	return credentials, nil
+}
+
+// FileCredentialsProvider reads the credentials from a file, and reloads them when the file changes, e.g. when
+// the credentials are rotated. The file can either be json, or contain KEY=VALUE lines using the
+// same names as the environment variables (C8Y_TENANT, C8Y_USER, C8Y_PASSWORD and C8Y_TOKEN)
+type FileCredentialsProvider struct {
+	path string
+
+	mu          sync.Mutex
+	modTime     time.Time
+	size        int64
+	credentials Credentials
+}
+
+// NewFileCredentialsProvider returns a provider which reads the credentials from the given file
+func NewFileCredentialsProvider(path string) *FileCredentialsProvider {
+	return &FileCredentialsProvider{path: path}
+}
+
+// Retrieve returns the credentials from the file. The file is only read again if it has been modified.
+// The previous credentials are used if the file can not be read whilst it is being rotated
+func (p *FileCredentialsProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return p.previous(err)
+	}
+	if !p.credentials.IsEmpty() && info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+		return p.credentials, nil
+	}
+
+	contents, err := os.ReadFile(p.path)
+	if err != nil {
+		return p.previous(err)
+	}
+	credentials, err := parseCredentialsFile(contents)
+	if err != nil {
+		return p.previous(err)
+	}
+	if credentials.IsEmpty() {
+		return p.previous(ErrNoCredentials)
+	}
+
+	Logger.Infof("Loaded credentials from file. path=%s", p.path)
+	p.credentials = credentials
+	p.modTime = info.ModTime()
+	p.size = info.Size()
+	return credentials, nil
+}
+
+func (p *FileCredentialsProvider) previous(err error) (Credentials, error) {
+	if p.credentials.IsEmpty() {
+		return Credentials{}, fmt.Errorf("failed to read credentials file. path=%s, %w", p.path, err)
+	}
+	Logger.Infof("Failed to read credentials file, using the previous credentials. path=%s, %s", p.path, err)
+	return p.credentials, nil
+}
+
+func parseCredentialsFile(contents []byte) (Credentials, error) {
+	credentials := Credentials{}
+	contents = bytes.TrimSpace(contents)
+	if bytes.HasPrefix(contents, []byte("{")) {
+		err := json.Unmarshal(contents, &credentials)
+		return credentials, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !found {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		switch strings.TrimSpace(key) {
+		case EnvironmentTenant:
+			credentials.Tenant = value
+		case EnvironmentUsername:
+			credentials.Username = value
+		case EnvironmentPassword:
+			credentials.Password = value
+		case EnvironmentToken:
+			credentials.Token = value
+		}
+	}
+	return credentials, scanner.Err()
+}
+
+// Microservice service user credentials
+type serviceUserCredentialsProvider struct {
+	client *Client
+	tenant string
+}
+
+// NewServiceUserCredentialsProvider returns a provider which uses the microservice service user of the
+// given tenant. The first service user is used if the tenant is empty. The service users must be loaded
+// via Microservice.SetServiceUsers, and are looked up for each request so updated subscriptions are used
+func NewServiceUserCredentialsProvider(client *Client, tenant string) CredentialsProvider {
+	return &serviceUserCredentialsProvider{
+		client: client,
+		tenant: tenant,
+	}
+}
+
+func (p *serviceUserCredentialsProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	p.client.clientMu.Lock()
+	defer p.client.clientMu.Unlock()
+	for _, user := range p.client.ServiceUsers {
+		if p.tenant == "" || p.tenant == user.Tenant {
+			return Credentials{
+				Tenant:   user.Tenant,
+				Username: user.Username,
+				Password: user.Password,
+			}, nil
+		}
+	}
+	return Credentials{}, fmt.Errorf("service user not found. tenant=%s, %w", p.tenant, ErrNoCredentials)
+}
+
+// TokenSource returns an OAuth access token, e.g. from the device authorization flow
+type TokenSource interface {
+	Token(ctx context.Context) (*api.AccessToken, error)
+}
+
+// TokenSourceFunc is an adapter to use a function as a token source
+type TokenSourceFunc func(ctx context.Context) (*api.AccessToken, error)
+
+// Token returns the token returned by the function
+func (f TokenSourceFunc) Token(ctx context.Context) (*api.AccessToken, error) {
+	return f(ctx)
+}
+
+type tokenSourceCredentialsProvider struct {
+	source TokenSource
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewTokenSourceCredentialsProvider returns a provider which uses the access token from the token source.
+// JWT access tokens are reused until they are about to expire, all other tokens are requested from the
+// source for each request, so the source is responsible for caching them
+func NewTokenSourceCredentialsProvider(source TokenSource) CredentialsProvider {
+	return &tokenSourceCredentialsProvider{source: source}
+}
+
+func (p *tokenSourceCredentialsProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && time.Now().Add(DefaultSessionRefreshMargin).Before(p.expiresAt) {
+		return Credentials{Token: p.token}, nil
+	}
+
+	token, err := p.source.Token(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+	if token == nil || token.Token == "" {
+		return Credentials{}, fmt.Errorf("token source did not return a token. %w", ErrNoCredentials)
+	}
+
+	p.token = token.Token
+	p.expiresAt = time.Time{}
+	if claims, err := parseTokenClaims(token.Token); err == nil && claims.ExpiresAt != nil {
+		p.expiresAt = claims.ExpiresAt.Time
+	}
+	return Credentials{Token: p.token}, nil
+}
+
+// Chain of credentials
+type chainCredentialsProvider struct {
+	providers []CredentialsProvider
+}
+
+// NewChainCredentialsProvider returns a provider which tries each provider in order, and uses
+// the credentials of the first one which succeeds
+func NewChainCredentialsProvider(providers ...CredentialsProvider) CredentialsProvider {
+	return &chainCredentialsProvider{providers: providers}
+}
+
+func (p *chainCredentialsProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	errs := make([]error, 0, len(p.providers))
+	for _, provider := range p.providers {
+		credentials, err := provider.Retrieve(ctx)
+		if err == nil && !credentials.IsEmpty() {
+			return credentials, nil
+		}
+		if err == nil {
+			err = ErrNoCredentials
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return Credentials{}, ErrNoCredentials
+	}
+	return Credentials{}, errors.Join(errs...)
+}
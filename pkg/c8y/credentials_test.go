@@ -0,0 +1,184 @@
+package c8y
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/reubenmiller/go-c8y/pkg/oauth/api"
+)
+
+func TestCredentials_ClientUsesProvider(t *testing.T) {
+	var authorization atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization.Store(r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"12345"}`))
+	}))
+	defer srv.Close()
+
+	var token atomic.Value
+	token.Store("token1")
+	client := NewClientFromOptions(nil, ClientOptions{
+		BaseURL:  srv.URL,
+		Username: "ignored",
+		Password: "ignored",
+		Credentials: CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+			return Credentials{Token: token.Load().(string)}, nil
+		}),
+	})
+
+	for _, want := range []string{"token1", "token2"} {
+		token.Store(want)
+		if _, _, err := client.Inventory.GetManagedObject(context.Background(), "12345", nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := authorization.Load(); got != "Bearer "+want {
+			t.Errorf("authorization: got %v, want %v", got, "Bearer "+want)
+		}
+	}
+
+	client.SetCredentialsProvider(CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		return Credentials{}, ErrNoCredentials
+	}))
+	if _, _, err := client.Inventory.GetManagedObject(context.Background(), "12345", nil); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("provider error: got %v, want %v", err, ErrNoCredentials)
+	}
+}
+
+func TestCredentials_ProviderUsesRequestContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"12345"}`))
+	}))
+	defer srv.Close()
+
+	type providerKey struct{}
+	var calls atomic.Int32
+	client := NewClientFromOptions(nil, ClientOptions{
+		BaseURL: srv.URL,
+		Credentials: CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+			calls.Add(1)
+			if ctx.Value(providerKey{}) == nil {
+				return Credentials{}, errors.New("missing request context")
+			}
+			if err := ctx.Err(); err != nil {
+				return Credentials{}, err
+			}
+			return Credentials{Token: "token"}, nil
+		}),
+	})
+
+	ctx := context.WithValue(context.Background(), providerKey{}, true)
+	if _, _, err := client.Inventory.GetManagedObject(ctx, "12345", nil); err != nil {
+		t.Errorf("request: unexpected error: %v", err)
+	}
+	if _, err := client.SendRequest(ctx, RequestOptions{
+		Method:   http.MethodPost,
+		Path:     "inventory/binaries",
+		FormData: map[string]io.Reader{"file": strings.NewReader("data")},
+	}); err != nil {
+		t.Errorf("multipart request: unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := client.Inventory.GetManagedObject(ctx, "12345", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled request: got %v, want %v", err, context.Canceled)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("provider calls: got %d, want 3", got)
+	}
+}
+
+func TestCredentials_Chain(t *testing.T) {
+	t.Setenv(EnvironmentTenant, "")
+	t.Setenv(EnvironmentUsername, "")
+	t.Setenv(EnvironmentPassword, "")
+	t.Setenv(EnvironmentToken, "")
+
+	provider := NewChainCredentialsProvider(
+		NewEnvironmentCredentialsProvider(),
+		NewStaticCredentialsProvider(Credentials{Tenant: "t12345", Username: "static", Password: "secret"}),
+	)
+
+	credentials, err := provider.Retrieve(context.Background())
+	if err != nil || credentials.Username != "static" {
+		t.Errorf("fallback: got %v (err=%v), want %s", credentials.Username, err, "static")
+	}
+
+	t.Setenv(EnvironmentToken, "envtoken")
+	credentials, err = provider.Retrieve(context.Background())
+	if err != nil || credentials.Token != "envtoken" {
+		t.Errorf("environment: got %v (err=%v), want %s", credentials.Token, err, "envtoken")
+	}
+
+	_, err = NewChainCredentialsProvider(NewStaticCredentialsProvider(Credentials{})).Retrieve(context.Background())
+	if !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("empty chain: got %v, want %v", err, ErrNoCredentials)
+	}
+}
+
+func TestCredentials_FileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(path, []byte(`{"tenant":"t12345","username":"user","password":"pass1"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := NewFileCredentialsProvider(path)
+	credentials, err := provider.Retrieve(context.Background())
+	if err != nil || credentials.Password != "pass1" {
+		t.Errorf("json file: got %v (err=%v), want %s", credentials.Password, err, "pass1")
+	}
+
+	contents := "# rotated\nC8Y_TENANT=t12345\nC8Y_USER=user\nexport C8Y_PASSWORD=\"pass2\"\n"
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	credentials, err = provider.Retrieve(context.Background())
+	if err != nil || credentials.Password != "pass2" {
+		t.Errorf("rotated file: got %v (err=%v), want %s", credentials.Password, err, "pass2")
+	}
+
+	// The previous credentials are used whilst the file is missing
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	credentials, err = provider.Retrieve(context.Background())
+	if err != nil || credentials.Password != "pass2" {
+		t.Errorf("missing file: got %v (err=%v), want %s", credentials.Password, err, "pass2")
+	}
+}
+
+func TestCredentials_TokenSource(t *testing.T) {
+	var calls int32
+	provider := NewTokenSourceCredentialsProvider(TokenSourceFunc(func(ctx context.Context) (*api.AccessToken, error) {
+		atomic.AddInt32(&calls, 1)
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}).SignedString([]byte("secret"))
+		return &api.AccessToken{Token: token}, err
+	}))
+
+	for i := 0; i < 3; i++ {
+		if credentials, err := provider.Retrieve(context.Background()); err != nil || credentials.Token == "" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("token source calls: got %d, want %d", got, 1)
+	}
+}
@@ -86,6 +86,7 @@ func (s *DeviceCertificateService) GetCertificates(ctx context.Context, tenant s
 	}
 	data := new(DeviceCertificateCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "DeviceCertificate.GetCertificates",
 		Method:       "GET",
 		Path:         "tenant/tenants/" + tenant + "/trusted-certificates",
 		Query:        opt,
@@ -101,6 +102,7 @@ func (s *DeviceCertificateService) GetCertificate(ctx context.Context, tenant st
 	}
 	data := new(Certificate)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "DeviceCertificate.GetCertificate",
 		Method:       "GET",
 		Path:         "tenant/tenants/" + tenant + "/trusted-certificates/" + fingerprint,
 		ResponseData: data,
@@ -114,8 +116,9 @@ func (s *DeviceCertificateService) Delete(ctx context.Context, tenant string, fi
 		tenant = s.client.TenantName
 	}
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "tenant/tenants/" + tenant + "/trusted-certificates/" + fingerprint,
+		Operation: "DeviceCertificate.Delete",
+		Method:    "DELETE",
+		Path:      "tenant/tenants/" + tenant + "/trusted-certificates/" + fingerprint,
 	})
 }
 
@@ -126,6 +129,7 @@ func (s *DeviceCertificateService) Create(ctx context.Context, tenant string, bo
 	}
 	data := new(Certificate)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "DeviceCertificate.Create",
 		Method:       "POST",
 		Path:         "tenant/tenants/" + tenant + "/trusted-certificates",
 		Body:         body,
@@ -141,6 +145,7 @@ func (s *DeviceCertificateService) Update(ctx context.Context, tenant string, fi
 	}
 	data := new(Certificate)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "DeviceCertificate.Update",
 		Method:       "PUT",
 		Path:         "tenant/tenants/" + tenant + "/trusted-certificates/" + fingerprint,
 		Body:         body,
@@ -56,6 +56,7 @@ type NewDeviceRequestCollection struct {
 func (s *DeviceCredentialsService) GetNewDeviceRequest(ctx context.Context, ID string) (*NewDeviceRequest, *Response, error) {
 	data := new(NewDeviceRequest)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "DeviceCredentials.GetNewDeviceRequest",
 		Method:       "GET",
 		Path:         "devicecontrol/newDeviceRequests/" + ID,
 		ResponseData: data,
@@ -67,6 +68,7 @@ func (s *DeviceCredentialsService) GetNewDeviceRequest(ctx context.Context, ID s
 func (s *DeviceCredentialsService) GetNewDeviceRequests(ctx context.Context, opt *NewDeviceRequestOptions) (*NewDeviceRequestCollection, *Response, error) {
 	data := new(NewDeviceRequestCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "DeviceCredentials.GetNewDeviceRequests",
 		Method:       "GET",
 		Path:         "devicecontrol/newDeviceRequests",
 		Query:        opt,
@@ -82,6 +84,7 @@ func (s *DeviceCredentialsService) Create(ctx context.Context, ID string) (*NewD
 		"id": ID,
 	}
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "DeviceCredentials.Create",
 		Method:       "POST",
 		Path:         "devicecontrol/newDeviceRequests",
 		Body:         body,
@@ -97,6 +100,7 @@ func (s *DeviceCredentialsService) Update(ctx context.Context, ID string, status
 		Status: status,
 	}
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "DeviceCredentials.Update",
 		Method:       "PUT",
 		Path:         "devicecontrol/newDeviceRequests/" + ID,
 		ResponseData: data,
@@ -108,8 +112,9 @@ func (s *DeviceCredentialsService) Update(ctx context.Context, ID string, status
 // Delete removes an existing New Device Request
 func (s *DeviceCredentialsService) Delete(ctx context.Context, ID string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "devicecontrol/newDeviceRequests/" + ID,
+		Operation: "DeviceCredentials.Delete",
+		Method:    "DELETE",
+		Path:      "devicecontrol/newDeviceRequests/" + ID,
 	})
 }
 
@@ -129,6 +134,7 @@ func (s *DeviceCredentialsService) CreateDeviceCredentials(ctx context.Context,
 		ID: ID,
 	}
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "DeviceCredentials.CreateDeviceCredentials",
 		Method:       "POST",
 		Path:         "devicecontrol/deviceCredentials",
 		Body:         body,
@@ -209,6 +215,7 @@ func (s *DeviceCredentialsService) CreateBulk(ctx context.Context, csvContents i
 
 	data := new(BulkNewDeviceRequest)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "DeviceCredentials.CreateBulk",
 		Method:       "POST",
 		Path:         "devicecontrol/bulkNewDeviceRequests",
 		FormData:     formData,
@@ -0,0 +1,563 @@
+package c8y
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// DryRunFormat format used to render a dry run request
+type DryRunFormat string
+
+const (
+	// DryRunFormatCurl render the request as a curl command
+	DryRunFormatCurl DryRunFormat = "curl"
+
+	// DryRunFormatHTTPie render the request as a HTTPie command
+	DryRunFormatHTTPie DryRunFormat = "httpie"
+
+	// DryRunFormatHTTPFile render the request as an entry of a .http file (VS Code REST Client / JetBrains HTTP Client)
+	DryRunFormatHTTPFile DryRunFormat = "http"
+
+	// DryRunFormatJSON render the request as json
+	DryRunFormatJSON DryRunFormat = "json"
+)
+
+// Environment variables which are referenced instead of the credentials when rendering
+// a request as a shell command with redaction enabled
+const (
+	EnvironmentToken     = "C8Y_TOKEN"
+	EnvironmentXSRFToken = "C8Y_XSRF_TOKEN"
+	EnvironmentCookie    = "C8Y_COOKIE"
+)
+
+// Headers which contain credentials
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"X-Xsrf-Token",
+}
+
+// DryRunRenderer renders a request, e.g. as a command which can be used to send the same request
+type DryRunRenderer func(req *DryRunRequest, redact bool) (string, error)
+
+// DryRunOptions options used to render dry run requests
+type DryRunOptions struct {
+	// Format output format. Defaults to curl. Ignored if a Renderer is provided
+	Format DryRunFormat
+
+	// Renderer custom renderer
+	Renderer DryRunRenderer
+
+	// RedactCredentials replaces the credentials with references to variables, e.g. $C8Y_PASSWORD
+	RedactCredentials bool
+}
+
+// DryRunFormPart part of a multipart/form-data request body
+type DryRunFormPart struct {
+	Name        string `json:"name"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Data        []byte `json:"-"`
+}
+
+// IsFile returns true if the part is a file
+func (p *DryRunFormPart) IsFile() bool {
+	return p.Filename != ""
+}
+
+// DryRunRequest snapshot of a request which was not sent due to dry run
+type DryRunRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"headers"`
+
+	// Body raw request body. Empty if the body is multipart/form-data
+	Body []byte `json:"-"`
+
+	// Form parts of a multipart/form-data request body
+	Form []DryRunFormPart `json:"-"`
+}
+
+// IsMultipart returns true if the request body is multipart/form-data
+func (r *DryRunRequest) IsMultipart() bool {
+	return len(r.Form) > 0
+}
+
+// NewDryRunRequest creates a snapshot of the request. The request body is read, and replaced
+// so the request can still be used afterwards
+func NewDryRunRequest(req *http.Request) (*DryRunRequest, error) {
+	out := &DryRunRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+	}
+	if out.Header == nil {
+		out.Header = http.Header{}
+	}
+
+	body, err := peekRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" && params["boundary"] != "" {
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid multipart body. %w", err)
+			}
+			data, err := io.ReadAll(part)
+			if err != nil {
+				return nil, err
+			}
+			out.Form = append(out.Form, DryRunFormPart{
+				Name:        part.FormName(),
+				Filename:    part.FileName(),
+				ContentType: part.Header.Get("Content-Type"),
+				Data:        data,
+			})
+		}
+		return out, nil
+	}
+
+	out.Body = body
+	return out, nil
+}
+
+// peekRequestBody returns the request body without consuming it
+func peekRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err == nil {
+			defer body.Close()
+			return io.ReadAll(body)
+		}
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return data, err
+}
+
+// RenderDryRunRequest renders the request using the given format
+func RenderDryRunRequest(req *http.Request, opts DryRunOptions) (string, error) {
+	snapshot, err := NewDryRunRequest(req)
+	if err != nil {
+		return "", err
+	}
+	renderer := opts.Renderer
+	if renderer == nil {
+		if renderer, err = GetDryRunRenderer(opts.Format); err != nil {
+			return "", err
+		}
+	}
+	return renderer(snapshot, opts.RedactCredentials)
+}
+
+// GetDryRunRenderer returns the renderer for a format. The curl renderer is returned if the format is empty
+func GetDryRunRenderer(format DryRunFormat) (DryRunRenderer, error) {
+	switch format {
+	case DryRunFormatCurl, "":
+		return RenderCurl, nil
+	case DryRunFormatHTTPie:
+		return RenderHTTPie, nil
+	case DryRunFormatHTTPFile:
+		return RenderHTTPFile, nil
+	case DryRunFormatJSON:
+		return RenderJSON, nil
+	}
+	return nil, fmt.Errorf("unknown dry run format: %s", format)
+}
+
+// NewDryRunHandler returns a dry run handler which writes each request to w using the given format.
+// It can be used as the DryRunHandler of the DefaultRequestOptions
+func NewDryRunHandler(w io.Writer, opts DryRunOptions) func(options *RequestOptions, req *http.Request) {
+	return func(options *RequestOptions, req *http.Request) {
+		output, err := RenderDryRunRequest(req, opts)
+		if err != nil {
+			Logger.Warnf("Could not render dry run request. %s", err)
+			return
+		}
+		fmt.Fprintln(w, output)
+	}
+}
+
+// isText checks if the data can be shown as text
+func isText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, c := range data {
+		if c < 0x20 && c != '\n' && c != '\r' && c != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedHeaderNames returns the header names in alphabetical order, excluding headers which
+// are set by the client which sends the request
+func sortedHeaderNames(header http.Header, exclude ...string) []string {
+	names := make([]string, 0, len(header))
+	for key := range header {
+		skip := strings.EqualFold(key, "Content-Length")
+		for _, name := range exclude {
+			skip = skip || strings.EqualFold(key, name)
+		}
+		if !skip {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isSensitiveHeader(key string) bool {
+	for _, name := range sensitiveHeaders {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// basicAuthCredentials returns the tenant, username and password of a basic authorization header value
+func basicAuthCredentials(value string) (tenant string, username string, password string, ok bool) {
+	encoded, found := strings.CutPrefix(value, "Basic ")
+	if !found {
+		return "", "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", "", false
+	}
+	username, password, _ = strings.Cut(string(decoded), ":")
+	if t, u, found := strings.Cut(username, "/"); found {
+		tenant, username = t, u
+	}
+	return tenant, username, password, true
+}
+
+// redactedHeaderValue returns the value of a sensitive header where the credentials are replaced by variables
+func redactedHeaderValue(key string, value string, variable func(name string) string) string {
+	switch {
+	case strings.EqualFold(key, "Authorization"):
+		if scheme, _, found := strings.Cut(value, " "); found && strings.EqualFold(scheme, "Bearer") {
+			return scheme + " " + variable(EnvironmentToken)
+		}
+		return variable(EnvironmentToken)
+	case strings.EqualFold(key, "Cookie"):
+		return variable(EnvironmentCookie)
+	default:
+		return variable(EnvironmentXSRFToken)
+	}
+}
+
+// Shell commands (curl and HTTPie)
+
+// shellQuote quotes a value so it can be used as a single shell argument
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// shellVariable returns a reference to an environment variable
+func shellVariable(name string) string {
+	return "$" + name
+}
+
+// shellPrintf returns a printf command which writes the binary data to stdout
+func shellPrintf(data []byte) string {
+	var b strings.Builder
+	for _, c := range data {
+		fmt.Fprintf(&b, "\\%03o", c)
+	}
+	return "printf " + shellQuote(b.String())
+}
+
+// basicAuthShellArgument returns the user argument which references the credential environment variables
+func basicAuthShellArgument(tenant string) string {
+	if tenant != "" {
+		return fmt.Sprintf(`"$%s/$%s:$%s"`, EnvironmentTenant, EnvironmentUsername, EnvironmentPassword)
+	}
+	return fmt.Sprintf(`"$%s:$%s"`, EnvironmentUsername, EnvironmentPassword)
+}
+
+// curlFilename quotes a filename used in a curl form argument
+func curlFilename(filename string) string {
+	return `"` + multipartQuoteEscaper.Replace(filename) + `"`
+}
+
+func joinShellArgs(prefix string, args []string) string {
+	return prefix + strings.Join(args, " \\\n  ")
+}
+
+// RenderCurl renders the request as a curl command
+func RenderCurl(req *DryRunRequest, redact bool) (string, error) {
+	args := []string{"curl"}
+	if req.Method != http.MethodGet {
+		args = append(args, "-X "+req.Method)
+	}
+	args = append(args, shellQuote(req.URL))
+
+	exclude := []string{}
+	if req.IsMultipart() {
+		// curl generates the multipart boundary
+		exclude = append(exclude, "Content-Type")
+	}
+	for _, key := range sortedHeaderNames(req.Header, exclude...) {
+		for _, value := range req.Header[key] {
+			if redact && isSensitiveHeader(key) {
+				if tenant, _, _, ok := basicAuthCredentials(value); ok && strings.EqualFold(key, "Authorization") {
+					args = append(args, "-u "+basicAuthShellArgument(tenant))
+				} else {
+					args = append(args, fmt.Sprintf(`-H "%s: %s"`, key, redactedHeaderValue(key, value, shellVariable)))
+				}
+				continue
+			}
+			args = append(args, "-H "+shellQuote(key+": "+value))
+		}
+	}
+
+	prefix := ""
+	switch {
+	case req.IsMultipart():
+		for _, part := range req.Form {
+			if part.IsFile() {
+				value := part.Name + "=@" + curlFilename(part.Filename)
+				if part.ContentType != "" {
+					value += ";type=" + part.ContentType
+				}
+				args = append(args, "-F "+shellQuote(value))
+			} else {
+				args = append(args, "--form-string "+shellQuote(part.Name+"="+string(part.Data)))
+			}
+		}
+	case len(req.Body) > 0 && isText(req.Body):
+		args = append(args, "--data-raw "+shellQuote(string(req.Body)))
+	case len(req.Body) > 0:
+		prefix = shellPrintf(req.Body) + " | "
+		args = append(args, "--data-binary @-")
+	}
+	return joinShellArgs(prefix, args), nil
+}
+
+// RenderHTTPie renders the request as a HTTPie command
+func RenderHTTPie(req *DryRunRequest, redact bool) (string, error) {
+	args := []string{"http"}
+	if req.IsMultipart() {
+		args = append(args, "--multipart")
+	}
+	args = append(args, req.Method, shellQuote(req.URL))
+
+	exclude := []string{}
+	if req.IsMultipart() {
+		// HTTPie generates the multipart boundary
+		exclude = append(exclude, "Content-Type")
+	}
+	for _, key := range sortedHeaderNames(req.Header, exclude...) {
+		for _, value := range req.Header[key] {
+			if redact && isSensitiveHeader(key) {
+				if tenant, _, _, ok := basicAuthCredentials(value); ok && strings.EqualFold(key, "Authorization") {
+					args = append(args, "-a "+basicAuthShellArgument(tenant))
+				} else {
+					args = append(args, fmt.Sprintf(`"%s:%s"`, key, redactedHeaderValue(key, value, shellVariable)))
+				}
+				continue
+			}
+			args = append(args, shellQuote(key+":"+value))
+		}
+	}
+
+	prefix := ""
+	switch {
+	case req.IsMultipart():
+		for _, part := range req.Form {
+			if part.IsFile() {
+				value := part.Name + "@" + part.Filename
+				if part.ContentType != "" {
+					value += ";type=" + part.ContentType
+				}
+				args = append(args, shellQuote(value))
+			} else {
+				args = append(args, shellQuote(part.Name+"="+string(part.Data)))
+			}
+		}
+	case len(req.Body) > 0 && isText(req.Body):
+		args = append(args, "--raw "+shellQuote(string(req.Body)))
+	case len(req.Body) > 0:
+		prefix = shellPrintf(req.Body) + " | "
+	}
+	return joinShellArgs(prefix, args), nil
+}
+
+// .http file
+
+// httpFileVariable returns a reference to a .http file variable
+func httpFileVariable(name string) string {
+	switch name {
+	case EnvironmentToken:
+		return "{{token}}"
+	case EnvironmentCookie:
+		return "{{cookie}}"
+	case EnvironmentXSRFToken:
+		return "{{xsrfToken}}"
+	}
+	return "{{" + strings.ToLower(name) + "}}"
+}
+
+// RenderHTTPFile renders the request as an entry of a .http file which can be used with the
+// VS Code REST Client or JetBrains HTTP Client. The contents of files, and of binary bodies,
+// are referenced using the "< ./filename" syntax
+func RenderHTTPFile(req *DryRunRequest, redact bool) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "###\n%s %s\n", req.Method, req.URL)
+
+	boundary := ""
+	for _, key := range sortedHeaderNames(req.Header) {
+		for _, value := range req.Header[key] {
+			if redact && isSensitiveHeader(key) {
+				if tenant, _, _, ok := basicAuthCredentials(value); ok && strings.EqualFold(key, "Authorization") {
+					user := "{{username}}"
+					if tenant != "" {
+						user = "{{tenant}}/" + user
+					}
+					value = "Basic " + user + " {{password}}"
+				} else {
+					value = redactedHeaderValue(key, value, httpFileVariable)
+				}
+			}
+			if req.IsMultipart() && strings.EqualFold(key, "Content-Type") {
+				_, params, _ := mime.ParseMediaType(value)
+				boundary = params["boundary"]
+			}
+			fmt.Fprintf(&b, "%s: %s\n", key, value)
+		}
+	}
+
+	switch {
+	case req.IsMultipart():
+		b.WriteString("\n")
+		for _, part := range req.Form {
+			fmt.Fprintf(&b, "--%s\n", boundary)
+			if part.IsFile() {
+				fmt.Fprintf(&b, "Content-Disposition: form-data; name=\"%s\"; filename=\"%s\"\n",
+					multipartQuoteEscaper.Replace(part.Name), multipartQuoteEscaper.Replace(part.Filename))
+			} else {
+				fmt.Fprintf(&b, "Content-Disposition: form-data; name=\"%s\"\n", multipartQuoteEscaper.Replace(part.Name))
+			}
+			if part.ContentType != "" {
+				fmt.Fprintf(&b, "Content-Type: %s\n", part.ContentType)
+			}
+			if part.IsFile() {
+				fmt.Fprintf(&b, "\n< ./%s\n", part.Filename)
+			} else {
+				fmt.Fprintf(&b, "\n%s\n", part.Data)
+			}
+		}
+		fmt.Fprintf(&b, "--%s--\n", boundary)
+	case len(req.Body) > 0 && isText(req.Body):
+		fmt.Fprintf(&b, "\n%s\n", req.Body)
+	case len(req.Body) > 0:
+		fmt.Fprintf(&b, "\n# Binary body (%d bytes)\n< ./body.bin\n", len(req.Body))
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// JSON
+
+type dryRunJSONPart struct {
+	DryRunFormPart
+	Size     int    `json:"size"`
+	Value    string `json:"value,omitempty"`
+	Data     string `json:"data,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type dryRunJSON struct {
+	*DryRunRequest
+	Body         any              `json:"body,omitempty"`
+	BodyEncoding string           `json:"bodyEncoding,omitempty"`
+	Form         []dryRunJSONPart `json:"form,omitempty"`
+}
+
+// jsonVariable returns a placeholder for a credential
+func jsonVariable(name string) string {
+	switch name {
+	case EnvironmentToken:
+		return "{token}"
+	case EnvironmentCookie:
+		return "{cookie}"
+	case EnvironmentXSRFToken:
+		return "{xsrfToken}"
+	}
+	return "{" + strings.ToLower(name) + "}"
+}
+
+// RenderJSON renders the request as json. Json bodies are included as json, other text is included
+// as a string, and binary data is base64 encoded
+func RenderJSON(req *DryRunRequest, redact bool) (string, error) {
+	out := dryRunJSON{
+		DryRunRequest: req,
+	}
+	if redact {
+		copied := *req
+		copied.Header = req.Header.Clone()
+		for key, values := range copied.Header {
+			if !isSensitiveHeader(key) {
+				continue
+			}
+			for i, value := range values {
+				if _, _, _, ok := basicAuthCredentials(value); ok && strings.EqualFold(key, "Authorization") {
+					values[i] = "Basic {base64 tenant/username:password}"
+				} else {
+					values[i] = redactedHeaderValue(key, value, jsonVariable)
+				}
+			}
+		}
+		out.DryRunRequest = &copied
+	}
+
+	switch {
+	case len(req.Body) > 0 && json.Valid(req.Body):
+		out.Body = json.RawMessage(req.Body)
+	case len(req.Body) > 0 && isText(req.Body):
+		out.Body = string(req.Body)
+	case len(req.Body) > 0:
+		out.Body = base64.StdEncoding.EncodeToString(req.Body)
+		out.BodyEncoding = "base64"
+	}
+
+	for _, part := range req.Form {
+		item := dryRunJSONPart{
+			DryRunFormPart: part,
+			Size:           len(part.Data),
+		}
+		if isText(part.Data) {
+			item.Value = string(part.Data)
+		} else {
+			item.Data = base64.StdEncoding.EncodeToString(part.Data)
+			item.Encoding = "base64"
+		}
+		out.Form = append(out.Form, item)
+	}
+
+	b, err := json.MarshalIndent(out, "", "  ")
+	return string(b), err
+}
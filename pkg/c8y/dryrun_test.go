@@ -0,0 +1,154 @@
+package c8y
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newDryRunTestClient(out io.Writer, opts DryRunOptions) *Client {
+	client := NewClientFromOptions(nil, ClientOptions{
+		BaseURL:  "https://example.c8y.io",
+		Tenant:   "t12345",
+		Username: "dryrun-user",
+		Password: "dryrun-secret",
+	})
+	client.SetRequestOptions(DefaultRequestOptions{
+		DryRun:        true,
+		DryRunHandler: NewDryRunHandler(out, opts),
+	})
+	return client
+}
+
+func TestDryRun_Curl(t *testing.T) {
+	out := new(bytes.Buffer)
+	client := newDryRunTestClient(out, DryRunOptions{Format: DryRunFormatCurl})
+
+	_, err := client.SendRequest(context.Background(), RequestOptions{
+		Method: http.MethodPost,
+		Path:   "inventory/managedObjects",
+		Body:   map[string]any{"name": "it's a device"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		"curl \\\n  -X POST \\\n  'https://example.c8y.io/inventory/managedObjects'",
+		"-H 'Authorization: " + NewBasicAuthString("t12345", "dryrun-user", "dryrun-secret") + "'",
+		// The body is rendered exactly as it is sent, including the trailing newline added by the json encoder
+		"--data-raw '{\"name\":\"it'\\''s a device\"}\n'",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("curl command: got %q, want to contain %q", got, want)
+		}
+	}
+}
+
+func TestDryRun_RedactCredentials(t *testing.T) {
+	testCases := []struct {
+		format DryRunFormat
+		want   string
+	}{
+		{DryRunFormatCurl, `-u "$C8Y_TENANT/$C8Y_USER:$C8Y_PASSWORD"`},
+		{DryRunFormatHTTPie, `-a "$C8Y_TENANT/$C8Y_USER:$C8Y_PASSWORD"`},
+		{DryRunFormatHTTPFile, "Authorization: Basic {{tenant}}/{{username}} {{password}}"},
+		{DryRunFormatJSON, "Basic {base64 tenant/username:password}"},
+	}
+	for _, tc := range testCases {
+		out := new(bytes.Buffer)
+		client := newDryRunTestClient(out, DryRunOptions{Format: tc.format, RedactCredentials: true})
+		if _, err := client.SendRequest(context.Background(), RequestOptions{Method: http.MethodGet, Path: "alarm/alarms"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := out.String(); !strings.Contains(got, tc.want) || strings.Contains(got, "dryrun-secret") || strings.Contains(got, "Basic dDEy") {
+			t.Errorf("%s: got %q, want to contain %q without the credentials", tc.format, got, tc.want)
+		}
+	}
+}
+
+func TestDryRun_Multipart(t *testing.T) {
+	f := createTestFile(t, "upload.txt", "file contents")
+	defer f.Close()
+
+	req, err := prepareMultipartRequest(http.MethodPost, "https://example.c8y.io/inventory/binaries", map[string]io.Reader{
+		"object": strings.NewReader(`{"name":"upload.txt"}`),
+		"file":   f,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		format DryRunFormat
+		want   []string
+	}{
+		{DryRunFormatCurl, []string{`-F 'file=@"upload.txt";type=text/plain'`, `--form-string 'object={"name":"upload.txt"}'`}},
+		{DryRunFormatHTTPie, []string{"--multipart", `'file@upload.txt;type=text/plain'`, `'object={"name":"upload.txt"}'`}},
+		{DryRunFormatHTTPFile, []string{"Content-Disposition: form-data; name=\"file\"; filename=\"upload.txt\"\nContent-Type: text/plain\n\n< ./upload.txt"}},
+	}
+
+	snapshot, err := NewDryRunRequest(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tc := range testCases {
+		renderer, err := GetDryRunRenderer(tc.format)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, err := renderer(snapshot, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: got %q, want to contain %q", tc.format, got, want)
+			}
+		}
+		if tc.format != DryRunFormatHTTPFile && strings.Contains(got, "multipart/form-data") {
+			t.Errorf("%s: content type should be generated by the tool: %q", tc.format, got)
+		}
+	}
+}
+
+func TestDryRun_BinaryBody(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPut, "https://example.c8y.io/inventory/binaries/1", bytes.NewReader([]byte{0x00, 0xff, '\''}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := RenderDryRunRequest(req, DryRunOptions{Format: DryRunFormatCurl})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `printf '\000\377\047' | curl`; !strings.HasPrefix(got, want) || !strings.Contains(got, "--data-binary @-") {
+		t.Errorf("binary body: got %q, want prefix %q", got, want)
+	}
+
+	got, err = RenderDryRunRequest(req, DryRunOptions{Format: DryRunFormatJSON})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var output struct {
+		Method       string `json:"method"`
+		Body         string `json:"body"`
+		BodyEncoding string `json:"bodyEncoding"`
+	}
+	if err := json.Unmarshal([]byte(got), &output); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if output.Method != http.MethodPut || output.Body != "AP8n" || output.BodyEncoding != "base64" {
+		t.Errorf("json: got %+v", output)
+	}
+
+	// The body can still be read after rendering
+	if body, _ := io.ReadAll(req.Body); len(body) != 3 {
+		t.Errorf("request body: got %v, want 3 bytes", body)
+	}
+}
@@ -50,6 +50,7 @@ func (s *DeviceEnrollmentService) Enroll(ctx context.Context, externalID string,
 	headers.Add("Authorization", NewBasicAuthString("", externalID, oneTimePassword))
 
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:   "DeviceEnrollment.Enroll",
 		Method:      "POST",
 		Path:        ".well-known/est/simpleenroll",
 		Header:      headers,
@@ -114,6 +115,7 @@ func (s *DeviceEnrollmentService) ReEnroll(ctx context.Context, opts ReEnrollOpt
 	headers.Add("Content-Transfer-Encoding", "base64")
 
 	resp, err := s.client.SendRequest(reqContext, RequestOptions{
+		Operation:   "DeviceEnrollment.ReEnroll",
 		Method:      "POST",
 		Path:        ".well-known/est/simplereenroll",
 		Header:      headers,
@@ -171,6 +173,7 @@ func (s *DeviceEnrollmentService) RequestAccessToken(ctx context.Context, client
 
 	data := new(AccessToken)
 	resp, err := deviceClient.SendRequest(context.Background(), RequestOptions{
+		Operation:    "DeviceEnrollment.RequestAccessToken",
 		Method:       http.MethodPost,
 		Path:         "devicecontrol/deviceAccessToken",
 		Host:         mtlsEndpoint(s.client.BaseURL),
@@ -0,0 +1,106 @@
+package c8y
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Error classes which can be used with errors.Is to check the type of error returned by the API
+var (
+	// ErrNotFound the item does not exist (404)
+	ErrNotFound = errors.New("item: not found")
+
+	// ErrUnauthorized the request is missing valid credentials (401)
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrForbidden the user does not have the required permissions (403)
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrConflict the item conflicts with an existing item, e.g. a duplicate (409)
+	ErrConflict = errors.New("conflict")
+
+	// ErrValidation the request was rejected due to invalid input (400, 422)
+	ErrValidation = errors.New("validation error")
+
+	// ErrRateLimited too many requests were sent (429)
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrServerError the server failed to process the request (5xx)
+	ErrServerError = errors.New("server error")
+)
+
+// Request ID headers which are checked (in order) to get the request ID of a failed request
+var RequestIDHeaders = []string{
+	"X-Request-Id",
+	"X-Correlation-Id",
+}
+
+// ErrorDetails additional error information returned by the server. Only available in DEBUG mode
+type ErrorDetails struct {
+	ExceptionClass      string `json:"exceptionClass,omitempty"`
+	ExceptionMessage    string `json:"exceptionMessage,omitempty"`
+	ExceptionStackTrace string `json:"exceptionStackTrace,omitempty"`
+}
+
+// StatusCode returns the HTTP status code of the response which caused the error
+func (r *ErrorResponse) StatusCode() int {
+	if r.Response == nil {
+		return 0
+	}
+	return r.Response.StatusCode()
+}
+
+// Kind returns the error class, e.g. ErrNotFound, or nil if the error does not belong to a known class
+func (r *ErrorResponse) Kind() error {
+	switch code := r.StatusCode(); {
+	case code == http.StatusNotFound:
+		return ErrNotFound
+	case code == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case code == http.StatusForbidden:
+		return ErrForbidden
+	case code == http.StatusConflict:
+		return ErrConflict
+	case code == http.StatusBadRequest || code == http.StatusUnprocessableEntity:
+		return ErrValidation
+	case code == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case code >= 500:
+		return ErrServerError
+	}
+
+	// Fallback to the error type, e.g. "inventory/notFound"
+	_, name, _ := strings.Cut(r.ErrorType, "/")
+	switch strings.ToLower(name) {
+	case "notfound":
+		return ErrNotFound
+	case "duplicate":
+		return ErrConflict
+	}
+	return nil
+}
+
+// Is reports whether the error belongs to the given error class, e.g. ErrNotFound
+func (r *ErrorResponse) Is(target error) bool {
+	kind := r.Kind()
+	return kind != nil && kind == target
+}
+
+// getRequestID returns the request ID of a response. The response headers are checked first
+// followed by the request headers
+func getRequestID(resp *http.Response) string {
+	for _, name := range RequestIDHeaders {
+		if v := resp.Header.Get(name); v != "" {
+			return v
+		}
+	}
+	if resp.Request != nil {
+		for _, name := range RequestIDHeaders {
+			if v := resp.Request.Header.Get(name); v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+package c8y
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckResponse_ErrorClasses(t *testing.T) {
+	testCases := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusForbidden, ErrForbidden},
+		{http.StatusConflict, ErrConflict},
+		{http.StatusUnprocessableEntity, ErrValidation},
+		{http.StatusBadRequest, ErrValidation},
+		{http.StatusTooManyRequests, ErrRateLimited},
+		{http.StatusServiceUnavailable, ErrServerError},
+	}
+
+	for _, tc := range testCases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Request-Id", "abc123")
+			w.WriteHeader(tc.status)
+			w.Write([]byte(`{"error":"inventory/example","message":"failed","details":{"exceptionClass":"Example"}}`))
+		}))
+
+		client := NewClientFromOptions(nil, ClientOptions{BaseURL: srv.URL})
+		_, _, err := client.Inventory.GetManagedObject(context.Background(), "12345", nil)
+		srv.Close()
+
+		if !errors.Is(err, tc.want) {
+			t.Errorf("status %d: got %v, want %v", tc.status, err, tc.want)
+		}
+
+		var apiErr *ErrorResponse
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("status %d: expected an *ErrorResponse", tc.status)
+		}
+		if apiErr.Method != http.MethodGet {
+			t.Errorf("method: got %q, want %q", apiErr.Method, http.MethodGet)
+		}
+		if apiErr.URL != srv.URL+"/inventory/managedObjects/12345" {
+			t.Errorf("url: got %q", apiErr.URL)
+		}
+		if apiErr.RequestID != "abc123" {
+			t.Errorf("request id: got %q, want %q", apiErr.RequestID, "abc123")
+		}
+		if apiErr.Details == nil || apiErr.Details.ExceptionClass != "Example" {
+			t.Errorf("details: got %v", apiErr.Details)
+		}
+	}
+}
+
+func TestErrorResponse_KindFromErrorType(t *testing.T) {
+	err := &ErrorResponse{ErrorType: "identity/Duplicate"}
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("duplicate error type should be a conflict")
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Errorf("duplicate error type should not be a not found error")
+	}
+	if errors.Is(&ErrorResponse{}, nil) {
+		t.Errorf("unknown error should not have a kind")
+	}
+}
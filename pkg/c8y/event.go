@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
 	"net/url"
 	"os"
@@ -11,7 +12,6 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/tidwall/gjson"
-	"go.uber.org/zap"
 )
 
 // EventService does something
@@ -61,6 +61,7 @@ type EventCollection struct {
 func (s *EventService) GetEvent(ctx context.Context, ID string) (*Event, *Response, error) {
 	data := new(Event)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Event.GetEvent",
 		Method:       "GET",
 		Path:         "event/events/" + ID,
 		ResponseData: data,
@@ -72,6 +73,7 @@ func (s *EventService) GetEvent(ctx context.Context, ID string) (*Event, *Respon
 func (s *EventService) GetEvents(ctx context.Context, opt *EventCollectionOptions) (*EventCollection, *Response, error) {
 	data := new(EventCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Event.GetEvents",
 		Method:       "GET",
 		Path:         "event/events",
 		Query:        opt,
@@ -80,10 +82,22 @@ func (s *EventService) GetEvents(ctx context.Context, opt *EventCollectionOption
 	return data, resp, err
 }
 
+// IterEvents returns an iterator over all events matching the given options. Pages are fetched
+// lazily by following the .next links. See Paginate for more details
+func (s *EventService) IterEvents(ctx context.Context, opt *EventCollectionOptions, limits PaginateLimits) iter.Seq2[Event, error] {
+	return Paginate[Event](ctx, s.client, RequestOptions{
+		Operation: "Event.IterEvents",
+		Method:    "GET",
+		Path:      "event/events",
+		Query:     opt,
+	}, "events", limits)
+}
+
 // Create creates a new event object
 func (s *EventService) Create(ctx context.Context, body interface{}) (*Event, *Response, error) {
 	data := new(Event)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Event.Create",
 		Method:       "POST",
 		Path:         "event/events",
 		Body:         body,
@@ -96,6 +110,7 @@ func (s *EventService) Create(ctx context.Context, body interface{}) (*Event, *R
 func (s *EventService) Update(ctx context.Context, ID string, body interface{}) (*Event, *Response, error) {
 	data := new(Event)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Event.Update",
 		Method:       "PUT",
 		Path:         "event/events/" + ID,
 		Body:         body,
@@ -107,17 +122,19 @@ func (s *EventService) Update(ctx context.Context, ID string, body interface{})
 // Delete event by its ID
 func (s *EventService) Delete(ctx context.Context, ID string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "event/events/" + ID,
+		Operation: "Event.Delete",
+		Method:    "DELETE",
+		Path:      "event/events/" + ID,
 	})
 }
 
 // DeleteEvents removes a collection of events based on the given filters
 func (s *EventService) DeleteEvents(ctx context.Context, opt *EventCollectionOptions) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "event/events",
-		Query:  opt,
+		Operation: "Event.DeleteEvents",
+		Method:    "DELETE",
+		Path:      "event/events",
+		Query:     opt,
 	})
 }
 
@@ -128,9 +145,9 @@ func (s *EventService) DownloadBinary(ctx context.Context, ID string) (filepath
 	client := s.client
 	u := "event/events/" + ID + "/binaries"
 
-	req, err := s.client.NewRequest("GET", u, "", nil)
+	req, err := s.client.NewRequestWithContext(ctx, "GET", u, "", nil)
 	if err != nil {
-		zap.S().Errorf("Could not create request. %s", err)
+		NewLoggerFromContext(ctx).Errorf("Could not create request. %s", err)
 		return
 	}
 
@@ -152,7 +169,7 @@ func (s *EventService) DownloadBinary(ctx context.Context, ID string) (filepath
 	defer out.Close()
 
 	// Get the data
-	resp, err := client.Do(ctx, req, out)
+	resp, err := client.Do(withOperation(ctx, "Event.DownloadBinary"), req, out)
 	if err != nil {
 		os.RemoveAll(tempDir)
 		return "", err
@@ -187,10 +204,16 @@ func (s *EventService) CreateBinary(ctx context.Context, filename string, ID str
 	req, err := prepareMultipartRequest("POST", u.String(), values)
 	if err != nil {
 		err = errors.Wrap(err, "Could not create binary upload request object")
-		zap.S().Error(err)
+		NewLoggerFromContext(ctx).Error(err)
+		return nil, nil, err
+	}
+	defer req.Body.(*multipartBody).closeValues()
+	req = req.WithContext(ctx)
+
+	if _, err := s.client.SetAuthorization(req); err != nil {
+		NewLoggerFromContext(ctx).Error(err)
 		return nil, nil, err
 	}
-	s.client.SetAuthorization(req)
 
 	req.Header.Set("Accept", "application/json")
 
@@ -225,6 +248,7 @@ func (s *EventService) UpdateBinary(ctx context.Context, ID, filename string) (*
 
 	data := new(EventBinary)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Event.UpdateBinary",
 		Method:       "PUT",
 		Path:         "event/events/" + ID + "/binaries",
 		ContentType:  "application/octet-stream",
@@ -237,7 +261,8 @@ func (s *EventService) UpdateBinary(ctx context.Context, ID, filename string) (*
 // DeleteBinary removes binary file associated to an event
 func (s *EventService) DeleteBinary(ctx context.Context, ID string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "event/events/" + ID + "/binaries",
+		Operation: "Event.DeleteBinary",
+		Method:    "DELETE",
+		Path:      "event/events/" + ID + "/binaries",
 	})
 }
@@ -54,6 +54,7 @@ type FeaturesService service
 func (s *FeaturesService) GetFeatures(ctx context.Context) ([]FeatureToggle, *Response, error) {
 	data := make([]FeatureToggle, 0)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Features.GetFeatures",
 		Method:       http.MethodGet,
 		Path:         "features",
 		ResponseData: &data,
@@ -65,6 +66,7 @@ func (s *FeaturesService) GetFeatures(ctx context.Context) ([]FeatureToggle, *Re
 func (s *FeaturesService) GetFeature(ctx context.Context, key string) (*FeatureToggle, *Response, error) {
 	data := new(FeatureToggle)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Features.GetFeature",
 		Method:       http.MethodGet,
 		Path:         "features/" + key,
 		ResponseData: data,
@@ -75,8 +77,9 @@ func (s *FeaturesService) GetFeature(ctx context.Context, key string) (*FeatureT
 // Enable a feature in the current tenant
 func (s *FeaturesService) Enable(ctx context.Context, key string) (*Response, error) {
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: http.MethodPut,
-		Path:   "features/" + key + "/by-tenant",
+		Operation: "Features.Enable",
+		Method:    http.MethodPut,
+		Path:      "features/" + key + "/by-tenant",
 		Body: FeatureToggle{
 			Active: true,
 		},
@@ -87,8 +90,9 @@ func (s *FeaturesService) Enable(ctx context.Context, key string) (*Response, er
 // Disable a feature in the current tenant
 func (s *FeaturesService) Disable(ctx context.Context, key string) (*Response, error) {
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: http.MethodPut,
-		Path:   "features/" + key + "/by-tenant",
+		Operation: "Features.Disable",
+		Method:    http.MethodPut,
+		Path:      "features/" + key + "/by-tenant",
 		Body: FeatureToggle{
 			Active: false,
 		},
@@ -99,9 +103,10 @@ func (s *FeaturesService) Disable(ctx context.Context, key string) (*Response, e
 // Update a feature toggle in the current tenant
 func (s *FeaturesService) Update(ctx context.Context, key string, toggle FeatureToggle) (*Response, error) {
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: http.MethodPut,
-		Path:   "features/" + key + "/by-tenant",
-		Body:   toggle,
+		Operation: "Features.Update",
+		Method:    http.MethodPut,
+		Path:      "features/" + key + "/by-tenant",
+		Body:      toggle,
 	})
 	return resp, err
 }
@@ -109,8 +114,9 @@ func (s *FeaturesService) Update(ctx context.Context, key string, toggle Feature
 // Delete a feature toggle in the current tenant
 func (s *FeaturesService) Delete(ctx context.Context, key string, body *Tenant) (*Response, error) {
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: http.MethodDelete,
-		Path:   "features/" + key + "/by-tenant",
+		Operation: "Features.Delete",
+		Method:    http.MethodDelete,
+		Path:      "features/" + key + "/by-tenant",
 	})
 	return resp, err
 }
@@ -124,6 +130,7 @@ func (s *FeaturesService) Delete(ctx context.Context, key string, body *Tenant)
 func (s *FeaturesService) GetFeatureByTenant(ctx context.Context, key string) (*FeatureToggle, *Response, error) {
 	data := new(FeatureToggle)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Features.GetFeatureByTenant",
 		Method:       http.MethodGet,
 		Path:         "features/" + key + "/by-tenant",
 		ResponseData: &data,
@@ -135,8 +142,9 @@ func (s *FeaturesService) GetFeatureByTenant(ctx context.Context, key string) (*
 // Should be called from the management tenant
 func (s *FeaturesService) EnableByTenant(ctx context.Context, key string, tenantID string) (*Response, error) {
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: http.MethodPut,
-		Path:   "features/" + key + "/by-tenant/" + tenantID,
+		Operation: "Features.EnableByTenant",
+		Method:    http.MethodPut,
+		Path:      "features/" + key + "/by-tenant/" + tenantID,
 		Body: FeatureToggle{
 			Active: true,
 		},
@@ -148,8 +156,9 @@ func (s *FeaturesService) EnableByTenant(ctx context.Context, key string, tenant
 // Should be called from the management tenant
 func (s *FeaturesService) DisableByTenant(ctx context.Context, key string, tenantID string) (*Response, error) {
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: http.MethodPut,
-		Path:   "features/" + key + "/by-tenant/" + tenantID,
+		Operation: "Features.DisableByTenant",
+		Method:    http.MethodPut,
+		Path:      "features/" + key + "/by-tenant/" + tenantID,
 		Body: FeatureToggle{
 			Active: false,
 		},
@@ -161,9 +170,10 @@ func (s *FeaturesService) DisableByTenant(ctx context.Context, key string, tenan
 // Should be called from the management tenant
 func (s *FeaturesService) UpdateByTenant(ctx context.Context, key string, toggle FeatureToggle, tenantID string) (*Response, error) {
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: http.MethodPut,
-		Path:   "features/" + key + "/by-tenant/" + tenantID,
-		Body:   toggle,
+		Operation: "Features.UpdateByTenant",
+		Method:    http.MethodPut,
+		Path:      "features/" + key + "/by-tenant/" + tenantID,
+		Body:      toggle,
 	})
 	return resp, err
 }
@@ -172,8 +182,9 @@ func (s *FeaturesService) UpdateByTenant(ctx context.Context, key string, toggle
 // Should be called from the management tenant
 func (s *FeaturesService) DeleteByTenant(ctx context.Context, key string, tenantID string) (*Response, error) {
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: http.MethodDelete,
-		Path:   "features/" + key + "/by-tenant/" + tenantID,
+		Operation: "Features.DeleteByTenant",
+		Method:    http.MethodDelete,
+		Path:      "features/" + key + "/by-tenant/" + tenantID,
 	})
 	return resp, err
 }
@@ -2,7 +2,6 @@ package c8y
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/reubenmiller/go-c8y/pkg/c8y/binary"
 )
@@ -67,7 +66,10 @@ func (s *InventoryFirmwareService) GetFirmwareByName(ctx context.Context, name s
 	}
 
 	opt := &ManagedObjectOptions{
-		Query:             fmt.Sprintf("$filter=(name eq '%s') and type eq '%s' $orderby=name,creationTime", name, FragmentFirmware),
+		Query: NewInventoryQuery(QueryEq("name", name), QueryEq("type", FragmentFirmware)).
+			OrderByAsc("name").
+			OrderByAsc("creationTime").
+			String(),
 		PaginationOptions: *paging,
 	}
 	return s.client.Inventory.GetManagedObjects(ctx, opt)
@@ -96,7 +98,10 @@ func (s *InventoryFirmwareService) GetFirmwareVersionsByName(ctx context.Context
 	}
 
 	opt := &ManagedObjectOptions{
-		Query:             fmt.Sprintf("$filter=(c8y_Firmware.version eq '%s') and bygroupid(%s) $orderby=c8y_Firmware.version,creationTime", name, firmware),
+		Query: NewInventoryQuery(QueryEq("c8y_Firmware.version", name), QueryByGroupID(firmware)).
+			OrderByAsc("c8y_Firmware.version").
+			OrderByAsc("creationTime").
+			String(),
 		PaginationOptions: *paging,
 		WithParents:       withParents,
 	}
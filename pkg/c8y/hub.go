@@ -1,68 +1,92 @@
 package c8y
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 // Hub maintains the set of active subscriptions and broadcasts messages to the clients.
 type Hub struct {
+	mu sync.RWMutex
+
 	// Registered clients.
 	clients map[*subscription]bool
-
-	// Inbound messages from the clients.
-	broadcast chan *Message
-
-	// Register requests from the clients.
-	register chan *subscription
-
-	// Unregister requests from clients by channel name.
-	unregister chan string
-
-	// Return a channel of channels
-	getChannels chan chan string
-
-	channels sync.Map
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		broadcast:  make(chan *Message),
-		register:   make(chan *subscription),
-		unregister: make(chan string),
-		clients:    make(map[*subscription]bool),
-
-		getChannels: make(chan chan string),
+		clients: make(map[*subscription]bool),
 	}
 }
 
 // GetActiveChannels returns the list of active channels which are currently subscribed to
 func (h *Hub) GetActiveChannels() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
 	channels := []string{}
-	h.channels.Range(func(key, value interface{}) bool {
-		channels = append(channels, key.(string))
-		return true
-	})
+	unique := map[string]bool{}
+	for client := range h.clients {
+		if channel := client.glob.String(); !unique[channel] {
+			unique[channel] = true
+			channels = append(channels, channel)
+		}
+	}
 	return channels
 }
 
-func (h *Hub) Run() {
-	for {
+func (h *Hub) register(client *subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[client] = true
+}
+
+// unregister removes the clients with the same channel pattern
+func (h *Hub) unregister(channel string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		if client.glob.String() == channel {
+			delete(h.clients, client)
+			client.close()
+		}
+	}
+}
+
+// remove removes a single client, and returns true if other clients are still using the same channel pattern
+func (h *Hub) remove(client *subscription) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		client.close()
+	}
+	for other := range h.clients {
+		if other.glob.String() == client.glob.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcast sends the message to all matching clients. It blocks until each client has received
+// the message, has been removed, or the context is done
+func (h *Hub) broadcast(ctx context.Context, message *Message) {
+	h.mu.RLock()
+	clients := make([]*subscription, 0, len(h.clients))
+	for client := range h.clients {
+		if ((client.isWildcard && client.glob.MatchString(message.Channel)) || client.glob.String() == message.Channel) && !client.disabled {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
 		select {
-		case client := <-h.register:
-			h.clients[client] = true
-			h.channels.Store(client.glob.String(), true)
-		case channel := <-h.unregister:
-			// Delete clients with the same channel pattern
-			h.channels.Delete(channel)
-			for client := range h.clients {
-				if client.glob.String() == channel {
-					delete(h.clients, client)
-				}
-			}
-		case message := <-h.broadcast:
-			for client := range h.clients {
-				if ((client.isWildcard && client.glob.MatchString(message.Channel)) || client.glob.String() == message.Channel) && !client.disabled {
-					client.out <- message
-				}
-			}
+		case client.out <- message:
+		case <-client.done:
+		case <-ctx.Done():
+			return
 		}
 	}
 }
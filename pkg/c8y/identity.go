@@ -40,6 +40,7 @@ func (s *IdentityService) Create(ctx context.Context, ID string, identityType st
 		ExternalID: externalID,
 	}
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Identity.Create",
 		Method:       "POST",
 		Path:         fmt.Sprintf("identity/globalIds/%s/externalIds", ID),
 		Body:         body,
@@ -54,6 +55,7 @@ func (s *IdentityService) Create(ctx context.Context, ID string, identityType st
 func (s *IdentityService) GetExternalID(ctx context.Context, identityType string, externalID string) (*Identity, *Response, error) {
 	data := new(Identity)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Identity.GetExternalID",
 		Method:       "GET",
 		Path:         fmt.Sprintf("identity/externalIds/%s/%s", identityType, externalID),
 		ResponseData: data,
@@ -64,7 +66,8 @@ func (s *IdentityService) GetExternalID(ctx context.Context, identityType string
 // Delete removes an existing external id
 func (s *IdentityService) Delete(ctx context.Context, identityType, externalID string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   fmt.Sprintf("identity/externalIds/%s/%s", identityType, externalID),
+		Operation: "Identity.Delete",
+		Method:    "DELETE",
+		Path:      fmt.Sprintf("identity/externalIds/%s/%s", identityType, externalID),
 	})
 }
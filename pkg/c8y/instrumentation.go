@@ -0,0 +1,86 @@
+package c8y
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/reubenmiller/go-c8y/pkg/telemetry"
+)
+
+// SetInstrumentation sets the tracer and metrics used to instrument all requests
+// and the realtime client. Use nil to disable instrumentation
+func (c *Client) SetInstrumentation(instrumentation *telemetry.Instrumentation) {
+	c.clientMu.Lock()
+	c.instrumentation = instrumentation
+	c.clientMu.Unlock()
+
+	if c.Realtime != nil {
+		c.Realtime.SetInstrumentation(instrumentation)
+	}
+}
+
+func (c *Client) getInstrumentation() *telemetry.Instrumentation {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	return c.instrumentation
+}
+
+// doInstrumented sends the request within a span and records the request metrics
+func (c *Client) doInstrumented(ctx context.Context, instrumentation *telemetry.Instrumentation, req *http.Request, v interface{}, middleware ...RequestMiddleware) (*Response, error) {
+	operation := telemetry.OperationFromContext(ctx)
+	if operation == "" {
+		operation = "HTTP " + req.Method
+	}
+
+	ctx, span := instrumentation.Start(ctx, operation,
+		telemetry.String(telemetry.AttributeHTTPMethod, req.Method),
+		telemetry.String(telemetry.AttributeURL, sanitizeURL(req.URL).String()),
+	)
+	defer span.End()
+
+	for key, value := range instrumentation.Propagate(span) {
+		req.Header.Set(key, value)
+	}
+
+	start := time.Now()
+	resp, err := c.do(ctx, req, v, middleware...)
+	duration := time.Since(start)
+
+	tenant := c.requestTenant(req)
+
+	metric := telemetry.RequestMetric{
+		Operation: operation,
+		Method:    req.Method,
+		Tenant:    tenant,
+		Duration:  duration,
+		Err:       err,
+	}
+	attrs := []telemetry.Attribute{
+		telemetry.String(telemetry.AttributeTenant, tenant),
+	}
+	if resp != nil {
+		metric.StatusCode = resp.StatusCode()
+		metric.Retries = resp.Attempts() - 1
+		attrs = append(attrs,
+			telemetry.Int(telemetry.AttributeHTTPStatusCode, resp.StatusCode()),
+			telemetry.Int(telemetry.AttributeRetryCount, metric.Retries),
+			telemetry.Int(telemetry.AttributeDuration, int(resp.Duration().Milliseconds())),
+		)
+	}
+	span.SetAttributes(attrs...)
+	if err != nil {
+		span.RecordError(err)
+	}
+	instrumentation.RecordRequest(ctx, metric)
+	return resp, err
+}
+
+// withOperation returns a context with the operation name of the service method sending the request,
+// unless the context already sets an operation
+func withOperation(ctx context.Context, operation string) context.Context {
+	if operation == "" || telemetry.OperationFromContext(ctx) != "" {
+		return ctx
+	}
+	return telemetry.WithOperation(ctx, operation)
+}
@@ -0,0 +1,125 @@
+package c8y
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/reubenmiller/go-c8y/pkg/telemetry"
+)
+
+type testSpan struct {
+	name  string
+	attrs map[string]any
+	err   error
+	ended bool
+}
+
+func (s *testSpan) SetAttributes(attrs ...telemetry.Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+func (s *testSpan) RecordError(err error) { s.err = err }
+func (s *testSpan) End()                  { s.ended = true }
+func (s *testSpan) SpanContext() telemetry.SpanContext {
+	return telemetry.SpanContext{
+		TraceID: [16]byte{1},
+		SpanID:  [8]byte{2},
+		Sampled: true,
+	}
+}
+
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, attrs ...telemetry.Attribute) (context.Context, telemetry.Span) {
+	span := &testSpan{name: name, attrs: map[string]any{}}
+	span.SetAttributes(attrs...)
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return ctx, span
+}
+
+func TestInstrumentation_RequestSpan(t *testing.T) {
+	var traceParent string
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		traceParent = r.Header.Get("traceparent")
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"id":"1"}`))
+	}))
+	defer srv.Close()
+
+	tracer := &testTracer{}
+	client := NewClientFromOptions(nil, ClientOptions{
+		BaseURL:         srv.URL,
+		Tenant:          "t12345",
+		Username:        "user",
+		Password:        "pass",
+		Retry:           fastRetry(3),
+		Instrumentation: &telemetry.Instrumentation{Tracer: tracer},
+	})
+
+	if _, _, err := client.Inventory.GetManagedObject(context.Background(), "1", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("spans: got %d, want 1", len(tracer.spans))
+	}
+	span := tracer.spans[0]
+	if span.name != "Inventory.GetManagedObject" {
+		t.Errorf("span name: got %q, want %q", span.name, "Inventory.GetManagedObject")
+	}
+	if !span.ended {
+		t.Errorf("span should be ended")
+	}
+	if want := "00-01000000000000000000000000000000-0200000000000000-01"; traceParent != want {
+		t.Errorf("traceparent: got %q, want %q", traceParent, want)
+	}
+	if got := span.attrs[telemetry.AttributeHTTPStatusCode]; got != http.StatusOK {
+		t.Errorf("status code: got %v, want %d", got, http.StatusOK)
+	}
+	if got := span.attrs[telemetry.AttributeRetryCount]; got != 1 {
+		t.Errorf("retry count: got %v, want 1", got)
+	}
+	if got := span.attrs[telemetry.AttributeTenant]; got != "t12345" {
+		t.Errorf("tenant: got %v, want %q", got, "t12345")
+	}
+}
+
+func TestInstrumentation_OperationOverride(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	tracer := &testTracer{}
+	client := NewClientFromOptions(nil, ClientOptions{BaseURL: srv.URL})
+	client.SetInstrumentation(&telemetry.Instrumentation{Tracer: tracer})
+
+	ctx := telemetry.WithOperation(context.Background(), "Custom.Operation")
+	if _, err := client.SendRequest(ctx, RequestOptions{Method: http.MethodGet, Path: "inventory/managedObjects"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.SendRequest(context.Background(), RequestOptions{Method: http.MethodGet, Path: "inventory/managedObjects"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := tracer.spans[0].name; got != "Custom.Operation" {
+		t.Errorf("span name: got %q, want %q", got, "Custom.Operation")
+	}
+	if got := tracer.spans[1].name; got != "HTTP GET" {
+		t.Errorf("span name: got %q, want %q", got, "HTTP GET")
+	}
+}
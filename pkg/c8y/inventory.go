@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
 	"net/url"
 	"os"
@@ -14,7 +15,6 @@ import (
 	"github.com/reubenmiller/go-c8y/pkg/c8y/contentType"
 
 	"github.com/tidwall/gjson"
-	"go.uber.org/zap"
 )
 
 // DeviceFragmentName name of the c8yDevice Fragment property
@@ -36,8 +36,12 @@ type ManagedObjectOptions struct {
 	// Read-only collection of managed objects fetched for a given list of ids (placeholder {ids}),for example "?ids=41,43,68".
 	Ids []string `url:"ids,omitempty"`
 
+	// Query is an inventory query, e.g. "$filter=(name eq 'device01') $orderby=name". See NewInventoryQuery
 	Query string `url:"query,omitempty"`
 
+	// Q is a device query, which is the same as Query but only matches devices (has(c8y_IsDevice))
+	Q string `url:"q,omitempty"`
+
 	PaginationOptions
 }
 
@@ -242,7 +246,7 @@ type ManagedObjectReference struct {
 // GetDevicesByName returns managed object devices by filter by a name
 func (s *InventoryService) GetDevicesByName(ctx context.Context, name string, paging *PaginationOptions) (*ManagedObjectCollection, *Response, error) {
 	opt := &ManagedObjectOptions{
-		Query:             fmt.Sprintf("(name eq '%s') and has(%s)", name, DeviceFragmentName),
+		Query:             NewInventoryQuery(QueryEq("name", name), QueryHas(DeviceFragmentName)).String(),
 		PaginationOptions: *paging,
 	}
 	return s.GetManagedObjects(ctx, opt)
@@ -257,6 +261,7 @@ func (s *InventoryService) GetDevices(ctx context.Context, paging *PaginationOpt
 
 	data := new(ManagedObjectCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Inventory.GetDevices",
 		Method:       "GET",
 		Path:         "inventory/managedObjects",
 		Query:        opt,
@@ -269,6 +274,7 @@ func (s *InventoryService) GetDevices(ctx context.Context, paging *PaginationOpt
 func (s *InventoryService) GetManagedObject(ctx context.Context, ID string, opt *ManagedObjectOptions) (*ManagedObject, *Response, error) {
 	data := new(ManagedObject)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Inventory.GetManagedObject",
 		Method:       "GET",
 		Path:         "inventory/managedObjects/" + ID,
 		Query:        opt,
@@ -281,6 +287,7 @@ func (s *InventoryService) GetManagedObject(ctx context.Context, ID string, opt
 func (s *InventoryService) GetManagedObjects(ctx context.Context, opt *ManagedObjectOptions) (*ManagedObjectCollection, *Response, error) {
 	data := new(ManagedObjectCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Inventory.GetManagedObjects",
 		Method:       "GET",
 		Path:         "inventory/managedObjects",
 		Query:        opt,
@@ -289,10 +296,22 @@ func (s *InventoryService) GetManagedObjects(ctx context.Context, opt *ManagedOb
 	return data, resp, err
 }
 
+// IterManagedObjects returns an iterator over all managed objects matching the given options. Pages are fetched
+// lazily by following the .next links. See Paginate for more details
+func (s *InventoryService) IterManagedObjects(ctx context.Context, opt *ManagedObjectOptions, limits PaginateLimits) iter.Seq2[ManagedObject, error] {
+	return Paginate[ManagedObject](ctx, s.client, RequestOptions{
+		Operation: "Inventory.IterManagedObjects",
+		Method:    "GET",
+		Path:      "inventory/managedObjects",
+		Query:     opt,
+	}, "managedObjects", limits)
+}
+
 // GetSupportedSeries returns the supported series for a give device
 func (s *InventoryService) GetSupportedSeries(ctx context.Context, id string) (*SupportedSeries, *Response, error) {
 	data := new(SupportedSeries)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Inventory.GetSupportedSeries",
 		Method:       "GET",
 		Path:         fmt.Sprintf("/inventory/managedObjects/%s/supportedSeries", id),
 		ResponseData: data,
@@ -305,6 +324,7 @@ func (s *InventoryService) GetSupportedSeries(ctx context.Context, id string) (*
 func (s *InventoryService) GetSupportedMeasurements(ctx context.Context, id string) (*SupportedMeasurements, *Response, error) {
 	data := new(SupportedMeasurements)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Inventory.GetSupportedMeasurements",
 		Method:       "GET",
 		Path:         fmt.Sprintf("/inventory/managedObjects/%s/supportedMeasurements", id),
 		ResponseData: data,
@@ -317,6 +337,7 @@ func (s *InventoryService) GetSupportedMeasurements(ctx context.Context, id stri
 func (s *InventoryService) GetChildDevices(ctx context.Context, id string, opt *PaginationOptions) (*ManagedObjectReferencesCollection, *Response, error) {
 	data := new(ManagedObjectReferencesCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Inventory.GetChildDevices",
 		Method:       "GET",
 		Path:         fmt.Sprintf("inventory/managedObjects/%s/childDevices", id),
 		Query:        opt,
@@ -330,6 +351,7 @@ func (s *InventoryService) GetChildDevices(ctx context.Context, id string, opt *
 func (s *InventoryService) GetChildAdditions(ctx context.Context, id string, opt *ManagedObjectOptions) (*ManagedObjectReferencesCollection, *Response, error) {
 	data := new(ManagedObjectReferencesCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Inventory.GetChildAdditions",
 		Method:       "GET",
 		Path:         fmt.Sprintf("inventory/managedObjects/%s/childAdditions", id),
 		Query:        opt,
@@ -342,6 +364,7 @@ func (s *InventoryService) GetChildAdditions(ctx context.Context, id string, opt
 func (s *InventoryService) GetChildAssets(ctx context.Context, id string, opt *ManagedObjectOptions) (*ManagedObjectReferencesCollection, *Response, error) {
 	data := new(ManagedObjectReferencesCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Inventory.GetChildAssets",
 		Method:       "GET",
 		Path:         fmt.Sprintf("inventory/managedObjects/%s/childAssets", id),
 		Query:        opt,
@@ -355,6 +378,7 @@ func (s *InventoryService) GetChildAssets(ctx context.Context, id string, opt *M
 func (s *InventoryService) Update(ctx context.Context, ID string, body interface{}) (*ManagedObject, *Response, error) {
 	data := new(ManagedObject)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Inventory.Update",
 		Method:       "PUT",
 		Path:         "inventory/managedObjects/" + ID,
 		Body:         body,
@@ -372,6 +396,7 @@ func (s *InventoryService) CreateDevice(ctx context.Context, name string) (*Mana
 func (s *InventoryService) Create(ctx context.Context, body interface{}) (*ManagedObject, *Response, error) {
 	data := new(ManagedObject)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Inventory.Create",
 		Method:       "POST",
 		Path:         "inventory/managedObjects",
 		Body:         body,
@@ -383,8 +408,9 @@ func (s *InventoryService) Create(ctx context.Context, body interface{}) (*Manag
 // Delete removes a managed object by ID
 func (s *InventoryService) Delete(ctx context.Context, ID string) (*Response, error) {
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "inventory/managedObjects/" + ID,
+		Operation: "Inventory.Delete",
+		Method:    "DELETE",
+		Path:      "inventory/managedObjects/" + ID,
 	})
 
 	return resp, err
@@ -393,9 +419,10 @@ func (s *InventoryService) Delete(ctx context.Context, ID string) (*Response, er
 // Delete a managed object with additional options
 func (s *InventoryService) DeleteWithOptions(ctx context.Context, ID string, options *ManagedObjectDeleteOptions) (*Response, error) {
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "inventory/managedObjects/" + ID,
-		Query:  options,
+		Operation: "Inventory.DeleteWithOptions",
+		Method:    "DELETE",
+		Path:      "inventory/managedObjects/" + ID,
+		Query:     options,
 	})
 
 	return resp, err
@@ -409,16 +436,16 @@ func (s *InventoryService) DownloadBinary(ctx context.Context, ID string) (filep
 	mo, _, err := client.Inventory.GetManagedObject(ctx, ID, nil)
 
 	if err != nil {
-		zap.S().Errorf("Could not retrieve managed object. %s", err)
+		NewLoggerFromContext(ctx).Errorf("Could not retrieve managed object. %s", err)
 		return
 	}
 
 	u := "inventory/binaries/" + ID
 
 	// req, err := http.NewRequest("GET", u.String(), nil)
-	req, err := s.client.NewRequest("GET", u, "", nil)
+	req, err := s.client.NewRequestWithContext(ctx, "GET", u, "", nil)
 	if err != nil {
-		zap.S().Errorf("Could not create request. %s", err)
+		NewLoggerFromContext(ctx).Errorf("Could not create request. %s", err)
 		return
 	}
 
@@ -440,7 +467,7 @@ func (s *InventoryService) DownloadBinary(ctx context.Context, ID string) (filep
 	defer out.Close()
 
 	// Get the data
-	resp, err := client.Do(ctx, req, out)
+	resp, err := client.Do(withOperation(ctx, "Inventory.DownloadBinary"), req, out)
 	if err != nil {
 		os.RemoveAll(tempDir)
 		return "", err
@@ -472,10 +499,16 @@ func (s *InventoryService) CreateBinary(ctx context.Context, binaryFile binary.M
 	req, err := prepareMultipartRequest("POST", u.String(), values)
 	if err != nil {
 		err = errors.Wrap(err, "Could not create binary upload request object")
-		zap.S().Error(err)
+		NewLoggerFromContext(ctx).Error(err)
+		return nil, nil, err
+	}
+	defer req.Body.(*multipartBody).closeValues()
+	req = req.WithContext(ctx)
+
+	if _, err := s.client.SetAuthorization(req); err != nil {
+		NewLoggerFromContext(ctx).Error(err)
 		return nil, nil, err
 	}
-	s.client.SetAuthorization(req)
 
 	req.Header.Set("Accept", "application/json")
 
@@ -495,6 +528,7 @@ func (s *InventoryService) CreateBinary(ctx context.Context, binaryFile binary.M
 func (s *InventoryService) UpdateBinary(ctx context.Context, ID string, file io.Reader) (*ManagedObject, *Response, error) {
 	data := new(ManagedObject)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Inventory.UpdateBinary",
 		Method:       "PUT",
 		Path:         "inventory/binaries/" + ID,
 		ContentType:  "text/plain",
@@ -507,8 +541,9 @@ func (s *InventoryService) UpdateBinary(ctx context.Context, ID string, file io.
 // DeleteBinary removes a managed object Binary by ID
 func (s *InventoryService) DeleteBinary(ctx context.Context, ID string) (*Response, error) {
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "inventory/binaries/" + ID,
+		Operation: "Inventory.DeleteBinary",
+		Method:    "DELETE",
+		Path:      "inventory/binaries/" + ID,
 	})
 	return resp, err
 }
@@ -517,6 +552,7 @@ func (s *InventoryService) DeleteBinary(ctx context.Context, ID string) (*Respon
 func (s *InventoryService) GetBinaries(ctx context.Context, opt *ManagedObjectOptions) (*ManagedObjectCollection, *Response, error) {
 	data := new(ManagedObjectCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Inventory.GetBinaries",
 		Method:       "GET",
 		Path:         "inventory/binaries",
 		Query:        opt,
@@ -539,13 +575,14 @@ func (s *InventoryService) ExpandCollection(ctx context.Context, col *ManagedObj
 		urlObj, err := url.Parse(*out.Next)
 
 		if err != nil {
-			zap.S().Errorf("")
+			NewLoggerFromContext(ctx).Errorf("Could not parse next link. %s", err)
 			return
 		}
 
 		data := new(ManagedObjectCollection)
 
 		_, err = s.client.SendRequest(ctx, RequestOptions{
+			Operation:    "Inventory.ExpandCollection",
 			Path:         urlObj.Path,
 			Query:        urlObj.RawQuery,
 			ResponseData: data,
@@ -577,6 +614,7 @@ func (s *InventoryService) CreateChildAddition(ctx context.Context, ID string, b
 	data := new(ManagedObject)
 
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Inventory.CreateChildAddition",
 		Method:       "POST",
 		Path:         "inventory/managedObjects/" + ID + "/childAdditions",
 		ContentType:  contentType.ContentTypeManagedObject,
@@ -591,9 +629,10 @@ func (s *InventoryService) AddChildAddition(ctx context.Context, ID, childID str
 	data := new(ManagedObject)
 
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: "POST",
-		Accept: contentType.ContentTypeJSON,
-		Path:   "inventory/managedObjects/" + ID + "/childAdditions",
+		Operation: "Inventory.AddChildAddition",
+		Method:    "POST",
+		Accept:    contentType.ContentTypeJSON,
+		Path:      "inventory/managedObjects/" + ID + "/childAdditions",
 		Body: &ManagedObjectReference{
 			ManagedObject: ManagedObject{
 				ID: childID,
@@ -0,0 +1,775 @@
+package c8y
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidInventoryQuery is returned when an inventory query can't be parsed
+var ErrInvalidInventoryQuery = errors.New("invalid inventory query")
+
+// QueryDateFormat is the format of dates used in inventory queries
+const QueryDateFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// InventoryQuery is an inventory query, which can be built using NewInventoryQuery or parsed from an existing
+// query using ParseInventoryQuery. The string representation can be used for the ManagedObjectOptions Query and Q
+// parameters, e.g.
+//
+//	query := NewInventoryQuery(QueryName("linux*"), QueryHas("c8y_IsDevice")).OrderByDesc("creationTime")
+//	// $filter=(name eq 'linux*' and has(c8y_IsDevice)) $orderby=creationTime desc
+type InventoryQuery struct {
+	// Filter is the filter expression. All managed objects are matched if it is nil
+	Filter QueryExpr
+
+	// OrderBy are the properties used to sort the results
+	OrderBy []QueryOrder
+}
+
+// NewInventoryQuery returns a query matching all of the given filters
+func NewInventoryQuery(filters ...QueryExpr) *InventoryQuery {
+	return &InventoryQuery{
+		Filter: QueryAnd(filters...),
+	}
+}
+
+// Where adds filters which must also be matched
+func (q *InventoryQuery) Where(filters ...QueryExpr) *InventoryQuery {
+	q.Filter = QueryAnd(append([]QueryExpr{q.Filter}, filters...)...)
+	return q
+}
+
+// OrderByAsc sorts the results by the property in ascending order
+func (q *InventoryQuery) OrderByAsc(property string) *InventoryQuery {
+	q.OrderBy = append(q.OrderBy, QueryOrder{Property: property})
+	return q
+}
+
+// OrderByDesc sorts the results by the property in descending order
+func (q *InventoryQuery) OrderByDesc(property string) *InventoryQuery {
+	q.OrderBy = append(q.OrderBy, QueryOrder{Property: property, Descending: true})
+	return q
+}
+
+// String returns the query in the form of "$filter=(<filter>) $orderby=<properties>"
+func (q *InventoryQuery) String() string {
+	parts := make([]string, 0, 2)
+	if !isNilQueryExpr(q.Filter) {
+		parts = append(parts, "$filter=("+q.Filter.String()+")")
+	}
+	if len(q.OrderBy) > 0 {
+		orderBy := make([]string, 0, len(q.OrderBy))
+		for _, order := range q.OrderBy {
+			orderBy = append(orderBy, order.String())
+		}
+		parts = append(parts, "$orderby="+strings.Join(orderBy, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Validate checks if the query is valid, e.g. that the property names and function arguments don't contain
+// invalid characters. Property names and arguments are not escaped when building a query, so any values which are
+// not known in advance should be validated before the query is sent
+func (q *InventoryQuery) Validate() error {
+	if err := validateQueryExpr(q.Filter); err != nil {
+		return err
+	}
+	for _, order := range q.OrderBy {
+		if !isQueryToken(order.Property, queryTokenIdent) {
+			return fmt.Errorf("%w. invalid order by property %q", ErrInvalidInventoryQuery, order.Property)
+		}
+	}
+	_, err := ParseInventoryQuery(q.String())
+	return err
+}
+
+// validateQueryExpr checks that the identifiers and arguments of the expression can't change the
+// structure of the query, e.g. QueryHas("a) or has(b")
+func validateQueryExpr(expr QueryExpr) error {
+	switch e := expr.(type) {
+	case *QueryComparison:
+		if e == nil {
+			return nil
+		}
+		if !isQueryToken(e.Property, queryTokenIdent) {
+			return fmt.Errorf("%w. invalid property %q", ErrInvalidInventoryQuery, e.Property)
+		}
+	case *QueryFunction:
+		if e == nil {
+			return nil
+		}
+		if !isQueryToken(e.Name, queryTokenIdent) {
+			return fmt.Errorf("%w. invalid function name %q", ErrInvalidInventoryQuery, e.Name)
+		}
+		for _, arg := range e.Args {
+			if !isQueryToken(arg, queryTokenIdent, queryTokenNumber, queryTokenString) {
+				return fmt.Errorf("%w. invalid argument of %s(): %q", ErrInvalidInventoryQuery, e.Name, arg)
+			}
+		}
+	case *QueryLogical:
+		if e == nil {
+			return nil
+		}
+		for _, operand := range e.Operands {
+			if err := validateQueryExpr(operand); err != nil {
+				return err
+			}
+		}
+	case *QueryNegation:
+		if e == nil {
+			return nil
+		}
+		if isNilQueryExpr(e.Operand) {
+			return fmt.Errorf("%w. not() requires an operand", ErrInvalidInventoryQuery)
+		}
+		return validateQueryExpr(e.Operand)
+	}
+	return nil
+}
+
+// isQueryToken returns true if the value is a single token of one of the given kinds
+func isQueryToken(value string, kinds ...queryTokenKind) bool {
+	tokens, err := lexInventoryQuery(value)
+	if err != nil || len(tokens) != 2 || tokens[0].pos != 0 || len(strings.TrimSpace(value)) != len(value) {
+		return false
+	}
+	for _, kind := range kinds {
+		if tokens[0].kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryOrder is a property used to sort the results
+type QueryOrder struct {
+	Property   string
+	Descending bool
+}
+
+func (o QueryOrder) String() string {
+	if o.Descending {
+		return o.Property + " desc"
+	}
+	return o.Property
+}
+
+// QueryExpr is an expression of an inventory query filter
+type QueryExpr interface {
+	String() string
+
+	// precedence is used to decide if the expression needs to be wrapped in brackets
+	precedence() int
+}
+
+const (
+	queryPrecedenceOr = iota + 1
+	queryPrecedenceAnd
+	queryPrecedencePrimary
+)
+
+// QueryOperator is a comparison operator
+type QueryOperator string
+
+const (
+	QueryOperatorEq QueryOperator = "eq"
+	QueryOperatorNe QueryOperator = "ne"
+	QueryOperatorGt QueryOperator = "gt"
+	QueryOperatorGe QueryOperator = "ge"
+	QueryOperatorLt QueryOperator = "lt"
+	QueryOperatorLe QueryOperator = "le"
+)
+
+var queryOperators = map[string]QueryOperator{
+	"eq": QueryOperatorEq,
+	"ne": QueryOperatorNe,
+	"gt": QueryOperatorGt,
+	"ge": QueryOperatorGe,
+	"lt": QueryOperatorLt,
+	"le": QueryOperatorLe,
+}
+
+// QueryComparison compares a property with a value, e.g. name eq 'device01'
+type QueryComparison struct {
+	Property string
+	Operator QueryOperator
+	Value    QueryValue
+}
+
+func (e *QueryComparison) String() string {
+	return e.Property + " " + string(e.Operator) + " " + e.Value.String()
+}
+
+func (e *QueryComparison) precedence() int {
+	return queryPrecedencePrimary
+}
+
+// QueryFunction is a function call, e.g. has(c8y_IsDevice) or bygroupid(12345)
+type QueryFunction struct {
+	Name string
+
+	// Args are the arguments as they appear in the query
+	Args []string
+}
+
+func (e *QueryFunction) String() string {
+	return e.Name + "(" + strings.Join(e.Args, ",") + ")"
+}
+
+func (e *QueryFunction) precedence() int {
+	return queryPrecedencePrimary
+}
+
+// QueryLogical combines expressions using "and" or "or"
+type QueryLogical struct {
+	// Operator is either "and" or "or"
+	Operator string
+	Operands []QueryExpr
+}
+
+func (e *QueryLogical) String() string {
+	operands := make([]string, 0, len(e.Operands))
+	for _, operand := range e.Operands {
+		if operand.precedence() < e.precedence() {
+			operands = append(operands, "("+operand.String()+")")
+		} else {
+			operands = append(operands, operand.String())
+		}
+	}
+	return strings.Join(operands, " "+e.Operator+" ")
+}
+
+func (e *QueryLogical) precedence() int {
+	if e.Operator == "or" {
+		return queryPrecedenceOr
+	}
+	return queryPrecedenceAnd
+}
+
+// QueryNegation negates an expression, e.g. not(has(c8y_IsDevice))
+type QueryNegation struct {
+	Operand QueryExpr
+}
+
+func (e *QueryNegation) String() string {
+	if e == nil || isNilQueryExpr(e.Operand) {
+		return ""
+	}
+	return "not(" + e.Operand.String() + ")"
+}
+
+func (e *QueryNegation) precedence() int {
+	return queryPrecedencePrimary
+}
+
+// QueryValueKind is the type of a value
+type QueryValueKind int
+
+const (
+	QueryValueString QueryValueKind = iota
+	QueryValueNumber
+	QueryValueBool
+	QueryValueNull
+)
+
+// QueryValue is a value which is compared to a property
+type QueryValue struct {
+	Kind QueryValueKind
+
+	// Value is the unquoted value
+	Value string
+}
+
+// String returns the value as it is used in a query. Strings are quoted
+func (v QueryValue) String() string {
+	switch v.Kind {
+	case QueryValueString:
+		return QueryQuote(v.Value)
+	case QueryValueNull:
+		return "null"
+	default:
+		return v.Value
+	}
+}
+
+// NewQueryValue converts the value to a query value. Dates (time.Time and Timestamp) are formatted
+// in UTC using QueryDateFormat. Values of other types are converted to strings
+func NewQueryValue(value any) QueryValue {
+	switch v := value.(type) {
+	case QueryValue:
+		return v
+	case nil:
+		return QueryValue{Kind: QueryValueNull}
+	case string:
+		return QueryValue{Kind: QueryValueString, Value: v}
+	case bool:
+		return QueryValue{Kind: QueryValueBool, Value: strconv.FormatBool(v)}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return QueryValue{Kind: QueryValueNumber, Value: fmt.Sprintf("%d", v)}
+	case float32:
+		return QueryValue{Kind: QueryValueNumber, Value: strconv.FormatFloat(float64(v), 'f', -1, 32)}
+	case float64:
+		return QueryValue{Kind: QueryValueNumber, Value: strconv.FormatFloat(v, 'f', -1, 64)}
+	case json.Number:
+		return QueryValue{Kind: QueryValueNumber, Value: v.String()}
+	case time.Time:
+		return QueryValue{Kind: QueryValueString, Value: v.UTC().Format(QueryDateFormat)}
+	case Timestamp:
+		return QueryValue{Kind: QueryValueString, Value: v.UTC().Format(QueryDateFormat)}
+	case *Timestamp:
+		return QueryValue{Kind: QueryValueString, Value: v.UTC().Format(QueryDateFormat)}
+	default:
+		return QueryValue{Kind: QueryValueString, Value: fmt.Sprint(v)}
+	}
+}
+
+// QueryQuote quotes a string value. Single quotes are escaped by doubling them
+func QueryQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func queryComparison(property string, operator QueryOperator, value any) *QueryComparison {
+	return &QueryComparison{
+		Property: property,
+		Operator: operator,
+		Value:    NewQueryValue(value),
+	}
+}
+
+// QueryEq matches managed objects where the property is equal to the value. A "*" in a string value
+// matches any characters, e.g. QueryEq("name", "linux*")
+func QueryEq(property string, value any) *QueryComparison {
+	return queryComparison(property, QueryOperatorEq, value)
+}
+
+// QueryNe matches managed objects where the property is not equal to the value
+func QueryNe(property string, value any) *QueryComparison {
+	return queryComparison(property, QueryOperatorNe, value)
+}
+
+// QueryGt matches managed objects where the property is greater than the value. Dates are compared using the
+// .date property, e.g. QueryGt("creationTime.date", time.Now().Add(-time.Hour))
+func QueryGt(property string, value any) *QueryComparison {
+	return queryComparison(property, QueryOperatorGt, value)
+}
+
+// QueryGe matches managed objects where the property is greater than or equal to the value
+func QueryGe(property string, value any) *QueryComparison {
+	return queryComparison(property, QueryOperatorGe, value)
+}
+
+// QueryLt matches managed objects where the property is less than the value
+func QueryLt(property string, value any) *QueryComparison {
+	return queryComparison(property, QueryOperatorLt, value)
+}
+
+// QueryLe matches managed objects where the property is less than or equal to the value
+func QueryLe(property string, value any) *QueryComparison {
+	return queryComparison(property, QueryOperatorLe, value)
+}
+
+// QueryName matches managed objects by name, where "*" matches any characters
+func QueryName(pattern string) *QueryComparison {
+	return QueryEq("name", pattern)
+}
+
+// QueryHas matches managed objects which have the fragment. The fragment is not escaped, so use
+// InventoryQuery.Validate if it is not known in advance
+func QueryHas(fragment string) *QueryFunction {
+	return &QueryFunction{Name: "has", Args: []string{fragment}}
+}
+
+// QueryByGroupID matches the managed objects which are children of the group. The id is not escaped, so use
+// InventoryQuery.Validate if it is not known in advance
+func QueryByGroupID(id string) *QueryFunction {
+	return &QueryFunction{Name: "bygroupid", Args: []string{id}}
+}
+
+// QueryAnd matches managed objects matching all of the expressions. Nil expressions are ignored,
+// and nil is returned if there are no expressions
+func QueryAnd(exprs ...QueryExpr) QueryExpr {
+	return queryLogical("and", exprs)
+}
+
+// QueryOr matches managed objects matching any of the expressions. Nil expressions are ignored,
+// and nil is returned if there are no expressions
+func QueryOr(exprs ...QueryExpr) QueryExpr {
+	return queryLogical("or", exprs)
+}
+
+func queryLogical(operator string, exprs []QueryExpr) QueryExpr {
+	operands := make([]QueryExpr, 0, len(exprs))
+	for _, expr := range exprs {
+		if isNilQueryExpr(expr) {
+			continue
+		}
+		// Flatten nested expressions using the same operator
+		if logical, ok := expr.(*QueryLogical); ok && logical.Operator == operator {
+			operands = append(operands, logical.Operands...)
+			continue
+		}
+		operands = append(operands, expr)
+	}
+	switch len(operands) {
+	case 0:
+		return nil
+	case 1:
+		return operands[0]
+	}
+	return &QueryLogical{Operator: operator, Operands: operands}
+}
+
+// QueryNot matches managed objects which don't match the expression. nil is returned if the expression is nil
+func QueryNot(expr QueryExpr) QueryExpr {
+	if isNilQueryExpr(expr) {
+		return nil
+	}
+	return &QueryNegation{Operand: expr}
+}
+
+// isNilQueryExpr returns true if the expression is nil, including typed nil pointers
+func isNilQueryExpr(expr QueryExpr) bool {
+	switch v := expr.(type) {
+	case nil:
+		return true
+	case *QueryComparison:
+		return v == nil
+	case *QueryFunction:
+		return v == nil
+	case *QueryLogical:
+		return v == nil
+	case *QueryNegation:
+		return v == nil
+	}
+	return false
+}
+
+// ParseInventoryQuery parses an inventory query, e.g. "$filter=(name eq 'device01') $orderby=name".
+// The "$filter=" prefix is optional, so plain filter expressions can also be parsed
+func ParseInventoryQuery(query string) (*InventoryQuery, error) {
+	tokens, err := lexInventoryQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	return p.parseQuery()
+}
+
+type queryTokenKind int
+
+const (
+	queryTokenEOF queryTokenKind = iota
+	queryTokenIdent
+	queryTokenString
+	queryTokenNumber
+	queryTokenLParen
+	queryTokenRParen
+	queryTokenComma
+	queryTokenFilter
+	queryTokenOrderBy
+)
+
+type queryToken struct {
+	kind  queryTokenKind
+	value string
+	pos   int
+}
+
+func (t queryToken) String() string {
+	switch t.kind {
+	case queryTokenEOF:
+		return "end of query"
+	case queryTokenString:
+		return QueryQuote(t.value)
+	}
+	return fmt.Sprintf("%q", t.value)
+}
+
+// isKeyword returns true if the token is the given (case-insensitive) keyword
+func (t queryToken) isKeyword(keyword string) bool {
+	return t.kind == queryTokenIdent && strings.EqualFold(t.value, keyword)
+}
+
+func queryError(pos int, format string, a ...any) error {
+	return fmt.Errorf("%w. %s at position %d", ErrInvalidInventoryQuery, fmt.Sprintf(format, a...), pos)
+}
+
+func isQueryIdentStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isQueryIdentPart(c byte) bool {
+	return isQueryIdentStart(c) || isQueryDigit(c) || c == '.' || c == '-'
+}
+
+func isQueryDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func lexInventoryQuery(query string) ([]queryToken, error) {
+	tokens := make([]queryToken, 0)
+	for i := 0; i < len(query); {
+		c := query[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: queryTokenLParen, value: "(", pos: start})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{kind: queryTokenRParen, value: ")", pos: start})
+			i++
+		case c == ',':
+			tokens = append(tokens, queryToken{kind: queryTokenComma, value: ",", pos: start})
+			i++
+		case c == '\'':
+			value := strings.Builder{}
+			closed := false
+			for i++; i < len(query); i++ {
+				if query[i] == '\'' {
+					if i+1 < len(query) && query[i+1] == '\'' {
+						value.WriteByte('\'')
+						i++
+						continue
+					}
+					closed = true
+					i++
+					break
+				}
+				value.WriteByte(query[i])
+			}
+			if !closed {
+				return nil, queryError(start, "unterminated string")
+			}
+			tokens = append(tokens, queryToken{kind: queryTokenString, value: value.String(), pos: start})
+		case hasPrefixFold(query[i:], "$filter="):
+			tokens = append(tokens, queryToken{kind: queryTokenFilter, value: query[i : i+8], pos: start})
+			i += len("$filter=")
+		case hasPrefixFold(query[i:], "$orderby="):
+			tokens = append(tokens, queryToken{kind: queryTokenOrderBy, value: query[i : i+9], pos: start})
+			i += len("$orderby=")
+		case isQueryDigit(c) || (c == '-' && i+1 < len(query) && isQueryDigit(query[i+1])):
+			for i++; i < len(query) && (isQueryDigit(query[i]) || strings.IndexByte(".eE+-", query[i]) >= 0); i++ {
+			}
+			if _, err := strconv.ParseFloat(query[start:i], 64); err != nil {
+				return nil, queryError(start, "invalid number %q", query[start:i])
+			}
+			tokens = append(tokens, queryToken{kind: queryTokenNumber, value: query[start:i], pos: start})
+		case isQueryIdentStart(c):
+			for i++; i < len(query) && isQueryIdentPart(query[i]); i++ {
+			}
+			tokens = append(tokens, queryToken{kind: queryTokenIdent, value: query[start:i], pos: start})
+		default:
+			return nil, queryError(start, "unexpected character %q", c)
+		}
+	}
+	return append(tokens, queryToken{kind: queryTokenEOF, pos: len(query)}), nil
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// queryParser is a recursive descent parser of the inventory query language. "and" takes precedence over "or"
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) peekAt(offset int) queryToken {
+	if p.pos+offset < len(p.tokens) {
+		return p.tokens[p.pos+offset]
+	}
+	return p.tokens[len(p.tokens)-1]
+}
+
+func (p *queryParser) next() queryToken {
+	token := p.tokens[p.pos]
+	if token.kind != queryTokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+func (p *queryParser) expect(kind queryTokenKind, description string) (queryToken, error) {
+	token := p.next()
+	if token.kind != kind {
+		return token, queryError(token.pos, "expected %s but found %s", description, token)
+	}
+	return token, nil
+}
+
+func (p *queryParser) parseQuery() (*InventoryQuery, error) {
+	query := &InventoryQuery{}
+	switch token := p.peek(); token.kind {
+	case queryTokenFilter:
+		p.next()
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		query.Filter = filter
+	case queryTokenOrderBy, queryTokenEOF:
+	default:
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		query.Filter = filter
+	}
+
+	if p.peek().kind == queryTokenOrderBy {
+		p.next()
+		for {
+			property, err := p.expect(queryTokenIdent, "a property")
+			if err != nil {
+				return nil, err
+			}
+			order := QueryOrder{Property: property.value}
+			if token := p.peek(); token.isKeyword("desc") {
+				order.Descending = true
+				p.next()
+			} else if token.isKeyword("asc") {
+				p.next()
+			}
+			query.OrderBy = append(query.OrderBy, order)
+			if p.peek().kind != queryTokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if token := p.peek(); token.kind != queryTokenEOF {
+		return nil, queryError(token.pos, "unexpected %s", token)
+	}
+	return query, nil
+}
+
+func (p *queryParser) parseOr() (QueryExpr, error) {
+	return p.parseLogical("or", p.parseAnd)
+}
+
+func (p *queryParser) parseAnd() (QueryExpr, error) {
+	return p.parseLogical("and", p.parseUnary)
+}
+
+func (p *queryParser) parseLogical(operator string, parseOperand func() (QueryExpr, error)) (QueryExpr, error) {
+	operands := make([]QueryExpr, 0, 1)
+	for {
+		operand, err := parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+		if !p.peek().isKeyword(operator) {
+			break
+		}
+		p.next()
+	}
+	return queryLogical(operator, operands), nil
+}
+
+func (p *queryParser) parseUnary() (QueryExpr, error) {
+	if p.peek().isKeyword("not") && p.peekAt(1).kind == queryTokenLParen {
+		p.next()
+		p.next()
+		operand, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(queryTokenRParen, `")"`); err != nil {
+			return nil, err
+		}
+		return QueryNot(operand), nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (QueryExpr, error) {
+	token := p.next()
+	switch token.kind {
+	case queryTokenLParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(queryTokenRParen, `")"`); err != nil {
+			return nil, err
+		}
+		return expr, nil
+
+	case queryTokenIdent:
+		if p.peek().kind == queryTokenLParen {
+			p.next()
+			return p.parseFunction(token)
+		}
+		operator := p.next()
+		op, ok := queryOperators[strings.ToLower(operator.value)]
+		if operator.kind != queryTokenIdent || !ok {
+			return nil, queryError(operator.pos, "expected an operator (eq, ne, gt, ge, lt, le) but found %s", operator)
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return &QueryComparison{
+			Property: token.value,
+			Operator: op,
+			Value:    value,
+		}, nil
+	}
+	return nil, queryError(token.pos, "expected an expression but found %s", token)
+}
+
+func (p *queryParser) parseFunction(name queryToken) (QueryExpr, error) {
+	function := &QueryFunction{Name: name.value, Args: []string{}}
+	if p.peek().kind == queryTokenRParen {
+		p.next()
+		return function, nil
+	}
+	for {
+		arg := p.next()
+		switch arg.kind {
+		case queryTokenIdent, queryTokenNumber:
+			function.Args = append(function.Args, arg.value)
+		case queryTokenString:
+			function.Args = append(function.Args, QueryQuote(arg.value))
+		default:
+			return nil, queryError(arg.pos, "expected an argument of %s() but found %s", name.value, arg)
+		}
+		separator := p.next()
+		if separator.kind == queryTokenRParen {
+			return function, nil
+		}
+		if separator.kind != queryTokenComma {
+			return nil, queryError(separator.pos, `expected "," or ")" but found %s`, separator)
+		}
+	}
+}
+
+func (p *queryParser) parseValue() (QueryValue, error) {
+	token := p.next()
+	switch token.kind {
+	case queryTokenString:
+		return QueryValue{Kind: QueryValueString, Value: token.value}, nil
+	case queryTokenNumber:
+		return QueryValue{Kind: QueryValueNumber, Value: token.value}, nil
+	case queryTokenIdent:
+		switch strings.ToLower(token.value) {
+		case "true", "false":
+			return QueryValue{Kind: QueryValueBool, Value: strings.ToLower(token.value)}, nil
+		case "null":
+			return QueryValue{Kind: QueryValueNull}, nil
+		}
+	}
+	return QueryValue{}, queryError(token.pos, "expected a value but found %s", token)
+}
@@ -0,0 +1,185 @@
+package c8y
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInventoryQuery_String(t *testing.T) {
+	since := time.Date(2024, 3, 1, 12, 30, 0, 0, time.FixedZone("CET", 3600))
+	tests := map[string]struct {
+		query *InventoryQuery
+		want  string
+	}{
+		"empty": {
+			query: NewInventoryQuery(),
+			want:  "",
+		},
+		"comparison and has": {
+			query: NewInventoryQuery(QueryName("linux*"), QueryHas("c8y_IsDevice")),
+			want:  "$filter=(name eq 'linux*' and has(c8y_IsDevice))",
+		},
+		"quoting": {
+			query: NewInventoryQuery(QueryEq("name", "it's a 'test'")),
+			want:  "$filter=(name eq 'it''s a ''test''')",
+		},
+		"values": {
+			query: NewInventoryQuery(QueryGt("c8y_Battery.level", 20), QueryLe("c8y_Temperature.value", 1.5), QueryNe("c8y_Active", true), QueryEq("owner", nil)),
+			want:  "$filter=(c8y_Battery.level gt 20 and c8y_Temperature.value le 1.5 and c8y_Active ne true and owner eq null)",
+		},
+		"dates": {
+			query: NewInventoryQuery(QueryGe("creationTime.date", since), QueryLt("lastUpdated.date", NewTimestamp(since.Add(time.Hour)))),
+			want:  "$filter=(creationTime.date ge '2024-03-01T11:30:00.000Z' and lastUpdated.date lt '2024-03-01T12:30:00.000Z')",
+		},
+		"or inside and": {
+			query: NewInventoryQuery(QueryOr(QueryEq("type", "a"), QueryEq("type", "b")), QueryNot(QueryHas("c8y_IsDevice"))),
+			want:  "$filter=((type eq 'a' or type eq 'b') and not(has(c8y_IsDevice)))",
+		},
+		"and inside or": {
+			query: NewInventoryQuery(QueryOr(QueryAnd(QueryByGroupID("12345"), QueryHas("c8y_IsDevice")), QueryEq("id", "1"))),
+			want:  "$filter=(bygroupid(12345) and has(c8y_IsDevice) or id eq '1')",
+		},
+		"nil filters are ignored": {
+			query: NewInventoryQuery(nil, QueryHas("c8y_IsDevice")).Where(nil),
+			want:  "$filter=(has(c8y_IsDevice))",
+		},
+		"where and order by": {
+			query: NewInventoryQuery(QueryHas("c8y_IsDevice")).Where(QueryEq("type", "linux")).OrderByAsc("name").OrderByDesc("creationTime"),
+			want:  "$filter=(has(c8y_IsDevice) and type eq 'linux') $orderby=name,creationTime desc",
+		},
+		"order by only": {
+			query: NewInventoryQuery().OrderByDesc("lastUpdated"),
+			want:  "$orderby=lastUpdated desc",
+		},
+	}
+	for name, test := range tests {
+		got := test.query.String()
+		if got != test.want {
+			t.Errorf("%s: got %s, want %s", name, got, test.want)
+		}
+		if err := test.query.Validate(); err != nil {
+			t.Errorf("%s: unexpected validation error: %v", name, err)
+		}
+	}
+}
+
+func TestParseInventoryQuery(t *testing.T) {
+	tests := map[string]struct {
+		query string
+		want  string
+	}{
+		"filter and order by": {
+			query: "$filter=(name eq 'device01') and type eq 'c8y_Firmware' $orderby=name,creationTime",
+			want:  "$filter=(name eq 'device01' and type eq 'c8y_Firmware') $orderby=name,creationTime",
+		},
+		"without filter prefix": {
+			query: "(name eq 'it''s') and has(c8y_IsDevice)",
+			want:  "$filter=(name eq 'it''s' and has(c8y_IsDevice))",
+		},
+		"precedence": {
+			query: "$filter=type eq 'a' or type eq 'b' and not(has(c8y_IsDevice) or bygroupid(1))",
+			want:  "$filter=(type eq 'a' or type eq 'b' and not(has(c8y_IsDevice) or bygroupid(1)))",
+		},
+		"brackets are kept": {
+			query: "$filter=(type eq 'a' or type eq 'b') and c8y_Battery.level GT -1.5",
+			want:  "$filter=((type eq 'a' or type eq 'b') and c8y_Battery.level gt -1.5)",
+		},
+		"order direction": {
+			query: "$orderby=name asc, creationTime DESC",
+			want:  "$orderby=name,creationTime desc",
+		},
+		"empty": {
+			query: "  ",
+			want:  "",
+		},
+	}
+	for name, test := range tests {
+		query, err := ParseInventoryQuery(test.query)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if got := query.String(); got != test.want {
+			t.Errorf("%s: got %s, want %s", name, got, test.want)
+		}
+	}
+
+	query, err := ParseInventoryQuery("$filter=(c8y_Active eq true and bygroupid(12345))")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logical, ok := query.Filter.(*QueryLogical)
+	if !ok || logical.Operator != "and" || len(logical.Operands) != 2 {
+		t.Fatalf("filter: got %#v, want an and expression with 2 operands", query.Filter)
+	}
+	if comparison, ok := logical.Operands[0].(*QueryComparison); !ok || comparison.Property != "c8y_Active" || comparison.Operator != QueryOperatorEq || comparison.Value.Kind != QueryValueBool {
+		t.Errorf("comparison: got %#v", logical.Operands[0])
+	}
+	if function, ok := logical.Operands[1].(*QueryFunction); !ok || function.Name != "bygroupid" || len(function.Args) != 1 || function.Args[0] != "12345" {
+		t.Errorf("function: got %#v", logical.Operands[1])
+	}
+}
+
+func TestParseInventoryQuery_Errors(t *testing.T) {
+	tests := map[string]string{
+		"unterminated string": "name eq 'device01",
+		"missing operator":    "name 'device01'",
+		"unknown operator":    "name like 'device01'",
+		"missing value":       "name eq",
+		"missing bracket":     "(name eq 'a' and has(c8y_IsDevice)",
+		"trailing operator":   "name eq 'a' and",
+		"invalid character":   "name eq \"a\"",
+		"trailing tokens":     "$filter=(name eq 'a') name",
+		"empty order by":      "$orderby=",
+	}
+	for name, query := range tests {
+		if _, err := ParseInventoryQuery(query); !errors.Is(err, ErrInvalidInventoryQuery) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrInvalidInventoryQuery)
+		}
+	}
+
+	invalid := map[string]*InventoryQuery{
+		"property with spaces":     NewInventoryQuery(QueryEq("name with spaces", "a")),
+		"property injection":       NewInventoryQuery(QueryEq("name eq 'a' or name", "b")),
+		"has injection":            NewInventoryQuery(QueryHas("x) or has(y")),
+		"has with brackets":        NewInventoryQuery(QueryHas("c8y_IsDevice)")),
+		"bygroupid injection":      NewInventoryQuery(QueryByGroupID("1) or bygroupid(2")),
+		"bygroupid with spaces":    NewInventoryQuery(QueryByGroupID("1 2")),
+		"empty fragment":           NewInventoryQuery(QueryHas("")),
+		"nested invalid":           NewInventoryQuery(QueryNot(QueryOr(QueryHas("a"), QueryHas("b c")))),
+		"order by injection":       NewInventoryQuery().OrderByAsc("name,creationTime desc"),
+		"function name injection":  NewInventoryQuery(&QueryFunction{Name: "has(a) or has", Args: []string{"b"}}),
+		"property with whitespace": NewInventoryQuery(QueryEq(" name", "a")),
+	}
+	for name, query := range invalid {
+		if err := query.Validate(); !errors.Is(err, ErrInvalidInventoryQuery) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrInvalidInventoryQuery)
+		}
+	}
+}
+
+func TestInventoryQuery_NotWithoutOperand(t *testing.T) {
+	if expr := QueryNot(nil); expr != nil {
+		t.Errorf("QueryNot(nil): got %v, want nil", expr)
+	}
+	if expr := QueryNot(QueryAnd()); expr != nil {
+		t.Errorf("QueryNot(QueryAnd()): got %v, want nil", expr)
+	}
+	if expr := QueryNot((*QueryFunction)(nil)); expr != nil {
+		t.Errorf("QueryNot(typed nil): got %v, want nil", expr)
+	}
+
+	query := NewInventoryQuery(QueryNot(QueryAnd()), QueryHas("c8y_IsDevice"))
+	if got, want := query.String(), "$filter=(has(c8y_IsDevice))"; got != want {
+		t.Errorf("String: got %q, want %q", got, want)
+	}
+	if err := query.Validate(); err != nil {
+		t.Errorf("Validate: unexpected error %v", err)
+	}
+
+	query = NewInventoryQuery(&QueryNegation{})
+	if err := query.Validate(); !errors.Is(err, ErrInvalidInventoryQuery) {
+		t.Errorf("Validate: got %v, want %v", err, ErrInvalidInventoryQuery)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"iter"
 	"strings"
 	"time"
 
@@ -73,6 +74,7 @@ type Measurements struct {
 func (s *MeasurementService) GetMeasurements(ctx context.Context, opt *MeasurementCollectionOptions) (*MeasurementCollection, *Response, error) {
 	data := new(MeasurementCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Measurement.GetMeasurements",
 		Method:       "GET",
 		Path:         "measurement/measurements",
 		Query:        opt,
@@ -81,12 +83,24 @@ func (s *MeasurementService) GetMeasurements(ctx context.Context, opt *Measureme
 	return data, resp, err
 }
 
+// IterMeasurements returns an iterator over all measurements matching the given options. Pages are fetched
+// lazily by following the .next links. See Paginate for more details
+func (s *MeasurementService) IterMeasurements(ctx context.Context, opt *MeasurementCollectionOptions, limits PaginateLimits) iter.Seq2[Measurement, error] {
+	return Paginate[Measurement](ctx, s.client, RequestOptions{
+		Operation: "Measurement.IterMeasurements",
+		Method:    "GET",
+		Path:      "measurement/measurements",
+		Query:     opt,
+	}, "measurements", limits)
+}
+
 // DeleteMeasurements removes a measurement collection
 func (s *MeasurementService) DeleteMeasurements(ctx context.Context, opt *MeasurementCollectionOptions) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "measurement/measurements",
-		Query:  opt,
+		Operation: "Measurement.DeleteMeasurements",
+		Method:    "DELETE",
+		Path:      "measurement/measurements",
+		Query:     opt,
 	})
 }
 
@@ -285,14 +299,14 @@ func (s *MeasurementService) GetMeasurementSeries(ctx context.Context, opt *Meas
 
 	Logger.Infof("query Parameters: %s", queryParams)
 
-	req, err := s.client.NewRequest("GET", u, queryParams, nil)
+	req, err := s.client.NewRequestWithContext(ctx, "GET", u, queryParams, nil)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	data := new(MeasurementSeriesGroup)
 
-	resp, err := s.client.Do(ctx, req, data)
+	resp, err := s.client.Do(withOperation(ctx, "Measurement.GetMeasurementSeries"), req, data)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -309,6 +323,7 @@ func (s *MeasurementService) GetMeasurementSeries(ctx context.Context, opt *Meas
 func (s *MeasurementService) GetMeasurement(ctx context.Context, ID string) (*Measurement, *Response, error) {
 	data := new(Measurement)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Measurement.GetMeasurement",
 		Method:       "GET",
 		Path:         "measurement/measurements/" + ID,
 		ResponseData: data,
@@ -321,8 +336,9 @@ func (s *MeasurementService) GetMeasurement(ctx context.Context, ID string) (*Me
 // when using the time series feature. Use `DeleteMeasurements` instead
 func (s *MeasurementService) Delete(ctx context.Context, ID string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "measurement/measurements/" + ID,
+		Operation: "Measurement.Delete",
+		Method:    "DELETE",
+		Path:      "measurement/measurements/" + ID,
 	})
 }
 
@@ -372,6 +388,7 @@ func (d *MeasurementSeriesGroup) MarshalCSV(delimiter string) ([]byte, error) {
 func (s *MeasurementService) Create(ctx context.Context, body MeasurementRepresentation) (*Measurement, *Response, error) {
 	data := new(Measurement)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Measurement.Create",
 		Method:       "POST",
 		Path:         "measurement/measurements",
 		Body:         body,
@@ -384,6 +401,7 @@ func (s *MeasurementService) Create(ctx context.Context, body MeasurementReprese
 func (s *MeasurementService) CreateMeasurements(ctx context.Context, body *Measurements) (*Measurements, *Response, error) {
 	data := new(Measurements)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Measurement.CreateMeasurements",
 		Method:       "POST",
 		Path:         "measurement/measurements",
 		ContentType:  "application/vnd.com.nsn.cumulocity.measurementCollection+json",
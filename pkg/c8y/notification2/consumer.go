@@ -0,0 +1,421 @@
+package notification2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// AckMode controls when a message is acknowledged
+type AckMode int
+
+const (
+	// AckModeAuto acknowledges the message once the handler returns without an error
+	AckModeAuto AckMode = iota
+
+	// AckModeManual leaves it to the handler to acknowledge the message using Delivery.Ack
+	AckModeManual
+
+	// AckModeBatch acknowledges the messages once the handler returns without an error, but the
+	// acknowledgements are collected and sent once BatchSize is reached or every BatchInterval
+	AckModeBatch
+)
+
+const (
+	// DefaultConsumerMaxAttempts is the default number of times the handler is called before the message is dead-lettered
+	DefaultConsumerMaxAttempts = 3
+
+	// DefaultConsumerBatchSize is the default number of acknowledgements sent in one batch
+	DefaultConsumerBatchSize = 100
+
+	// DefaultConsumerBatchInterval is the default maximum time an acknowledgement is delayed in batch mode
+	DefaultConsumerBatchInterval = time.Second
+
+	// DefaultConsumerRetryDelay is the default delay before calling the handler again after it failed
+	DefaultConsumerRetryDelay = time.Second
+
+	// DefaultConsumerRedeliveryWindow is the default number of message identifiers remembered to detect redeliveries
+	DefaultConsumerRedeliveryWindow = 10000
+)
+
+// ErrConsumerRunning is returned when starting a consumer which is already running
+var ErrConsumerRunning = errors.New("consumer is already running")
+
+// ErrHandlerPanic is returned when the handler panics whilst processing a message
+var ErrHandlerPanic = errors.New("handler panicked")
+
+// Handler processes a message. The message is not acknowledged if an error is returned (or the handler panics),
+// and the handler will be called again until the maximum attempts have been reached
+type Handler func(ctx context.Context, message Message) error
+
+// DeadLetterHandler is called with a message which could not be processed and the last handler error.
+// The message is acknowledged if it returns nil, otherwise the message is left unacknowledged so that it is redelivered
+type DeadLetterHandler func(ctx context.Context, message Message, err error) error
+
+// ConsumerOptions controls how messages are processed and acknowledged
+type ConsumerOptions struct {
+	// Pattern the messages are filtered by, e.g. a source id. Defaults to all messages
+	Pattern string
+
+	AckMode AckMode
+
+	// Concurrency is the maximum number of messages which are handled at the same time. Defaults to 1.
+	// Messages with the same ordering key are always handled in the order they were received
+	Concurrency int
+
+	// OrderingKey returns the key used to preserve the order of messages. Defaults to the message source (description)
+	OrderingKey func(Message) string
+
+	// MaxAttempts is the number of times the handler is called before the message is passed to the DeadLetter handler
+	MaxAttempts int
+
+	// RetryDelay is the delay between handler attempts
+	RetryDelay time.Duration
+
+	// DeadLetter is called when the handler failed MaxAttempts times. If nil, then the message is not acknowledged
+	DeadLetter DeadLetterHandler
+
+	// BatchSize and BatchInterval control when the acknowledgements are sent in AckModeBatch
+	BatchSize     int
+	BatchInterval time.Duration
+
+	// RedeliveryWindow is the number of message identifiers remembered to detect redelivered messages
+	RedeliveryWindow int
+}
+
+// Delivery contains information about the delivery of a message, and is available to the handler via DeliveryFromContext
+type Delivery struct {
+	// Attempt is the number of times the handler has been called with the message during this delivery (starting at 1)
+	Attempt int
+
+	// Redelivered is true if the message has already been received before, e.g. because it was not acknowledged in time
+	Redelivered bool
+
+	// Deliveries is the number of times the message has been received
+	Deliveries int
+
+	consumer   *Consumer
+	identifier []byte
+	acked      bool
+	mu         sync.Mutex
+}
+
+// Ack acknowledges the message. It only needs to be called when using AckModeManual, and can be called again if it fails
+func (d *Delivery) Ack() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.acked {
+		return nil
+	}
+	if err := d.consumer.client.SendMessageAck(d.identifier); err != nil {
+		return err
+	}
+	d.acked = true
+	return nil
+}
+
+func (d *Delivery) isAcked() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.acked
+}
+
+type deliveryKey struct{}
+
+// DeliveryFromContext returns the delivery information of the message being handled
+func DeliveryFromContext(ctx context.Context) (*Delivery, bool) {
+	delivery, ok := ctx.Value(deliveryKey{}).(*Delivery)
+	return delivery, ok
+}
+
+// Consumer processes the messages received by a notification2 client with at-least-once semantics.
+// Messages are only acknowledged after they have been processed
+type Consumer struct {
+	client  *Notification2Client
+	handler Handler
+	options ConsumerOptions
+
+	running sync.Mutex
+
+	// ready is closed once the consumer has registered with the client
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	// deliveries counts how often each of the recent message identifiers has been received
+	mu         sync.Mutex
+	deliveries map[string]int
+	recent     []string
+
+	// pending acknowledgements in batch mode
+	ackMu       sync.Mutex
+	pendingAcks [][]byte
+}
+
+// NewConsumer creates a consumer which calls the handler for each message received by the client
+func NewConsumer(client *Notification2Client, handler Handler, options ConsumerOptions) *Consumer {
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1
+	}
+	if options.OrderingKey == nil {
+		options.OrderingKey = func(m Message) string {
+			return string(m.Description)
+		}
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = DefaultConsumerMaxAttempts
+	}
+	if options.RetryDelay <= 0 {
+		options.RetryDelay = DefaultConsumerRetryDelay
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultConsumerBatchSize
+	}
+	if options.BatchInterval <= 0 {
+		options.BatchInterval = DefaultConsumerBatchInterval
+	}
+	if options.RedeliveryWindow <= 0 {
+		options.RedeliveryWindow = DefaultConsumerRedeliveryWindow
+	}
+	if options.Pattern == "" {
+		options.Pattern = SourceWildcard
+	}
+	return &Consumer{
+		client:     client,
+		handler:    handler,
+		options:    options,
+		deliveries: make(map[string]int),
+		ready:      make(chan struct{}),
+	}
+}
+
+// Ready returns a channel which is closed once the consumer receives the client's messages. Connect
+// the client after it is closed, otherwise messages received in the meantime are not handled until they are redelivered
+func (c *Consumer) Ready() <-chan struct{} {
+	return c.ready
+}
+
+// Consume processes the messages using the handler until the ctx is done. See NewConsumer
+func (c *Notification2Client) Consume(ctx context.Context, handler Handler, options ConsumerOptions) error {
+	return NewConsumer(c, handler, options).Run(ctx)
+}
+
+// Run processes the messages until the ctx is done. It waits for the handlers to return, and sends
+// any pending acknowledgements before returning
+func (c *Consumer) Run(ctx context.Context) error {
+	if !c.running.TryLock() {
+		return ErrConsumerRunning
+	}
+	defer c.running.Unlock()
+
+	in := make(chan Message)
+	subscription := &ClientSubscription{
+		Pattern: c.options.Pattern,
+		Out:     in,
+	}
+	c.client.hub.register <- subscription
+	defer c.unregister(subscription, in)
+	c.readyOnce.Do(func() { close(c.ready) })
+
+	// Each worker handles the messages of a subset of the ordering keys, so that messages with
+	// the same key are handled in order
+	var wg sync.WaitGroup
+	queues := make([]chan Message, c.options.Concurrency)
+	for i := range queues {
+		queues[i] = make(chan Message, 1)
+		wg.Add(1)
+		go func(queue <-chan Message) {
+			defer wg.Done()
+			for message := range queue {
+				c.process(ctx, message)
+			}
+		}(queues[i])
+	}
+
+	var flushDone chan struct{}
+	if c.options.AckMode == AckModeBatch {
+		flushDone = make(chan struct{})
+		go func() {
+			defer close(flushDone)
+			c.flushPeriodically(ctx)
+		}()
+	}
+
+	func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message := <-in:
+				select {
+				case queues[c.worker(message)] <- message:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+
+	if flushDone != nil {
+		<-flushDone
+		c.flush()
+	}
+	return nil
+}
+
+// unregister removes the subscription from the hub. Messages are discarded (and not acknowledged)
+// until the hub has removed the subscription, as the hub could be blocked sending to it
+func (c *Consumer) unregister(subscription *ClientSubscription, in <-chan Message) {
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-in:
+			case <-done:
+				return
+			}
+		}
+	}()
+	c.client.hub.unregister <- subscription
+	close(done)
+}
+
+func (c *Consumer) worker(message Message) int {
+	if c.options.Concurrency == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(c.options.OrderingKey(message)))
+	return int(h.Sum32() % uint32(c.options.Concurrency))
+}
+
+// received records the delivery of the message, and returns the number of times it has been received
+func (c *Consumer) received(identifier []byte) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := string(identifier)
+	count, ok := c.deliveries[id]
+	if !ok {
+		c.recent = append(c.recent, id)
+		if len(c.recent) > c.options.RedeliveryWindow {
+			delete(c.deliveries, c.recent[0])
+			c.recent = c.recent[1:]
+		}
+	}
+	c.deliveries[id] = count + 1
+	return count + 1
+}
+
+func (c *Consumer) process(ctx context.Context, message Message) {
+	deliveries := c.received(message.Identifier)
+	delivery := &Delivery{
+		Redelivered: deliveries > 1,
+		Deliveries:  deliveries,
+		consumer:    c,
+		identifier:  message.Identifier,
+	}
+	if delivery.Redelivered {
+		Logger.Infof("Message has been redelivered. id=%s, deliveries=%d", message.Identifier, deliveries)
+	}
+	handlerCtx := context.WithValue(ctx, deliveryKey{}, delivery)
+
+	var err error
+	for attempt := 1; attempt <= c.options.MaxAttempts; attempt++ {
+		delivery.Attempt = attempt
+		if err = c.handle(handlerCtx, message); err == nil {
+			c.ack(delivery)
+			return
+		}
+		Logger.Warnf("Failed to handle message. id=%s, attempt=%d, err=%s", message.Identifier, attempt, err)
+		if attempt == c.options.MaxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			// Leave the message unacknowledged so that it is redelivered
+			return
+		case <-time.After(c.options.RetryDelay):
+		}
+	}
+
+	if c.options.DeadLetter == nil {
+		Logger.Warnf("Message could not be processed and will be redelivered. id=%s", message.Identifier)
+		return
+	}
+	if dlErr := c.options.DeadLetter(handlerCtx, message, err); dlErr != nil {
+		Logger.Warnf("Dead-letter handler failed, message will be redelivered. id=%s, err=%s", message.Identifier, dlErr)
+		return
+	}
+	if err := delivery.Ack(); err != nil {
+		Logger.Warnf("Failed to acknowledge dead-lettered message. id=%s, err=%s", message.Identifier, err)
+	}
+}
+
+// handle calls the handler, and converts a panic to an error so that it counts as a failed attempt
+func (c *Consumer) handle(ctx context.Context, message Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w. %v", ErrHandlerPanic, r)
+		}
+	}()
+	return c.handler(ctx, message)
+}
+
+// ack acknowledges a successfully handled message according to the ack mode
+func (c *Consumer) ack(delivery *Delivery) {
+	switch c.options.AckMode {
+	case AckModeManual:
+		if !delivery.isAcked() {
+			Logger.Debugf("Message was not acknowledged by the handler. id=%s", delivery.identifier)
+		}
+	case AckModeBatch:
+		delivery.mu.Lock()
+		delivery.acked = true
+		delivery.mu.Unlock()
+		c.ackMu.Lock()
+		c.pendingAcks = append(c.pendingAcks, delivery.identifier)
+		full := len(c.pendingAcks) >= c.options.BatchSize
+		c.ackMu.Unlock()
+		if full {
+			c.flush()
+		}
+	default:
+		if err := delivery.Ack(); err != nil {
+			Logger.Warnf("Failed to acknowledge message. id=%s, err=%s", delivery.identifier, err)
+		}
+	}
+}
+
+func (c *Consumer) flushPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(c.options.BatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.flush()
+		}
+	}
+}
+
+// flush sends the pending acknowledgements
+func (c *Consumer) flush() {
+	c.ackMu.Lock()
+	pending := c.pendingAcks
+	c.pendingAcks = nil
+	c.ackMu.Unlock()
+
+	for _, identifier := range pending {
+		if err := c.client.SendMessageAck(identifier); err != nil {
+			Logger.Warnf("Failed to acknowledge message. id=%s, err=%s", identifier, err)
+		}
+	}
+}
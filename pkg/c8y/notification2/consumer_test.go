@@ -0,0 +1,252 @@
+package notification2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/reubenmiller/go-c8y/internal/pkg/testingutils"
+)
+
+// newConsumerTestServer sends the frames to each client, and returns the received acknowledgements
+func newConsumerTestServer(t *testing.T, frames []string) (*httptest.Server, <-chan string) {
+	acks := make(chan string, 100)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for _, frame := range frames {
+			if err := ws.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+				return
+			}
+		}
+		for {
+			_, message, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			acks <- string(message)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, acks
+}
+
+func frame(id, source, payload string) string {
+	return fmt.Sprintf("%s\n/t12345/measurements/%s\nCREATE\n\n%s", id, source, payload)
+}
+
+// connectAfterConsuming connects once the consumer is ready, as the server sends the messages straight away
+func connectAfterConsuming(t *testing.T, client *Notification2Client, consumer *Consumer) {
+	t.Helper()
+	select {
+	case <-consumer.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the consumer to be ready")
+	}
+	testingutils.Ok(t, client.Connect())
+}
+
+func collectAcks(t *testing.T, acks <-chan string, count int) map[string]int {
+	t.Helper()
+	received := map[string]int{}
+	for i := 0; i < count; i++ {
+		select {
+		case ack := <-acks:
+			received[ack]++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for acks: got %v, want %d", received, count)
+		}
+	}
+	return received
+}
+
+func Test_ConsumerOrderingAndDeadLetter(t *testing.T) {
+	srv, acks := newConsumerTestServer(t, []string{
+		frame("a1", "A", `{"seq":1}`),
+		frame("b1", "B", `{"seq":1}`),
+		frame("a2", "A", `{"seq":2}`),
+		frame("bad", "C", `{"seq":1}`),
+		frame("b2", "B", `{"seq":2}`),
+		frame("a3", "A", `{"seq":3}`),
+		frame("a1", "A", `{"seq":1}`),
+	})
+	client := NewNotification2Client(srv.URL, nil, Subscription{Token: "token"}, ConnectionOptions{})
+	defer client.Close()
+
+	var mu sync.Mutex
+	order := map[string][]int64{}
+	redelivered := []string{}
+	deadLetters := []string{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	consumer := NewConsumer(client, func(ctx context.Context, message Message) error {
+		if string(message.Identifier) == "bad" {
+			return errors.New("invalid message")
+		}
+		delivery, ok := DeliveryFromContext(ctx)
+		testingutils.Assert(t, ok, "delivery should be in the context")
+
+		mu.Lock()
+		defer mu.Unlock()
+		if delivery.Redelivered {
+			redelivered = append(redelivered, string(message.Identifier))
+			return nil
+		}
+		source := string(message.Description)
+		order[source] = append(order[source], message.JSON().Get("seq").Int())
+		return nil
+	}, ConsumerOptions{
+		Concurrency: 2,
+		MaxAttempts: 2,
+		RetryDelay:  time.Millisecond,
+		DeadLetter: func(ctx context.Context, message Message, err error) error {
+			mu.Lock()
+			defer mu.Unlock()
+			deadLetters = append(deadLetters, string(message.Identifier))
+			return nil
+		},
+	})
+	go func() {
+		done <- consumer.Run(ctx)
+	}()
+	connectAfterConsuming(t, client, consumer)
+
+	received := collectAcks(t, acks, 7)
+	cancel()
+	testingutils.Ok(t, <-done)
+
+	testingutils.Equals(t, map[string]int{"a1": 2, "a2": 1, "a3": 1, "b1": 1, "b2": 1, "bad": 1}, received)
+	testingutils.Equals(t, []int64{1, 2, 3}, order["/t12345/measurements/A"])
+	testingutils.Equals(t, []int64{1, 2}, order["/t12345/measurements/B"])
+	testingutils.Equals(t, []string{"a1"}, redelivered)
+	testingutils.Equals(t, []string{"bad"}, deadLetters)
+}
+
+func Test_ConsumerAckModes(t *testing.T) {
+	frames := []string{
+		frame("m1", "A", `{}`),
+		frame("m2", "A", `{}`),
+		frame("m3", "A", `{}`),
+	}
+
+	// Manual: only the messages acknowledged by the handler
+	srv, acks := newConsumerTestServer(t, frames)
+	client := NewNotification2Client(srv.URL, nil, Subscription{Token: "token"}, ConnectionOptions{})
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	consumer := NewConsumer(client, func(ctx context.Context, message Message) error {
+		if string(message.Identifier) == "m2" {
+			delivery, _ := DeliveryFromContext(ctx)
+			return delivery.Ack()
+		}
+		return nil
+	}, ConsumerOptions{AckMode: AckModeManual})
+	go consumer.Run(ctx)
+	connectAfterConsuming(t, client, consumer)
+
+	testingutils.Equals(t, map[string]int{"m2": 1}, collectAcks(t, acks, 1))
+	select {
+	case ack := <-acks:
+		t.Errorf("unexpected ack: %s", ack)
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+
+	// Batch: acknowledgements are sent once the batch is full
+	srv, acks = newConsumerTestServer(t, frames)
+	client = NewNotification2Client(srv.URL, nil, Subscription{Token: "token"}, ConnectionOptions{})
+	defer client.Close()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	consumer = NewConsumer(client, func(ctx context.Context, message Message) error {
+		return nil
+	}, ConsumerOptions{AckMode: AckModeBatch, BatchSize: 3, BatchInterval: time.Hour})
+	go consumer.Run(ctx)
+	connectAfterConsuming(t, client, consumer)
+
+	testingutils.Equals(t, map[string]int{"m1": 1, "m2": 1, "m3": 1}, collectAcks(t, acks, 3))
+}
+
+func Test_ConsumerHandlerPanic(t *testing.T) {
+	srv, acks := newConsumerTestServer(t, []string{
+		frame("panic", "A", `{"seq":1}`),
+		frame("ok", "B", `{"seq":1}`),
+	})
+	client := NewNotification2Client(srv.URL, nil, Subscription{Token: "token"}, ConnectionOptions{})
+	defer client.Close()
+
+	var mu sync.Mutex
+	attempts := 0
+	var deadLetterErr error
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	consumer := NewConsumer(client, func(ctx context.Context, message Message) error {
+		if string(message.Identifier) == "panic" {
+			mu.Lock()
+			attempts++
+			mu.Unlock()
+			panic("unexpected message")
+		}
+		return nil
+	}, ConsumerOptions{
+		MaxAttempts: 2,
+		RetryDelay:  time.Millisecond,
+		DeadLetter: func(ctx context.Context, message Message, err error) error {
+			mu.Lock()
+			defer mu.Unlock()
+			deadLetterErr = err
+			return nil
+		},
+	})
+	go consumer.Run(ctx)
+	connectAfterConsuming(t, client, consumer)
+
+	testingutils.Equals(t, map[string]int{"panic": 1, "ok": 1}, collectAcks(t, acks, 2))
+
+	mu.Lock()
+	defer mu.Unlock()
+	testingutils.Equals(t, 2, attempts)
+	testingutils.Assert(t, errors.Is(deadLetterErr, ErrHandlerPanic), "expected ErrHandlerPanic, got %v", deadLetterErr)
+}
+
+func Test_SendMessageAckWhenNotConnected(t *testing.T) {
+	client := NewNotification2Client("http://localhost", nil, Subscription{Token: "token"}, ConnectionOptions{})
+	defer client.Close()
+
+	err := client.SendMessageAck([]byte("m1"))
+	testingutils.Assert(t, errors.Is(err, ErrNotConnected), "expected ErrNotConnected, got %v", err)
+}
+
+func Test_DeliveryAckRetriesAfterFailure(t *testing.T) {
+	srv, acks := newConsumerTestServer(t, nil)
+	client := NewNotification2Client(srv.URL, nil, Subscription{Token: "token"}, ConnectionOptions{})
+	defer client.Close()
+
+	delivery := &Delivery{
+		consumer:   NewConsumer(client, nil, ConsumerOptions{}),
+		identifier: []byte("m1"),
+	}
+
+	err := delivery.Ack()
+	testingutils.Assert(t, errors.Is(err, ErrNotConnected), "expected ErrNotConnected, got %v", err)
+	testingutils.Assert(t, !delivery.isAcked(), "expected the delivery to not be acknowledged")
+
+	testingutils.Ok(t, client.Connect())
+	testingutils.Ok(t, delivery.Ack())
+	testingutils.Assert(t, delivery.isAcked(), "expected the delivery to be acknowledged")
+	testingutils.Equals(t, map[string]int{"m1": 1}, collectAcks(t, acks, 1))
+}
@@ -0,0 +1,164 @@
+package notification2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// APIKind is the Cumulocity api which the notification relates to
+type APIKind string
+
+const (
+	APIAlarms         APIKind = "alarms"
+	APIEvents         APIKind = "events"
+	APIMeasurements   APIKind = "measurements"
+	APIManagedObjects APIKind = "managedobjects"
+	APIOperations     APIKind = "operations"
+)
+
+// ErrInvalidFrame is returned when a websocket frame does not contain a valid notification
+var ErrInvalidFrame = errors.New("invalid notification frame")
+
+// minimumHeaders is the number of mandatory header lines: identifier, description and action
+const minimumHeaders = 3
+
+// ParseMessages parses a websocket frame containing one or more notifications. Each notification consists of
+// the header lines (identifier, description, action and any additional headers), an empty line and the body.
+// The body can span multiple lines. Any messages which were parsed before an invalid message are also returned
+func ParseMessages(raw []byte) ([]Message, error) {
+	messages := []Message{}
+	rest := raw
+	for len(bytes.TrimSpace(rest)) > 0 {
+		message, remaining, err := parseNext(rest)
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, message)
+		rest = remaining
+	}
+	if len(messages) == 0 {
+		return messages, fmt.Errorf("%w. frame is empty", ErrInvalidFrame)
+	}
+	return messages, nil
+}
+
+// parseMessage parses the first message in the frame
+func parseMessage(raw []byte) *Message {
+	messages, err := ParseMessages(raw)
+	if len(messages) == 0 {
+		Logger.Warnf("Could not parse notification. %s", err)
+		return &Message{}
+	}
+	return &messages[0]
+}
+
+// parseNext parses the first message, and returns the remaining data
+func parseNext(data []byte) (Message, []byte, error) {
+	message := Message{}
+
+	headers := [][]byte{}
+	for len(data) > 0 {
+		var line []byte
+		line, data = nextLine(data)
+		if len(line) == 0 {
+			if len(headers) == 0 {
+				// Ignore blank lines between messages
+				continue
+			}
+			// Empty line is the border between the header and body
+			break
+		}
+		headers = append(headers, bytes.Clone(line))
+	}
+
+	if len(headers) < minimumHeaders {
+		return message, nil, fmt.Errorf("%w. expected at least %d header lines but got %d", ErrInvalidFrame, minimumHeaders, len(headers))
+	}
+
+	message.Identifier = headers[0]
+	message.Description = headers[1]
+	message.Action = headers[2]
+	for _, header := range headers[minimumHeaders:] {
+		message.Headers = append(message.Headers, string(header))
+	}
+	message.ActionType = ActionType(strings.ToUpper(string(message.Action)))
+	message.Tenant, message.API, message.SourceID = parseDescription(string(message.Description))
+
+	payload, remaining := splitBody(data)
+	if len(payload) > 0 {
+		message.Payload = bytes.Clone(payload)
+	}
+	return message, remaining, nil
+}
+
+// splitBody returns the body of the current message and any data belonging to the next message.
+// A JSON body ends with its closing bracket, any other body (e.g. the id of a deleted object) ends
+// at the next empty line or at the headers of the next message
+func splitBody(data []byte) ([]byte, []byte) {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err == nil {
+			offset := decoder.InputOffset()
+			return trimmed[:offset], trimmed[offset:]
+		}
+	}
+
+	end := 0
+	rest := trimmed
+	for len(rest) > 0 {
+		line, remaining := nextLine(rest)
+		if len(bytes.TrimSpace(line)) == 0 || (end > 0 && isHeaderStart(rest)) {
+			break
+		}
+		end = len(trimmed) - len(remaining)
+		rest = remaining
+	}
+	return bytes.TrimRight(trimmed[:end], " \t\r\n"), trimmed[end:]
+}
+
+// isHeaderStart checks if the data starts with the headers of a message, i.e. an identifier
+// followed by a description such as /t12345/measurements/12345 and an action
+func isHeaderStart(data []byte) bool {
+	identifier, rest := nextLine(data)
+	description, rest := nextLine(rest)
+	action, _ := nextLine(rest)
+	if len(identifier) == 0 || len(action) == 0 || !bytes.HasPrefix(description, []byte{'/'}) {
+		return false
+	}
+	_, api, _ := parseDescription(string(description))
+	return api != ""
+}
+
+// nextLine returns the next line (without the line ending) and the remaining data.
+// Lines can end with \n, \r\n or \r
+func nextLine(data []byte) ([]byte, []byte) {
+	index := bytes.IndexAny(data, "\r\n")
+	if index == -1 {
+		return data, nil
+	}
+	rest := data[index+1:]
+	if data[index] == '\r' && len(rest) > 0 && rest[0] == '\n' {
+		rest = rest[1:]
+	}
+	return data[:index], rest
+}
+
+// parseDescription splits the description, e.g. /t12345/measurements/12345, into the tenant, api and source id
+func parseDescription(description string) (tenant string, api APIKind, sourceID string) {
+	parts := strings.Split(strings.Trim(description, "/"), "/")
+	if len(parts) > 0 {
+		tenant = parts[0]
+	}
+	if len(parts) > 1 {
+		api = APIKind(strings.ToLower(parts[1]))
+	}
+	if len(parts) > 2 {
+		sourceID = parts[len(parts)-1]
+	}
+	return
+}
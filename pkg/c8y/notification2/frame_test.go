@@ -0,0 +1,102 @@
+package notification2
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/reubenmiller/go-c8y/internal/pkg/testingutils"
+)
+
+func readFrame(tb testing.TB, name string) []byte {
+	tb.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", "frames", name))
+	testingutils.Ok(tb, err)
+	return raw
+}
+
+func Test_ParseMessages(t *testing.T) {
+	messages, err := ParseMessages(readFrame(t, "alarm_multiline.txt"))
+	testingutils.Ok(t, err)
+	testingutils.Equals(t, 1, len(messages))
+	testingutils.Equals(t, ActionTypeUpdate, messages[0].ActionType)
+	testingutils.Equals(t, APIAlarms, messages[0].API)
+	testingutils.Equals(t, "t123456", messages[0].Tenant)
+	testingutils.Equals(t, "11111", messages[0].SourceID)
+	testingutils.Equals(t, "MAJOR", messages[0].JSON().Get("severity").String())
+	testingutils.Equals(t, "11111", messages[0].JSON().Get("source.id").String())
+
+	messages, err = ParseMessages(readFrame(t, "batched.txt"))
+	testingutils.Ok(t, err)
+	testingutils.Equals(t, 2, len(messages))
+	testingutils.Equals(t, APIOperations, messages[0].API)
+	testingutils.Equals(t, []string{"x-custom-header: 1"}, messages[0].Headers)
+	testingutils.Equals(t, "333", messages[0].JSON().Get("id").String())
+	testingutils.Equals(t, "CLJuEJgjIAAwBQ==", string(messages[1].Identifier))
+	testingutils.Equals(t, APIEvents, messages[1].API)
+	testingutils.Equals(t, "444", messages[1].JSON().Get("id").String())
+
+	messages, err = ParseMessages(readFrame(t, "managedobject_delete_crlf.txt"))
+	testingutils.Ok(t, err)
+	testingutils.Equals(t, ActionTypeDelete, messages[0].ActionType)
+	testingutils.Equals(t, APIManagedObjects, messages[0].API)
+	testingutils.Equals(t, "/t123456/managedobjects/11111", string(messages[0].Description))
+	testingutils.Equals(t, "11111", string(messages[0].Payload))
+
+	// A body which is not JSON does not include the next message
+	messages, err = ParseMessages(readFrame(t, "batched_delete.txt"))
+	testingutils.Ok(t, err)
+	testingutils.Equals(t, 2, len(messages))
+	testingutils.Equals(t, ActionTypeDelete, messages[0].ActionType)
+	testingutils.Equals(t, "11111", string(messages[0].Payload))
+	testingutils.Equals(t, ActionTypeCreate, messages[1].ActionType)
+	testingutils.Equals(t, "22222", messages[1].SourceID)
+	testingutils.Equals(t, "device", messages[1].JSON().Get("name").String())
+
+	messages, err = ParseMessages([]byte("m1\n/t1/managedobjects/1\nDELETE\n\n1\nm2\n/t1/managedobjects/2\nDELETE\n\n2"))
+	testingutils.Ok(t, err)
+	testingutils.Equals(t, 2, len(messages))
+	testingutils.Equals(t, "1", string(messages[0].Payload))
+	testingutils.Equals(t, "m2", string(messages[1].Identifier))
+	testingutils.Equals(t, "2", string(messages[1].Payload))
+
+	// Large payloads are not truncated
+	large := append([]byte("id\n/t1/events/1\nCREATE\n\n{\"text\":\""), bytes.Repeat([]byte("a"), 100000)...)
+	large = append(large, []byte("\"}")...)
+	messages, err = ParseMessages(large)
+	testingutils.Ok(t, err)
+	testingutils.Equals(t, 100000, len(messages[0].JSON().Get("text").String()))
+
+	_, err = ParseMessages([]byte("id\n/t1/events/1\n"))
+	testingutils.Assert(t, errors.Is(err, ErrInvalidFrame), "missing headers should be invalid. got %v", err)
+
+	_, err = ParseMessages([]byte("\n\n"))
+	testingutils.Assert(t, errors.Is(err, ErrInvalidFrame), "empty frame should be invalid. got %v", err)
+}
+
+func FuzzParseMessages(f *testing.F) {
+	entries, err := os.ReadDir(filepath.Join("testdata", "frames"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, entry := range entries {
+		f.Add(readFrame(f, entry.Name()))
+	}
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		messages, err := ParseMessages(raw)
+		if err == nil && len(messages) == 0 {
+			t.Fatalf("no messages and no error")
+		}
+		for _, message := range messages {
+			if len(message.Identifier) == 0 || len(message.Description) == 0 || len(message.Action) == 0 {
+				t.Errorf("message is missing mandatory headers: %+v", message)
+			}
+			if bytes.ContainsAny(message.Identifier, "\r\n") {
+				t.Errorf("identifier contains a line break: %q", message.Identifier)
+			}
+		}
+	})
+}
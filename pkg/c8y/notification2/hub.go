@@ -37,6 +37,11 @@ func (h *Hub) Run() {
 		case client := <-h.register:
 			h.clients[client] = true
 		case subscription := <-h.unregister:
+			if h.clients[subscription] {
+				// Only delete the given client
+				delete(h.clients, subscription)
+				continue
+			}
 			// Delete clients with the same channel pattern
 			for client := range h.clients {
 				if subscription.Pattern == SourceWildcard || subscription.Pattern == client.Pattern {
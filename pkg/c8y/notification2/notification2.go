@@ -1,17 +1,20 @@
 package notification2
 
 import (
-	"bufio"
-	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"math"
 	"net/http"
 	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/reubenmiller/go-c8y/pkg/logger"
+	"github.com/reubenmiller/go-c8y/pkg/telemetry"
 	"github.com/reubenmiller/go-c8y/pkg/wsurl"
 	"github.com/tidwall/gjson"
 	tomb "gopkg.in/tomb.v2"
@@ -19,6 +22,9 @@ import (
 
 var Logger logger.Logger
 
+// ErrNotConnected is returned when a message can't be sent as the websocket is not connected
+var ErrNotConnected = errors.New("websocket is not connected")
+
 func init() {
 	Logger = logger.NewLogger("notifications2")
 }
@@ -51,6 +57,9 @@ type ConnectionOptions struct {
 	PongWait     time.Duration
 	WriteWait    time.Duration
 	Insecure     bool
+
+	// TokenRenewalMargin is how long before the token expires that it is renewed. Defaults to 1 minute
+	TokenRenewalMargin time.Duration
 }
 
 func (o *ConnectionOptions) GetWriteDuration() time.Duration {
@@ -74,6 +83,13 @@ func (o *ConnectionOptions) GetPingDuration() time.Duration {
 	return o.PingInterval
 }
 
+func (o *ConnectionOptions) GetTokenRenewalMargin() time.Duration {
+	if o.TokenRenewalMargin == 0 {
+		return DefaultTokenRenewalMargin
+	}
+	return o.TokenRenewalMargin
+}
+
 // Notification2Client is a client used for the notification2 interface
 type Notification2Client struct {
 	mtx               sync.RWMutex
@@ -88,7 +104,15 @@ type Notification2Client struct {
 	ConnectionOptions ConnectionOptions
 
 	hub  *Hub
-	send chan []byte
+	send chan outgoingMessage
+
+	instrumentation *telemetry.Instrumentation
+
+	// traceCtx is the context given when connecting, which is used as the parent of the connection spans
+	traceCtx context.Context
+
+	errors       chan error
+	reconnecting atomic.Bool
 }
 
 type Subscription struct {
@@ -96,6 +120,9 @@ type Subscription struct {
 	Token    string `json:"token,omitempty"`
 
 	TokenRenewal func(string) (string, error)
+
+	// TokenExpiry returns the expiry of the token. Defaults to the expiry (exp) claim of the token
+	TokenExpiry func(string) (time.Time, error)
 }
 
 type ClientSubscription struct {
@@ -111,6 +138,15 @@ type Message struct {
 	Description []byte `json:"description"`
 	Action      []byte `json:"action"`
 	Payload     []byte `json:"data,omitempty"`
+
+	// Values parsed from the header
+	ActionType ActionType `json:"-"`
+	Tenant     string     `json:"-"`
+	API        APIKind    `json:"-"`
+	SourceID   string     `json:"-"`
+
+	// Headers contains any additional header lines after the action
+	Headers []string `json:"-"`
 }
 
 type ActionType string
@@ -158,9 +194,11 @@ func NewNotification2Client(host string, wsDialer *websocket.Dialer, subscriptio
 		Subscription:      subscription,
 		ConnectionOptions: options,
 
-		send: make(chan []byte),
+		send: make(chan outgoingMessage),
 
 		hub: NewHub(),
+
+		errors: make(chan error, errorBufferSize),
 	}
 
 	go client.hub.Run()
@@ -171,8 +209,20 @@ func NewNotification2Client(host string, wsDialer *websocket.Dialer, subscriptio
 // Connect performs a handshake with the server and will repeatedly initiate a
 // websocket connection until `Close` is called on the client.
 func (c *Notification2Client) Connect() error {
+	return c.ConnectContext(context.Background())
+}
+
+// ConnectContext is like Connect, but the connection spans (including the spans of any reconnects) are
+// created as children of the span in the given context. The context is not used to cancel the connection
+func (c *Notification2Client) ConnectContext(ctx context.Context) error {
+	c.mtx.Lock()
+	c.traceCtx = context.WithoutCancel(ctx)
+	c.mtx.Unlock()
+
 	if !c.IsConnected() {
-		err := c.connect()
+		done := c.getInstrumentation().StartConnection(ctx, telemetry.ClientNotification2, false)
+		err := c.connect(true)
+		done(err)
 		if err != nil {
 			return err
 		}
@@ -180,12 +230,38 @@ func (c *Notification2Client) Connect() error {
 	return nil
 }
 
+func (c *Notification2Client) getTraceContext() context.Context {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.traceCtx == nil {
+		return context.Background()
+	}
+	return c.traceCtx
+}
+
+// SetInstrumentation sets the tracer and metrics used to instrument the connection. Use nil to disable instrumentation
+func (c *Notification2Client) SetInstrumentation(instrumentation *telemetry.Instrumentation) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.instrumentation = instrumentation
+}
+
+func (c *Notification2Client) getInstrumentation() *telemetry.Instrumentation {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.instrumentation
+}
+
 func (c *Notification2Client) Endpoint() string {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
 	return c.url.String()
 }
 
 func (c *Notification2Client) URL(hideSensitive bool) string {
-	wsURL := getEndpoint(c.url.String(), c.Subscription).String()
+	c.mtx.RLock()
+	wsURL := c.url.String()
+	c.mtx.RUnlock()
 	if hideSensitive {
 		if u, err := url.Parse(wsURL); err == nil {
 			q := u.Query()
@@ -243,14 +319,12 @@ func (c *Notification2Client) disconnect() error {
 	return nil
 }
 
-func (c *Notification2Client) createWebsocket() (*websocket.Conn, error) {
-
-	if c.Subscription.TokenRenewal != nil {
-		token, err := c.Subscription.TokenRenewal(c.Subscription.Token)
-		if err != nil {
+// createWebsocket dials the server. If renewToken is true, then the token is renewed before dialing
+func (c *Notification2Client) createWebsocket(renewToken bool) (*websocket.Conn, error) {
+	if renewToken {
+		if err := c.renewToken(); err != nil {
 			return nil, err
 		}
-		c.Subscription.Token = token
 	}
 
 	Logger.Debugf("Establishing connection to %s", c.URL(true))
@@ -264,19 +338,32 @@ func (c *Notification2Client) createWebsocket() (*websocket.Conn, error) {
 	return ws, nil
 }
 
-func (c *Notification2Client) reconnect() error {
+// reconnect closes the connection and connects again. If tokenRenewed is true, then the first
+// attempt is made without waiting and uses the current token, as it has just been renewed
+func (c *Notification2Client) reconnect(tokenRenewed bool) error {
+	if !c.reconnecting.CompareAndSwap(false, true) {
+		return nil
+	}
+	defer c.reconnecting.Store(false)
+
 	c.Close()
 
 	connected := false
 	interval := MinimumRetryInterval
 
 	for !connected {
-		Logger.Warnf("Retrying in %ds", interval)
-		<-time.After(time.Duration(interval) * time.Second)
-		err := c.connect()
+		if !tokenRenewed {
+			Logger.Warnf("Retrying in %ds", interval)
+			<-time.After(time.Duration(interval) * time.Second)
+		}
+		done := c.getInstrumentation().StartConnection(c.getTraceContext(), telemetry.ClientNotification2, true)
+		err := c.connect(!tokenRenewed)
+		done(err)
+		tokenRenewed = false
 
 		if err != nil {
 			Logger.Warnf("Failed to connect. %s", err)
+			c.reportError(fmt.Errorf("failed to reconnect. %w", err))
 			interval = int64(math.Min(float64(MaximumRetryInterval), RetryBackoffFactor*float64(interval)))
 			continue
 		}
@@ -288,8 +375,8 @@ func (c *Notification2Client) reconnect() error {
 	return nil
 }
 
-// StartWebsocket opens a websocket to cumulocity
-func (c *Notification2Client) connect() error {
+// StartWebsocket opens a websocket to cumulocity. If renewToken is true, then the token is renewed before connecting
+func (c *Notification2Client) connect(renewToken bool) error {
 	if c.dialer == nil {
 		panic("Missing dialer for realtime client")
 	}
@@ -300,7 +387,7 @@ func (c *Notification2Client) connect() error {
 			Logger.Infof("Error whilst closing connection before connecting. %s", err)
 		}
 	}
-	ws, err := c.createWebsocket()
+	ws, err := c.createWebsocket(renewToken)
 
 	if err != nil {
 		return err
@@ -311,56 +398,22 @@ func (c *Notification2Client) connect() error {
 
 	c.ws = ws
 	if c.tomb == nil {
-		c.tomb = &tomb.Tomb{}
-		c.tomb.Go(c.worker)
+		t := &tomb.Tomb{}
+		c.tomb = t
+		t.Go(func() error {
+			return c.worker(t, ws)
+		})
+		if c.Subscription.TokenRenewal != nil {
+			t.Go(func() error {
+				return c.tokenRenewer(t)
+			})
+		}
 	}
 	c.connected = true
 
 	return nil
 }
 
-func parseMessage(raw []byte) *Message {
-	inHeader := true
-	message := &Message{}
-
-	scanner := bufio.NewScanner(bytes.NewReader(raw))
-
-	i := 0
-	for scanner.Scan() {
-		// Note: .Bytes() does not allocate memory, so you need to allocate the data
-		// and copy the data to another variable if you want it to persist
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			inHeader = false
-			// empty line is the border between the header and body
-			continue
-		}
-		if inHeader {
-			switch i {
-			case 0:
-				message.Identifier = make([]byte, len(line))
-				copy(message.Identifier, line)
-			case 1:
-				message.Description = make([]byte, len(line))
-				copy(message.Description, line)
-			case 2:
-				message.Action = make([]byte, len(line))
-				copy(message.Action, line)
-			}
-			// Ignore unknown header indexes
-		} else {
-			// Copy payload
-			message.Payload = make([]byte, len(line))
-			copy(message.Payload, line)
-			// TODO: Check if a single websocket message can continue multiple messages
-			// Stop processing further messages
-			break
-		}
-		i++
-	}
-	return message
-}
-
 func (c *Notification2Client) writeHandler() {
 	ticker := time.NewTicker(c.ConnectionOptions.GetPingDuration())
 
@@ -377,11 +430,12 @@ func (c *Notification2Client) writeHandler() {
 				return
 			}
 
-			if c.ws != nil {
-				c.ws.SetWriteDeadline(time.Now().Add(c.ConnectionOptions.GetWriteDuration()))
-				if err := c.ws.WriteMessage(websocket.TextMessage, message); err != nil {
-					Logger.Warnf("Failed to send message. %s", err)
-				}
+			err := c.writeMessage(message.data)
+			if err != nil {
+				Logger.Warnf("Failed to send message. %s", err)
+			}
+			if message.result != nil {
+				message.result <- err
 			}
 
 		case <-ticker.C:
@@ -411,26 +465,55 @@ func (c *Notification2Client) Register(pattern string, out chan<- Message) {
 	}
 }
 
+// writeMessage writes a text message to the websocket
+func (c *Notification2Client) writeMessage(message []byte) error {
+	if c.ws == nil {
+		return ErrNotConnected
+	}
+	c.ws.SetWriteDeadline(time.Now().Add(c.ConnectionOptions.GetWriteDuration()))
+	if err := c.ws.WriteMessage(websocket.TextMessage, message); err != nil {
+		return err
+	}
+	c.getInstrumentation().RecordMessage(context.Background(), telemetry.MessageMetric{
+		Client:    telemetry.ClientNotification2,
+		Direction: telemetry.DirectionSent,
+		Bytes:     len(message),
+	})
+	return nil
+}
+
+// SendMessageAck acknowledges a message. An error is returned if the acknowledgement could not be written,
+// e.g. when the websocket is not connected, in which case the message will be redelivered
 func (c *Notification2Client) SendMessageAck(messageIdentifier []byte) error {
 	Logger.Debugf("Sending message ack: %s", messageIdentifier)
-	c.send <- messageIdentifier
+	result := make(chan error, 1)
+	c.send <- outgoingMessage{data: messageIdentifier, result: result}
+	if err := <-result; err != nil {
+		return fmt.Errorf("failed to send message ack. id=%s. %w", messageIdentifier, err)
+	}
 	return nil
 }
 
-func (c *Notification2Client) worker() error {
+// outgoingMessage is a message written by the write handler. The result of the write is sent to result if it is set
+type outgoingMessage struct {
+	data   []byte
+	result chan error
+}
+
+func (c *Notification2Client) worker(t *tomb.Tomb, ws *websocket.Conn) error {
 	done := make(chan struct{})
 
-	c.ws.SetReadDeadline(time.Now().Add(c.ConnectionOptions.GetPongDuration()))
-	c.ws.SetPongHandler(func(string) error {
+	ws.SetReadDeadline(time.Now().Add(c.ConnectionOptions.GetPongDuration()))
+	ws.SetPongHandler(func(string) error {
 		Logger.Debug("Received pong message")
-		c.ws.SetReadDeadline(time.Now().Add(c.ConnectionOptions.GetPongDuration()))
+		ws.SetReadDeadline(time.Now().Add(c.ConnectionOptions.GetPongDuration()))
 		return nil
 	})
 
 	go func() {
 		defer close(done)
 		for {
-			messageType, rawMessage, err := c.ws.ReadMessage()
+			messageType, rawMessage, err := ws.ReadMessage()
 
 			if err == nil {
 				Logger.Debugf("Received websocket message: type=%d, len=%d", messageType, len(rawMessage))
@@ -443,19 +526,33 @@ func (c *Notification2Client) worker() error {
 				} else {
 					Logger.Infof("websocket error. %v", err)
 				}
-				go c.reconnect()
+				if c.isCurrentConnection(ws) {
+					go c.reconnect(false)
+				} else {
+					Logger.Info("Connection has been closed by the client")
+				}
 				break
 			}
 
 			switch messageType {
 			case websocket.TextMessage:
 				Logger.Debugf("Raw notification2 message (len=%d):\n%s", len(rawMessage), rawMessage)
-				message := parseMessage(rawMessage)
-				Logger.Debugf("message id: %s", message.Identifier)
-				Logger.Debugf("message description: %s", message.Description)
-				Logger.Debugf("message action: %s", message.Action)
-				Logger.Debugf("message payload: %s", message.Payload)
-				c.hub.broadcast <- *message
+				c.getInstrumentation().RecordMessage(context.Background(), telemetry.MessageMetric{
+					Client:    telemetry.ClientNotification2,
+					Direction: telemetry.DirectionReceived,
+					Bytes:     len(rawMessage),
+				})
+				messages, err := ParseMessages(rawMessage)
+				if err != nil {
+					Logger.Warnf("Failed to parse notification. %s", err)
+				}
+				for _, message := range messages {
+					Logger.Debugf("message id: %s", message.Identifier)
+					Logger.Debugf("message description: %s", message.Description)
+					Logger.Debugf("message action: %s", message.Action)
+					Logger.Debugf("message payload: %s", message.Payload)
+					c.hub.broadcast <- message
+				}
 
 			case websocket.CloseMessage:
 				Logger.Warnf("Received close message. %v", rawMessage)
@@ -468,8 +565,8 @@ func (c *Notification2Client) worker() error {
 		}
 	}()
 
-	defer c.ws.Close()
-	<-c.tomb.Dying()
+	defer ws.Close()
+	<-t.Dying()
 	Logger.Info("Worker is shutting down")
 	return nil
 }
@@ -477,6 +574,6 @@ func (c *Notification2Client) worker() error {
 // Unsubscribe unsubscribe to a given pattern
 func (c *Notification2Client) Unsubscribe() error {
 	Logger.Info("unsubscribing")
-	c.send <- []byte("unsubscribe_subscriber")
+	c.send <- outgoingMessage{data: []byte("unsubscribe_subscriber")}
 	return nil
 }
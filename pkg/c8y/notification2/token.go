@@ -0,0 +1,151 @@
+package notification2
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	tomb "gopkg.in/tomb.v2"
+)
+
+// DefaultTokenRenewalMargin is the default time before the token expires that it is renewed
+const DefaultTokenRenewalMargin = time.Minute
+
+// errorBufferSize is the number of errors which are kept until they are read from the error channel
+const errorBufferSize = 16
+
+var (
+	// ErrTokenRenewal is returned when the token could not be renewed
+	ErrTokenRenewal = errors.New("failed to renew token")
+
+	// ErrTokenNotRenewed is returned when the renewed token does not expire after the previous token
+	ErrTokenNotRenewed = errors.New("token was not renewed")
+)
+
+// Errors returns the channel where connection and token renewal errors are published. Errors are
+// dropped if the channel is not read from
+func (c *Notification2Client) Errors() <-chan error {
+	return c.errors
+}
+
+func (c *Notification2Client) reportError(err error) {
+	select {
+	case c.errors <- err:
+	default:
+		Logger.Warnf("Error channel is full, dropping error. %s", err)
+	}
+}
+
+func (c *Notification2Client) isCurrentConnection(ws *websocket.Conn) bool {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.connected && c.ws == ws
+}
+
+// Token returns the current token used by the client. The token changes when it is renewed
+func (c *Notification2Client) Token() string {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.Subscription.Token
+}
+
+// tokenExpiry returns the expiry time of the current token
+func (c *Notification2Client) tokenExpiry() (time.Time, error) {
+	c.mtx.RLock()
+	token := c.Subscription.Token
+	expiry := c.Subscription.TokenExpiry
+	c.mtx.RUnlock()
+
+	if expiry != nil {
+		return expiry(token)
+	}
+	claims := jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil {
+		return time.Time{}, err
+	}
+	if claims.ExpiresAt == nil {
+		return time.Time{}, errors.New("token does not have an expiry")
+	}
+	return claims.ExpiresAt.Time, nil
+}
+
+// renewToken renews the token (if required) and rebuilds the endpoint
+func (c *Notification2Client) renewToken() error {
+	c.mtx.RLock()
+	token := c.Subscription.Token
+	renew := c.Subscription.TokenRenewal
+	c.mtx.RUnlock()
+
+	if renew == nil {
+		return nil
+	}
+	newToken, err := renew(token)
+	if err != nil {
+		err = fmt.Errorf("%w. %w", ErrTokenRenewal, err)
+		c.reportError(err)
+		return err
+	}
+
+	c.mtx.Lock()
+	c.Subscription.Token = newToken
+	c.url = getEndpoint(c.host, c.Subscription)
+	c.mtx.Unlock()
+	return nil
+}
+
+// tokenRenewer renews the token shortly before it expires, and then reconnects using the new token
+func (c *Notification2Client) tokenRenewer(t *tomb.Tomb) error {
+	margin := c.ConnectionOptions.GetTokenRenewalMargin()
+
+	// retryInterval is set after a failed renewal
+	var retryInterval time.Duration
+
+	for {
+		expiresAt, err := c.tokenExpiry()
+		if err != nil {
+			Logger.Warnf("Could not get the token expiry, the token will not be renewed. %s", err)
+			c.reportError(fmt.Errorf("%w. %w", ErrTokenRenewal, err))
+			return nil
+		}
+
+		// Limit the margin to half of the remaining lifetime so that short-lived tokens are not renewed straight away
+		remaining := time.Until(expiresAt)
+		wait := remaining - min(margin, remaining/2)
+		if retryInterval > 0 {
+			wait = retryInterval
+		}
+		Logger.Debugf("Renewing token in %s", wait)
+		select {
+		case <-t.Dying():
+			return nil
+		case <-time.After(wait):
+		}
+
+		if err := c.renewToken(); err != nil {
+			Logger.Warnf("Failed to renew token. %s", err)
+			retryInterval = nextRetryInterval(retryInterval)
+			continue
+		}
+
+		renewedExpiresAt, err := c.tokenExpiry()
+		if err == nil && !renewedExpiresAt.After(expiresAt) {
+			c.reportError(fmt.Errorf("%w. expires at %s", ErrTokenNotRenewed, renewedExpiresAt.Format(time.RFC3339)))
+			retryInterval = nextRetryInterval(retryInterval)
+			continue
+		}
+
+		Logger.Info("Token has been renewed. Reconnecting using the new token")
+		go c.reconnect(true)
+		return nil
+	}
+}
+
+// nextRetryInterval returns the next interval using the same backoff as reconnecting
+func nextRetryInterval(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return time.Duration(MinimumRetryInterval) * time.Second
+	}
+	return min(time.Duration(MaximumRetryInterval)*time.Second, time.Duration(RetryBackoffFactor*float64(interval)))
+}
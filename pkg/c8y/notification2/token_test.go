@@ -0,0 +1,115 @@
+package notification2_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/reubenmiller/go-c8y/internal/pkg/testingutils"
+	"github.com/reubenmiller/go-c8y/pkg/c8y/notification2"
+	"github.com/reubenmiller/go-c8y/pkg/c8ytest"
+)
+
+func newTokenTestServer(t *testing.T) *c8ytest.Server {
+	srv := c8ytest.NewServer(c8ytest.Options{})
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// waitForConnections returns the tokens used by the first n connections to the server
+func waitForConnections(t *testing.T, srv *c8ytest.Server, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if consumers := srv.Notification2Consumers(); len(consumers) >= n {
+			tokens := []string{}
+			for _, consumer := range consumers[:n] {
+				tokens = append(tokens, consumer.Token)
+			}
+			return tokens
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_TokenRenewalReconnects(t *testing.T) {
+	srv := newTokenTestServer(t)
+
+	initial := srv.NewNotification2Token("initial", "alarms", false, 4*time.Second)
+	renewed := srv.NewNotification2Token("renewed", "alarms", false, time.Hour)
+	client := notification2.NewNotification2Client(srv.URL, nil, notification2.Subscription{
+		Token: initial,
+		TokenRenewal: func(token string) (string, error) {
+			// Only renew the token if it is about to expire
+			claims := jwt.RegisteredClaims{}
+			if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil {
+				return "", err
+			}
+			if time.Until(claims.ExpiresAt.Time) > 2500*time.Millisecond {
+				return token, nil
+			}
+			return renewed, nil
+		},
+	}, notification2.ConnectionOptions{TokenRenewalMargin: 2 * time.Second})
+	defer client.Close()
+
+	testingutils.Ok(t, client.Connect())
+	testingutils.Equals(t, []string{initial, renewed}, waitForConnections(t, srv, 2))
+	deadline := time.Now().Add(5 * time.Second)
+	for !client.IsConnected() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	testingutils.Assert(t, client.IsConnected(), "client should be connected")
+	testingutils.Assert(t, client.URL(true) != client.URL(false), "url should contain the token")
+}
+
+func Test_TokenRenewalReconnectsWithRenewedToken(t *testing.T) {
+	srv := newTokenTestServer(t)
+
+	// The token used to connect is short-lived, so it is renewed proactively once
+	var renewals atomic.Int32
+	issued := []string{
+		srv.NewNotification2Token("connect", "alarms", false, 3*time.Second),
+		srv.NewNotification2Token("renewed", "alarms", false, time.Hour),
+		srv.NewNotification2Token("unexpected", "alarms", false, time.Hour),
+	}
+	client := notification2.NewNotification2Client(srv.URL, nil, notification2.Subscription{
+		Token: srv.NewNotification2Token("initial", "alarms", false, time.Hour),
+		TokenRenewal: func(token string) (string, error) {
+			return issued[min(int(renewals.Add(1)), len(issued))-1], nil
+		},
+	}, notification2.ConnectionOptions{TokenRenewalMargin: 2 * time.Second})
+	defer client.Close()
+
+	testingutils.Ok(t, client.Connect())
+	testingutils.Equals(t, issued[:2], waitForConnections(t, srv, 2))
+	testingutils.Equals(t, int32(2), renewals.Load())
+}
+
+func Test_TokenRenewalErrors(t *testing.T) {
+	srv := newTokenTestServer(t)
+
+	renewalErr := errors.New("not authorized")
+	client := notification2.NewNotification2Client(srv.URL, nil, notification2.Subscription{
+		Token: srv.NewNotification2Token("initial", "alarms", false, time.Hour),
+		TokenRenewal: func(token string) (string, error) {
+			return "", renewalErr
+		},
+	}, notification2.ConnectionOptions{})
+	defer client.Close()
+
+	err := client.Connect()
+	testingutils.Assert(t, errors.Is(err, notification2.ErrTokenRenewal) && errors.Is(err, renewalErr), "unexpected error: %v", err)
+
+	select {
+	case err := <-client.Errors():
+		testingutils.Assert(t, errors.Is(err, notification2.ErrTokenRenewal), "unexpected error: %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("renewal error was not published")
+	}
+}
@@ -0,0 +1,271 @@
+package c8y
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/reubenmiller/go-c8y/pkg/c8y/notification2"
+)
+
+// ErrConsumerGroupRunning is returned when starting a consumer group which is already running
+var ErrConsumerGroupRunning = errors.New("consumer group is already running")
+
+// Notification2ConsumerGroupOptions controls the shared subscription used by a consumer group
+type Notification2ConsumerGroupOptions struct {
+	// Subscription name. The subscription must already exist, see Notification2SubscriptionManager
+	Subscription string
+
+	// Subscriber name shared by all replicas of the service. Defaults to the subscription name
+	Subscriber string
+
+	// Replica name used to derive the consumer names. It must be unique and stable for each replica.
+	// Defaults to the hostname, which is the pod name when running in Kubernetes
+	Replica string
+
+	// Consumers is the number of shared connections opened by this process. Defaults to 1
+	Consumers int
+
+	// ExpiresInMinutes is the lifetime of the tokens. The tokens are renewed before they expire
+	ExpiresInMinutes int64
+
+	ConnectionOptions notification2.ConnectionOptions
+
+	// ConsumerOptions controls how the messages of each connection are processed
+	ConsumerOptions notification2.ConsumerOptions
+}
+
+// Notification2ConsumerMetrics are the statistics of a single consumer in the group
+type Notification2ConsumerMetrics struct {
+	Consumer  string
+	Connected bool
+
+	// Received is the number of messages received, including redeliveries
+	Received int64
+
+	// Redelivered is the number of messages which had already been received by the consumer
+	Redelivered int64
+
+	// Processed is the number of messages which were handled successfully
+	Processed int64
+
+	// Failed is the number of failed handler attempts
+	Failed int64
+
+	// DeadLettered is the number of messages which were passed to the dead-letter handler
+	DeadLettered int64
+
+	// LastMessage is the time the last message was received
+	LastMessage time.Time
+}
+
+// notification2ConsumerStats collects the metrics of a consumer
+type notification2ConsumerStats struct {
+	consumer     string
+	client       *notification2.Notification2Client
+	received     atomic.Int64
+	redelivered  atomic.Int64
+	processed    atomic.Int64
+	failed       atomic.Int64
+	deadLettered atomic.Int64
+	lastMessage  atomic.Int64
+}
+
+// Notification2ConsumerGroup runs multiple consumers of a shared subscription. Each notification is only
+// delivered to one of the consumers of the group, so the replicas of a horizontally scaled service
+// can split the notifications between them
+type Notification2ConsumerGroup struct {
+	service *Notification2Service
+	options Notification2ConsumerGroupOptions
+
+	running sync.Mutex
+
+	mu        sync.RWMutex
+	consumers []*notification2ConsumerStats
+}
+
+// NewConsumerGroup creates a consumer group for a shared subscription
+//
+// Example:
+//
+//	group, err := client.Notification2.NewConsumerGroup(c8y.Notification2ConsumerGroupOptions{
+//		Subscription: "myserviceAlarms",
+//		Consumers:    4,
+//	})
+//	err = group.Run(ctx, func(ctx context.Context, msg notification2.Message) error {
+//		log.Printf("Received message. %s", msg.Payload)
+//		return nil
+//	})
+func (s *Notification2Service) NewConsumerGroup(options Notification2ConsumerGroupOptions) (*Notification2ConsumerGroup, error) {
+	if options.Subscription == "" {
+		return nil, fmt.Errorf("%w. subscription name is required", ErrInvalidSubscription)
+	}
+	if options.Subscriber == "" {
+		options.Subscriber = options.Subscription
+	}
+	if options.Replica == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("could not derive the replica name. %w", err)
+		}
+		options.Replica = hostname
+	}
+	if options.Consumers <= 0 {
+		options.Consumers = 1
+	}
+
+	group := &Notification2ConsumerGroup{
+		service: s,
+		options: options,
+	}
+	for _, name := range group.ConsumerNames() {
+		group.consumers = append(group.consumers, &notification2ConsumerStats{consumer: name})
+	}
+	return group, nil
+}
+
+// Subscriber returns the (normalized) subscriber name shared by the replicas
+func (g *Notification2ConsumerGroup) Subscriber() string {
+	return g.service.NormalizedConsumer(g.options.Subscriber)
+}
+
+// ConsumerNames returns the names of the consumers run by this process. The names only depend on the
+// replica name and the number of consumers, so they are the same when the replica is restarted
+func (g *Notification2ConsumerGroup) ConsumerNames() []string {
+	replica := g.service.NormalizedConsumer(g.options.Replica)
+	names := make([]string, 0, g.options.Consumers)
+	for i := range g.options.Consumers {
+		names = append(names, fmt.Sprintf("%sc%d", replica, i))
+	}
+	return names
+}
+
+// Metrics returns the statistics of each consumer of the group
+func (g *Notification2ConsumerGroup) Metrics() []Notification2ConsumerMetrics {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	metrics := make([]Notification2ConsumerMetrics, 0, len(g.consumers))
+	for _, stats := range g.consumers {
+		item := Notification2ConsumerMetrics{
+			Consumer:     stats.consumer,
+			Connected:    stats.client != nil && stats.client.IsConnected(),
+			Received:     stats.received.Load(),
+			Redelivered:  stats.redelivered.Load(),
+			Processed:    stats.processed.Load(),
+			Failed:       stats.failed.Load(),
+			DeadLettered: stats.deadLettered.Load(),
+		}
+		if last := stats.lastMessage.Load(); last > 0 {
+			item.LastMessage = time.Unix(0, last)
+		}
+		metrics = append(metrics, item)
+	}
+	return metrics
+}
+
+// Run connects the consumers and handles the messages until the ctx is done. An error is returned
+// if any of the consumers can't connect. The connections are closed when Run returns, however the
+// subscriber is not removed, so the messages received in the meantime are delivered once the group is restarted
+func (g *Notification2ConsumerGroup) Run(ctx context.Context, handler notification2.Handler) error {
+	if !g.running.TryLock() {
+		return ErrConsumerGroupRunning
+	}
+	defer g.running.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	clients := make([]*notification2.Notification2Client, 0, len(g.consumers))
+	var wg sync.WaitGroup
+	defer func() {
+		// Stop the consumers before closing the connections so that pending acknowledgements are sent
+		cancel()
+		wg.Wait()
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+
+	for _, stats := range g.consumers {
+		client, err := g.service.CreateClient(ctx, Notification2ClientOptions{
+			Consumer: stats.consumer,
+			Options: Notification2TokenOptions{
+				Subscription:     g.options.Subscription,
+				Subscriber:       g.Subscriber(),
+				ExpiresInMinutes: g.options.ExpiresInMinutes,
+				Shared:           true,
+			},
+			ConnectionOptions: g.options.ConnectionOptions,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create consumer %s. %w", stats.consumer, err)
+		}
+		clients = append(clients, client)
+
+		g.mu.Lock()
+		stats.client = client
+		g.mu.Unlock()
+
+		consumer := notification2.NewConsumer(client, stats.handler(handler), stats.consumerOptions(g.options.ConsumerOptions))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := consumer.Run(ctx); err != nil {
+				Logger.Warnf("Consumer stopped. consumer=%s, err=%s", stats.consumer, err)
+			}
+		}()
+
+		select {
+		case <-consumer.Ready():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err := client.ConnectContext(ctx); err != nil {
+			return fmt.Errorf("failed to connect consumer %s. %w", stats.consumer, err)
+		}
+		Logger.Infof("Consumer connected. subscriber=%s, consumer=%s", g.Subscriber(), stats.consumer)
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+// handler records the metrics of each message
+func (s *notification2ConsumerStats) handler(handler notification2.Handler) notification2.Handler {
+	return func(ctx context.Context, message notification2.Message) error {
+		if delivery, ok := notification2.DeliveryFromContext(ctx); ok && delivery.Attempt == 1 {
+			s.received.Add(1)
+			s.lastMessage.Store(time.Now().UnixNano())
+			if delivery.Redelivered {
+				s.redelivered.Add(1)
+			}
+		}
+		// a panic is recovered by the consumer, so it still needs to count as a failed attempt
+		defer func() {
+			if r := recover(); r != nil {
+				s.failed.Add(1)
+				panic(r)
+			}
+		}()
+		if err := handler(ctx, message); err != nil {
+			s.failed.Add(1)
+			return err
+		}
+		s.processed.Add(1)
+		return nil
+	}
+}
+
+// consumerOptions wraps the dead-letter handler to record the metrics
+func (s *notification2ConsumerStats) consumerOptions(options notification2.ConsumerOptions) notification2.ConsumerOptions {
+	if deadLetter := options.DeadLetter; deadLetter != nil {
+		options.DeadLetter = func(ctx context.Context, message notification2.Message, err error) error {
+			s.deadLettered.Add(1)
+			return deadLetter(ctx, message, err)
+		}
+	}
+	return options
+}
@@ -0,0 +1,193 @@
+package c8y_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/reubenmiller/go-c8y/pkg/c8y"
+	"github.com/reubenmiller/go-c8y/pkg/c8y/notification2"
+	"github.com/reubenmiller/go-c8y/pkg/c8ytest"
+)
+
+func TestNotification2ConsumerGroup_ConsumerNames(t *testing.T) {
+	client := c8y.NewClientFromOptions(nil, c8y.ClientOptions{BaseURL: "http://localhost"})
+	group, err := client.Notification2.NewConsumerGroup(c8y.Notification2ConsumerGroupOptions{
+		Subscription: "svcAlarms",
+		Replica:      "my-service-7d9f8-abcde",
+		Consumers:    3,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := group.ConsumerNames(), []string{"myservice7d9f8abcdec0", "myservice7d9f8abcdec1", "myservice7d9f8abcdec2"}; !slices.Equal(got, want) {
+		t.Errorf("consumer names: got %v, want %v", got, want)
+	}
+	if got := group.Subscriber(); got != "svcAlarms" {
+		t.Errorf("subscriber: got %q, want %q", got, "svcAlarms")
+	}
+
+	// Names are derived from the hostname by default
+	group, err = client.Notification2.NewConsumerGroup(c8y.Notification2ConsumerGroupOptions{Subscription: "svcAlarms"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if names := group.ConsumerNames(); len(names) != 1 || names[0] == "c0" {
+		t.Errorf("consumer names: got %v, want a name derived from the hostname", names)
+	}
+
+	if _, err := client.Notification2.NewConsumerGroup(c8y.Notification2ConsumerGroupOptions{}); err == nil {
+		t.Errorf("missing subscription: expected an error")
+	}
+}
+
+func TestNotification2ConsumerGroup_Run(t *testing.T) {
+	srv := c8ytest.NewServer(c8ytest.Options{})
+	defer srv.Close()
+	client := srv.NewClient()
+	group, err := client.Notification2.NewConsumerGroup(c8y.Notification2ConsumerGroupOptions{
+		Subscription: "svcAlarms",
+		Subscriber:   "svc",
+		Replica:      "pod1",
+		Consumers:    2,
+		ConsumerOptions: notification2.ConsumerOptions{
+			MaxAttempts: 2,
+			RetryDelay:  10 * time.Millisecond,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- group.Run(ctx, func(ctx context.Context, message notification2.Message) error {
+			if message.SourceID == "3" {
+				return fmt.Errorf("failed")
+			}
+			return nil
+		})
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(srv.Notification2Consumers()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the consumers to connect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The consumers of the shared subscriber take turns, so each consumer receives one message per source
+	for _, source := range []string{"1", "2", "3", "1", "2", "3"} {
+		if sent := srv.PublishNotification2("svcAlarms", "measurements", source, "CREATE", "{}"); sent != 1 {
+			t.Fatalf("notification was sent to %d consumers, want 1", sent)
+		}
+	}
+
+	for {
+		total := int64(0)
+		for _, metric := range group.Metrics() {
+			total += metric.Processed + metric.Failed
+		}
+		// each consumer processes 2 messages, and fails twice on the third message
+		if total == 8 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for messages. metrics=%+v", group.Metrics())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := group.Run(ctx, nil); err != c8y.ErrConsumerGroupRunning {
+		t.Errorf("second run: got %v, want %v", err, c8y.ErrConsumerGroupRunning)
+	}
+
+	for _, metric := range group.Metrics() {
+		if !metric.Connected || metric.Received != 3 || metric.Processed != 2 || metric.Failed != 2 || metric.LastMessage.IsZero() {
+			t.Errorf("metrics: got %+v", metric)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run: got %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the group to stop")
+	}
+
+	consumers := []string{}
+	for _, consumer := range srv.Notification2Consumers() {
+		if !consumer.Shared || consumer.Subscriber != "svc" || consumer.Subscription != "svcAlarms" {
+			t.Errorf("consumer: got %+v, want a shared token for the subscriber", consumer)
+		}
+		consumers = append(consumers, consumer.Consumer)
+	}
+	slices.Sort(consumers)
+	if want := []string{"pod1c0", "pod1c1"}; !slices.Equal(consumers, want) {
+		t.Errorf("consumers: got %v, want %v", consumers, want)
+	}
+}
+
+func TestNotification2ConsumerGroup_HandlerPanic(t *testing.T) {
+	srv := c8ytest.NewServer(c8ytest.Options{})
+	defer srv.Close()
+	client := srv.NewClient()
+
+	deadLetterErr := make(chan error, 1)
+	group, err := client.Notification2.NewConsumerGroup(c8y.Notification2ConsumerGroupOptions{
+		Subscription: "svcAlarms",
+		Subscriber:   "svc",
+		Replica:      "pod1",
+		ConsumerOptions: notification2.ConsumerOptions{
+			MaxAttempts: 2,
+			RetryDelay:  10 * time.Millisecond,
+			DeadLetter: func(ctx context.Context, message notification2.Message, err error) error {
+				deadLetterErr <- err
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go group.Run(ctx, func(ctx context.Context, message notification2.Message) error {
+		panic("boom")
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(srv.Notification2Consumers()) < 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the consumer to connect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sent := srv.PublishNotification2("svcAlarms", "measurements", "1", "CREATE", "{}"); sent != 1 {
+		t.Fatalf("notification was sent to %d consumers, want 1", sent)
+	}
+
+	select {
+	case err := <-deadLetterErr:
+		if !errors.Is(err, notification2.ErrHandlerPanic) {
+			t.Errorf("dead-letter error: got %v, want %v", err, notification2.ErrHandlerPanic)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the message to be dead-lettered")
+	}
+
+	metrics := group.Metrics()
+	if len(metrics) != 1 || metrics[0].Received != 1 || metrics[0].Processed != 0 || metrics[0].Failed != 2 || metrics[0].DeadLettered != 1 {
+		t.Errorf("metrics: got %+v", metrics)
+	}
+}
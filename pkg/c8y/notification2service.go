@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"iter"
 	"net/http"
 	"strings"
 	"time"
@@ -56,6 +57,9 @@ type Notification2Subscription struct {
 	Subscription       string                          `json:"subscription,omitempty"`
 	SubscriptionFilter Notification2SubscriptionFilter `json:"subscriptionFilter,omitempty"`
 
+	// NonPersistent subscriptions do not keep the notifications when no consumers are connected
+	NonPersistent bool `json:"nonPersistent,omitempty"`
+
 	// Allow access to custom fields
 	Item gjson.Result `json:"-"`
 }
@@ -107,6 +111,7 @@ type UnsubscribeResponse struct {
 func (s *Notification2Service) GetSubscription(ctx context.Context, ID string) (*Notification2Subscription, *Response, error) {
 	data := new(Notification2Subscription)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Notification2.GetSubscription",
 		Method:       http.MethodGet,
 		Path:         "notification2/subscriptions/" + ID,
 		ResponseData: data,
@@ -118,6 +123,7 @@ func (s *Notification2Service) GetSubscription(ctx context.Context, ID string) (
 func (s *Notification2Service) GetSubscriptions(ctx context.Context, opt *Notification2SubscriptionCollectionOptions) (*Notification2SubscriptionCollection, *Response, error) {
 	data := new(Notification2SubscriptionCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Notification2.GetSubscriptions",
 		Method:       http.MethodGet,
 		Path:         "notification2/subscriptions",
 		Query:        opt,
@@ -126,6 +132,17 @@ func (s *Notification2Service) GetSubscriptions(ctx context.Context, opt *Notifi
 	return data, resp, err
 }
 
+// IterSubscriptions returns an iterator over all subscriptions matching the given options. Pages are fetched
+// lazily by following the .next links. See Paginate for more details
+func (s *Notification2Service) IterSubscriptions(ctx context.Context, opt *Notification2SubscriptionCollectionOptions, limits PaginateLimits) iter.Seq2[Notification2Subscription, error] {
+	return Paginate[Notification2Subscription](ctx, s.client, RequestOptions{
+		Operation: "Notification2.IterSubscriptions",
+		Method:    http.MethodGet,
+		Path:      "notification2/subscriptions",
+		Query:     opt,
+	}, "subscriptions", limits)
+}
+
 // Create token
 func (s *Notification2Service) CreateToken(ctx context.Context, options Notification2TokenOptions) (*Notification2Token, *Response, error) {
 	data := new(Notification2Token)
@@ -135,6 +152,7 @@ func (s *Notification2Service) CreateToken(ctx context.Context, options Notifica
 		options.Subscriber = options.GetDefaultSubscriber()
 	}
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Notification2.CreateToken",
 		Method:       "POST",
 		Path:         "notification2/token",
 		Body:         options,
@@ -147,6 +165,7 @@ func (s *Notification2Service) CreateToken(ctx context.Context, options Notifica
 func (s *Notification2Service) UnsubscribeSubscriber(ctx context.Context, token string) (*UnsubscribeResponse, *Response, error) {
 	data := new(UnsubscribeResponse)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Notification2.UnsubscribeSubscriber",
 		Method:       "POST",
 		Path:         "notification2/unsubscribe?token=" + token,
 		ResponseData: data,
@@ -158,6 +177,7 @@ func (s *Notification2Service) UnsubscribeSubscriber(ctx context.Context, token
 func (s *Notification2Service) CreateSubscription(ctx context.Context, ID string, subscription Notification2Subscription) (*Event, *Response, error) {
 	data := new(Event)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Notification2.CreateSubscription",
 		Method:       http.MethodPost,
 		Path:         "notification2/subscriptions",
 		Body:         subscription,
@@ -169,17 +189,19 @@ func (s *Notification2Service) CreateSubscription(ctx context.Context, ID string
 // Delete subscription by id
 func (s *Notification2Service) DeleteSubscription(ctx context.Context, ID string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "notification2/subscriptions/" + ID,
+		Operation: "Notification2.DeleteSubscription",
+		Method:    "DELETE",
+		Path:      "notification2/subscriptions/" + ID,
 	})
 }
 
 // DeleteSubscription removes a subscription by source
 func (s *Notification2Service) DeleteSubscriptionBySource(ctx context.Context, opt Notification2SubscriptionDeleteOptions) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "notification2/subscriptions",
-		Query:  opt,
+		Operation: "Notification2.DeleteSubscriptionBySource",
+		Method:    "DELETE",
+		Path:      "notification2/subscriptions",
+		Query:     opt,
 	})
 }
 
@@ -217,6 +239,18 @@ func (c *Notification2TokenClaim) Subscription() string {
 	return c.Topic[index+1:]
 }
 
+// ExpiresWithin returns true if the token expires within the given margin. The margin is limited
+// to half of the token's lifetime so that short-lived tokens are not renewed straight away
+func (c *Notification2TokenClaim) ExpiresWithin(margin time.Duration) bool {
+	if c.ExpiresAt == nil {
+		return false
+	}
+	if c.IssuedAt != nil {
+		margin = min(margin, c.ExpiresAt.Sub(c.IssuedAt.Time)/2)
+	}
+	return time.Until(c.ExpiresAt.Time) < margin
+}
+
 func (c *Notification2TokenClaim) HasExpired() bool {
 	var v = jwt.NewValidator(jwt.WithLeeway(5 * time.Second))
 	err := v.Validate(c)
@@ -228,9 +262,12 @@ func (s *Notification2Service) ParseToken(tokenString string) (*Notification2Tok
 	if len(parts) != 3 {
 		return nil, fmt.Errorf("invalid token. expected 3 fields")
 	}
-	raw, err := base64.RawStdEncoding.DecodeString(parts[1])
+	// JWTs use url encoding, however also accept standard encoding for compatibility
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
 	if err != nil {
-		return nil, err
+		if raw, err = base64.RawStdEncoding.DecodeString(parts[1]); err != nil {
+			return nil, err
+		}
 	}
 
 	claim := &Notification2TokenClaim{}
@@ -238,6 +275,18 @@ func (s *Notification2Service) ParseToken(tokenString string) (*Notification2Tok
 	return claim, err
 }
 
+// TokenExpiresAt returns the time when the token expires. An error is returned if the token does not have an expiry
+func (s *Notification2Service) TokenExpiresAt(tokenString string) (time.Time, error) {
+	claims, err := s.ParseToken(tokenString)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if claims.ExpiresAt == nil {
+		return time.Time{}, fmt.Errorf("token does not have an expiry")
+	}
+	return claims.ExpiresAt.Time, nil
+}
+
 func (s *Notification2Service) RenewToken(ctx context.Context, opt Notification2ClientOptions) (string, error) {
 	isValid := true
 	claimMatch := true // default to true in case if the user does not provide any expected information
@@ -259,6 +308,9 @@ func (s *Notification2Service) RenewToken(ctx context.Context, opt Notification2
 		} else if err := jwt.NewValidator(jwt.WithLeeway(5 * time.Second)).Validate(token.Claims); err != nil {
 			Logger.Infof("Token is invalid. %s", err)
 			isValid = false
+		} else if claims.ExpiresWithin(opt.ConnectionOptions.GetTokenRenewalMargin()) {
+			Logger.Infof("Token expires soon and will be renewed. expiresAt=%v", claims.ExpiresAt)
+			isValid = false
 		}
 
 		Logger.Infof("Existing token: alg=%s, valid=%v, expired=%v, issuedAt: %v, expiresAt: %v, subscription=%s, subscriber=%s, shared=%v, tenant=%s", token.Method.Alg(), isValid, claims.HasExpired(), claims.IssuedAt, claims.ExpiresAt, claims.Subscription(), claims.Subscriber, claims.IsShared(), claims.Tenant())
@@ -284,7 +336,7 @@ func (s *Notification2Service) RenewToken(ctx context.Context, opt Notification2
 		if claimMatch && expiresInMinutes == 0 {
 			// Reuse the expiration time given in the token
 			if claims.ExpiresAt != nil && claims.IssuedAt != nil {
-				expiresInMinutes = claims.ExpiresAt.Unix() - claims.IssuedAt.Unix()
+				expiresInMinutes = (claims.ExpiresAt.Unix() - claims.IssuedAt.Unix()) / 60
 			}
 		}
 
@@ -352,6 +404,17 @@ func (s *Notification2Service) RenewToken(ctx context.Context, opt Notification2
 //	}
 //
 // ```
+//
+// Alternatively, use Consume to only acknowledge the messages once they have been processed:
+//
+// ```
+//
+//	err = notificationsClient.Consume(ctx, func(ctx context.Context, msg notification2.Message) error {
+//	    log.Printf("Received message. %s", msg.Payload)
+//	    return nil
+//	}, notification2.ConsumerOptions{AckMode: notification2.AckModeAuto})
+//
+// ```
 func (s *Notification2Service) CreateClient(ctx context.Context, opt Notification2ClientOptions) (*notification2.Notification2Client, error) {
 	// Validate token against expected subscriptions
 	token, err := s.RenewToken(ctx, opt)
@@ -359,15 +422,20 @@ func (s *Notification2Service) CreateClient(ctx context.Context, opt Notificatio
 		return nil, err
 	}
 
+	// The token is renewed for the lifetime of the client, so don't stop when the ctx is cancelled
+	renewalCtx := context.WithoutCancel(ctx)
 	client := notification2.NewNotification2Client(s.client.BaseURL.String(), nil, notification2.Subscription{
 		TokenRenewal: func(v string) (string, error) {
-			return s.RenewToken(ctx, Notification2ClientOptions{
-				Token: v,
+			return s.RenewToken(renewalCtx, Notification2ClientOptions{
+				Token:             v,
+				ConnectionOptions: opt.ConnectionOptions,
 			})
 		},
-		Consumer: s.NormalizedConsumer(opt.Consumer),
-		Token:    token,
+		TokenExpiry: s.TokenExpiresAt,
+		Consumer:    s.NormalizedConsumer(opt.Consumer),
+		Token:       token,
 	}, opt.ConnectionOptions)
+	client.SetInstrumentation(s.client.getInstrumentation())
 	return client, nil
 }
 
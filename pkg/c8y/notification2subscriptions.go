@@ -0,0 +1,329 @@
+package c8y
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/reubenmiller/go-c8y/pkg/c8y/notification2"
+)
+
+const (
+	// Notification2ContextTenant subscribes to the notifications of all devices in the tenant
+	Notification2ContextTenant = "tenant"
+
+	// Notification2ContextManagedObject subscribes to the notifications of a single managed object (source)
+	Notification2ContextManagedObject = "mo"
+)
+
+// ErrInvalidSubscription is returned when a desired subscription is not valid
+var ErrInvalidSubscription = errors.New("invalid notification2 subscription")
+
+// Notification2SubscriptionManagerOptions controls which subscriptions are managed
+type Notification2SubscriptionManagerOptions struct {
+	// Prefix of the subscription names owned by the manager. Existing subscriptions starting with the prefix
+	// which are not in the desired set are deleted. If empty, only the subscriptions matching the context, source and
+	// name of a desired subscription are managed, so subscriptions with the same name but a different source are left as is
+	Prefix string
+
+	// UnsubscribeOnShutdown unsubscribes the subscribers of the clients created by the manager when Shutdown is called.
+	// This removes the subscriber's queue, so any notifications sent whilst the service is offline are discarded
+	UnsubscribeOnShutdown bool
+}
+
+// Notification2ReconcileResult lists the changes made by Reconcile
+type Notification2ReconcileResult struct {
+	Created []Notification2Subscription
+
+	// Updated are the subscriptions which were deleted and created again. Their queued notifications are lost
+	Updated   []Notification2Subscription
+	Deleted   []Notification2Subscription
+	Unchanged []Notification2Subscription
+}
+
+// Notification2SubscriptionManager keeps the subscriptions in the tenant in line with a desired set of subscriptions,
+// and tracks the clients created for them so that their subscribers can be removed on shutdown
+type Notification2SubscriptionManager struct {
+	service *Notification2Service
+	options Notification2SubscriptionManagerOptions
+
+	mu      sync.Mutex
+	clients []*notification2.Notification2Client
+}
+
+// NewSubscriptionManager creates a manager for the notification2 subscriptions
+//
+// Example:
+//
+//	manager := client.Notification2.NewSubscriptionManager(c8y.Notification2SubscriptionManagerOptions{
+//		Prefix:                "myservice",
+//		UnsubscribeOnShutdown: true,
+//	})
+//	_, err := manager.Reconcile(ctx, []c8y.Notification2Subscription{
+//		{
+//			Context:            c8y.Notification2ContextTenant,
+//			Subscription:       "myserviceAlarms",
+//			SubscriptionFilter: c8y.Notification2SubscriptionFilter{Apis: []string{"alarms"}},
+//		},
+//	})
+//	defer manager.Shutdown(context.Background())
+func (s *Notification2Service) NewSubscriptionManager(options Notification2SubscriptionManagerOptions) *Notification2SubscriptionManager {
+	return &Notification2SubscriptionManager{
+		service: s,
+		options: options,
+	}
+}
+
+// notification2SubscriptionKey identifies a subscription. A subscription can only exist once
+// for each context and source
+type notification2SubscriptionKey struct {
+	context      string
+	source       string
+	subscription string
+}
+
+func (k notification2SubscriptionKey) String() string {
+	if k.source == "" {
+		return fmt.Sprintf("%s/%s", k.context, k.subscription)
+	}
+	return fmt.Sprintf("%s/%s/%s", k.context, k.source, k.subscription)
+}
+
+func subscriptionKey(subscription Notification2Subscription) notification2SubscriptionKey {
+	key := notification2SubscriptionKey{
+		context:      subscription.Context,
+		subscription: subscription.Subscription,
+	}
+	if subscription.Source != nil {
+		key.source = subscription.Source.ID
+	}
+	return key
+}
+
+// normalizeSubscription sets the default context and checks that the subscription can be created
+func normalizeSubscription(subscription Notification2Subscription) (Notification2Subscription, error) {
+	if subscription.Subscription == "" {
+		return subscription, fmt.Errorf("%w. subscription name is required", ErrInvalidSubscription)
+	}
+	hasSource := subscription.Source != nil && subscription.Source.ID != ""
+	if subscription.Context == "" {
+		subscription.Context = Notification2ContextTenant
+		if hasSource {
+			subscription.Context = Notification2ContextManagedObject
+		}
+	}
+
+	switch subscription.Context {
+	case Notification2ContextTenant:
+		if hasSource {
+			return subscription, fmt.Errorf("%w. tenant subscriptions do not support a source. subscription=%s", ErrInvalidSubscription, subscription.Subscription)
+		}
+		subscription.Source = nil
+	case Notification2ContextManagedObject:
+		if !hasSource {
+			return subscription, fmt.Errorf("%w. mo subscriptions require a source. subscription=%s", ErrInvalidSubscription, subscription.Subscription)
+		}
+	default:
+		return subscription, fmt.Errorf("%w. unsupported context: %s", ErrInvalidSubscription, subscription.Context)
+	}
+	return subscription, nil
+}
+
+// subscriptionEqual returns true if the existing subscription matches the desired definition
+func subscriptionEqual(existing, desired Notification2Subscription) bool {
+	return subscriptionKey(existing) == subscriptionKey(desired) &&
+		existing.SubscriptionFilter.TypeFilter == desired.SubscriptionFilter.TypeFilter &&
+		existing.NonPersistent == desired.NonPersistent &&
+		sameElements(existing.SubscriptionFilter.Apis, desired.SubscriptionFilter.Apis) &&
+		sameElements(existing.FragmentsToCopy, desired.FragmentsToCopy)
+}
+
+// sameElements compares two lists ignoring the order
+func sameElements(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// isManaged returns true if the existing subscription is owned by the manager
+func (m *Notification2SubscriptionManager) isManaged(subscription Notification2Subscription, wanted map[notification2SubscriptionKey]Notification2Subscription) bool {
+	if _, ok := wanted[subscriptionKey(subscription)]; ok {
+		return true
+	}
+	return m.options.Prefix != "" && strings.HasPrefix(subscription.Subscription, m.options.Prefix)
+}
+
+// Reconcile creates, updates and deletes subscriptions so that the managed subscriptions match the desired set.
+// It is idempotent, so it can be called each time the service starts.
+//
+// Subscriptions are identified by their context, source and name. The notification2 api does not support
+// updating a subscription, so a subscription with a different filter, fragments to copy or persistence is
+// deleted and created again. Deleting a subscription also deletes its queue, so any notifications which have not
+// been consumed yet are lost, and notifications sent between the delete and create are not delivered.
+// Managed subscriptions which are not in the desired set are deleted. The subscriptions are changed
+// even if some of the changes fail, and the errors are returned together
+func (m *Notification2SubscriptionManager) Reconcile(ctx context.Context, desired []Notification2Subscription) (*Notification2ReconcileResult, error) {
+	result := &Notification2ReconcileResult{}
+
+	wanted := make(map[notification2SubscriptionKey]Notification2Subscription, len(desired))
+	order := make([]notification2SubscriptionKey, 0, len(desired))
+	for _, item := range desired {
+		subscription, err := normalizeSubscription(item)
+		if err != nil {
+			return result, err
+		}
+		key := subscriptionKey(subscription)
+		if _, exists := wanted[key]; exists {
+			return result, fmt.Errorf("%w. duplicate subscription: %s", ErrInvalidSubscription, key)
+		}
+		wanted[key] = subscription
+		order = append(order, key)
+	}
+
+	existing, err := Collect(m.service.IterSubscriptions(ctx, &Notification2SubscriptionCollectionOptions{
+		PaginationOptions: *NewPaginationOptions(100),
+	}, PaginateLimits{}))
+	if err != nil {
+		return result, fmt.Errorf("failed to get existing subscriptions. %w", err)
+	}
+
+	errs := []error{}
+	found := make(map[notification2SubscriptionKey]bool, len(existing))
+	for _, subscription := range existing {
+		if !m.isManaged(subscription, wanted) {
+			continue
+		}
+		key := subscriptionKey(subscription)
+		target, ok := wanted[key]
+		if !ok || found[key] {
+			Logger.Infof("Deleting subscription. id=%s, key=%s", subscription.ID, key)
+			if _, err := m.service.DeleteSubscription(ctx, subscription.ID); err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete subscription %s. %w", key, err))
+				continue
+			}
+			result.Deleted = append(result.Deleted, subscription)
+			continue
+		}
+		found[key] = true
+
+		if subscriptionEqual(subscription, target) {
+			result.Unchanged = append(result.Unchanged, subscription)
+			continue
+		}
+
+		Logger.Infof("Updating subscription. id=%s, key=%s", subscription.ID, key)
+		if _, err := m.service.DeleteSubscription(ctx, subscription.ID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to update subscription %s. %w", key, err))
+			continue
+		}
+		created, err := m.createSubscription(ctx, target)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to update subscription %s. %w", key, err))
+			continue
+		}
+		result.Updated = append(result.Updated, created)
+	}
+
+	for _, key := range order {
+		if found[key] {
+			continue
+		}
+		Logger.Infof("Creating subscription. key=%s", key)
+		created, err := m.createSubscription(ctx, wanted[key])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to create subscription %s. %w", key, err))
+			continue
+		}
+		result.Created = append(result.Created, created)
+	}
+	return result, errors.Join(errs...)
+}
+
+func (m *Notification2SubscriptionManager) createSubscription(ctx context.Context, subscription Notification2Subscription) (Notification2Subscription, error) {
+	data := Notification2Subscription{}
+	resp, err := m.service.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Notification2.CreateSubscription",
+		Method:       http.MethodPost,
+		Path:         "notification2/subscriptions",
+		Body:         subscription,
+		ResponseData: &data,
+	})
+	if err != nil {
+		return data, err
+	}
+	if resp != nil {
+		data.Item = resp.JSON()
+	}
+	return data, nil
+}
+
+// CreateClient creates a notification2 client (see Notification2Service.CreateClient) which is closed,
+// and optionally unsubscribed, when the manager is shut down
+func (m *Notification2SubscriptionManager) CreateClient(ctx context.Context, opt Notification2ClientOptions) (*notification2.Notification2Client, error) {
+	client, err := m.service.CreateClient(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.clients = append(m.clients, client)
+	m.mu.Unlock()
+	return client, nil
+}
+
+// Shutdown closes the clients created by the manager. If UnsubscribeOnShutdown is set, then the subscribers
+// are also unsubscribed so that they don't remain as orphans once the service has been removed
+func (m *Notification2SubscriptionManager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	clients := m.clients
+	m.clients = nil
+	m.mu.Unlock()
+
+	errs := []error{}
+	for _, client := range clients {
+		token := client.Token()
+		if err := client.Close(); err != nil {
+			Logger.Warnf("Failed to close notification2 client. %s", err)
+		}
+		if !m.options.UnsubscribeOnShutdown {
+			continue
+		}
+		if err := m.unsubscribe(ctx, token); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// unsubscribe removes the subscriber of the token. A new token is created for the same subscriber if it has expired
+func (m *Notification2SubscriptionManager) unsubscribe(ctx context.Context, token string) error {
+	claims, err := m.service.ParseToken(token)
+	if err != nil {
+		return fmt.Errorf("failed to unsubscribe subscriber. %w", err)
+	}
+	if claims.HasExpired() {
+		renewed, _, err := m.service.CreateToken(ctx, Notification2TokenOptions{
+			ExpiresInMinutes: MinTokenMinutes,
+			Subscriber:       claims.Subscriber,
+			Subscription:     claims.Subscription(),
+			Shared:           claims.IsShared(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to unsubscribe subscriber %s. %w", claims.Subscriber, err)
+		}
+		token = renewed.Token
+	}
+
+	Logger.Infof("Unsubscribing subscriber. subscriber=%s, subscription=%s", claims.Subscriber, claims.Subscription())
+	if _, _, err := m.service.UnsubscribeSubscriber(ctx, token); err != nil {
+		return fmt.Errorf("failed to unsubscribe subscriber %s. %w", claims.Subscriber, err)
+	}
+	return nil
+}
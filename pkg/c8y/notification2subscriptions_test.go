@@ -0,0 +1,185 @@
+package c8y_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/reubenmiller/go-c8y/pkg/c8y"
+	"github.com/reubenmiller/go-c8y/pkg/c8ytest"
+)
+
+func tenantSubscription(name string, apis ...string) c8y.Notification2Subscription {
+	return c8y.Notification2Subscription{
+		Context:            c8y.Notification2ContextTenant,
+		Subscription:       name,
+		SubscriptionFilter: c8y.Notification2SubscriptionFilter{Apis: apis},
+	}
+}
+
+// newSubscriptionTestServer returns a fake server which already has the given subscriptions
+func newSubscriptionTestServer(t *testing.T, existing ...c8y.Notification2Subscription) (*c8ytest.Server, *c8y.Client) {
+	t.Helper()
+	srv := c8ytest.NewServer(c8ytest.Options{})
+	t.Cleanup(srv.Close)
+	client := srv.NewClient()
+	for _, subscription := range existing {
+		if _, _, err := client.Notification2.CreateSubscription(context.Background(), "", subscription); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return srv, client
+}
+
+func getSubscriptions(t *testing.T, client *c8y.Client) []c8y.Notification2Subscription {
+	t.Helper()
+	subscriptions, err := c8y.Collect(client.Notification2.IterSubscriptions(context.Background(), &c8y.Notification2SubscriptionCollectionOptions{
+		PaginationOptions: *c8y.NewPaginationOptions(100),
+	}, c8y.PaginateLimits{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return subscriptions
+}
+
+func TestNotification2SubscriptionManager_Reconcile(t *testing.T) {
+	existing := []c8y.Notification2Subscription{
+		tenantSubscription("svcAlarms", "alarms"),
+		tenantSubscription("svcEvents", "events"),
+		tenantSubscription("svcOld", "alarms"),
+		tenantSubscription("otherService", "alarms"),
+		{Context: c8y.Notification2ContextManagedObject, Source: &c8y.Source{ID: "12345"}, Subscription: "svcDevice"},
+	}
+	// add enough unmanaged subscriptions to require multiple pages
+	for i := range 150 {
+		existing = append(existing, tenantSubscription(fmt.Sprintf("unmanaged%d", i), "alarms"))
+	}
+	existing = append(existing, tenantSubscription("svcLast", "measurements"))
+
+	_, client := newSubscriptionTestServer(t, existing...)
+	manager := client.Notification2.NewSubscriptionManager(c8y.Notification2SubscriptionManagerOptions{Prefix: "svc"})
+
+	desired := []c8y.Notification2Subscription{
+		// unchanged
+		{Subscription: "svcAlarms", SubscriptionFilter: c8y.Notification2SubscriptionFilter{Apis: []string{"alarms"}}},
+		// changed filter
+		{Subscription: "svcEvents", SubscriptionFilter: c8y.Notification2SubscriptionFilter{Apis: []string{"events"}, TypeFilter: "c8y_Test"}},
+		// context is detected from the source
+		{Subscription: "svcDevice", Source: &c8y.Source{ID: "12345"}},
+		// new
+		{Subscription: "svcNew", NonPersistent: true, FragmentsToCopy: []string{"c8y_Position"}},
+		// only found on the second page
+		{Subscription: "svcLast", SubscriptionFilter: c8y.Notification2SubscriptionFilter{Apis: []string{"measurements"}}},
+	}
+
+	result, err := manager.Reconcile(context.Background(), desired)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := func(items []c8y.Notification2Subscription) []string {
+		out := []string{}
+		for _, item := range items {
+			out = append(out, item.Subscription)
+		}
+		slices.Sort(out)
+		return out
+	}
+	if got, want := names(result.Unchanged), []string{"svcAlarms", "svcDevice", "svcLast"}; !slices.Equal(got, want) {
+		t.Errorf("unchanged: got %v, want %v", got, want)
+	}
+	if got, want := names(result.Updated), []string{"svcEvents"}; !slices.Equal(got, want) {
+		t.Errorf("updated: got %v, want %v", got, want)
+	}
+	if got, want := names(result.Created), []string{"svcNew"}; !slices.Equal(got, want) {
+		t.Errorf("created: got %v, want %v", got, want)
+	}
+	if got, want := names(result.Deleted), []string{"svcOld"}; !slices.Equal(got, want) {
+		t.Errorf("deleted: got %v, want %v", got, want)
+	}
+	if len(result.Created) == 1 && (!result.Created[0].NonPersistent || result.Created[0].Context != c8y.Notification2ContextTenant) {
+		t.Errorf("created: got %+v, want a non-persistent tenant subscription", result.Created[0])
+	}
+	subscriptions := getSubscriptions(t, client)
+	if got, want := len(subscriptions), len(existing); got != want {
+		t.Errorf("subscriptions: got %d, want %d", got, want)
+	}
+
+	// Reconciling again does not change anything
+	result, err = manager.Reconcile(context.Background(), desired)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Created)+len(result.Updated)+len(result.Deleted) != 0 || len(result.Unchanged) != len(desired) {
+		t.Errorf("second reconcile: got %+v, want no changes", result)
+	}
+	if got := names(getSubscriptions(t, client)); !slices.Equal(got, names(subscriptions)) {
+		t.Errorf("second reconcile: subscriptions were changed")
+	}
+}
+
+func TestNotification2SubscriptionManager_ReconcileWithoutPrefix(t *testing.T) {
+	_, client := newSubscriptionTestServer(t,
+		c8y.Notification2Subscription{Context: c8y.Notification2ContextManagedObject, Source: &c8y.Source{ID: "12345"}, Subscription: "device"},
+		c8y.Notification2Subscription{Context: c8y.Notification2ContextManagedObject, Source: &c8y.Source{ID: "67890"}, Subscription: "device"},
+		tenantSubscription("device", "alarms"),
+	)
+	manager := client.Notification2.NewSubscriptionManager(c8y.Notification2SubscriptionManagerOptions{})
+
+	result, err := manager.Reconcile(context.Background(), []c8y.Notification2Subscription{
+		{Subscription: "device", Source: &c8y.Source{ID: "12345"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Unchanged) != 1 || len(result.Created)+len(result.Updated)+len(result.Deleted) != 0 {
+		t.Errorf("result: got %+v, want only the matching subscription to be unchanged", result)
+	}
+	if got := getSubscriptions(t, client); len(got) != 3 {
+		t.Errorf("subscriptions with the same name but a different context or source should not be deleted. got %+v", got)
+	}
+}
+
+func TestNotification2SubscriptionManager_InvalidSubscriptions(t *testing.T) {
+	_, client := newSubscriptionTestServer(t)
+	manager := client.Notification2.NewSubscriptionManager(c8y.Notification2SubscriptionManagerOptions{})
+
+	tests := map[string][]c8y.Notification2Subscription{
+		"missing name":        {{Context: c8y.Notification2ContextTenant}},
+		"mo without source":   {{Context: c8y.Notification2ContextManagedObject, Subscription: "a"}},
+		"tenant with source":  {{Context: c8y.Notification2ContextTenant, Source: &c8y.Source{ID: "1"}, Subscription: "a"}},
+		"unsupported context": {{Context: "group", Subscription: "a"}},
+		"duplicate":           {{Subscription: "a"}, {Subscription: "a", NonPersistent: true}},
+	}
+	for name, desired := range tests {
+		if _, err := manager.Reconcile(context.Background(), desired); !errors.Is(err, c8y.ErrInvalidSubscription) {
+			t.Errorf("%s: got %v, want ErrInvalidSubscription", name, err)
+		}
+	}
+}
+
+func TestNotification2SubscriptionManager_UnsubscribeOnShutdown(t *testing.T) {
+	srv, client := newSubscriptionTestServer(t)
+	manager := client.Notification2.NewSubscriptionManager(c8y.Notification2SubscriptionManagerOptions{UnsubscribeOnShutdown: true})
+
+	token := srv.NewNotification2Token("svc", "svcAlarms", false, time.Hour)
+	if _, err := manager.CreateClient(context.Background(), c8y.Notification2ClientOptions{Token: token}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := manager.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := srv.Notification2Unsubscribed(); !slices.Equal(got, []string{token}) {
+		t.Errorf("unsubscribed: got %v, want the client token", got)
+	}
+
+	// The clients are only unsubscribed once
+	if err := manager.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := srv.Notification2Unsubscribed(); len(got) != 1 {
+		t.Errorf("unsubscribed: got %d, want 1", len(got))
+	}
+}
@@ -2,6 +2,7 @@ package c8y
 
 import (
 	"context"
+	"iter"
 
 	"github.com/tidwall/gjson"
 )
@@ -62,6 +63,7 @@ type OperationUpdateOptions struct {
 func (s *OperationService) GetOperation(ctx context.Context, ID string) (*Operation, *Response, error) {
 	data := new(Operation)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Operation.GetOperation",
 		Method:       "GET",
 		Path:         "devicecontrol/operations/" + ID,
 		ResponseData: data,
@@ -73,6 +75,7 @@ func (s *OperationService) GetOperation(ctx context.Context, ID string) (*Operat
 func (s *OperationService) GetOperations(ctx context.Context, opt *OperationCollectionOptions) (*OperationCollection, *Response, error) {
 	data := new(OperationCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Operation.GetOperations",
 		Method:       "GET",
 		Path:         "devicecontrol/operations",
 		Query:        opt,
@@ -81,12 +84,24 @@ func (s *OperationService) GetOperations(ctx context.Context, opt *OperationColl
 	return data, resp, err
 }
 
+// IterOperations returns an iterator over all operations matching the given options. Pages are fetched
+// lazily by following the .next links. See Paginate for more details
+func (s *OperationService) IterOperations(ctx context.Context, opt *OperationCollectionOptions, limits PaginateLimits) iter.Seq2[Operation, error] {
+	return Paginate[Operation](ctx, s.client, RequestOptions{
+		Operation: "Operation.IterOperations",
+		Method:    "GET",
+		Path:      "devicecontrol/operations",
+		Query:     opt,
+	}, "operations", limits)
+}
+
 // DeleteOperations deletes a collection of Cumulocity operations
 func (s *OperationService) DeleteOperations(ctx context.Context, opt *OperationCollectionOptions) (*Response, error) {
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "devicecontrol/operations",
-		Query:  opt,
+		Operation: "Operation.DeleteOperations",
+		Method:    "DELETE",
+		Path:      "devicecontrol/operations",
+		Query:     opt,
 	})
 	return resp, err
 }
@@ -95,6 +110,7 @@ func (s *OperationService) DeleteOperations(ctx context.Context, opt *OperationC
 func (s *OperationService) Create(ctx context.Context, body interface{}) (*Operation, *Response, error) {
 	data := new(Operation)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Operation.Create",
 		Method:       "POST",
 		Path:         "devicecontrol/operations",
 		Body:         body,
@@ -107,6 +123,7 @@ func (s *OperationService) Create(ctx context.Context, body interface{}) (*Opera
 func (s *OperationService) Update(ctx context.Context, ID string, body *OperationUpdateOptions) (*Operation, *Response, error) {
 	data := new(Operation)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Operation.Update",
 		Method:       "PUT",
 		Path:         "devicecontrol/operations/" + ID,
 		Body:         body,
@@ -0,0 +1,132 @@
+package c8y
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"reflect"
+
+	"github.com/tidwall/gjson"
+)
+
+// PaginateLimits limits the number of results returned when iterating over a collection
+type PaginateLimits struct {
+	// MaxItems is the maximum number of items to return. 0 means no limit
+	MaxItems int
+
+	// MaxPages is the maximum number of pages to request. 0 means no limit
+	MaxPages int
+}
+
+// Paginate returns a lazy iterator over all items of a collection. The first page is requested using
+// the given request options (the Query should include the PaginationOptions), and each following page
+// is requested by following the .next link of the previous page. Pages are only fetched when the
+// iterator is consumed.
+//
+// property is the name of the collection's array property in the response, e.g. "alarms" or "managedObjects".
+// Each item is decoded into T, and if T has an Item gjson.Result field then it will be set to the raw item.
+//
+// Iteration stops after the first error (which is yielded), when the context is done,
+// when the last page has been reached, or when one of the limits is reached.
+//
+// Example:
+//
+//	for alarm, err := range c8y.Paginate[c8y.Alarm](ctx, client, opts, "alarms", c8y.PaginateLimits{}) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(alarm.ID)
+//	}
+func Paginate[T any](ctx context.Context, client *Client, options RequestOptions, property string, limits PaginateLimits) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		if options.Method == "" {
+			options.Method = http.MethodGet
+		}
+		options.ResponseData = nil
+
+		pages := 0
+		items := 0
+
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+
+			resp, err := client.SendRequest(ctx, options)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if resp.IsDryRun() {
+				return
+			}
+			pages++
+
+			page := resp.JSON(property).Array()
+			for _, raw := range page {
+				item, err := decodePageItem[T](raw)
+				if !yield(item, err) || err != nil {
+					return
+				}
+				items++
+				if limits.MaxItems > 0 && items >= limits.MaxItems {
+					return
+				}
+			}
+
+			if limits.MaxPages > 0 && pages >= limits.MaxPages {
+				return
+			}
+
+			// Stop on the last page. Cumulocity always includes the next link even if there are no more results
+			if len(page) == 0 {
+				return
+			}
+			if pageSize := resp.JSON("statistics.pageSize"); pageSize.Exists() && len(page) < int(pageSize.Int()) {
+				return
+			}
+			next := resp.JSON("next").String()
+			if next == "" {
+				return
+			}
+
+			nextURL, err := url.Parse(next)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			options.Path = nextURL.Path
+			options.Query = nextURL.RawQuery
+		}
+	}
+}
+
+// decodePageItem decodes a single collection item and sets the optional Item field
+func decodePageItem[T any](raw gjson.Result) (T, error) {
+	var item T
+	if err := DecodeJSONBytes([]byte(raw.Raw), &item); err != nil {
+		return item, err
+	}
+	rv := reflect.ValueOf(&item).Elem()
+	if rv.Kind() == reflect.Struct {
+		if field := rv.FieldByName("Item"); field.IsValid() && field.CanSet() && field.Type() == reflect.TypeOf(raw) {
+			field.Set(reflect.ValueOf(raw))
+		}
+	}
+	return item, nil
+}
+
+// Collect consumes an iterator and returns all of the items. Collection stops at the first error
+func Collect[T any](seq iter.Seq2[T, error]) ([]T, error) {
+	items := make([]T, 0)
+	for item, err := range seq {
+		if err != nil {
+			return items, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,411 @@
+package c8y
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ParallelPaginateOptions controls how pages are fetched concurrently
+type ParallelPaginateOptions struct {
+	// Workers is the maximum number of pages which are requested at the same time. Defaults to 4
+	Workers int
+
+	// PageSize used for each request. If not set, the pageSize of the request options is used
+	PageSize int
+
+	PaginateLimits
+}
+
+func (o ParallelPaginateOptions) getWorkers() int {
+	if o.Workers <= 0 {
+		return 4
+	}
+	return o.Workers
+}
+
+// setQueryValues returns a copy of the request options where the given query parameters
+// are replaced. Any query parameters in the path are moved to the query.
+func setQueryValues(options RequestOptions, values url.Values) (RequestOptions, error) {
+	rawQuery, err := options.GetQuery()
+	if err != nil {
+		return options, err
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return options, err
+	}
+	for key, value := range values {
+		query[key] = value
+	}
+
+	tempURL, err := url.Parse(options.Path)
+	if err != nil {
+		return options, err
+	}
+	tempURL.RawQuery = ""
+	options.Path = tempURL.String()
+	options.Query = query.Encode()
+	return options, nil
+}
+
+type pageResult[T any] struct {
+	items      []T
+	totalPages int
+	err        error
+
+	// hasTotalPages is true if the response included the total number of pages
+	hasTotalPages bool
+
+	// last is true if the page is the last page, i.e. it is empty or not full
+	last bool
+}
+
+// fetchPage requests a single page using the currentPage query parameter
+func fetchPage[T any](ctx context.Context, client *Client, options RequestOptions, property string, page int, pageSize int) pageResult[T] {
+	values := url.Values{}
+	values.Set("currentPage", strconv.Itoa(page))
+	if pageSize > 0 {
+		values.Set("pageSize", strconv.Itoa(pageSize))
+	}
+	if page == 1 {
+		values.Set("withTotalPages", "true")
+	}
+
+	pageOptions, err := setQueryValues(options, values)
+	if err != nil {
+		return pageResult[T]{err: err}
+	}
+	if pageOptions.Method == "" {
+		pageOptions.Method = http.MethodGet
+	}
+	pageOptions.ResponseData = nil
+
+	resp, err := client.SendRequest(ctx, pageOptions)
+	if err != nil {
+		return pageResult[T]{err: err}
+	}
+	if resp.IsDryRun() {
+		return pageResult[T]{last: true}
+	}
+
+	totalPages := resp.JSON("statistics.totalPages")
+	raw := resp.JSON(property).Array()
+	result := pageResult[T]{
+		totalPages:    int(totalPages.Int()),
+		hasTotalPages: totalPages.Exists(),
+		last:          len(raw) == 0,
+	}
+	if pageSize := resp.JSON("statistics.pageSize"); pageSize.Exists() && len(raw) < int(pageSize.Int()) {
+		result.last = true
+	}
+	result.items = make([]T, 0, len(raw))
+	for _, v := range raw {
+		item, err := decodePageItem[T](v)
+		if err != nil {
+			result.err = err
+			return result
+		}
+		result.items = append(result.items, item)
+	}
+	return result
+}
+
+// PaginateParallel returns an iterator over all items of a collection where the pages are fetched
+// concurrently using a bounded pool of workers. The first page is requested with withTotalPages=true
+// to get the total number of pages, then the remaining pages are requested using currentPage=N.
+//
+// Items are yielded in the same order as they would be when fetching the pages sequentially.
+// At most Workers pages are buffered in memory at any time.
+//
+// If the endpoint does not return the total number of pages (e.g. it does not support withTotalPages),
+// then the remaining pages are requested sequentially until the last page is reached.
+// The total page count can also be unreliable on collections which change whilst being exported.
+// Use PaginateByDateRange in such cases.
+func PaginateParallel[T any](ctx context.Context, client *Client, options RequestOptions, property string, opts ParallelPaginateOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		first := fetchPage[T](ctx, client, options, property, 1, opts.PageSize)
+		if first.err != nil {
+			yield(zero, first.err)
+			return
+		}
+
+		totalPages := first.totalPages
+		if opts.MaxPages > 0 && totalPages > opts.MaxPages {
+			totalPages = opts.MaxPages
+		}
+
+		items := 0
+		emit := func(result pageResult[T]) bool {
+			for _, item := range result.items {
+				if !yield(item, nil) {
+					return false
+				}
+				items++
+				if opts.MaxItems > 0 && items >= opts.MaxItems {
+					return false
+				}
+			}
+			if result.err != nil {
+				yield(zero, result.err)
+				return false
+			}
+			return true
+		}
+
+		if !emit(first) {
+			return
+		}
+
+		if !first.hasTotalPages {
+			if first.last {
+				return
+			}
+			paginateRemaining(ctx, client, options, property, opts, items, yield)
+			return
+		}
+
+		// Pages are requested in order, and each page has its own result channel
+		// so results can be emitted in order whilst still limiting the number of pages in memory
+		pending := make([]chan pageResult[T], 0, opts.getWorkers())
+		nextPage := 2
+		start := func() {
+			page := nextPage
+			nextPage++
+			out := make(chan pageResult[T], 1)
+			pending = append(pending, out)
+			go func() {
+				out <- fetchPage[T](ctx, client, options, property, page, opts.PageSize)
+			}()
+		}
+
+		for nextPage <= totalPages && len(pending) < opts.getWorkers() {
+			start()
+		}
+
+		for len(pending) > 0 {
+			var result pageResult[T]
+			select {
+			case result = <-pending[0]:
+			case <-ctx.Done():
+				yield(zero, ctx.Err())
+				return
+			}
+			pending = pending[1:]
+
+			if nextPage <= totalPages {
+				start()
+			}
+			if !emit(result) {
+				return
+			}
+		}
+	}
+}
+
+// paginateRemaining requests the pages after the first page sequentially. It is used when the total number
+// of pages is unknown, so the pages can't be requested concurrently
+func paginateRemaining[T any](ctx context.Context, client *Client, options RequestOptions, property string, opts ParallelPaginateOptions, items int, yield func(T, error) bool) {
+	var zero T
+	if opts.MaxPages == 1 {
+		return
+	}
+	values := url.Values{}
+	values.Set("currentPage", "2")
+	if opts.PageSize > 0 {
+		values.Set("pageSize", strconv.Itoa(opts.PageSize))
+	}
+	nextOptions, err := setQueryValues(options, values)
+	if err != nil {
+		yield(zero, err)
+		return
+	}
+
+	limits := PaginateLimits{}
+	if opts.MaxPages > 0 {
+		limits.MaxPages = opts.MaxPages - 1
+	}
+	if opts.MaxItems > 0 {
+		limits.MaxItems = opts.MaxItems - items
+	}
+	for item, err := range Paginate[T](ctx, client, nextOptions, property, limits) {
+		if !yield(item, err) {
+			return
+		}
+	}
+}
+
+// DateRangeShardOptions controls how a date range is split into shards which are fetched concurrently
+type DateRangeShardOptions struct {
+	// DateFrom start of the date range (inclusive)
+	DateFrom time.Time
+
+	// DateTo end of the date range
+	DateTo time.Time
+
+	// Shards is the number of equally sized date ranges to split the range into. Defaults to Workers
+	Shards int
+
+	// Workers is the maximum number of shards which are fetched at the same time. Defaults to 4
+	Workers int
+
+	// Buffer is the number of items each shard can buffer before it waits for the consumer. Defaults to 2000
+	Buffer int
+
+	// Descending yields the shards from the newest to the oldest date range, which matches
+	// the order of collections which return the newest items first (e.g. events and alarms)
+	Descending bool
+
+	// MaxItems is the maximum number of items to return. 0 means no limit
+	MaxItems int
+}
+
+func (o DateRangeShardOptions) getWorkers() int {
+	if o.Workers <= 0 {
+		return 4
+	}
+	return o.Workers
+}
+
+func (o DateRangeShardOptions) getShards() int {
+	if o.Shards <= 0 {
+		return o.getWorkers()
+	}
+	return o.Shards
+}
+
+func (o DateRangeShardOptions) getBuffer() int {
+	if o.Buffer <= 0 {
+		return 2000
+	}
+	return o.Buffer
+}
+
+// DateRangeShard a single date range
+type DateRangeShard struct {
+	DateFrom time.Time
+	DateTo   time.Time
+}
+
+// SplitDateRange splits a date range into n equally sized shards (in ascending order)
+func SplitDateRange(from time.Time, to time.Time, n int) []DateRangeShard {
+	if n < 1 {
+		n = 1
+	}
+	step := to.Sub(from) / time.Duration(n)
+	if step <= 0 {
+		return []DateRangeShard{{DateFrom: from, DateTo: to}}
+	}
+	shards := make([]DateRangeShard, 0, n)
+	for i := 0; i < n; i++ {
+		shard := DateRangeShard{
+			DateFrom: from.Add(time.Duration(i) * step),
+			DateTo:   from.Add(time.Duration(i+1) * step),
+		}
+		if i == n-1 {
+			shard.DateTo = to
+		}
+		shards = append(shards, shard)
+	}
+	return shards
+}
+
+type shardItem[T any] struct {
+	item T
+	err  error
+}
+
+// PaginateByDateRange returns an iterator over all items of a collection where the requested date range
+// is split into shards, and each shard is paginated sequentially (by following the .next links) in parallel
+// with the other shards. This is an alternative to PaginateParallel for endpoints where the total page count
+// is unreliable. The endpoint must support the dateFrom and dateTo query parameters.
+//
+// Items are yielded shard by shard so the order is preserved as long as the collection is sorted by date.
+func PaginateByDateRange[T any](ctx context.Context, client *Client, options RequestOptions, property string, opts DateRangeShardOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		if !opts.DateTo.After(opts.DateFrom) {
+			yield(zero, fmt.Errorf("invalid date range. dateTo must be after dateFrom"))
+			return
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		shards := SplitDateRange(opts.DateFrom, opts.DateTo, opts.getShards())
+		if opts.Descending {
+			for i, j := 0, len(shards)-1; i < j; i, j = i+1, j-1 {
+				shards[i], shards[j] = shards[j], shards[i]
+			}
+		}
+
+		outputs := make([]chan shardItem[T], len(shards))
+		for i := range outputs {
+			outputs[i] = make(chan shardItem[T], opts.getBuffer())
+		}
+
+		// Start the shards in the order they are consumed, limiting the number of concurrent shards
+		sem := make(chan struct{}, opts.getWorkers())
+		go func() {
+			for i, shard := range shards {
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					for _, out := range outputs[i:] {
+						close(out)
+					}
+					return
+				}
+				go func(shard DateRangeShard, out chan<- shardItem[T]) {
+					defer func() { <-sem }()
+					defer close(out)
+
+					values := url.Values{}
+					values.Set("dateFrom", shard.DateFrom.Format(time.RFC3339Nano))
+					values.Set("dateTo", shard.DateTo.Format(time.RFC3339Nano))
+					shardOptions, err := setQueryValues(options, values)
+					if err != nil {
+						out <- shardItem[T]{err: err}
+						return
+					}
+
+					for item, err := range Paginate[T](ctx, client, shardOptions, property, PaginateLimits{}) {
+						select {
+						case out <- shardItem[T]{item: item, err: err}:
+						case <-ctx.Done():
+							return
+						}
+						if err != nil {
+							return
+						}
+					}
+				}(shard, outputs[i])
+			}
+		}()
+
+		items := 0
+		for _, out := range outputs {
+			for v := range out {
+				if !yield(v.item, v.err) || v.err != nil {
+					return
+				}
+				items++
+				if opts.MaxItems > 0 && items >= opts.MaxItems {
+					return
+				}
+			}
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package c8y
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newPaginationTestServer serves a collection of alarms with the given total number of items.
+// Requests for the failPage return a 500 error
+func newPaginationTestServer(t *testing.T, total int, failPage int) (*httptest.Server, *int32) {
+	t.Helper()
+	return newPaginationTestServerWithOptions(t, total, failPage, true)
+}
+
+// newPaginationTestServerWithOptions is like newPaginationTestServer, but the total number of pages
+// is only included in the response if supportsTotalPages is true
+func newPaginationTestServerWithOptions(t *testing.T, total int, failPage int, supportsTotalPages bool) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		pageSize, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+		if pageSize == 0 {
+			pageSize = 5
+		}
+		currentPage, _ := strconv.Atoi(r.URL.Query().Get("currentPage"))
+		if currentPage == 0 {
+			currentPage = 1
+		}
+		if currentPage == failPage {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"general/internalError","message":"boom"}`))
+			return
+		}
+
+		items := ""
+		for i := (currentPage-1)*pageSize + 1; i <= total && i <= currentPage*pageSize; i++ {
+			if items != "" {
+				items += ","
+			}
+			items += fmt.Sprintf(`{"id":"%d","type":"c8y_TestAlarm"}`, i)
+		}
+		totalPages := ""
+		if supportsTotalPages && r.URL.Query().Get("withTotalPages") == "true" {
+			totalPages = fmt.Sprintf(`,"totalPages":%d`, (total+pageSize-1)/pageSize)
+		}
+		next := fmt.Sprintf("%s/alarm/alarms?pageSize=%d&currentPage=%d", srv.URL, pageSize, currentPage+1)
+		fmt.Fprintf(w, `{"next":%q,"statistics":{"pageSize":%d,"currentPage":%d%s},"alarms":[%s]}`, next, pageSize, currentPage, totalPages, items)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestPaginate_AllPages(t *testing.T) {
+	srv, requests := newPaginationTestServer(t, 5, 0)
+	client := NewClientFromOptions(nil, ClientOptions{BaseURL: srv.URL})
+
+	opt := &AlarmCollectionOptions{PaginationOptions: *NewPaginationOptions(2)}
+	alarms, err := Collect(client.Alarm.IterAlarms(context.Background(), opt, PaginateLimits{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(alarms) != 5 {
+		t.Fatalf("items: got %d, want 5", len(alarms))
+	}
+	for i, alarm := range alarms {
+		if want := strconv.Itoa(i + 1); alarm.ID != want {
+			t.Errorf("alarm %d: got id %q, want %q", i, alarm.ID, want)
+		}
+		if alarm.Item.Get("type").String() != "c8y_TestAlarm" {
+			t.Errorf("alarm %d: Item should be set", i)
+		}
+	}
+	// the last page is detected from the page size so no additional request is required
+	if got := atomic.LoadInt32(requests); got != 3 {
+		t.Errorf("requests: got %d, want 3", got)
+	}
+}
+
+func TestPaginate_Limits(t *testing.T) {
+	srv, requests := newPaginationTestServer(t, 10, 0)
+	client := NewClientFromOptions(nil, ClientOptions{BaseURL: srv.URL})
+	opt := &AlarmCollectionOptions{PaginationOptions: *NewPaginationOptions(2)}
+
+	alarms, err := Collect(client.Alarm.IterAlarms(context.Background(), opt, PaginateLimits{MaxItems: 3}))
+	if err != nil || len(alarms) != 3 {
+		t.Fatalf("MaxItems: got %d items (err=%v), want 3", len(alarms), err)
+	}
+	if got := atomic.LoadInt32(requests); got != 2 {
+		t.Errorf("MaxItems requests: got %d, want 2", got)
+	}
+
+	alarms, err = Collect(client.Alarm.IterAlarms(context.Background(), opt, PaginateLimits{MaxPages: 2}))
+	if err != nil || len(alarms) != 4 {
+		t.Errorf("MaxPages: got %d items (err=%v), want 4", len(alarms), err)
+	}
+}
+
+func TestPaginate_SurfacesErrors(t *testing.T) {
+	srv, _ := newPaginationTestServer(t, 10, 2)
+	client := NewClientFromOptions(nil, ClientOptions{BaseURL: srv.URL})
+	opt := &AlarmCollectionOptions{PaginationOptions: *NewPaginationOptions(2)}
+
+	alarms, err := Collect(client.Alarm.IterAlarms(context.Background(), opt, PaginateLimits{}))
+	if err == nil {
+		t.Fatal("expected the error from the second page")
+	}
+	if len(alarms) != 2 {
+		t.Errorf("items before the error: got %d, want 2", len(alarms))
+	}
+}
+
+func TestPaginate_ContextCancelled(t *testing.T) {
+	srv, requests := newPaginationTestServer(t, 10, 0)
+	client := NewClientFromOptions(nil, ClientOptions{BaseURL: srv.URL})
+	opt := &AlarmCollectionOptions{PaginationOptions: *NewPaginationOptions(2)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	count := 0
+	var lastErr error
+	for _, err := range client.Alarm.IterAlarms(ctx, opt, PaginateLimits{}) {
+		if err != nil {
+			lastErr = err
+			break
+		}
+		count++
+		if count == 2 {
+			cancel()
+		}
+	}
+	if lastErr != context.Canceled {
+		t.Errorf("error: got %v, want %v", lastErr, context.Canceled)
+	}
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("requests: got %d, want 1", got)
+	}
+}
+
+func TestPaginateParallel_InOrder(t *testing.T) {
+	srv, requests := newPaginationTestServer(t, 23, 0)
+	client := NewClientFromOptions(nil, ClientOptions{BaseURL: srv.URL})
+
+	options := RequestOptions{
+		Path:  "alarm/alarms",
+		Query: &AlarmCollectionOptions{PaginationOptions: *NewPaginationOptions(2)},
+	}
+	alarms, err := Collect(PaginateParallel[Alarm](context.Background(), client, options, "alarms", ParallelPaginateOptions{Workers: 3}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(alarms) != 23 {
+		t.Fatalf("items: got %d, want 23", len(alarms))
+	}
+	for i, alarm := range alarms {
+		if want := strconv.Itoa(i + 1); alarm.ID != want {
+			t.Fatalf("alarm %d: got id %q, want %q", i, alarm.ID, want)
+		}
+	}
+	if got := atomic.LoadInt32(requests); got != 12 {
+		t.Errorf("requests: got %d, want 12", got)
+	}
+}
+
+func TestPaginateParallel_SurfacesErrors(t *testing.T) {
+	srv, _ := newPaginationTestServer(t, 20, 3)
+	client := NewClientFromOptions(nil, ClientOptions{BaseURL: srv.URL})
+
+	options := RequestOptions{Path: "alarm/alarms"}
+	alarms, err := Collect(PaginateParallel[Alarm](context.Background(), client, options, "alarms", ParallelPaginateOptions{PageSize: 5}))
+	if err == nil {
+		t.Fatal("expected the error from the third page")
+	}
+	if len(alarms) != 10 {
+		t.Errorf("items before the error: got %d, want 10", len(alarms))
+	}
+}
+
+func TestPaginateParallel_WithoutTotalPages(t *testing.T) {
+	srv, requests := newPaginationTestServerWithOptions(t, 23, 0, false)
+	client := NewClientFromOptions(nil, ClientOptions{BaseURL: srv.URL})
+
+	options := RequestOptions{Path: "alarm/alarms"}
+	alarms, err := Collect(PaginateParallel[Alarm](context.Background(), client, options, "alarms", ParallelPaginateOptions{PageSize: 5}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(alarms) != 23 {
+		t.Fatalf("items: got %d, want 23", len(alarms))
+	}
+	for i, alarm := range alarms {
+		if want := strconv.Itoa(i + 1); alarm.ID != want {
+			t.Fatalf("alarm %d: got id %q, want %q", i, alarm.ID, want)
+		}
+	}
+	if got := atomic.LoadInt32(requests); got != 5 {
+		t.Errorf("requests: got %d, want 5", got)
+	}
+
+	// The limits still apply to the sequentially requested pages
+	alarms, err = Collect(PaginateParallel[Alarm](context.Background(), client, options, "alarms", ParallelPaginateOptions{
+		PageSize:       5,
+		PaginateLimits: PaginateLimits{MaxItems: 12},
+	}))
+	if err != nil || len(alarms) != 12 {
+		t.Errorf("max items: got %d items (err=%v), want 12", len(alarms), err)
+	}
+}
+
+func TestSplitDateRange(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(10 * time.Hour)
+
+	shards := SplitDateRange(from, to, 3)
+	if len(shards) != 3 {
+		t.Fatalf("shards: got %d, want 3", len(shards))
+	}
+	if !shards[0].DateFrom.Equal(from) || !shards[2].DateTo.Equal(to) {
+		t.Errorf("shards should cover the whole range: got %v", shards)
+	}
+	for i := 1; i < len(shards); i++ {
+		if !shards[i].DateFrom.Equal(shards[i-1].DateTo) {
+			t.Errorf("shard %d: should start where the previous shard ended", i)
+		}
+	}
+}
+
+func TestPaginateByDateRange(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// one item per hour
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		dateFrom, err1 := time.Parse(time.RFC3339Nano, r.URL.Query().Get("dateFrom"))
+		dateTo, err2 := time.Parse(time.RFC3339Nano, r.URL.Query().Get("dateTo"))
+		if err1 != nil || err2 != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		items := ""
+		for ts := dateFrom; ts.Before(dateTo); ts = ts.Add(time.Hour) {
+			if items != "" {
+				items += ","
+			}
+			items += fmt.Sprintf(`{"id":"%d"}`, int(ts.Sub(from).Hours()))
+		}
+		fmt.Fprintf(w, `{"statistics":{"pageSize":100},"events":[%s]}`, items)
+	}))
+	defer srv.Close()
+	client := NewClientFromOptions(nil, ClientOptions{BaseURL: srv.URL})
+
+	options := RequestOptions{Path: "event/events", Query: "pageSize=100&dateFrom=ignored"}
+	events, err := Collect(PaginateByDateRange[Event](context.Background(), client, options, "events", DateRangeShardOptions{
+		DateFrom: from,
+		DateTo:   from.Add(24 * time.Hour),
+		Shards:   6,
+		Workers:  2,
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 24 {
+		t.Fatalf("items: got %d, want 24", len(events))
+	}
+	for i, event := range events {
+		if want := strconv.Itoa(i); event.ID != want {
+			t.Fatalf("event %d: got id %q, want %q", i, event.ID, want)
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 6 {
+		t.Errorf("requests: got %d, want 6", got)
+	}
+}
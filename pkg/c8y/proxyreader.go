@@ -2,6 +2,7 @@ package c8y
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -20,6 +21,14 @@ func (r ProxyReader) Close() error {
 	return nil
 }
 
+// Seek sets the offset of the underlying reader if it supports seeking
+func (r ProxyReader) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := r.reader.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, errors.New("reader does not support seeking")
+}
+
 func (r ProxyReader) GetValue() string {
 	if r.value == nil {
 		return "<nil>"
@@ -0,0 +1,328 @@
+package c8y
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultRateLimitIdleTimeout is the default time after which the limits of an unused tenant are removed
+const DefaultRateLimitIdleTimeout = 10 * time.Minute
+
+// RateLimitOptions controls the client side rate limiting of outgoing requests.
+// Limits are applied per tenant so that traffic of one tenant can not starve another tenant
+type RateLimitOptions struct {
+	// RequestsPerSecond is the sustained number of requests per second allowed per tenant.
+	// A value of 0 disables the rate limiter
+	RequestsPerSecond float64
+
+	// Burst is the maximum number of requests which can be sent at once. Defaults to 1
+	Burst int
+
+	// MaxInFlight is the maximum number of concurrent requests per tenant. A value of 0 disables the limit.
+	// A request is considered in-flight until its response body has been closed
+	MaxInFlight int
+
+	// DefaultTenant is used when the tenant can not be detected from the Authorization header, and the request
+	// was not sent by a Client with a TenantName (e.g. a bearer token without a tenant claim, or a cookie session)
+	DefaultTenant string
+
+	// KeyFunc overrides how the limiter key is derived from a request
+	KeyFunc func(*http.Request) string
+
+	// IdleTimeout is the time after which the limits of a key which has not been used are removed, so that
+	// keys which are only used for a short time (e.g. per user or token) do not accumulate.
+	// Defaults to DefaultRateLimitIdleTimeout
+	IdleTimeout time.Duration
+}
+
+// WithRateLimit limits the request rate and the number of concurrent requests per tenant
+func WithRateLimit(opts RateLimitOptions) ClientOption {
+	limiter := NewRateLimiter(opts)
+	return func(tr http.RoundTripper) http.RoundTripper {
+		return &funcTripper{roundTrip: func(req *http.Request) (*http.Response, error) {
+			return limiter.RoundTrip(tr, req)
+		}}
+	}
+}
+
+// RateLimiter token bucket rate limiter and concurrency governor keyed by tenant
+type RateLimiter struct {
+	opts      RateLimitOptions
+	mu        sync.Mutex
+	tenants   map[string]*tenantLimiter
+	lastSweep time.Time
+}
+
+type tenantLimiter struct {
+	bucket   *tokenBucket
+	inFlight chan struct{}
+
+	// lastUsed is protected by the RateLimiter's mutex
+	lastUsed time.Time
+}
+
+// idle returns true if the limiter has no requests in-flight and all of its tokens are available,
+// so removing it does not change the limits
+func (v *tenantLimiter) idle(now time.Time) bool {
+	if len(v.inFlight) > 0 {
+		return false
+	}
+	return v.bucket == nil || v.bucket.full(now)
+}
+
+// NewRateLimiter creates a new rate limiter
+func NewRateLimiter(opts RateLimitOptions) *RateLimiter {
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultRateLimitIdleTimeout
+	}
+	return &RateLimiter{
+		opts:      opts,
+		tenants:   make(map[string]*tenantLimiter),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *RateLimiter) get(key string) *tenantLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.evictIdle(now)
+	if v, ok := l.tenants[key]; ok {
+		v.lastUsed = now
+		return v
+	}
+	v := &tenantLimiter{lastUsed: now}
+	if l.opts.RequestsPerSecond > 0 {
+		v.bucket = newTokenBucket(l.opts.RequestsPerSecond, l.opts.Burst)
+	}
+	if l.opts.MaxInFlight > 0 {
+		v.inFlight = make(chan struct{}, l.opts.MaxInFlight)
+	}
+	l.tenants[key] = v
+	return v
+}
+
+// evictIdle removes the limiters which have not been used within the idle timeout. The limiters
+// are checked at most once per idle timeout. The caller must hold the mutex
+func (l *RateLimiter) evictIdle(now time.Time) {
+	if now.Sub(l.lastSweep) < l.opts.IdleTimeout {
+		return
+	}
+	l.lastSweep = now
+	for key, v := range l.tenants {
+		if now.Sub(v.lastUsed) >= l.opts.IdleTimeout && v.idle(now) {
+			delete(l.tenants, key)
+		}
+	}
+}
+
+// Len returns the number of keys which are currently being limited
+func (l *RateLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.tenants)
+}
+
+// Key returns the limiter key (tenant) used for the request. The tenant is read from the Authorization header,
+// then from the TenantName of the Client sending the request, and lastly DefaultTenant is used
+func (l *RateLimiter) Key(req *http.Request) string {
+	if l.opts.KeyFunc != nil {
+		return l.opts.KeyFunc(req)
+	}
+	if tenant := TenantFromAuthorization(req.Header.Get("Authorization")); tenant != "" {
+		return tenant
+	}
+	if tenant := clientTenantFromContext(req.Context()); tenant != "" {
+		return tenant
+	}
+	return l.opts.DefaultTenant
+}
+
+// Wait blocks until the request is allowed to be sent. The returned release function must be called
+// once the request has finished
+func (l *RateLimiter) Wait(ctx context.Context, key string) (release func(), waited time.Duration, err error) {
+	limiter := l.get(key)
+	start := time.Now()
+	release = func() {}
+
+	if limiter.inFlight != nil {
+		select {
+		case limiter.inFlight <- struct{}{}:
+			var once sync.Once
+			release = func() {
+				once.Do(func() { <-limiter.inFlight })
+			}
+		case <-ctx.Done():
+			return release, time.Since(start), ctx.Err()
+		}
+	}
+
+	if limiter.bucket != nil {
+		if delay := limiter.bucket.reserve(time.Now()); delay > 0 {
+			if err := sleepContext(ctx, delay); err != nil {
+				release()
+				return func() {}, time.Since(start), err
+			}
+		}
+	}
+	return release, time.Since(start), nil
+}
+
+// RoundTrip sends the request using the given transport once the limits allow it
+func (l *RateLimiter) RoundTrip(tr http.RoundTripper, req *http.Request) (*http.Response, error) {
+	release, waited, err := l.Wait(req.Context(), l.Key(req))
+	addRateLimitWait(req.Context(), waited)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := tr.RoundTrip(req)
+	if err != nil || resp == nil || resp.Body == nil {
+		release()
+		return resp, err
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releaseOnClose releases the in-flight slot once the response body is closed or fully read
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseOnClose) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		r.release()
+	}
+	return n, err
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
+
+// tokenBucket is a simple token bucket which allows reserving tokens in the future
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// reserve takes a token and returns how long the caller has to wait before the token is available
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// full returns true if the bucket has refilled all of its tokens
+func (b *tokenBucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last.IsZero() || b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// TenantFromAuthorization returns the tenant referenced by an Authorization header value.
+// Basic auth values must use the {tenant}/{username} format, and bearer tokens must contain the tenant claim.
+// An empty string is returned if the tenant can not be detected
+func TenantFromAuthorization(auth string) string {
+	scheme, value, found := strings.Cut(strings.TrimSpace(auth), " ")
+	if !found {
+		return ""
+	}
+	value = strings.TrimSpace(value)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		raw, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return ""
+		}
+		username, _, _ := strings.Cut(string(raw), ":")
+		if tenant, _, found := strings.Cut(username, "/"); found {
+			return tenant
+		}
+	case "bearer":
+		claims := &CumulocityTokenClaim{}
+		if _, _, err := jwt.NewParser().ParseUnverified(value, claims); err == nil {
+			return claims.Tenant
+		}
+	}
+	return ""
+}
+
+// requestStats statistics collected by the transport layer whilst sending a request
+type requestStats struct {
+	rateLimitWait int64
+}
+
+type contextClientTenantKey string
+
+func getClientTenantContextKey() contextClientTenantKey {
+	return contextClientTenantKey("clientTenant")
+}
+
+// withClientTenant stores the TenantName of the client sending the request, so that the transport layer can use it
+// when the tenant is not part of the request's credentials
+func withClientTenant(ctx context.Context, tenant string) context.Context {
+	if tenant == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, getClientTenantContextKey(), tenant)
+}
+
+func clientTenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(getClientTenantContextKey()).(string)
+	return tenant
+}
+
+type contextRequestStatsKey string
+
+func getRequestStatsContextKey() contextRequestStatsKey {
+	return contextRequestStatsKey("requestStats")
+}
+
+func withRequestStats(ctx context.Context, stats *requestStats) context.Context {
+	return context.WithValue(ctx, getRequestStatsContextKey(), stats)
+}
+
+func addRateLimitWait(ctx context.Context, d time.Duration) {
+	if stats, ok := ctx.Value(getRequestStatsContextKey()).(*requestStats); ok && d > 0 {
+		atomic.AddInt64(&stats.rateLimitWait, int64(d))
+	}
+}
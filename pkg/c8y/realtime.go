@@ -1,6 +1,7 @@
 package c8y
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
@@ -10,8 +11,6 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
-	"os"
-	"os/signal"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,10 +19,10 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/obeattie/ohmyglob"
+	"github.com/reubenmiller/go-c8y/pkg/telemetry"
 	"github.com/reubenmiller/go-c8y/pkg/wsurl"
 	"github.com/tidwall/gjson"
 	"golang.org/x/net/publicsuffix"
-	tomb "gopkg.in/tomb.v2"
 )
 
 const (
@@ -51,6 +50,20 @@ const (
 	RetryBackoffFactor float64 = 1.5
 )
 
+var (
+	// ErrRealtimeNotConnected is returned when sending a message before the client is connected
+	ErrRealtimeNotConnected = errors.New("realtime client is not connected")
+
+	// ErrRealtimeClosed is returned when the client is closed whilst waiting for a response
+	ErrRealtimeClosed = errors.New("realtime client is closed")
+
+	// ErrRealtimeTimeout is returned when the server does not respond to a request in time
+	ErrRealtimeTimeout = errors.New("timeout waiting for response")
+
+	// ErrRealtimeReconnectNone is used when the server advises the client to not reconnect
+	ErrRealtimeReconnectNone = errors.New("server indicated that no retry or handshake should be done")
+)
+
 const (
 	writeWait = 10 * time.Second
 
@@ -65,11 +78,10 @@ type RealtimeClient struct {
 	url           *url.URL
 	c8yURL        *url.URL
 	clientID      string
-	tomb          *tomb.Tomb
 	messages      chan *Message
 	connected     bool
 	dialer        *websocket.Dialer
-	ws            *websocket.Conn
+	transport     realtimeTransport
 	extension     interface{}
 	tenant        string
 	username      string
@@ -77,11 +89,40 @@ type RealtimeClient struct {
 	requestID     uint64
 	requestHeader http.Header
 
+	// connectionTypeOption is the preferred Bayeux connection type
+	connectionTypeOption string
+	httpClient           *http.Client
+
+	// defaultHTTPClient is used for long-polling if httpClient is not set. It is reused when reconnecting
+	defaultHTTPClient *http.Client
+
 	send chan *request
 
 	hub *Hub
 
 	pendingRequests sync.Map
+
+	instrumentation *telemetry.Instrumentation
+
+	// traceCtx is the context given to Connect, which is used as the parent of the connection spans
+	traceCtx context.Context
+
+	// Lifecycle. Cancelling runCtx stops the writer (signalled via writerDone), and
+	// all other go routines which are tracked by wg
+	runCtx       context.Context
+	cancel       context.CancelFunc
+	writerDone   chan struct{}
+	wg           sync.WaitGroup
+	reconnecting atomic.Bool
+
+	// err is the reason why the server terminated the connection
+	err error
+
+	// session is read during the handshake which can be called while mtx is held
+	session atomic.Pointer[Session]
+
+	// listeners are notified about connection state changes and subscription acknowledgements
+	listeners *realtimeListeners
 }
 
 // Message is the type delivered to subscribers.
@@ -94,6 +135,7 @@ type Message struct {
 	Advice       *advice      `json:"advice,omitempty"`
 	Successful   bool         `json:"successful,omitempty"`
 	Subscription string       `json:"subscription,omitempty"`
+	Error        string       `json:"error,omitempty"`
 }
 
 // RealtimeData contains the websocket frame data
@@ -109,6 +151,16 @@ type subscription struct {
 	out        chan<- *Message
 	isWildcard bool
 	disabled   bool
+
+	// done is closed when the subscription is removed from the hub
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *subscription) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
 }
 
 type request struct {
@@ -183,13 +235,14 @@ func getC8yExtensionFromXSRFToken(token string) c8yExtensionMessage {
 func getRealtimeURL(host string) *url.URL {
 	c8yHost, err := wsurl.GetWebsocketURL(host, "cep/realtime")
 	if err != nil {
-		Logger.Fatalf("Invalid websocket url. %s", err)
+		Logger.Infof("Invalid websocket url. %s", err)
+		return nil
 	}
 	return c8yHost
 }
 
 // NewRealtimeClient initializes a new Bayeux client. By default `http.DefaultClient`
-// is used for HTTP connections.
+// is used for HTTP connections. No go routines are started until Connect is called
 func NewRealtimeClient(host string, wsDialer *websocket.Dialer, tenant, username, password string) *RealtimeClient {
 	if wsDialer == nil {
 		// Default client ignores self signed certificates (to enable compatibility to the edge which uses self signed certs)
@@ -221,10 +274,9 @@ func NewRealtimeClient(host string, wsDialer *websocket.Dialer, tenant, username
 		send: make(chan *request),
 
 		hub: NewHub(),
-	}
 
-	go client.hub.Run()
-	go client.writeHandler()
+		listeners: newRealtimeListeners(),
+	}
 	return client
 }
 
@@ -258,29 +310,78 @@ func (c *RealtimeClient) SetBearerToken(token string) {
 	c.extension = getC8yExtensionFromToken(token)
 }
 
+// SetSession sets the session used to authorize the handshake. The current session token
+// is used for each handshake, so it does not need to be set manually after it has been refreshed.
+// Use nil to remove the session
+func (c *RealtimeClient) SetSession(session *Session) {
+	c.session.Store(session)
+}
+
+// getExtension returns the extension used to authorize the handshake
+func (c *RealtimeClient) getExtension() interface{} {
+	session := c.session.Load()
+	if session == nil {
+		return c.extension
+	}
+	credentials, err := session.Credentials(context.Background())
+	if err != nil {
+		Logger.Infof("Failed to refresh the session. The existing token will be used. %s", err)
+	}
+	if credentials.Token == "" {
+		return c.extension
+	}
+	return getC8yExtensionFromToken(credentials.Token)
+}
+
 // TenantName returns the tenant name used in the client
 func (c *RealtimeClient) TenantName() string {
 	return c.tenant
 }
 
-// Connect performs a handshake with the server and will repeatedly initiate a
-// websocket connection until `Close` is called on the client.
-func (c *RealtimeClient) Connect() error {
-	if !c.IsConnected() {
+// SetInstrumentation sets the tracer and metrics used to instrument the connection. Use nil to disable instrumentation
+func (c *RealtimeClient) SetInstrumentation(instrumentation *telemetry.Instrumentation) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.instrumentation = instrumentation
+}
 
-		err := <-c.connect()
-		if err != nil {
-			return err
-		}
+func (c *RealtimeClient) getInstrumentation() *telemetry.Instrumentation {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.instrumentation
+}
 
-		err = <-c.getAdvice()
-		if err != nil {
-			return err
-		}
+// Connect performs a handshake with the server. The ctx controls the initial connection
+// attempt only, afterwards the client will repeatedly try to reconnect if the connection is
+// lost until `Close` is called. Nothing is left running if the connection attempt fails
+func (c *RealtimeClient) Connect(ctx context.Context) error {
+	if c.IsConnected() {
+		return nil
+	}
+
+	c.mtx.Lock()
+	c.traceCtx = context.WithoutCancel(ctx)
+	c.mtx.Unlock()
+
+	c.start()
+	done := c.getInstrumentation().StartConnection(ctx, telemetry.ClientRealtime, false)
+	err := c.connectAndHandshake(ctx)
+	done(err)
+	if err != nil {
+		c.shutdown(err)
+		return err
 	}
+	c.setState(RealtimeStateEvent{State: RealtimeStateConnected})
 	return nil
 }
 
+func (c *RealtimeClient) connectAndHandshake(ctx context.Context) error {
+	if err := c.connect(ctx); err != nil {
+		return err
+	}
+	return waitContext(ctx, c.getAdvice())
+}
+
 // IsConnected returns true if the websocket is connected
 func (c *RealtimeClient) IsConnected() bool {
 	c.mtx.RLock()
@@ -289,14 +390,22 @@ func (c *RealtimeClient) IsConnected() bool {
 	return isConnected
 }
 
-// Close notifies the Bayeux server of the intent to disconnect and terminates
-// the background polling loop.
+// Err returns the reason why the server terminated the connection, e.g. it advised not to reconnect
+func (c *RealtimeClient) Err() error {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.err
+}
+
+// Close notifies the Bayeux server of the intent to disconnect, stops reconnecting and waits for
+// all background go routines to exit. The client can be connected again afterwards
 func (c *RealtimeClient) Close() error {
-	if err := c.disconnect(); err != nil {
-		Logger.Infof("Failed to disconnect. %s", err)
+	if c.IsConnected() {
+		if err := c.disconnect(); err != nil {
+			Logger.Infof("Failed to disconnect. %s", err)
+		}
 	}
-	Logger.Infof("Killing go routine")
-	c.tomb.Killf("Close")
+	c.shutdown(nil)
 	return nil
 }
 
@@ -309,39 +418,138 @@ func (c *RealtimeClient) disconnect() error {
 	message := &request{
 		ID:       c.nextMessageID(),
 		Channel:  "/meta/disconnect",
-		ClientID: c.clientID,
+		ClientID: c.getClientID(),
 	}
 
 	// Change to disconnected state, as the server will not send a reply upon receiving the /meta/disconnect command
 	c.mtx.Lock()
 	c.connected = false
 	c.mtx.Unlock()
-	c.send <- message
+	return c.enqueue(message)
+}
 
-	return nil
+// start starts the go routine used to write to the websocket. It is stopped by shutdown
+func (c *RealtimeClient) start() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	writerDone := make(chan struct{})
+	c.runCtx = ctx
+	c.cancel = cancel
+	c.writerDone = writerDone
+
+	go func() {
+		defer close(writerDone)
+		c.writeHandler(ctx)
+	}()
 }
 
-func (c *RealtimeClient) createWebsocket() error {
-	Logger.Infof("Establishing connection to %s", c.url.String())
-	ws, _, err := c.dialer.Dial(c.url.String(), c.requestHeader)
+// shutdown stops all go routines and closes the websocket. It blocks until the go routines have exited.
+// The cause is published in the closed state event
+func (c *RealtimeClient) shutdown(cause error) {
+	c.mtx.Lock()
+	cancel := c.cancel
+	writerDone := c.writerDone
+	if cancel != nil {
+		// Cancel whilst holding the lock so that a connection which is being established is discarded
+		cancel()
+	}
+	c.cancel = nil
+	c.runCtx = nil
+	c.writerDone = nil
+	c.connected = false
+	c.mtx.Unlock()
 
-	if err != nil {
-		return err
+	if cancel == nil {
+		return
 	}
+
+	// Let the writer finish sending any message (e.g. /meta/disconnect) before closing the websocket
+	<-writerDone
+
 	c.mtx.Lock()
-	defer c.mtx.Unlock()
-	c.ws = ws
-	return nil
+	transport := c.transport
+	c.transport = nil
+	c.mtx.Unlock()
+	if transport != nil {
+		transport.close()
+	}
+
+	c.wg.Wait()
+
+	c.pendingRequests.Range(func(key, value interface{}) bool {
+		c.pendingRequests.Delete(key)
+		return true
+	})
+	Logger.Infof("Realtime client has been stopped")
+	c.setState(RealtimeStateEvent{State: RealtimeStateClosed, Err: cause})
 }
 
-func (c *RealtimeClient) reconnect() error {
-	connected := false
+func (c *RealtimeClient) getRunContext() context.Context {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.runCtx
+}
 
+func (c *RealtimeClient) getTransport() realtimeTransport {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.transport
+}
+
+func (c *RealtimeClient) getClientID() string {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.clientID
+}
+
+// terminate closes the connection without reconnecting
+func (c *RealtimeClient) terminate(err error) {
+	Logger.Infof("Closing connection. %s", err)
 	c.mtx.Lock()
-	if c.tomb != nil {
-		c.tomb.Kill(errors.New("websocket died"))
+	c.connected = false
+	c.err = err
+	transport := c.transport
+	c.mtx.Unlock()
+	if transport != nil {
+		transport.close()
 	}
-	c.tomb = nil
+	c.setState(RealtimeStateEvent{State: RealtimeStateClosed, Err: err})
+}
+
+// startReconnect reconnects in the background unless the client is already reconnecting or has been closed.
+// The cause is the reason why the connection was lost
+func (c *RealtimeClient) startReconnect(ctx context.Context, cause error) {
+	if ctx.Err() != nil || !c.reconnecting.CompareAndSwap(false, true) {
+		return
+	}
+
+	// Only called by the reader and writer which are waited for before the wait group, so the counter can't be zero
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer c.reconnecting.Store(false)
+		if err := c.reconnect(ctx, cause); err != nil {
+			Logger.Infof("Stopped reconnecting. %s", err)
+		}
+	}()
+}
+
+func (c *RealtimeClient) getTraceContext() context.Context {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.traceCtx == nil {
+		return context.Background()
+	}
+	return c.traceCtx
+}
+
+func (c *RealtimeClient) reconnect(ctx context.Context, cause error) error {
+	disconnectedAt := time.Now()
+	c.mtx.Lock()
 	c.connected = false
 	c.mtx.Unlock()
 
@@ -352,198 +560,224 @@ func (c *RealtimeClient) reconnect() error {
 	})
 
 	interval := MinimumRetryInterval
+	attempt := 0
 
-	for !connected {
-		Logger.Infof("Retrying in %ds", interval)
-		<-time.After(time.Duration(interval) * time.Second)
-		c.ws.Close()
-		err := c.createWebsocket()
+	for {
+		attempt++
+		delay := time.Duration(interval) * time.Second
+		c.setState(RealtimeStateEvent{
+			State:          RealtimeStateReconnecting,
+			Attempt:        attempt,
+			NextDelay:      delay,
+			Err:            cause,
+			DisconnectedAt: disconnectedAt,
+		})
 
-		if err != nil {
-			interval = int64(math.Min(float64(MaximumRetryInterval), RetryBackoffFactor*float64(interval)))
-			continue
+		Logger.Infof("Retrying in %ds", interval)
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
 		}
 
-		if err := c.Connect(); err != nil {
-			Logger.Infof("Failed to get advice from server. %s", err)
-		} else {
-			connected = true
+		done := c.getInstrumentation().StartConnection(c.getTraceContext(), telemetry.ClientRealtime, true)
+		err := c.connectAndHandshake(ctx)
+		done(err)
+
+		if err == nil {
+			break
 		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		Logger.Infof("Failed to reconnect. %s", err)
+		cause = err
+		interval = int64(math.Min(float64(MaximumRetryInterval), RetryBackoffFactor*float64(interval)))
 	}
 
 	Logger.Info("Established connection, any subscriptions will be also be resubmitted")
+	c.setState(RealtimeStateEvent{
+		State:          RealtimeStateConnected,
+		Attempt:        attempt,
+		DisconnectedAt: disconnectedAt,
+	})
 
 	c.reactivateSubscriptions()
 	return nil
 }
 
-// StartWebsocket opens a websocket to cumulocity
-func (c *RealtimeClient) connect() chan error {
-	if c.dialer == nil {
-		panic("Missing dialer for realtime client")
+// connect opens a connection to cumulocity and sends the handshake
+func (c *RealtimeClient) connect(ctx context.Context) error {
+	if c.url == nil {
+		return errors.New("invalid realtime url")
+	}
+	runCtx := c.getRunContext()
+	if runCtx == nil {
+		return ErrRealtimeClosed
 	}
-	Logger.Infof("Establishing connection to %s", c.url.String())
-	ws, _, err := c.dialer.Dial(c.url.String(), c.requestHeader)
 
+	c.setState(RealtimeStateEvent{State: RealtimeStateConnecting})
+	transport, err := c.dial(ctx)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	c.mtx.Lock()
-	defer c.mtx.Unlock()
-
-	c.ws = ws
-
-	if c.tomb == nil {
-		c.tomb = &tomb.Tomb{}
-		c.tomb.Go(c.worker)
+	if runCtx.Err() != nil {
+		// The client was closed whilst connecting
+		c.mtx.Unlock()
+		transport.close()
+		return ErrRealtimeClosed
 	}
+	previous := c.transport
+	c.transport = transport
+	c.err = nil
+	c.mtx.Unlock()
 
-	return c.handshake()
-}
-
-func (c *RealtimeClient) worker() error {
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt)
-	done := make(chan struct{})
-
-	c.ws.SetPongHandler(func(string) error {
-		c.ws.SetReadDeadline(time.Now().Add(pongWait))
-		return nil
-	})
+	if previous != nil {
+		previous.close()
+	}
 
+	c.wg.Add(1)
 	go func() {
-		defer close(done)
-		for {
-			messages := []Message{}
+		defer c.wg.Done()
+		c.readHandler(runCtx, transport)
+	}()
 
-			err := c.ws.ReadJSON(&messages)
+	c.setState(RealtimeStateEvent{State: RealtimeStateHandshaking})
+	return waitContext(ctx, c.handshake())
+}
 
-			if err != nil {
-				Logger.Infof("wc ReadJSON: error=%s, message=%v", err, messages)
+// readHandler reads messages from the transport until it is closed
+func (c *RealtimeClient) readHandler(ctx context.Context, transport realtimeTransport) {
+	for {
+		messages, err := transport.receive()
 
-				if !c.IsConnected() {
-					Logger.Info("Connection has been closed by the client")
-					return
-				}
-				Logger.Info("Handling connection error. You need to reconnect")
+		if err != nil {
+			Logger.Infof("ws receive: error=%s, message=%v", err, messages)
 
-				go c.reconnect()
+			if ctx.Err() != nil || c.getTransport() != transport {
+				Logger.Info("Connection has been closed by the client")
 				return
 			}
 
-			for _, message := range messages {
-				if strings.HasPrefix(message.Channel, "/meta") {
-					if messageText, err := json.Marshal(message); err == nil {
-						Logger.Infof("ws (recv): %s : %s", message.Channel, messageText)
-					}
-				}
+			// The responses to the pending requests will never be received
+			c.failPendingRequests(err)
 
-				switch channelType := message.Channel; channelType {
-				case "/meta/handshake":
-					if message.Successful {
-						c.mtx.Lock()
-						c.clientID = message.ClientID
-						c.connected = true
-						c.mtx.Unlock()
-					} else {
-						Logger.Fatalf("No clientID present in handshake. Check that the tenant, username and password is correct. Raw Message: %v", message)
-					}
+			if !c.IsConnected() {
+				Logger.Info("Connection has been closed by the client")
+				return
+			}
+			Logger.Info("Handling connection error. You need to reconnect")
+			c.startReconnect(ctx, err)
+			return
+		}
 
-				case "/meta/subscribe":
-					if message.Successful {
-						Logger.Infof("Successfully subscribed to channel %s", message.Subscription)
-					} else {
-						Logger.Infof("Failed to subscribe to channel %s", message.Subscription)
-					}
+		for i := range messages {
+			c.handleMessage(ctx, &messages[i])
+		}
+	}
+}
 
-				case "/meta/unsubscribe":
-					if message.Successful {
-						Logger.Infof("Successfully unsubscribed to channel %s", message.Subscription)
-					}
+func (c *RealtimeClient) handleMessage(ctx context.Context, message *Message) {
+	if strings.HasPrefix(message.Channel, "/meta") {
+		if messageText, err := json.Marshal(message); err == nil {
+			Logger.Infof("ws (recv): %s : %s", message.Channel, messageText)
+		}
+	}
 
-				case "/meta/connect":
-					// https://docs.cometd.org/current/reference/
-					wasConnected := c.IsConnected()
-					connected := message.Successful
-
-					if message.Advice != nil {
-						retryDelay := message.Advice.Interval
-						if retryDelay <= 0 {
-							// Minimum retry delay
-							retryDelay = MinimumRetryDelay
-						}
-						switch message.Advice.Reconnect {
-						case "handshake":
-							Logger.Infof("Scheduling sending of new handshake to server with %d ms delay", retryDelay)
-							time.AfterFunc(time.Duration(retryDelay)*time.Millisecond, func() {
-								c.handshake()
-							})
-						case "retry":
-							Logger.Infof("Resending /meta/connect heartbeat with %d ms delay", retryDelay)
-							time.AfterFunc(time.Duration(retryDelay)*time.Millisecond, func() {
-								c.sendMeta()
-							})
-						case "none":
-							// Do not attempt to retry or send a handshake as it must respect the servers response
-							panic("Server indicated that no retry or handshake should be done")
-						}
-						// Server indicated that a handshake should be sent again
-						break
-					}
+	switch channelType := message.Channel; channelType {
+	case "/meta/handshake":
+		if message.Successful {
+			c.mtx.Lock()
+			c.clientID = message.ClientID
+			c.connected = true
+			c.mtx.Unlock()
+		} else {
+			Logger.Infof("No clientID present in handshake. Check that the tenant, username and password is correct. Raw Message: %v", message)
+		}
 
-					if !wasConnected && connected {
-						// Reconnected
-					} else if wasConnected && !connected {
-						// Disconnected
-						c.disconnect()
-					} else if connected {
-						// New connection
-						c.mtx.Lock()
-						c.connected = true
-						c.mtx.Unlock()
-
-						go c.sendMeta()
-					}
+	case "/meta/subscribe":
+		if message.Successful {
+			Logger.Infof("Successfully subscribed to channel %s", message.Subscription)
+		} else {
+			Logger.Infof("Failed to subscribe to channel %s", message.Subscription)
+		}
 
-				case "/meta/disconnect":
-					if message.Successful {
-						Logger.Infof("Successfully disconnected with server")
-					}
+	case "/meta/unsubscribe":
+		if message.Successful {
+			Logger.Infof("Successfully unsubscribed to channel %s", message.Subscription)
+		}
 
-				default:
-					// Data package received
-					message.Payload.Item = gjson.ParseBytes(message.Payload.Data)
-					c.hub.broadcast <- &message
-				}
+	case "/meta/connect":
+		// https://docs.cometd.org/current/reference/
+		wasConnected := c.IsConnected()
+		connected := message.Successful
 
-				// remove the message from the queue
-				if message.ID != "" {
-					Logger.Infof("Removing message from pending requests: %s", message.ID)
-					c.pendingRequests.Delete(message.ID)
-					c.logRemainingResponses()
-				}
+		if message.Advice != nil {
+			retryDelay := message.Advice.Interval
+			if retryDelay <= 0 {
+				// Minimum retry delay
+				retryDelay = MinimumRetryDelay
+			}
+			switch message.Advice.Reconnect {
+			case "handshake":
+				Logger.Infof("Scheduling sending of new handshake to server with %d ms delay", retryDelay)
+				time.AfterFunc(time.Duration(retryDelay)*time.Millisecond, func() {
+					if ctx.Err() == nil {
+						c.handshake()
+					}
+				})
+			case "retry":
+				Logger.Infof("Resending /meta/connect heartbeat with %d ms delay", retryDelay)
+				time.AfterFunc(time.Duration(retryDelay)*time.Millisecond, func() {
+					if ctx.Err() == nil {
+						c.sendMeta()
+					}
+				})
+			case "none":
+				// Do not attempt to retry or send a handshake as it must respect the servers response
+				c.terminate(ErrRealtimeReconnectNone)
 			}
+			// Server indicated that a handshake should be sent again
+			break
 		}
-	}()
 
-	for {
-		defer c.ws.Close()
-		select {
-		case <-c.tomb.Dying():
-			return nil
+		if !wasConnected && connected {
+			// Reconnected
+		} else if wasConnected && !connected {
+			// Disconnected
+			c.disconnect()
+			c.setState(RealtimeStateEvent{State: RealtimeStateClosed, Err: responseError(message)})
+		} else if connected {
+			// New connection
+			c.mtx.Lock()
+			c.connected = true
+			c.mtx.Unlock()
+
+			go c.sendMeta()
+		}
 
-		case <-interrupt:
-			Logger.Info("interrupt")
+	case "/meta/disconnect":
+		if message.Successful {
+			Logger.Infof("Successfully disconnected with server")
+		}
 
-			// Cleanly close the connection by sending a close message and then
-			// waiting (with timeout) for the server to close the connection.
-			if err := c.Disconnect(); err != nil {
-				Logger.Info("Failed to send disconnect to server:", err)
-				return err
-			}
+	default:
+		// Data package received
+		message.Payload.Item = gjson.ParseBytes(message.Payload.Data)
+		c.getInstrumentation().RecordMessage(context.Background(), telemetry.MessageMetric{
+			Client:    telemetry.ClientRealtime,
+			Direction: telemetry.DirectionReceived,
+			Bytes:     len(message.Payload.Data),
+		})
+		c.hub.broadcast(ctx, message)
+	}
 
-			return fmt.Errorf("stopping websocket")
+	// Notify the sender that the response has been received. Only meta messages are responses
+	if message.ID != "" && strings.HasPrefix(message.Channel, "/meta") {
+		if pending, ok := c.pendingRequests.LoadAndDelete(message.ID); ok {
+			Logger.Infof("Removing message from pending requests: %s", message.ID)
+			pending.(*pendingRequest).resolve(message)
+			c.logRemainingResponses()
 		}
 	}
 }
@@ -555,7 +789,7 @@ func (c *RealtimeClient) handshake() chan error {
 		Version:                  VERSION,
 		MinimumVersion:           MINIMUM_VERSION,
 		SupportedConnectionTypes: []string{"websocket", "long-polling"},
-		Extension:                c.extension,
+		Extension:                c.getExtension(),
 		Advice: &advice{
 			Interval:  0,
 			Timeout:   60000,
@@ -563,39 +797,35 @@ func (c *RealtimeClient) handshake() chan error {
 		},
 	}
 
-	c.send <- message
-	return c.WaitForMessage(message.ID)
+	return c.request(message)
 }
 
 func (c *RealtimeClient) sendMeta() error {
-	if c.ws == nil {
-		return fmt.Errorf("websocket is nil")
+	if c.getTransport() == nil {
+		return fmt.Errorf("transport is nil")
 	}
 	message := &request{
 		ID:             c.nextMessageID(),
 		Channel:        "/meta/connect",
-		ConnectionType: "websocket",
-		ClientID:       c.clientID,
+		ConnectionType: c.ConnectionType(),
+		ClientID:       c.getClientID(),
 	}
 
-	c.send <- message
-	return nil
+	return c.enqueue(message)
 }
 
 func (c *RealtimeClient) getAdvice() chan error {
-	clientID := c.clientID
 	message := &request{
 		ID:             c.nextMessageID(),
 		Channel:        "/meta/connect",
-		ConnectionType: "websocket",
-		ClientID:       clientID,
+		ConnectionType: c.ConnectionType(),
+		ClientID:       c.getClientID(),
 		Advice: &advice{
 			Timeout: 0,
 		},
 	}
 
-	c.send <- message
-	return c.WaitForMessage(message.ID)
+	return c.request(message)
 }
 
 func getRealtimeID(id ...string) string {
@@ -637,64 +867,65 @@ func RealtimeOperations(id ...string) string {
 
 // Subscribe setup a subscription to the given element
 func (c *RealtimeClient) Subscribe(pattern string, out chan<- *Message) chan error {
+	_, response := c.subscribe(pattern, out)
+	return response
+}
+
+func (c *RealtimeClient) subscribe(pattern string, out chan<- *Message) (*subscription, chan error) {
 	Logger.Infof("Subscribing to %s", pattern)
 
 	glob, err := ohmyglob.Compile(pattern, nil)
 	if err != nil {
-		errCh := make(chan error)
-		defer func() {
-			fmt.Println("Closing channel")
-			close(out)
-		}()
-		errCh <- fmt.Errorf("invalid pattern: %s", err)
-		return errCh
+		close(out)
+		return nil, errorChannel(fmt.Errorf("invalid pattern: %s", err))
 	}
 
 	message := &request{
 		ID:             c.nextMessageID(),
 		Channel:        "/meta/subscribe",
 		Subscription:   pattern,
-		ConnectionType: "websocket",
-		ClientID:       c.clientID,
+		ConnectionType: c.ConnectionType(),
+		ClientID:       c.getClientID(),
 	}
 
-	c.hub.register <- &subscription{
+	client := &subscription{
 		glob:       glob,
 		out:        out,
 		isWildcard: strings.HasSuffix(glob.String(), "*"),
 		disabled:   false,
+		done:       make(chan struct{}),
 	}
+	c.hub.register(client)
 
-	c.send <- message
-
-	return c.WaitForMessage(message.ID)
+	return client, c.trackSubscription(pattern, false, c.request(message))
 }
 
 // reactivateSubscriptions sends subscription messages to the Bayeux server for each active subscription currently set in the client
 func (c *RealtimeClient) reactivateSubscriptions() {
-	ids := []string{}
+	responses := []chan error{}
 
 	for _, subscription := range c.hub.GetActiveChannels() {
 		message := &request{
 			ID:             c.nextMessageID(),
 			Channel:        "/meta/subscribe",
 			Subscription:   subscription,
-			ConnectionType: "websocket",
-			ClientID:       c.clientID,
+			ConnectionType: c.ConnectionType(),
+			ClientID:       c.getClientID(),
 		}
 
-		ids = append(ids, message.ID)
-		c.send <- message
+		responses = append(responses, c.trackSubscription(subscription, true, c.request(message)))
 	}
 
-	c.WaitForMessages(ids...)
+	for err := range waitAll(responses...) {
+		Logger.Infof("Failed to resubscribe. %s", err)
+	}
 }
 
 // UnsubscribeAll unsubscribes to all of the subscribed channels.
 // The channel related to the subscription is left open, and will be
 // reused if another call with the same pattern is made to Subscribe()
 func (c *RealtimeClient) UnsubscribeAll() chan error {
-	ids := []string{}
+	responses := []chan error{}
 
 	subs := c.hub.GetActiveChannels()
 	for _, pattern := range subs {
@@ -702,16 +933,15 @@ func (c *RealtimeClient) UnsubscribeAll() chan error {
 			ID:           c.nextMessageID(),
 			Channel:      "/meta/unsubscribe",
 			Subscription: pattern,
-			ClientID:     c.clientID,
+			ClientID:     c.getClientID(),
 		}
 
-		ids = append(ids, message.ID)
-		c.send <- message
+		responses = append(responses, c.request(message))
 	}
 
 	// Wait for the server to response to the unsubscribe messages
 	// only when all of them have been received (or a timeout has occurred) then return
-	return c.WaitForMessages(ids...)
+	return waitAll(responses...)
 }
 
 // Unsubscribe unsubscribe to a given pattern
@@ -722,12 +952,11 @@ func (c *RealtimeClient) Unsubscribe(pattern string) chan error {
 		ID:           c.nextMessageID(),
 		Channel:      "/meta/unsubscribe",
 		Subscription: pattern,
-		ClientID:     c.clientID,
+		ClientID:     c.getClientID(),
 	}
 
-	c.hub.unregister <- pattern
-	c.send <- message
-	return c.WaitForMessage(message.ID)
+	c.hub.unregister(pattern)
+	return c.request(message)
 }
 
 func (c *RealtimeClient) nextMessageID() string {
@@ -751,105 +980,206 @@ func (c *RealtimeClient) logRemainingResponses() {
 	Logger.Infof("Pending messages ids: %s", strings.Join(ids, ","))
 }
 
-// WaitForMessages waits for a server response related to the list of message ids
-func (c *RealtimeClient) WaitForMessages(ids ...string) chan error {
-	wg := new(sync.WaitGroup)
-	wg.Add(len(ids))
+// pendingRequest is a request which is waiting for a response from the server
+type pendingRequest struct {
+	response chan *Message
+	err      chan error
+}
 
-	errorChannel := make(chan error)
-	defer close(errorChannel)
+func newPendingRequest() *pendingRequest {
+	return &pendingRequest{
+		response: make(chan *Message, 1),
+		err:      make(chan error, 1),
+	}
+}
 
+// fail is used when the response will never be received, e.g. the connection was lost
+func (r *pendingRequest) fail(err error) {
+	select {
+	case r.err <- err:
+	default:
+	}
+}
+
+func (c *RealtimeClient) failPendingRequests(err error) {
+	c.pendingRequests.Range(func(key, value interface{}) bool {
+		c.pendingRequests.Delete(key)
+		value.(*pendingRequest).fail(err)
+		return true
+	})
+}
+
+func (r *pendingRequest) resolve(message *Message) {
+	select {
+	case r.response <- message:
+	default:
+	}
+}
+
+// responseError returns an error if the server did not accept the request
+func responseError(message *Message) error {
+	if message.Successful {
+		return nil
+	}
+	if message.Error != "" {
+		return fmt.Errorf("%s failed. %s", message.Channel, message.Error)
+	}
+	return fmt.Errorf("%s failed", message.Channel)
+}
+
+// enqueue hands the message to the writer. It returns an error if the client has not been started
+func (c *RealtimeClient) enqueue(message *request) error {
+	ctx := c.getRunContext()
+	if ctx == nil {
+		return ErrRealtimeNotConnected
+	}
+	if message.ID == "" {
+		message.ID = c.nextMessageID()
+	}
+	select {
+	case c.send <- message:
+		return nil
+	case <-ctx.Done():
+		return ErrRealtimeClosed
+	}
+}
+
+// request sends the message and waits for the response from the server
+func (c *RealtimeClient) request(message *request) chan error {
+	if message.ID == "" {
+		message.ID = c.nextMessageID()
+	}
+
+	// The request must be pending before it is sent, otherwise the response could be missed
+	pending := newPendingRequest()
+	c.pendingRequests.Store(message.ID, pending)
+	if err := c.enqueue(message); err != nil {
+		c.pendingRequests.Delete(message.ID)
+		return errorChannel(err)
+	}
+	return c.waitForResponse(message.ID, pending)
+}
+
+// WaitForMessages waits for a server response related to the list of message ids
+func (c *RealtimeClient) WaitForMessages(ids ...string) chan error {
+	responses := make([]chan error, 0, len(ids))
 	for _, id := range ids {
-		go func(id string) {
-			err := <-c.WaitForMessage(id)
-			if err != nil {
-				errorChannel <- err
-			}
-			wg.Done()
-		}(id)
+		responses = append(responses, c.WaitForMessage(id))
 	}
-	wg.Wait()
-	return errorChannel
+	return waitAll(responses...)
 }
 
 // WaitForMessage waits for a message with the corresponding id to be sent by the server
 func (c *RealtimeClient) WaitForMessage(ID string) chan error {
-	out := make(chan error)
+	pending, ok := c.pendingRequests.Load(ID)
+	if !ok {
+		// Response has already been received
+		return errorChannel(nil)
+	}
+	return c.waitForResponse(ID, pending.(*pendingRequest))
+}
+
+func (c *RealtimeClient) waitForResponse(ID string, pending *pendingRequest) chan error {
+	out := make(chan error, 1)
 
-	waitInterval := 10 * time.Second
+	var done <-chan struct{}
+	if ctx := c.getRunContext(); ctx != nil {
+		done = ctx.Done()
+	}
 
 	Logger.Infof("Waiting for message: id=%s", ID)
 
 	go func() {
-		ticker := time.NewTicker(200 * time.Millisecond)
-		defer func() {
-			ticker.Stop()
-			close(out)
-		}()
-		timeout := time.After(waitInterval)
-
-		for {
-			select {
-			case <-ticker.C:
-				// Logger.Infof("Checking if ID has been removed")
-				if _, exists := c.pendingRequests.Load(ID); !exists {
-					Logger.Infof("Received message %s", ID)
-					out <- nil
-					return
-				}
-			case <-timeout:
-				out <- errors.New("Timeout")
-				return
-			}
+		defer close(out)
+		timeout := time.NewTimer(10 * time.Second)
+		defer timeout.Stop()
+
+		select {
+		case message := <-pending.response:
+			Logger.Infof("Received message %s", ID)
+			out <- responseError(message)
+		case err := <-pending.err:
+			out <- fmt.Errorf("%w. id=%s", err, ID)
+		case <-timeout.C:
+			c.pendingRequests.Delete(ID)
+			out <- fmt.Errorf("%w. id=%s", ErrRealtimeTimeout, ID)
+		case <-done:
+			out <- ErrRealtimeClosed
 		}
 	}()
 
 	return out
 }
 
-func (c *RealtimeClient) writeHandler() {
-	ticker := time.NewTicker(pingPeriod)
+// errorChannel returns a closed channel containing the given error (if not nil)
+func errorChannel(err error) chan error {
+	out := make(chan error, 1)
+	if err != nil {
+		out <- err
+	}
+	close(out)
+	return out
+}
+
+// waitAll waits for all of the responses, and returns a closed channel containing any errors
+func waitAll(responses ...chan error) chan error {
+	out := make(chan error, len(responses))
+	for _, response := range responses {
+		if err := <-response; err != nil {
+			out <- err
+		}
+	}
+	close(out)
+	return out
+}
+
+// waitContext waits for the response or until the context is done
+func waitContext(ctx context.Context, response <-chan error) error {
+	select {
+	case err := <-response:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	defer func() {
-		ticker.Stop()
+func (c *RealtimeClient) writeHandler(ctx context.Context) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
 
-		// Close
-		close(c.send)
-	}()
 	for {
 		select {
-		case message, ok := <-c.send:
-			if !ok {
-				// The send channel has been closed
-				Logger.Info("Channel has been closed")
-				return
-			}
-
-			if message.ID == "" {
-				message.ID = c.nextMessageID()
-			}
-
-			// Store message id
-			c.pendingRequests.Store(message.ID, message)
+		case <-ctx.Done():
+			Logger.Info("Stopping writer")
+			return
 
+		case message := <-c.send:
 			c.logMessage(message)
 			c.logRemainingResponses()
 
-			if c.ws != nil {
-				if err := c.ws.WriteJSON([]request{*message}); err != nil {
-					Logger.Infof("Failed to send JSON message. %s", err)
-				}
+			transport := c.getTransport()
+			if transport == nil {
+				Logger.Infof("Transport is not connected. Dropping message %s", message.ID)
+				continue
+			}
+			if err := transport.send([]request{*message}); err != nil {
+				Logger.Infof("Failed to send JSON message. %s", err)
+			} else {
+				c.getInstrumentation().RecordMessage(context.Background(), telemetry.MessageMetric{
+					Client:    telemetry.ClientRealtime,
+					Direction: telemetry.DirectionSent,
+					Bytes:     len(message.Data),
+				})
 			}
 
 		case <-ticker.C:
 			// Regularly check if the Websocket is alive by sending a PingMessage to the server
-			if c.ws != nil {
-				// A websocket ping should initiate a websocket pong response from the server
-				// If the pong is not received in the minimum time, then the connection will be reset
-				c.ws.SetWriteDeadline(time.Now().Add(writeWait))
-				if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if transport := c.getTransport(); transport != nil {
+				if err := transport.ping(); err != nil {
 					Logger.Info("Failed to send ping message to server")
-					go c.reconnect()
+					if c.IsConnected() {
+						c.startReconnect(ctx, err)
+					}
 					break
 				}
 				Logger.Info("Sent ping successfully")
@@ -0,0 +1,199 @@
+package c8y
+
+import (
+	"sync"
+	"time"
+)
+
+// RealtimeState is the state of the connection to the Bayeux server
+type RealtimeState string
+
+const (
+	// RealtimeStateConnecting the websocket connection is being established
+	RealtimeStateConnecting RealtimeState = "connecting"
+
+	// RealtimeStateHandshaking the websocket is open and the handshake is being sent
+	RealtimeStateHandshaking RealtimeState = "handshaking"
+
+	// RealtimeStateConnected the handshake was successful and messages are being received
+	RealtimeStateConnected RealtimeState = "connected"
+
+	// RealtimeStateReconnecting the connection was lost and the client is waiting to try again
+	RealtimeStateReconnecting RealtimeState = "reconnecting"
+
+	// RealtimeStateClosed the client is not connected and will not reconnect. This is also the initial state
+	RealtimeStateClosed RealtimeState = "closed"
+)
+
+// RealtimeStateEvent is published whenever the connection state changes
+type RealtimeStateEvent struct {
+	State    RealtimeState
+	Previous RealtimeState
+	Time     time.Time
+
+	// Attempt is the reconnection attempt number (starting at 1). It is zero for the initial connection
+	Attempt int
+
+	// NextDelay is the delay before the next reconnection attempt. Only set when reconnecting
+	NextDelay time.Duration
+
+	// Err is the reason for the state change, e.g. why the connection was lost or why the last attempt failed
+	Err error
+
+	// DisconnectedAt is the time the connection was lost. It is set when reconnecting and once the connection
+	// has been re-established, so that any messages missed in the meantime can be retrieved via the REST api
+	DisconnectedAt time.Time
+}
+
+// Reconnected returns true if the connection was re-established after being lost
+func (e RealtimeStateEvent) Reconnected() bool {
+	return e.State == RealtimeStateConnected && !e.DisconnectedAt.IsZero()
+}
+
+// RealtimeSubscriptionEvent is published when the server accepts or rejects a subscription
+type RealtimeSubscriptionEvent struct {
+	Subscription string
+	Successful   bool
+	Time         time.Time
+
+	// Err is the reason why the subscription failed, e.g. rejected by the server or timed out
+	Err error
+
+	// Resubscribed is true if the subscription was sent again after reconnecting
+	Resubscribed bool
+}
+
+// realtimeListeners stores the state and the handlers which are notified about state changes
+type realtimeListeners struct {
+	mu            sync.RWMutex
+	state         RealtimeState
+	nextID        int
+	stateHandlers map[int]func(RealtimeStateEvent)
+	subHandlers   map[int]func(RealtimeSubscriptionEvent)
+	order         []int
+}
+
+func newRealtimeListeners() *realtimeListeners {
+	return &realtimeListeners{
+		state:         RealtimeStateClosed,
+		stateHandlers: make(map[int]func(RealtimeStateEvent)),
+		subHandlers:   make(map[int]func(RealtimeSubscriptionEvent)),
+	}
+}
+
+func (l *realtimeListeners) add(register func(id int)) func() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.nextID++
+	id := l.nextID
+	register(id)
+	l.order = append(l.order, id)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			delete(l.stateHandlers, id)
+			delete(l.subHandlers, id)
+			for i, v := range l.order {
+				if v == id {
+					l.order = append(l.order[:i], l.order[i+1:]...)
+					break
+				}
+			}
+		})
+	}
+}
+
+// OnStateChange registers a handler which is called whenever the connection state changes.
+// Handlers are called from the client's go routines, so they must not block or call Close.
+// The returned func removes the handler
+func (c *RealtimeClient) OnStateChange(handler func(RealtimeStateEvent)) func() {
+	return c.listeners.add(func(id int) {
+		c.listeners.stateHandlers[id] = handler
+	})
+}
+
+// OnSubscription registers a handler which is called when the server acknowledges (or rejects) a subscription,
+// including the subscriptions which are sent again after reconnecting.
+// Handlers are called from the client's go routines, so they must not block or call Close.
+// The returned func removes the handler
+func (c *RealtimeClient) OnSubscription(handler func(RealtimeSubscriptionEvent)) func() {
+	return c.listeners.add(func(id int) {
+		c.listeners.subHandlers[id] = handler
+	})
+}
+
+// State returns the current connection state
+func (c *RealtimeClient) State() RealtimeState {
+	c.listeners.mu.RLock()
+	defer c.listeners.mu.RUnlock()
+	return c.listeners.state
+}
+
+// setState changes the state and notifies the handlers. Events which do not change the state are
+// still published when reconnecting, as the attempt number and delay change
+func (c *RealtimeClient) setState(event RealtimeStateEvent) {
+	l := c.listeners
+	l.mu.Lock()
+	if event.State == l.state && event.State != RealtimeStateReconnecting {
+		l.mu.Unlock()
+		return
+	}
+	event.Previous = l.state
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	l.state = event.State
+	handlers := make([]func(RealtimeStateEvent), 0, len(l.stateHandlers))
+	for _, id := range l.order {
+		if handler, ok := l.stateHandlers[id]; ok {
+			handlers = append(handlers, handler)
+		}
+	}
+	l.mu.Unlock()
+
+	Logger.Infof("Realtime connection state changed: %s -> %s", event.Previous, event.State)
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+func (c *RealtimeClient) publishSubscription(event RealtimeSubscriptionEvent) {
+	l := c.listeners
+	l.mu.RLock()
+	handlers := make([]func(RealtimeSubscriptionEvent), 0, len(l.subHandlers))
+	for _, id := range l.order {
+		if handler, ok := l.subHandlers[id]; ok {
+			handlers = append(handlers, handler)
+		}
+	}
+	l.mu.RUnlock()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// trackSubscription publishes the result of a subscribe request once the response has been received
+func (c *RealtimeClient) trackSubscription(pattern string, resubscribed bool, response chan error) chan error {
+	out := make(chan error, 1)
+	go func() {
+		defer close(out)
+		err := <-response
+		c.publishSubscription(RealtimeSubscriptionEvent{
+			Subscription: pattern,
+			Successful:   err == nil,
+			Err:          err,
+			Resubscribed: resubscribed,
+		})
+		if err != nil {
+			out <- err
+		}
+	}()
+	return out
+}
@@ -0,0 +1,501 @@
+package c8y
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/reubenmiller/go-c8y/pkg/telemetry"
+)
+
+// bayeuxTestServer is a minimal Bayeux server which responds to the meta messages. The respond func can be used
+// to change the response to a message, and return any additional messages which should be sent.
+// Both websocket and long-polling connections are supported
+type bayeuxTestServer struct {
+	*httptest.Server
+
+	respond func(req request) []Message
+
+	// disableWebsocket rejects websocket upgrades, like a proxy which blocks websockets
+	disableWebsocket atomic.Bool
+	longPolls        atomic.Int32
+}
+
+func newBayeuxTestServer(t *testing.T, respond func(req request) []Message) *bayeuxTestServer {
+	t.Helper()
+	s := &bayeuxTestServer{respond: respond}
+	upgrader := websocket.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !websocket.IsWebSocketUpgrade(r) {
+			s.serveLongPolling(w, r)
+			return
+		}
+		if s.disableWebsocket.Load() {
+			http.Error(w, "websockets are not allowed", http.StatusForbidden)
+			return
+		}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		connects := 0
+		for {
+			requests := []request{}
+			if err := ws.ReadJSON(&requests); err != nil {
+				return
+			}
+			for _, req := range requests {
+				if messages := s.messages(req, &connects); len(messages) > 0 {
+					if err := ws.WriteJSON(messages); err != nil {
+						return
+					}
+				}
+			}
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// serveLongPolling handles a long-polling request. Requests without a response are held until the client cancels them
+func (s *bayeuxTestServer) serveLongPolling(w http.ResponseWriter, r *http.Request) {
+	requests := []request{}
+	if err := json.NewDecoder(r.Body).Decode(&requests); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	connects := int(s.longPolls.Load())
+	messages := []Message{}
+	for _, req := range requests {
+		if req.ConnectionType != "" && req.ConnectionType != RealtimeConnectionTypeLongPolling {
+			http.Error(w, "unexpected connection type "+req.ConnectionType, http.StatusBadRequest)
+			return
+		}
+		if req.Channel == "/meta/connect" {
+			connects = int(s.longPolls.Add(1)) - 1
+		}
+		messages = append(messages, s.messages(req, &connects)...)
+	}
+	if len(messages) == 0 {
+		<-r.Context().Done()
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(messages)
+}
+
+func (s *bayeuxTestServer) messages(req request, connects *int) []Message {
+	var messages []Message
+	if s.respond != nil {
+		messages = s.respond(req)
+	}
+	if messages == nil {
+		switch req.Channel {
+		case "/meta/handshake":
+			messages = []Message{{Channel: req.Channel, ID: req.ID, ClientID: "client01", Successful: true}}
+		case "/meta/connect":
+			// Hold subsequent connect messages like a long poll
+			*connects++
+			if *connects == 1 {
+				messages = []Message{{Channel: req.Channel, ID: req.ID, Successful: true}}
+			}
+		default:
+			messages = []Message{{Channel: req.Channel, ID: req.ID, Subscription: req.Subscription, Successful: true}}
+		}
+	}
+	return messages
+}
+
+func TestRealtimeClient_Subscribe(t *testing.T) {
+	srv := newBayeuxTestServer(t, func(req request) []Message {
+		if req.Channel == "/meta/subscribe" {
+			return []Message{
+				{Channel: req.Channel, ID: req.ID, Subscription: req.Subscription, Successful: true},
+				{Channel: "/measurements/12345", Payload: RealtimeData{RealtimeAction: "CREATE", Data: json.RawMessage(`{"id":"1"}`)}},
+			}
+		}
+		return nil
+	})
+	client := NewRealtimeClient(srv.URL, nil, "t12345", "user", "pass")
+
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ch := make(chan *Message, 1)
+	if err := <-client.Subscribe(RealtimeMeasurements("12345"), ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case msg := <-ch:
+		if got := msg.Payload.Item.Get("id").String(); got != "1" {
+			t.Errorf("message: got %q, want %q", got, "1")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		client.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close did not wait for the go routines to exit")
+	}
+	if client.IsConnected() {
+		t.Errorf("connected after close")
+	}
+}
+
+func TestRealtimeClient_ConnectErrors(t *testing.T) {
+	// Server is not reachable
+	srv := newBayeuxTestServer(t, nil)
+	srv.Close()
+	client := NewRealtimeClient(srv.URL, nil, "t12345", "user", "pass")
+	if err := client.Connect(context.Background()); err == nil {
+		t.Errorf("unreachable server: expected an error")
+	}
+
+	// Invalid credentials
+	srv = newBayeuxTestServer(t, func(req request) []Message {
+		if req.Channel == "/meta/handshake" {
+			return []Message{{Channel: req.Channel, ID: req.ID, Error: "401::Unauthorized"}}
+		}
+		return nil
+	})
+	client = NewRealtimeClient(srv.URL, nil, "t12345", "user", "wrong")
+	if err := client.Connect(context.Background()); err == nil || !strings.Contains(err.Error(), "401::Unauthorized") {
+		t.Errorf("handshake: got %v, want the handshake error", err)
+	}
+
+	// Cancelled whilst waiting for the handshake
+	srv = newBayeuxTestServer(t, func(req request) []Message {
+		return []Message{}
+	})
+	client = NewRealtimeClient(srv.URL, nil, "t12345", "user", "pass")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := client.Connect(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("cancelled: got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Messages can't be sent before connecting
+	if err := <-client.Subscribe(RealtimeAlarms(), make(chan *Message)); !errors.Is(err, ErrRealtimeNotConnected) {
+		t.Errorf("not connected: got %v, want %v", err, ErrRealtimeNotConnected)
+	}
+}
+
+func TestRealtimeClient_ReconnectNone(t *testing.T) {
+	var mu sync.Mutex
+	connects := 0
+	srv := newBayeuxTestServer(t, func(req request) []Message {
+		if req.Channel != "/meta/connect" {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		connects++
+		if connects == 1 {
+			return []Message{{Channel: req.Channel, ID: req.ID, Successful: true}}
+		}
+		return []Message{{Channel: req.Channel, ID: req.ID, Advice: &advice{Reconnect: "none"}}}
+	})
+	client := NewRealtimeClient(srv.URL, nil, "t12345", "user", "pass")
+	defer client.Close()
+
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !errors.Is(client.Err(), ErrRealtimeReconnectNone) {
+		if time.Now().After(deadline) {
+			t.Fatalf("connection was not terminated: got %v, want %v", client.Err(), ErrRealtimeReconnectNone)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if client.IsConnected() {
+		t.Errorf("connected after the server advised not to reconnect")
+	}
+}
+
+func TestRealtimeClient_StateEvents(t *testing.T) {
+	srv := newBayeuxTestServer(t, func(req request) []Message {
+		if req.Channel == "/meta/subscribe" && req.Subscription == "/alarms/*" {
+			return []Message{{Channel: req.Channel, ID: req.ID, Subscription: req.Subscription, Error: "403::Forbidden"}}
+		}
+		return nil
+	})
+	client := NewRealtimeClient(srv.URL, nil, "t12345", "user", "pass")
+
+	events := make(chan RealtimeStateEvent, 20)
+	client.OnStateChange(func(event RealtimeStateEvent) {
+		events <- event
+	})
+	subscriptions := make(chan RealtimeSubscriptionEvent, 10)
+	client.OnSubscription(func(event RealtimeSubscriptionEvent) {
+		subscriptions <- event
+	})
+
+	if got := client.State(); got != RealtimeStateClosed {
+		t.Errorf("initial state: got %s, want %s", got, RealtimeStateClosed)
+	}
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Subscription acknowledgements
+	<-client.Subscribe(RealtimeMeasurements("12345"), make(chan *Message, 1))
+	if err := <-client.Subscribe(RealtimeAlarms(), make(chan *Message, 1)); err == nil {
+		t.Errorf("rejected subscription: expected an error")
+	}
+	for _, want := range []bool{true, false} {
+		event := <-subscriptions
+		if event.Successful != want || event.Resubscribed {
+			t.Errorf("subscription %s: got successful=%v, want %v", event.Subscription, event.Successful, want)
+		}
+	}
+
+	// Drop the connection
+	client.getTransport().close()
+
+	expected := []RealtimeState{
+		RealtimeStateConnecting,
+		RealtimeStateHandshaking,
+		RealtimeStateConnected,
+		RealtimeStateReconnecting,
+	}
+	for _, want := range expected {
+		select {
+		case event := <-events:
+			if event.State != want {
+				t.Fatalf("state: got %s, want %s", event.State, want)
+			}
+			if event.State == RealtimeStateReconnecting {
+				if event.Attempt != 1 || event.NextDelay <= 0 || event.DisconnectedAt.IsZero() || event.Err == nil {
+					t.Errorf("reconnecting event: got %+v", event)
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for state %s", want)
+		}
+	}
+
+	client.Close()
+	if event := <-events; event.State != RealtimeStateClosed || event.Previous != RealtimeStateReconnecting {
+		t.Errorf("close: got %s (previous %s), want %s", event.State, event.Previous, RealtimeStateClosed)
+	}
+	if got := client.State(); got != RealtimeStateClosed {
+		t.Errorf("state after close: got %s, want %s", got, RealtimeStateClosed)
+	}
+}
+
+func TestRealtimeClient_LongPolling(t *testing.T) {
+	srv := newBayeuxTestServer(t, func(req request) []Message {
+		if req.Channel == "/meta/subscribe" {
+			return []Message{
+				{Channel: req.Channel, ID: req.ID, Subscription: req.Subscription, Successful: true},
+				{Channel: "/measurements/12345", Payload: RealtimeData{RealtimeAction: "CREATE", Data: json.RawMessage(`{"id":"1"}`)}},
+			}
+		}
+		return nil
+	})
+	srv.disableWebsocket.Store(true)
+
+	// Websocket only
+	client := NewRealtimeClient(srv.URL, nil, "t12345", "user", "pass")
+	client.SetConnectionType(RealtimeConnectionTypeWebsocket)
+	if err := client.Connect(context.Background()); err == nil {
+		t.Fatalf("websocket: expected an error")
+	}
+
+	// Fallback to long-polling
+	client.SetConnectionType(RealtimeConnectionTypeAuto)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := client.ConnectionType(); got != RealtimeConnectionTypeLongPolling {
+		t.Errorf("connection type: got %s, want %s", got, RealtimeConnectionTypeLongPolling)
+	}
+
+	ch := make(chan *Message, 1)
+	if err := <-client.Subscribe(RealtimeMeasurements("12345"), ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case msg := <-ch:
+		if got := msg.Payload.Item.Get("id").String(); got != "1" {
+			t.Errorf("message: got %q, want %q", got, "1")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		client.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(15 * time.Second):
+		t.Fatal("close did not abort the long poll")
+	}
+}
+
+func TestRealtimeClient_LongPollingClientIsReused(t *testing.T) {
+	client := NewRealtimeClient("http://localhost", nil, "t12345", "user", "pass")
+	first, err := client.getLongPollingClient()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := client.getLongPollingClient()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first != second {
+		t.Errorf("default client should be reused when reconnecting")
+	}
+
+	custom := &http.Client{}
+	client.SetHTTPClient(custom)
+	if got, _ := client.getLongPollingClient(); got != custom {
+		t.Errorf("client set by SetHTTPClient should be used")
+	}
+}
+
+// messageMetrics counts the messages by direction
+type messageMetrics struct {
+	mu       sync.Mutex
+	messages map[string]int
+}
+
+func (m *messageMetrics) RecordRequest(ctx context.Context, r telemetry.RequestMetric)       {}
+func (m *messageMetrics) RecordConnection(ctx context.Context, c telemetry.ConnectionMetric) {}
+func (m *messageMetrics) RecordMessage(ctx context.Context, msg telemetry.MessageMetric) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.messages == nil {
+		m.messages = map[string]int{}
+	}
+	m.messages[msg.Direction]++
+}
+
+func (m *messageMetrics) count(direction string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.messages[direction]
+}
+
+func newAlarmNotificationServer(t *testing.T) *bayeuxTestServer {
+	return newBayeuxTestServer(t, func(req request) []Message {
+		if req.Channel == "/meta/subscribe" {
+			return []Message{
+				{Channel: req.Channel, ID: req.ID, Subscription: req.Subscription, Successful: true},
+				{Channel: "/alarms/12345", Payload: RealtimeData{RealtimeAction: "CREATE", Data: json.RawMessage(`{"id":"1","severity":"MAJOR","c8y_Custom":{"value":1}}`)}},
+				{Channel: "/alarms/12345", Payload: RealtimeData{RealtimeAction: "UPDATE", Data: json.RawMessage(`{"id":"1","severity":"MINOR"}`)}},
+				{Channel: "/alarms/12345", Payload: RealtimeData{RealtimeAction: "DELETE", Data: json.RawMessage(`"1"`)}},
+			}
+		}
+		return nil
+	})
+}
+
+func TestRealtimeClient_SubscribeAlarms(t *testing.T) {
+	srv := newAlarmNotificationServer(t)
+	client := NewRealtimeClient(srv.URL, nil, "t12345", "user", "pass")
+	defer client.Close()
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	alarms, err := client.SubscribeAlarms(ctx, "12345")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []struct {
+		Action   RealtimeAction
+		ID       string
+		Severity string
+	}{
+		{RealtimeActionCreate, "1", "MAJOR"},
+		{RealtimeActionUpdate, "1", "MINOR"},
+		{RealtimeActionDelete, "1", ""},
+	}
+	for i, want := range expected {
+		select {
+		case notification := <-alarms:
+			if notification.Action != want.Action || notification.ID != want.ID || notification.Data.Severity != want.Severity {
+				t.Errorf("notification %d: got %s/%s/%s, want %s/%s/%s", i, notification.Action, notification.ID, notification.Data.Severity, want.Action, want.ID, want.Severity)
+			}
+			if i == 0 && notification.Data.Item.Get("c8y_Custom.value").Int() != 1 {
+				t.Errorf("custom fragment: got %s", notification.Data.Item.Raw)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for notification %d", i)
+		}
+	}
+
+	cancel()
+	select {
+	case _, ok := <-alarms:
+		if ok {
+			t.Errorf("unexpected notification after cancel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel was not closed after cancel")
+	}
+	if channels := client.hub.GetActiveChannels(); len(channels) != 0 {
+		t.Errorf("active channels: got %v, want none", channels)
+	}
+}
+
+func TestRealtimeClient_SubscribeBackpressureDrop(t *testing.T) {
+	srv := newAlarmNotificationServer(t)
+	metrics := &messageMetrics{}
+	client := NewRealtimeClient(srv.URL, nil, "t12345", "user", "pass")
+	client.SetInstrumentation(&telemetry.Instrumentation{Metrics: metrics})
+	defer client.Close()
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	alarms, err := client.SubscribeAlarms(ctx, "12345", WithRealtimeBufferSize(1), WithRealtimeBackpressure(RealtimeBackpressureDrop))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for metrics.count(telemetry.DirectionDropped) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("dropped: got %d, want %d", metrics.count(telemetry.DirectionDropped), 2)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if notification := <-alarms; notification.Action != RealtimeActionCreate {
+		t.Errorf("first notification: got %s, want %s", notification.Action, RealtimeActionCreate)
+	}
+	select {
+	case notification := <-alarms:
+		t.Errorf("unexpected notification: %s", notification.Action)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
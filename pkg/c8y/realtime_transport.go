@@ -0,0 +1,348 @@
+package c8y
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// RealtimeConnectionTypeAuto uses a websocket, and falls back to long-polling if the websocket connection can't be established
+	RealtimeConnectionTypeAuto = ""
+
+	// RealtimeConnectionTypeWebsocket only uses a websocket
+	RealtimeConnectionTypeWebsocket = "websocket"
+
+	// RealtimeConnectionTypeLongPolling only uses HTTP long-polling, e.g. when a proxy blocks websocket upgrades
+	RealtimeConnectionTypeLongPolling = "long-polling"
+)
+
+// errTransportClosed is returned when receiving from a transport which has been closed
+var errTransportClosed = errors.New("transport is closed")
+
+// realtimeTransport sends and receives Bayeux messages over a single connection
+type realtimeTransport interface {
+	// connectionType returns the Bayeux connection type used in the messages
+	connectionType() string
+
+	// send sends the messages. It is only called from the writer go routine
+	send(messages []request) error
+
+	// receive blocks until messages are received from the server or the transport fails
+	receive() ([]Message, error)
+
+	// ping checks if the connection is still alive
+	ping() error
+
+	close() error
+}
+
+// websocketTransport sends the messages over a websocket
+type websocketTransport struct {
+	ws *websocket.Conn
+}
+
+func newWebsocketTransport(ws *websocket.Conn) *websocketTransport {
+	ws.SetPongHandler(func(string) error {
+		ws.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+	return &websocketTransport{ws: ws}
+}
+
+func (t *websocketTransport) connectionType() string {
+	return RealtimeConnectionTypeWebsocket
+}
+
+func (t *websocketTransport) send(messages []request) error {
+	t.ws.SetWriteDeadline(time.Now().Add(writeWait))
+	return t.ws.WriteJSON(messages)
+}
+
+func (t *websocketTransport) receive() ([]Message, error) {
+	messages := []Message{}
+	err := t.ws.ReadJSON(&messages)
+	return messages, err
+}
+
+func (t *websocketTransport) ping() error {
+	// A websocket ping should initiate a websocket pong response from the server
+	// If the pong is not received in the minimum time, then the connection will be reset
+	t.ws.SetWriteDeadline(time.Now().Add(writeWait))
+	return t.ws.WriteMessage(websocket.PingMessage, nil)
+}
+
+func (t *websocketTransport) close() error {
+	return t.ws.Close()
+}
+
+// longPollingTransport sends each batch of messages as a HTTP POST request, and the server
+// responds with the messages in the response body. The /meta/connect request is held by the
+// server until there are messages to deliver or the advised timeout is reached
+type longPollingTransport struct {
+	url    string
+	client *http.Client
+	header http.Header
+
+	// ctx is cancelled when the transport is closed, which aborts any /meta/connect request
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+
+	incoming chan []Message
+	errs     chan error
+}
+
+func newLongPollingTransport(endpoint string, client *http.Client, header http.Header) *longPollingTransport {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &longPollingTransport{
+		url:      endpoint,
+		client:   client,
+		header:   header,
+		ctx:      ctx,
+		cancel:   cancel,
+		incoming: make(chan []Message),
+		errs:     make(chan error, 1),
+	}
+}
+
+func (t *longPollingTransport) connectionType() string {
+	return RealtimeConnectionTypeLongPolling
+}
+
+// send posts the messages in the background, so that other messages can be sent whilst
+// the server is holding the /meta/connect request
+func (t *longPollingTransport) send(messages []request) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return errTransportClosed
+	}
+
+	ctx, cancel := t.ctx, context.CancelFunc(func() {})
+	if !isLongPoll(messages) {
+		// Let short requests, e.g. /meta/disconnect, complete even if the transport is closed
+		ctx, cancel = context.WithTimeout(context.Background(), writeWait)
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		defer cancel()
+		response, err := t.post(ctx, messages)
+		if err != nil {
+			select {
+			case t.errs <- err:
+			default:
+			}
+			return
+		}
+		select {
+		case t.incoming <- response:
+		case <-t.ctx.Done():
+		}
+	}()
+	return nil
+}
+
+func (t *longPollingTransport) post(ctx context.Context, messages []request) ([]Message, error) {
+	body, err := json.Marshal(messages)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range t.header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("long-polling request failed. %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("long-polling request failed. status=%d", resp.StatusCode)
+	}
+
+	response := []Message{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("invalid long-polling response. %w", err)
+	}
+	return response, nil
+}
+
+func (t *longPollingTransport) receive() ([]Message, error) {
+	select {
+	case messages := <-t.incoming:
+		return messages, nil
+	case err := <-t.errs:
+		return nil, err
+	case <-t.ctx.Done():
+		return nil, errTransportClosed
+	}
+}
+
+// ping is not required as each request uses a new HTTP request
+func (t *longPollingTransport) ping() error {
+	return nil
+}
+
+// close aborts the /meta/connect request and waits for the other requests to complete.
+// The idle connections are closed as the session has ended
+func (t *longPollingTransport) close() error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+
+	t.cancel()
+	t.wg.Wait()
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+func isLongPoll(messages []request) bool {
+	for _, message := range messages {
+		if message.Channel == "/meta/connect" {
+			return true
+		}
+	}
+	return false
+}
+
+// getLongPollingURL returns the http url of the Bayeux endpoint
+func getLongPollingURL(websocketURL *url.URL) string {
+	u := *websocketURL
+	if u.Scheme == "ws" {
+		u.Scheme = "http"
+	} else {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
+
+// SetConnectionType sets the Bayeux connection type, RealtimeConnectionTypeWebsocket or RealtimeConnectionTypeLongPolling.
+// By default (RealtimeConnectionTypeAuto) a websocket is used, and long-polling is used if the websocket can't be established.
+// It is applied the next time the client connects
+func (c *RealtimeClient) SetConnectionType(connectionType string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.connectionTypeOption = connectionType
+}
+
+// SetHTTPClient sets the HTTP client used for long-polling. By default, a client using the
+// proxy, TLS settings and cookies of the websocket dialer is used. The client's idle connections
+// are closed when the long-polling connection is closed
+func (c *RealtimeClient) SetHTTPClient(client *http.Client) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.httpClient = client
+}
+
+// ConnectionType returns the Bayeux connection type of the current connection
+func (c *RealtimeClient) ConnectionType() string {
+	if transport := c.getTransport(); transport != nil {
+		return transport.connectionType()
+	}
+	return RealtimeConnectionTypeWebsocket
+}
+
+// dial creates the transport using the configured connection type
+func (c *RealtimeClient) dial(ctx context.Context) (realtimeTransport, error) {
+	c.mtx.RLock()
+	connectionType := c.connectionTypeOption
+	c.mtx.RUnlock()
+
+	switch connectionType {
+	case RealtimeConnectionTypeLongPolling:
+		return c.newLongPollingTransport()
+	case RealtimeConnectionTypeWebsocket:
+		return c.dialWebsocket(ctx)
+	case RealtimeConnectionTypeAuto:
+		transport, err := c.dialWebsocket(ctx)
+		if err == nil || ctx.Err() != nil {
+			return transport, err
+		}
+		Logger.Infof("Falling back to long-polling. %s", err)
+		return c.newLongPollingTransport()
+	default:
+		return nil, fmt.Errorf("unsupported connection type: %s", connectionType)
+	}
+}
+
+func (c *RealtimeClient) dialWebsocket(ctx context.Context) (realtimeTransport, error) {
+	if c.dialer == nil {
+		return nil, errors.New("missing dialer for realtime client")
+	}
+	Logger.Infof("Establishing connection to %s", c.url.String())
+	ws, _, err := c.dialer.DialContext(ctx, c.url.String(), c.requestHeader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to establish websocket connection. %w", err)
+	}
+	return newWebsocketTransport(ws), nil
+}
+
+func (c *RealtimeClient) newLongPollingTransport() (realtimeTransport, error) {
+	client, err := c.getLongPollingClient()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := getLongPollingURL(c.url)
+	Logger.Infof("Using long-polling connection to %s", endpoint)
+	return newLongPollingTransport(endpoint, client, c.requestHeader), nil
+}
+
+// getLongPollingClient returns the HTTP client set by SetHTTPClient, or the default client. The default
+// client is only created once, so that reconnecting reuses its connections
+func (c *RealtimeClient) getLongPollingClient() (*http.Client, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.httpClient != nil {
+		return c.httpClient, nil
+	}
+	if c.defaultHTTPClient != nil {
+		return c.defaultHTTPClient, nil
+	}
+
+	client := &http.Client{}
+	if c.dialer != nil {
+		client.Transport = &http.Transport{
+			Proxy:           c.dialer.Proxy,
+			TLSClientConfig: c.dialer.TLSClientConfig,
+		}
+		client.Jar = c.dialer.Jar
+	}
+	if client.Jar == nil {
+		// The server can use a cookie to identify the client
+		jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cookie jar: %w", err)
+		}
+		client.Jar = jar
+	}
+	c.defaultHTTPClient = client
+	return client, nil
+}
@@ -0,0 +1,255 @@
+package c8y
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/reubenmiller/go-c8y/pkg/telemetry"
+	"github.com/tidwall/gjson"
+)
+
+// RealtimeAction is the action which triggered a realtime notification
+type RealtimeAction string
+
+const (
+	RealtimeActionCreate RealtimeAction = "CREATE"
+	RealtimeActionUpdate RealtimeAction = "UPDATE"
+	RealtimeActionDelete RealtimeAction = "DELETE"
+)
+
+// Action returns the action which triggered the notification
+func (d RealtimeData) Action() RealtimeAction {
+	return RealtimeAction(d.RealtimeAction)
+}
+
+// RealtimeNotification is a realtime notification with the data decoded into its type
+type RealtimeNotification[T any] struct {
+	Action  RealtimeAction
+	Channel string
+
+	// ID of the object. Delete notifications only include the id, so Data is left empty
+	ID   string
+	Data T
+
+	// Message is the raw message received from the server
+	Message *Message
+}
+
+// AlarmNotification is a realtime notification of an alarm
+type AlarmNotification = RealtimeNotification[Alarm]
+
+// EventNotification is a realtime notification of an event
+type EventNotification = RealtimeNotification[Event]
+
+// MeasurementNotification is a realtime notification of a measurement
+type MeasurementNotification = RealtimeNotification[Measurement]
+
+// OperationNotification is a realtime notification of an operation
+type OperationNotification = RealtimeNotification[Operation]
+
+// ManagedObjectNotification is a realtime notification of a managed object
+type ManagedObjectNotification = RealtimeNotification[ManagedObject]
+
+// RealtimeBackpressure controls what happens when the consumer of a typed subscription can't keep up
+type RealtimeBackpressure int
+
+const (
+	// RealtimeBackpressureBlock waits for the consumer, which will also delay the delivery of messages
+	// to other subscriptions once the buffer is full
+	RealtimeBackpressureBlock RealtimeBackpressure = iota
+
+	// RealtimeBackpressureDrop drops new notifications whilst the buffer is full
+	RealtimeBackpressureDrop
+)
+
+// DefaultRealtimeBufferSize is the default number of notifications buffered for each typed subscription
+const DefaultRealtimeBufferSize = 100
+
+type realtimeSubscriptionOptions struct {
+	bufferSize   int
+	backpressure RealtimeBackpressure
+}
+
+// RealtimeSubscriptionOption configures a typed subscription
+type RealtimeSubscriptionOption func(*realtimeSubscriptionOptions)
+
+// WithRealtimeBufferSize sets the number of notifications which are buffered before the back-pressure policy is applied
+func WithRealtimeBufferSize(size int) RealtimeSubscriptionOption {
+	return func(o *realtimeSubscriptionOptions) {
+		if size >= 0 {
+			o.bufferSize = size
+		}
+	}
+}
+
+// WithRealtimeBackpressure sets the policy used when the buffer is full. Blocked and dropped notifications
+// are recorded in the message metrics (telemetry.DirectionBlocked and telemetry.DirectionDropped)
+func WithRealtimeBackpressure(policy RealtimeBackpressure) RealtimeSubscriptionOption {
+	return func(o *realtimeSubscriptionOptions) {
+		o.backpressure = policy
+	}
+}
+
+// SubscribeAlarms subscribes to the alarms of a device. Use "*" or an empty id to subscribe to all devices.
+// The channel is closed and the subscription is removed when the ctx is done
+func (c *RealtimeClient) SubscribeAlarms(ctx context.Context, deviceID string, opts ...RealtimeSubscriptionOption) (<-chan AlarmNotification, error) {
+	return subscribeTyped(ctx, c, RealtimeAlarms(realtimeDeviceID(deviceID)), func(v *Alarm, item gjson.Result) {
+		v.Item = item
+	}, opts)
+}
+
+// SubscribeEvents subscribes to the events of a device. Use "*" or an empty id to subscribe to all devices.
+// The channel is closed and the subscription is removed when the ctx is done
+func (c *RealtimeClient) SubscribeEvents(ctx context.Context, deviceID string, opts ...RealtimeSubscriptionOption) (<-chan EventNotification, error) {
+	return subscribeTyped(ctx, c, RealtimeEvents(realtimeDeviceID(deviceID)), func(v *Event, item gjson.Result) {
+		v.Item = item
+	}, opts)
+}
+
+// SubscribeMeasurements subscribes to the measurements of a device. Use "*" or an empty id to subscribe to all devices.
+// The channel is closed and the subscription is removed when the ctx is done
+func (c *RealtimeClient) SubscribeMeasurements(ctx context.Context, deviceID string, opts ...RealtimeSubscriptionOption) (<-chan MeasurementNotification, error) {
+	return subscribeTyped(ctx, c, RealtimeMeasurements(realtimeDeviceID(deviceID)), func(v *Measurement, item gjson.Result) {
+		v.Item = item
+	}, opts)
+}
+
+// SubscribeOperations subscribes to the operations of an agent. Use "*" or an empty id to subscribe to all agents.
+// The channel is closed and the subscription is removed when the ctx is done
+func (c *RealtimeClient) SubscribeOperations(ctx context.Context, deviceID string, opts ...RealtimeSubscriptionOption) (<-chan OperationNotification, error) {
+	return subscribeTyped(ctx, c, RealtimeOperations(realtimeDeviceID(deviceID)), func(v *Operation, item gjson.Result) {
+		v.Item = item
+	}, opts)
+}
+
+// SubscribeManagedObjects subscribes to changes of a managed object. Use "*" or an empty id to subscribe to all managed objects.
+// The channel is closed and the subscription is removed when the ctx is done
+func (c *RealtimeClient) SubscribeManagedObjects(ctx context.Context, id string, opts ...RealtimeSubscriptionOption) (<-chan ManagedObjectNotification, error) {
+	return subscribeTyped(ctx, c, RealtimeManagedObjects(realtimeDeviceID(id)), func(v *ManagedObject, item gjson.Result) {
+		v.Item = item
+	}, opts)
+}
+
+func realtimeDeviceID(id string) string {
+	if id == "" {
+		return "*"
+	}
+	return id
+}
+
+// subscribeTyped subscribes to the pattern and decodes each message before passing it to the returned channel.
+// The setItem func is used to set the custom fragments of the decoded value
+func subscribeTyped[T any](ctx context.Context, c *RealtimeClient, pattern string, setItem func(*T, gjson.Result), opts []RealtimeSubscriptionOption) (<-chan RealtimeNotification[T], error) {
+	options := realtimeSubscriptionOptions{
+		bufferSize:   DefaultRealtimeBufferSize,
+		backpressure: RealtimeBackpressureBlock,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	in := make(chan *Message, options.bufferSize)
+	client, response := c.subscribe(pattern, in)
+	if err := waitContext(ctx, response); err != nil {
+		if client != nil {
+			c.removeSubscription(client)
+		}
+		return nil, err
+	}
+
+	out := make(chan RealtimeNotification[T], options.bufferSize)
+	go func() {
+		defer close(out)
+		defer c.removeSubscription(client)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message := <-in:
+				notification, err := decodeNotification(message, setItem)
+				if err != nil {
+					Logger.Infof("Failed to decode realtime notification. channel=%s, err=%s", message.Channel, err)
+					continue
+				}
+				if !deliverNotification(ctx, c, out, notification, options.backpressure) {
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func decodeNotification[T any](message *Message, setItem func(*T, gjson.Result)) (RealtimeNotification[T], error) {
+	notification := RealtimeNotification[T]{
+		Action:  message.Payload.Action(),
+		Channel: message.Channel,
+		Message: message,
+	}
+
+	item := gjson.ParseBytes(message.Payload.Data)
+	if item.Type == gjson.String || item.Type == gjson.Number {
+		// Delete notifications only contain the id
+		notification.ID = item.String()
+		return notification, nil
+	}
+
+	if err := json.Unmarshal(message.Payload.Data, &notification.Data); err != nil {
+		return notification, err
+	}
+	setItem(&notification.Data, item)
+	notification.ID = item.Get("id").String()
+	return notification, nil
+}
+
+// deliverNotification passes the notification to the consumer using the back-pressure policy.
+// It returns false if the ctx is done
+func deliverNotification[T any](ctx context.Context, c *RealtimeClient, out chan<- RealtimeNotification[T], notification RealtimeNotification[T], policy RealtimeBackpressure) bool {
+	select {
+	case out <- notification:
+		return true
+	default:
+	}
+
+	direction := telemetry.DirectionBlocked
+	if policy == RealtimeBackpressureDrop {
+		direction = telemetry.DirectionDropped
+	}
+	c.getInstrumentation().RecordMessage(context.Background(), telemetry.MessageMetric{
+		Client:    telemetry.ClientRealtime,
+		Direction: direction,
+		Bytes:     len(notification.Message.Payload.Data),
+	})
+
+	if policy == RealtimeBackpressureDrop {
+		Logger.Infof("Consumer is too slow, dropping realtime notification. channel=%s", notification.Channel)
+		return true
+	}
+
+	select {
+	case out <- notification:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// removeSubscription removes the subscription, and unsubscribes from the server if
+// there are no other subscriptions using the same channel
+func (c *RealtimeClient) removeSubscription(client *subscription) {
+	if c.hub.remove(client) || !c.IsConnected() {
+		return
+	}
+	pattern := client.glob.String()
+	Logger.Infof("unsubscribing to %s", pattern)
+	err := c.enqueue(&request{
+		ID:           c.nextMessageID(),
+		Channel:      "/meta/unsubscribe",
+		Subscription: pattern,
+		ClientID:     c.getClientID(),
+	})
+	if err != nil {
+		Logger.Infof("Failed to unsubscribe. %s", err)
+	}
+}
@@ -0,0 +1,506 @@
+package c8y
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrInteractionNotFound is returned in replay only mode when no recorded interaction matches a request
+var ErrInteractionNotFound = errors.New("recorder: no recorded interaction matches the request")
+
+// RecorderMode controls if interactions are recorded or replayed
+type RecorderMode int
+
+const (
+	// RecorderModeRecord sends all requests to the server and records the interactions.
+	// Any existing interactions in the cassette are replaced
+	RecorderModeRecord RecorderMode = iota
+
+	// RecorderModeReplay replays recorded interactions. Requests which do not match a recorded
+	// interaction are sent to the server and added to the cassette
+	RecorderModeReplay
+
+	// RecorderModeReplayOnly only replays recorded interactions. Requests which do not match a
+	// recorded interaction fail with ErrInteractionNotFound, so no requests are sent to the server
+	RecorderModeReplayOnly
+)
+
+// ParseRecorderMode parses a recorder mode (record, replay or replay-only)
+func ParseRecorderMode(v string) (RecorderMode, error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "record":
+		return RecorderModeRecord, nil
+	case "replay":
+		return RecorderModeReplay, nil
+	case "replay-only", "replayonly", "strict":
+		return RecorderModeReplayOnly, nil
+	}
+	return RecorderModeReplay, fmt.Errorf("invalid recorder mode. value=%s", v)
+}
+
+// Body encodings used in cassettes
+const (
+	BodyEncodingBase64    = "base64"
+	BodyEncodingMultipart = "multipart"
+)
+
+// Cassette contains a list of recorded interactions
+type Cassette struct {
+	Version      int            `json:"version"`
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction a single request and its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest a recorded request. Sensitive information is replaced by placeholders
+type RecordedRequest struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	Headers      http.Header `json:"headers,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"`
+}
+
+// RecordedResponse a recorded response. Sensitive information is replaced by placeholders
+type RecordedResponse struct {
+	StatusCode   int         `json:"statusCode"`
+	Headers      http.Header `json:"headers,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"`
+}
+
+// RecordedPart a part of a multipart request. Only the checksum of the content is stored
+type RecordedPart struct {
+	Name        string `json:"name"`
+	FileName    string `json:"filename,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        int    `json:"size"`
+	SHA256      string `json:"sha256"`
+}
+
+// RecorderMatcher reports whether a request matches a recorded request.
+// Both requests have already been redacted
+type RecorderMatcher func(req *RecordedRequest, recorded *RecordedRequest) bool
+
+// MatchOptions controls which parts of a request have to match a recorded request
+type MatchOptions struct {
+	// MatchHost compares the scheme and host. By default only the path and query are compared
+	MatchHost bool
+
+	// IgnoreQueryParams query parameters which are ignored, e.g. dateFrom
+	IgnoreQueryParams []string
+
+	// MatchBody compares the request body. JSON bodies are compared semantically
+	MatchBody bool
+
+	// Headers which must be equal, e.g. Accept
+	Headers []string
+}
+
+// NewRecorderMatcher returns a matcher which compares the method, path and query (and optionally other fields)
+func NewRecorderMatcher(opts MatchOptions) RecorderMatcher {
+	normalizeURL := func(v string) string {
+		// The host can contain a placeholder, e.g. {host}, so it is not parsed
+		origin := ""
+		if scheme, rest, found := strings.Cut(v, "://"); found {
+			host, path, _ := strings.Cut(rest, "/")
+			origin = scheme + "://" + host
+			v = "/" + path
+		}
+		u, err := url.Parse(v)
+		if err != nil {
+			return v
+		}
+		query := u.Query()
+		for _, key := range opts.IgnoreQueryParams {
+			query.Del(key)
+		}
+		u.RawQuery = query.Encode()
+		if !opts.MatchHost {
+			return u.RequestURI()
+		}
+		return origin + u.RequestURI()
+	}
+
+	return func(req *RecordedRequest, recorded *RecordedRequest) bool {
+		if !strings.EqualFold(req.Method, recorded.Method) {
+			return false
+		}
+		if normalizeURL(req.URL) != normalizeURL(recorded.URL) {
+			return false
+		}
+		for _, header := range opts.Headers {
+			if req.Headers.Get(header) != recorded.Headers.Get(header) {
+				return false
+			}
+		}
+		if opts.MatchBody && !bodiesEqual(req, recorded) {
+			return false
+		}
+		return true
+	}
+}
+
+func bodiesEqual(a *RecordedRequest, b *RecordedRequest) bool {
+	if a.BodyEncoding != b.BodyEncoding {
+		return false
+	}
+	if a.Body == b.Body {
+		return true
+	}
+	if a.BodyEncoding == "" {
+		var aValue, bValue any
+		if json.Unmarshal([]byte(a.Body), &aValue) == nil && json.Unmarshal([]byte(b.Body), &bValue) == nil {
+			return reflect.DeepEqual(aValue, bValue)
+		}
+	}
+	return false
+}
+
+// RecorderOptions controls how interactions are recorded and replayed
+type RecorderOptions struct {
+	// Mode recorder mode. Defaults to RecorderModeRecord
+	Mode RecorderMode
+
+	// Matcher used to find a recorded interaction. Defaults to NewRecorderMatcher(MatchOptions{})
+	Matcher RecorderMatcher
+
+	// SensitiveValues returns the values which are replaced by placeholders before an interaction is stored,
+	// e.g. Client.SensitiveValues. Credentials (Basic Auth values, OAuth2 and XSRF tokens) are always redacted.
+	// When replaying, non-secret placeholders (e.g. {host}) in the responses are replaced with the current values
+	SensitiveValues func() []SensitiveValue
+}
+
+// Recorder records and replays http interactions to and from a cassette file
+type Recorder struct {
+	path string
+	opts RecorderOptions
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+// NewRecorder creates a recorder using the given cassette file. Recorded interactions are
+// loaded from the cassette unless the recorder is in record mode
+func NewRecorder(cassettePath string, opts RecorderOptions) (*Recorder, error) {
+	if opts.Matcher == nil {
+		opts.Matcher = NewRecorderMatcher(MatchOptions{})
+	}
+	r := &Recorder{
+		path:     cassettePath,
+		opts:     opts,
+		cassette: &Cassette{Version: 1},
+	}
+
+	if opts.Mode != RecorderModeRecord {
+		b, err := os.ReadFile(cassettePath)
+		if err != nil {
+			if opts.Mode == RecorderModeReplayOnly || !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("could not read cassette. %w", err)
+			}
+		} else if err := json.Unmarshal(b, r.cassette); err != nil {
+			return nil, fmt.Errorf("invalid cassette. %w", err)
+		}
+	}
+	r.used = make([]bool, len(r.cassette.Interactions))
+	return r, nil
+}
+
+// WithRecorder records or replays all requests using the given cassette file
+func WithRecorder(cassettePath string, opts RecorderOptions) (ClientOption, error) {
+	recorder, err := NewRecorder(cassettePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	return recorder.ClientOption(), nil
+}
+
+// ClientOption returns a client option which routes the requests via the recorder
+func (r *Recorder) ClientOption() ClientOption {
+	return func(tr http.RoundTripper) http.RoundTripper {
+		return &funcTripper{roundTrip: func(req *http.Request) (*http.Response, error) {
+			return r.RoundTrip(tr, req)
+		}}
+	}
+}
+
+// Interactions returns the recorded interactions
+func (r *Recorder) Interactions() []*Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.cassette.Interactions)
+}
+
+// RoundTrip replays a matching interaction, or sends the request using the given transport and records it
+func (r *Recorder) RoundTrip(tr http.RoundTripper, req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	recordedReq := r.recordRequest(req, body)
+
+	if r.opts.Mode != RecorderModeRecord {
+		if interaction := r.find(recordedReq); interaction != nil {
+			Logger.Infof("Replaying recorded response: %s %s", req.Method, recordedReq.URL)
+			return r.replay(req, interaction)
+		}
+		if r.opts.Mode == RecorderModeReplayOnly {
+			return nil, fmt.Errorf("%w. %s %s", ErrInteractionNotFound, req.Method, recordedReq.URL)
+		}
+	}
+
+	// The original request body has been consumed, so send a copy of the request
+	outReq := req
+	if body != nil {
+		outReq = req.Clone(req.Context())
+		outReq.Body = io.NopCloser(bytes.NewReader(body))
+		outReq.ContentLength = int64(len(body))
+		outReq.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	resp, err := tr.RoundTrip(outReq)
+	if err != nil {
+		return resp, err
+	}
+	resp.Request = req
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := &Interaction{
+		Request:  *recordedReq,
+		Response: r.recordResponse(resp, respBody),
+	}
+	if err := r.add(interaction); err != nil {
+		Logger.Warnf("Could not save cassette. %s", err)
+	}
+	return resp, nil
+}
+
+func (r *Recorder) sensitiveValues() []SensitiveValue {
+	if r.opts.SensitiveValues == nil {
+		return nil
+	}
+	return r.opts.SensitiveValues()
+}
+
+func (r *Recorder) redact(v string) string {
+	return RedactSensitiveInformation(v, r.sensitiveValues())
+}
+
+func (r *Recorder) restore(v string) string {
+	for _, value := range r.sensitiveValues() {
+		if !value.Secret && value.Value != "" && strings.HasPrefix(value.Placeholder, "{") {
+			v = strings.ReplaceAll(v, value.Placeholder, value.Value)
+		}
+	}
+	return v
+}
+
+func (r *Recorder) redactHeaders(headers http.Header, exclude ...string) http.Header {
+	out := http.Header{}
+	for key, values := range headers {
+		if slices.ContainsFunc(exclude, func(v string) bool { return strings.EqualFold(v, key) }) {
+			continue
+		}
+		for _, value := range values {
+			out.Add(key, r.redact(value))
+		}
+	}
+	return out
+}
+
+func (r *Recorder) recordRequest(req *http.Request, body []byte) *RecordedRequest {
+	recorded := &RecordedRequest{
+		Method: req.Method,
+		URL:    r.redact(req.URL.String()),
+		// Credentials are not stored at all
+		Headers: r.redactHeaders(req.Header, "Authorization", "Cookie", "X-Xsrf-Token"),
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		// The boundary is random, so only store a summary of each part
+		parts, err := summarizeMultipart(body, params["boundary"])
+		if err == nil {
+			b, _ := json.Marshal(parts)
+			recorded.Body = string(b)
+			recorded.BodyEncoding = BodyEncodingMultipart
+			recorded.Headers.Set("Content-Type", mediaType)
+			return recorded
+		}
+	}
+	recorded.Body, recorded.BodyEncoding = r.encodeBody(body, req.Header.Get("Content-Type"))
+	return recorded
+}
+
+func (r *Recorder) recordResponse(resp *http.Response, body []byte) RecordedResponse {
+	recorded := RecordedResponse{
+		StatusCode: resp.StatusCode,
+		Headers:    r.redactHeaders(resp.Header, "Set-Cookie"),
+	}
+	recorded.Body, recorded.BodyEncoding = r.encodeBody(body, resp.Header.Get("Content-Type"))
+	return recorded
+}
+
+// encodeBody redacts text bodies, and base64 encodes binary bodies
+func (r *Recorder) encodeBody(body []byte, contentType string) (string, string) {
+	if len(body) == 0 {
+		return "", ""
+	}
+	if utf8.Valid(body) && !strings.Contains(contentType, "octet-stream") {
+		return r.redact(string(body)), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), BodyEncodingBase64
+}
+
+func (r *Recorder) find(req *RecordedRequest) *Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Use the interactions in the recorded order, so that repeated requests get the same
+	// sequence of responses. Fallback to the last matching interaction if all have been used
+	var fallback *Interaction
+	for i, interaction := range r.cassette.Interactions {
+		if !r.opts.Matcher(req, &interaction.Request) {
+			continue
+		}
+		if !r.used[i] {
+			r.used[i] = true
+			return interaction
+		}
+		fallback = interaction
+	}
+	return fallback
+}
+
+func (r *Recorder) add(interaction *Interaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.used = append(r.used, true)
+	return r.save()
+}
+
+// save writes the cassette to a temp file which is then renamed to avoid partially written cassettes
+func (r *Recorder) save() error {
+	b, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(r.path), "cassette-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), r.path)
+}
+
+func (r *Recorder) replay(req *http.Request, interaction *Interaction) (*http.Response, error) {
+	recorded := interaction.Response
+
+	var body []byte
+	switch recorded.BodyEncoding {
+	case BodyEncodingBase64:
+		v, err := base64.StdEncoding.DecodeString(recorded.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recorded body. %w", err)
+		}
+		body = v
+	default:
+		body = []byte(r.restore(recorded.Body))
+	}
+
+	headers := http.Header{}
+	for key, values := range recorded.Headers {
+		for _, value := range values {
+			headers.Add(key, r.restore(value))
+		}
+	}
+	// The body is stored uncompressed
+	headers.Del("Content-Encoding")
+	headers.Del("Content-Length")
+
+	return &http.Response{
+		StatusCode:    recorded.StatusCode,
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        headers,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// readRequestBody reads and closes the request body
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	defer req.Body.Close()
+	return io.ReadAll(req.Body)
+}
+
+func summarizeMultipart(body []byte, boundary string) ([]RecordedPart, error) {
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	parts := make([]RecordedPart, 0)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, RecordedPart{
+			Name:        part.FormName(),
+			FileName:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+			Size:        len(content),
+			SHA256:      fmt.Sprintf("%x", sha256.Sum256(content)),
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package c8y
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newRecorderTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/inventory/managedObjects/12345":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"12345","self":"` + srv.URL + `/inventory/managedObjects/12345"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/inventory/binaries/1":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte{0x00, 0xff, 0x10})
+		case r.Method == http.MethodPost && r.URL.Path == "/inventory/binaries":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":"1"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newRecorderTestClient(t *testing.T, baseURL string, cassette string, mode RecorderMode) *Client {
+	t.Helper()
+	var client *Client
+	recorder, err := NewRecorder(cassette, RecorderOptions{
+		Mode: mode,
+		SensitiveValues: func() []SensitiveValue {
+			return client.SensitiveValues()
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client = NewClientFromOptions(NewHTTPClient(recorder.ClientOption()), ClientOptions{
+		BaseURL:  baseURL,
+		Tenant:   "t12345",
+		Username: "recorder-user",
+		Password: "recorder-secret",
+	})
+	return client
+}
+
+func TestRecorder_RecordAndReplay(t *testing.T) {
+	srv := newRecorderTestServer(t)
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+
+	sendRequests := func(client *Client) (string, string, string) {
+		t.Helper()
+		ctx := context.Background()
+		mo, _, err := client.Inventory.GetManagedObject(ctx, "12345", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		download, err := client.SendRequest(ctx, RequestOptions{Method: http.MethodGet, Path: "inventory/binaries/1"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		upload, err := client.SendRequest(ctx, RequestOptions{
+			Method: http.MethodPost,
+			Path:   "inventory/binaries",
+			FormData: map[string]io.Reader{
+				"file":   strings.NewReader("file contents"),
+				"object": strings.NewReader(`{"name":"file.txt"}`),
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return mo.Self, string(download.Body()), upload.JSON("id").String()
+	}
+
+	recordClient := newRecorderTestClient(t, srv.URL, cassette, RecorderModeRecord)
+	self, download, upload := sendRequests(recordClient)
+
+	contents, err := os.ReadFile(cassette)
+	if err != nil {
+		t.Fatalf("cassette should be written: %v", err)
+	}
+	for _, secret := range []string{"recorder-secret", "recorder-user", NewBasicAuthString("t12345", "recorder-user", "recorder-secret"), srv.Listener.Addr().String()} {
+		if strings.Contains(string(contents), secret) {
+			t.Errorf("cassette should not contain %q", secret)
+		}
+	}
+
+	// Replay without a server, using a different host
+	srv.Close()
+	replayClient := newRecorderTestClient(t, "https://replay.example.com", cassette, RecorderModeReplayOnly)
+	replaySelf, replayDownload, replayUpload := sendRequests(replayClient)
+
+	if want := "http://replay.example.com/inventory/managedObjects/12345"; replaySelf != want {
+		t.Errorf("self: got %q, want %q", replaySelf, want)
+	}
+	if replayDownload != download {
+		t.Errorf("binary download: got %v, want %v", []byte(replayDownload), []byte(download))
+	}
+	if replayUpload != upload || upload != "1" {
+		t.Errorf("multipart upload: got %q, want %q", replayUpload, upload)
+	}
+	if self == "" {
+		t.Errorf("recorded self link should not be empty")
+	}
+
+	_, err = replayClient.SendRequest(context.Background(), RequestOptions{Method: http.MethodGet, Path: "alarm/alarms"})
+	if !errors.Is(err, ErrInteractionNotFound) {
+		t.Errorf("unmatched request: got %v, want %v", err, ErrInteractionNotFound)
+	}
+}
+
+func TestRecorderMatcher(t *testing.T) {
+	recorded := &RecordedRequest{Method: "POST", URL: "https://{host}/event/events?dateFrom=1&type=a", Body: `{"a":1,"b":2}`}
+
+	testCases := []struct {
+		opts MatchOptions
+		req  RecordedRequest
+		want bool
+	}{
+		{MatchOptions{}, RecordedRequest{Method: "POST", URL: "http://other/event/events?type=a&dateFrom=1"}, true},
+		{MatchOptions{}, RecordedRequest{Method: "GET", URL: "http://other/event/events?type=a&dateFrom=1"}, false},
+		{MatchOptions{}, RecordedRequest{Method: "POST", URL: "http://other/event/events?type=a&dateFrom=2"}, false},
+		{MatchOptions{IgnoreQueryParams: []string{"dateFrom"}}, RecordedRequest{Method: "POST", URL: "http://other/event/events?type=a&dateFrom=2"}, true},
+		{MatchOptions{MatchHost: true}, RecordedRequest{Method: "POST", URL: "http://other/event/events?type=a&dateFrom=1"}, false},
+		{MatchOptions{MatchBody: true}, RecordedRequest{Method: "POST", URL: "/event/events?type=a&dateFrom=1", Body: `{"b":2, "a":1}`}, true},
+		{MatchOptions{MatchBody: true}, RecordedRequest{Method: "POST", URL: "/event/events?type=a&dateFrom=1", Body: `{"a":2}`}, false},
+	}
+	for i, tc := range testCases {
+		if got := NewRecorderMatcher(tc.opts)(&tc.req, recorded); got != tc.want {
+			t.Errorf("case %d: got %v, want %v", i, got, tc.want)
+		}
+	}
+}
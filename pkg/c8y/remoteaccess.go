@@ -53,6 +53,7 @@ func (s *RemoteAccessService) config_path(mo_id string, config_id string) string
 func (s *RemoteAccessService) GetConfiguration(ctx context.Context, mo_id, config_id string) (*RemoteAccessConfiguration, *Response, error) {
 	data := new(RemoteAccessConfiguration)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "RemoteAccess.GetConfiguration",
 		Method:       http.MethodGet,
 		Path:         s.config_path(mo_id, config_id),
 		ResponseData: data,
@@ -65,6 +66,7 @@ func (s *RemoteAccessService) GetConfiguration(ctx context.Context, mo_id, confi
 func (s *RemoteAccessService) GetConfigurations(ctx context.Context, mo_id string, opt *RemoteAccessCollectionOptions) ([]RemoteAccessConfiguration, *Response, error) {
 	data := make([]RemoteAccessConfiguration, 0)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "RemoteAccess.GetConfigurations",
 		Method:       http.MethodGet,
 		Path:         s.path(mo_id),
 		Query:        opt,
@@ -76,9 +78,10 @@ func (s *RemoteAccessService) GetConfigurations(ctx context.Context, mo_id strin
 // DeleteConfiguration delete remote access configuration
 func (s *RemoteAccessService) DeleteConfiguration(ctx context.Context, mo_id string, config_id string, opt *RemoteAccessCollectionOptions) (*Response, error) {
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: http.MethodDelete,
-		Path:   s.config_path(mo_id, config_id),
-		Query:  opt,
+		Operation: "RemoteAccess.DeleteConfiguration",
+		Method:    http.MethodDelete,
+		Path:      s.config_path(mo_id, config_id),
+		Query:     opt,
 	})
 	return resp, err
 }
@@ -87,6 +90,7 @@ func (s *RemoteAccessService) DeleteConfiguration(ctx context.Context, mo_id str
 func (s *RemoteAccessService) Create(ctx context.Context, mo_id string, config_id string, body interface{}) (*RemoteAccessConfiguration, *Response, error) {
 	data := new(RemoteAccessConfiguration)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "RemoteAccess.Create",
 		Method:       http.MethodPost,
 		Path:         s.config_path(mo_id, config_id),
 		Body:         body,
@@ -99,6 +103,7 @@ func (s *RemoteAccessService) Create(ctx context.Context, mo_id string, config_i
 func (s *RemoteAccessService) Update(ctx context.Context, mo_id string, config_id string, body *OperationUpdateOptions) (*Operation, *Response, error) {
 	data := new(Operation)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "RemoteAccess.Update",
 		Method:       http.MethodPut,
 		Path:         s.config_path(mo_id, config_id),
 		Body:         body,
@@ -30,6 +30,9 @@ type Response struct {
 	receivedAt time.Time
 	duration   time.Duration
 	dryRun     bool
+	attempts   []RequestAttempt
+
+	rateLimitWait time.Duration
 }
 
 // IsDryRun return if the response is from a dry run
@@ -37,10 +40,29 @@ func (r *Response) IsDryRun() bool {
 	return r.dryRun
 }
 
+// Duration returns the duration of the last attempt of the request
 func (r *Response) Duration() time.Duration {
 	return r.duration
 }
 
+// Attempts returns the number of attempts it took to get the response
+func (r *Response) Attempts() int {
+	if len(r.attempts) == 0 {
+		return 1
+	}
+	return len(r.attempts)
+}
+
+// RateLimitWait returns the total time the request waited for the client side rate limiter (see WithRateLimit)
+func (r *Response) RateLimitWait() time.Duration {
+	return r.rateLimitWait
+}
+
+// AttemptHistory returns details about each attempt which was sent to get the response
+func (r *Response) AttemptHistory() []RequestAttempt {
+	return r.attempts
+}
+
 func (r *Response) SetBody(v []byte) {
 	r.body = v
 	r.size = int64(len(r.body))
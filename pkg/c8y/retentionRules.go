@@ -50,6 +50,7 @@ type RetentionRuleCollection struct {
 func (s *RetentionRuleService) GetRetentionRule(ctx context.Context, ID string) (*RetentionRule, *Response, error) {
 	data := new(RetentionRule)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "RetentionRule.GetRetentionRule",
 		Method:       "GET",
 		Path:         RetentionRuleAPI + "/" + ID,
 		ResponseData: data,
@@ -61,6 +62,7 @@ func (s *RetentionRuleService) GetRetentionRule(ctx context.Context, ID string)
 func (s *RetentionRuleService) GetRetentionRules(ctx context.Context, opt *PaginationOptions) (*RetentionRuleCollection, *Response, error) {
 	data := new(RetentionRuleCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "RetentionRule.GetRetentionRules",
 		Method:       "GET",
 		Path:         RetentionRuleAPI,
 		Query:        opt,
@@ -73,6 +75,7 @@ func (s *RetentionRuleService) GetRetentionRules(ctx context.Context, opt *Pagin
 func (s *RetentionRuleService) Create(ctx context.Context, body RetentionRule) (*RetentionRule, *Response, error) {
 	data := new(RetentionRule)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "RetentionRule.Create",
 		Method:       "POST",
 		Path:         RetentionRuleAPI,
 		Body:         body,
@@ -85,6 +88,7 @@ func (s *RetentionRuleService) Create(ctx context.Context, body RetentionRule) (
 func (s *RetentionRuleService) Update(ctx context.Context, ID string, body RetentionRule) (*RetentionRule, *Response, error) {
 	data := new(RetentionRule)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "RetentionRule.Update",
 		Method:       "PUT",
 		Path:         RetentionRuleAPI + "/" + ID,
 		Body:         body,
@@ -96,7 +100,8 @@ func (s *RetentionRuleService) Update(ctx context.Context, ID string, body Reten
 // Delete retention rule by its ID
 func (s *RetentionRuleService) Delete(ctx context.Context, ID string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   RetentionRuleAPI + "/" + ID,
+		Operation: "RetentionRule.Delete",
+		Method:    "DELETE",
+		Path:      RetentionRuleAPI + "/" + ID,
 	})
 }
@@ -0,0 +1,384 @@
+package c8y
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultRetryStatusCodes http status codes which are retried by default
+var DefaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// IdempotentMethods http methods which are safe to retry without the risk of creating duplicates
+var IdempotentMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodPut,
+	http.MethodDelete,
+}
+
+// ErrBodyNotRewindable is returned when a request body can not be sent again for a retry
+var ErrBodyNotRewindable = errors.New("request body can not be rewound")
+
+// RetryOptions controls if and how a failed request is retried
+type RetryOptions struct {
+	// MaxAttempts is the maximum number of attempts (including the first request).
+	// A value of 1 or less disables retries
+	MaxAttempts int
+
+	// MinDelay is the delay before the first retry. Defaults to 500ms
+	MinDelay time.Duration
+
+	// MaxDelay is the maximum delay between two attempts. Defaults to 30s
+	MaxDelay time.Duration
+
+	// Multiplier applied to the delay after each unsuccessful attempt. Defaults to 2
+	Multiplier float64
+
+	// Jitter is the fraction (0-1) of the delay which is randomized to avoid
+	// many clients retrying at the same time. Defaults to 0.2
+	Jitter float64
+
+	// StatusCodes which should be retried. Defaults to DefaultRetryStatusCodes
+	StatusCodes []int
+
+	// RetryNonIdempotent allows retrying non-idempotent methods such as POST and PATCH.
+	// Only enable this if the server side can handle duplicate requests
+	RetryNonIdempotent bool
+
+	// IgnoreRetryAfter ignores the Retry-After response header and always uses the calculated backoff
+	IgnoreRetryAfter bool
+
+	// MaxRetryAfter is the maximum Retry-After value which will be waited for.
+	// If the server requests a longer delay then the response is returned without a retry.
+	// Defaults to MaxDelay
+	MaxRetryAfter time.Duration
+}
+
+// NewRetryOptions returns retry options using the default backoff settings and the given maximum attempts
+func NewRetryOptions(maxAttempts int) *RetryOptions {
+	return &RetryOptions{
+		MaxAttempts: maxAttempts,
+	}
+}
+
+// DefaultRetryOptions returns the recommended retry options (3 attempts with exponential backoff)
+func DefaultRetryOptions() *RetryOptions {
+	return NewRetryOptions(3)
+}
+
+// WithNonIdempotent allows retrying non-idempotent methods (e.g. POST)
+func (o *RetryOptions) WithNonIdempotent(v bool) *RetryOptions {
+	o.RetryNonIdempotent = v
+	return o
+}
+
+// Enabled returns true if more than one attempt is allowed
+func (o *RetryOptions) Enabled() bool {
+	return o != nil && o.MaxAttempts > 1
+}
+
+func (o *RetryOptions) getMinDelay() time.Duration {
+	if o.MinDelay <= 0 {
+		return 500 * time.Millisecond
+	}
+	return o.MinDelay
+}
+
+func (o *RetryOptions) getMaxDelay() time.Duration {
+	if o.MaxDelay <= 0 {
+		return 30 * time.Second
+	}
+	return o.MaxDelay
+}
+
+func (o *RetryOptions) getMaxRetryAfter() time.Duration {
+	if o.MaxRetryAfter <= 0 {
+		return o.getMaxDelay()
+	}
+	return o.MaxRetryAfter
+}
+
+func (o *RetryOptions) getMultiplier() float64 {
+	if o.Multiplier < 1 {
+		return 2
+	}
+	return o.Multiplier
+}
+
+func (o *RetryOptions) getJitter() float64 {
+	if o.Jitter <= 0 {
+		return 0.2
+	}
+	return math.Min(o.Jitter, 1)
+}
+
+func (o *RetryOptions) getStatusCodes() []int {
+	if len(o.StatusCodes) == 0 {
+		return DefaultRetryStatusCodes
+	}
+	return o.StatusCodes
+}
+
+// Backoff returns the jittered exponential delay to wait before the given attempt (starting from 1)
+func (o *RetryOptions) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := float64(o.getMinDelay()) * math.Pow(o.getMultiplier(), float64(attempt-1))
+	delay = math.Min(delay, float64(o.getMaxDelay()))
+
+	jitter := o.getJitter()
+	delay = delay * (1 - jitter + 2*jitter*rand.Float64())
+	return time.Duration(math.Min(delay, float64(o.getMaxDelay())))
+}
+
+// CanRetryMethod checks if requests with the given method are allowed to be retried
+func (o *RetryOptions) CanRetryMethod(method string) bool {
+	if o.RetryNonIdempotent {
+		return true
+	}
+	for _, m := range IdempotentMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRetryableStatusCode checks if the status code should be retried
+func (o *RetryOptions) IsRetryableStatusCode(code int) bool {
+	for _, v := range o.getStatusCodes() {
+		if v == code {
+			return true
+		}
+	}
+	return false
+}
+
+// nextDelay returns the delay to wait before the next attempt, and false if the request should not be retried.
+// attempt is the number of the attempt which has just been completed
+func (o *RetryOptions) nextDelay(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool) {
+	if !o.Enabled() || attempt >= o.MaxAttempts || !o.CanRetryMethod(req.Method) {
+		return 0, false
+	}
+
+	if err != nil {
+		if !IsRetryableError(err) {
+			return 0, false
+		}
+		return o.Backoff(attempt), true
+	}
+
+	if resp == nil || !o.IsRetryableStatusCode(resp.StatusCode) {
+		return 0, false
+	}
+
+	delay := o.Backoff(attempt)
+	if !o.IgnoreRetryAfter {
+		if retryAfter, ok := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			if retryAfter > o.getMaxRetryAfter() {
+				return 0, false
+			}
+			delay = retryAfter
+		}
+	}
+	return delay, true
+}
+
+// IsRetryableError checks if a transport error is transient and the request can be sent again,
+// e.g. the connection was reset by the server
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return false
+}
+
+// ParseRetryAfter parses the value of a Retry-After header which can either be
+// the number of seconds to wait, or a http date
+func ParseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if ts, err := http.ParseTime(v); err == nil {
+		delay := ts.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// RequestAttempt details about a single attempt of sending a request
+type RequestAttempt struct {
+	// Attempt number, starting from 1
+	Attempt int
+
+	// StatusCode of the response. 0 if no response was received
+	StatusCode int
+
+	// Err transport error (if any)
+	Err error
+
+	// Duration of the attempt
+	Duration time.Duration
+
+	// Delay waited after this attempt before the next attempt was sent
+	Delay time.Duration
+}
+
+// contextRetryOptionsKey request specific retry options
+type contextRetryOptionsKey string
+
+func getRetryOptionsContextKey() contextRetryOptionsKey {
+	return contextRetryOptionsKey("retryOptions")
+}
+
+// WithRetryContext returns a context where the given retry options are used for all requests using the context
+func WithRetryContext(ctx context.Context, opts *RetryOptions) context.Context {
+	return context.WithValue(ctx, getRetryOptionsContextKey(), opts)
+}
+
+// getRetryOptions resolves the retry options for a request. Request specific options take
+// precedence over the common options provided in the context, and then the client defaults
+func (c *Client) getRetryOptions(ctx context.Context) *RetryOptions {
+	if opts, ok := ctx.Value(getRetryOptionsContextKey()).(*RetryOptions); ok && opts != nil {
+		return opts
+	}
+	if ctxOptions, ok := ctx.Value(GetContextCommonOptionsKey()).(CommonOptions); ok && ctxOptions.Retry != nil {
+		return ctxOptions.Retry
+	}
+	return c.retryOptions
+}
+
+// SetRetryOptions sets the default retry options used for all requests. Use nil to disable retries
+func (c *Client) SetRetryOptions(opts *RetryOptions) {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	c.retryOptions = opts
+}
+
+// rewindableBody makes sure the request body can be read again for a retry by setting req.GetBody.
+// The returned closer must be called once all attempts are finished
+func rewindableBody(req *http.Request) (io.Closer, error) {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return nil, nil
+	}
+
+	switch body := req.Body.(type) {
+	case *multipartBody:
+		if body.canRewind() {
+			req.GetBody = body.rewind
+		}
+		return nil, nil
+	case io.ReadSeeker:
+		if offset, err := body.Seek(0, io.SeekCurrent); err == nil {
+			req.Body = io.NopCloser(body)
+			req.GetBody = func() (io.ReadCloser, error) {
+				if _, err := body.Seek(offset, io.SeekStart); err != nil {
+					return nil, err
+				}
+				return io.NopCloser(body), nil
+			}
+			return body.(io.Closer), nil
+		}
+	}
+
+	// Fallback to buffering the body in memory
+	buf, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(buf))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf)), nil
+	}
+	return nil, nil
+}
+
+// canRewindRequest checks if the request can be sent again
+func canRewindRequest(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// rewindRequest returns a copy of the request with a fresh body which can be sent again
+func rewindRequest(ctx context.Context, req *http.Request) (*http.Request, error) {
+	next := req.Clone(ctx)
+	if req.Body == nil || req.Body == http.NoBody {
+		return next, nil
+	}
+	if req.GetBody == nil {
+		return nil, ErrBodyNotRewindable
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	next.Body = body
+	return next, nil
+}
+
+// drainBody discards the remaining response body so the connection can be reused
+func drainBody(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+}
+
+// sleepContext waits for the given duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,250 @@
+package c8y
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newRetryTestServer returns a server which responds with the given status codes in order,
+// and then with 200 OK for all subsequent requests
+func newRetryTestServer(t *testing.T, codes ...int) (*httptest.Server, *int32, *[]string) {
+	t.Helper()
+	var count int32
+	bodies := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := atomic.AddInt32(&count, 1)
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if int(i) <= len(codes) {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(codes[i-1])
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"12345"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &count, &bodies
+}
+
+func newRetryTestClient(url string, retry *RetryOptions) *Client {
+	return NewClientFromOptions(nil, ClientOptions{
+		BaseURL:  url,
+		Username: "user",
+		Password: "pass",
+		Retry:    retry,
+	})
+}
+
+func fastRetry(attempts int) *RetryOptions {
+	return &RetryOptions{
+		MaxAttempts: attempts,
+		MinDelay:    time.Millisecond,
+		MaxDelay:    5 * time.Millisecond,
+	}
+}
+
+func TestRetry_RetriesIdempotentRequests(t *testing.T) {
+	srv, count, _ := newRetryTestServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	client := newRetryTestClient(srv.URL, fastRetry(3))
+
+	mo, resp, err := client.Inventory.GetManagedObject(context.Background(), "12345", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mo.ID != "12345" {
+		t.Errorf("ID: got %q, want %q", mo.ID, "12345")
+	}
+	if got := atomic.LoadInt32(count); got != 3 {
+		t.Errorf("requests: got %d, want 3", got)
+	}
+	if resp.Attempts() != 3 {
+		t.Errorf("Attempts: got %d, want 3", resp.Attempts())
+	}
+	history := resp.AttemptHistory()
+	if history[0].StatusCode != http.StatusServiceUnavailable || history[2].StatusCode != http.StatusOK {
+		t.Errorf("unexpected attempt history: %+v", history)
+	}
+}
+
+func TestRetry_GivesUpAfterMaxAttempts(t *testing.T) {
+	srv, count, _ := newRetryTestServer(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	client := newRetryTestClient(srv.URL, fastRetry(2))
+
+	_, resp, err := client.Inventory.GetManagedObject(context.Background(), "12345", nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if resp.StatusCode() != http.StatusBadGateway {
+		t.Errorf("status code: got %d, want %d", resp.StatusCode(), http.StatusBadGateway)
+	}
+	if got := atomic.LoadInt32(count); got != 2 {
+		t.Errorf("requests: got %d, want 2", got)
+	}
+}
+
+func TestRetry_PostIsOnlyRetriedWhenEnabled(t *testing.T) {
+	srv, count, _ := newRetryTestServer(t, http.StatusServiceUnavailable)
+	client := newRetryTestClient(srv.URL, fastRetry(3))
+
+	body := map[string]string{"name": "device01"}
+	if _, _, err := client.Inventory.Create(context.Background(), body); err == nil {
+		t.Fatal("expected an error as POST should not be retried by default")
+	}
+	if got := atomic.LoadInt32(count); got != 1 {
+		t.Fatalf("requests: got %d, want 1", got)
+	}
+
+	// Opt-in for a single request
+	srv2, count2, bodies2 := newRetryTestServer(t, http.StatusServiceUnavailable)
+	client2 := newRetryTestClient(srv2.URL, nil)
+	resp, err := client2.SendRequest(context.Background(), RequestOptions{
+		Method:       http.MethodPost,
+		Path:         "inventory/managedObjects",
+		Body:         body,
+		ResponseData: new(ManagedObject),
+		Retry:        fastRetry(3).WithNonIdempotent(true),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Attempts() != 2 {
+		t.Errorf("Attempts: got %d, want 2", resp.Attempts())
+	}
+	if got := atomic.LoadInt32(count2); got != 2 {
+		t.Errorf("requests: got %d, want 2", got)
+	}
+	if (*bodies2)[0] == "" || (*bodies2)[0] != (*bodies2)[1] {
+		t.Errorf("body should be resent on retry: %q", *bodies2)
+	}
+
+	// Opt-in via the common options in the context
+	srv3, count3, _ := newRetryTestServer(t, http.StatusServiceUnavailable)
+	client3 := newRetryTestClient(srv3.URL, nil)
+	ctx := WithCommonOptionsContext(context.Background(), CommonOptions{
+		Retry: fastRetry(3).WithNonIdempotent(true),
+	})
+	if _, _, err := client3.Inventory.Create(ctx, body); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(count3); got != 2 {
+		t.Errorf("requests: got %d, want 2", got)
+	}
+}
+
+func TestRetry_RewindsMultipartBody(t *testing.T) {
+	srv, count, bodies := newRetryTestServer(t, http.StatusServiceUnavailable)
+	client := newRetryTestClient(srv.URL, fastRetry(2).WithNonIdempotent(true))
+
+	contents := "Jan 01 00:00:00 host service: started\n"
+	resp, err := client.SendRequest(context.Background(), RequestOptions{
+		Method: http.MethodPost,
+		Path:   "inventory/binaries",
+		FormData: map[string]io.Reader{
+			"file":   createTestFile(t, "syslog.txt", contents),
+			"object": strings.NewReader(`{"name":"syslog.txt"}`),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(count); got != 2 {
+		t.Fatalf("requests: got %d, want 2", got)
+	}
+	if resp.Attempts() != 2 {
+		t.Errorf("Attempts: got %d, want 2", resp.Attempts())
+	}
+	for i, body := range *bodies {
+		if !strings.Contains(body, contents) || !strings.Contains(body, `{"name":"syslog.txt"}`) {
+			t.Errorf("body %d is incomplete: %q", i, body)
+		}
+	}
+}
+
+func TestRetry_RewindsMultipartBodyMoreThanOnce(t *testing.T) {
+	var count int32
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) <= 2 {
+			// Respond before the body has been read, so the writer is still streaming when the request is retried
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`{"id":"12345"}`))
+	}))
+	t.Cleanup(srv.Close)
+	client := newRetryTestClient(srv.URL, fastRetry(3).WithNonIdempotent(true))
+
+	contents := strings.Repeat("Jan 01 00:00:00 host service: started\n", 50000)
+	file := createTestFile(t, "syslog.txt", contents)
+	_, err := client.SendRequest(context.Background(), RequestOptions{
+		Method: http.MethodPost,
+		Path:   "inventory/binaries",
+		FormData: map[string]io.Reader{
+			"file": file,
+			// strings.Reader is not safe for concurrent use, so the race detector reports a writer which is still running
+			"object": strings.NewReader(contents),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&count); got != 3 {
+		t.Fatalf("requests: got %d, want 3", got)
+	}
+	if !strings.Contains(body, contents) {
+		t.Errorf("body of the last attempt is incomplete: got %d bytes", len(body))
+	}
+	if _, err := file.Read(make([]byte, 1)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("file should be closed after the request: got %v", err)
+	}
+}
+
+func TestSendRequest_ClosesMultipartValuesOnDryRun(t *testing.T) {
+	client := newRetryTestClient("https://example.c8y.io", nil)
+	file := createTestFile(t, "syslog.txt", "contents")
+	_, err := client.SendRequest(context.Background(), RequestOptions{
+		Method:   http.MethodPost,
+		Path:     "inventory/binaries",
+		DryRun:   true,
+		FormData: map[string]io.Reader{"file": file},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := file.Read(make([]byte, 1)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("file should be closed after a dry run: got %v", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"Mon, 01 Jan 2024 00:00:10 GMT", 10 * time.Second, true},
+		{"invalid", 0, false},
+	}
+	for _, tc := range testCases {
+		got, ok := ParseRetryAfter(tc.value, now)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("ParseRetryAfter(%q): got (%s, %v), want (%s, %v)", tc.value, got, ok, tc.want, tc.ok)
+		}
+	}
+}
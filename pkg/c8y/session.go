@@ -0,0 +1,286 @@
+package c8y
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSessionRefreshMargin is the time before the token expires when the session is refreshed
+const DefaultSessionRefreshMargin = 1 * time.Minute
+
+// ErrNoSessionToken is returned when the login did not provide a token
+var ErrNoSessionToken = errors.New("session login did not return a token")
+
+// SessionLoginFunc logs in and stores the new token (and cookies) on the client, e.g. via SetToken and SetCookies
+type SessionLoginFunc func(ctx context.Context, c *Client) error
+
+// SessionOptions controls how a session is created and refreshed
+type SessionOptions struct {
+	// Login is used to create and refresh the session. Defaults to LoginUsingOAuth2
+	Login SessionLoginFunc
+
+	// InitRequest is passed to LoginUsingOAuth2 when using the default login
+	InitRequest string
+
+	// RefreshMargin is the time before the token expires when it is refreshed. Defaults to DefaultSessionRefreshMargin
+	RefreshMargin time.Duration
+
+	// OnRefresh is called after every successful login
+	OnRefresh func(credentials SessionCredentials)
+}
+
+// SessionCredentials are the credentials of the active session
+type SessionCredentials struct {
+	Token     string
+	XSRFToken string
+	Cookies   []*http.Cookie
+
+	// ExpiresAt is the expiry time of the token. It is zero if the token does not expire
+	ExpiresAt time.Time
+}
+
+// Session manages an OAI-Secure session. The token is refreshed before it expires,
+// or when a request is rejected with 401 Unauthorized, by running the configured login again.
+// A session is safe to use from multiple go routines, and concurrent refreshes result in a single login
+type Session struct {
+	client *Client
+	login  SessionLoginFunc
+	margin time.Duration
+
+	onRefresh func(credentials SessionCredentials)
+
+	// loginMu serializes logins
+	loginMu sync.Mutex
+
+	mu          sync.RWMutex
+	credentials SessionCredentials
+	previous    string
+}
+
+// NewSession creates a new session for the client. The session is not active
+// until it has been logged in and set on the client via SetSession
+func NewSession(client *Client, opts SessionOptions) *Session {
+	login := opts.Login
+	if login == nil {
+		initRequest := opts.InitRequest
+		login = func(ctx context.Context, c *Client) error {
+			return c.LoginUsingOAuth2(ctx, initRequest)
+		}
+	}
+	margin := opts.RefreshMargin
+	if margin <= 0 {
+		margin = DefaultSessionRefreshMargin
+	}
+	return &Session{
+		client:    client,
+		login:     login,
+		margin:    margin,
+		onRefresh: opts.OnRefresh,
+	}
+}
+
+// StartSession logs in and uses the session for all requests and the realtime client
+func (c *Client) StartSession(ctx context.Context, opts SessionOptions) (*Session, error) {
+	session := NewSession(c, opts)
+	if err := session.Login(ctx); err != nil {
+		return nil, err
+	}
+	c.SetSession(session)
+	return session, nil
+}
+
+// SetSession sets the session used to authorize requests and the realtime client. Use nil to remove the session
+func (c *Client) SetSession(session *Session) {
+	c.clientMu.Lock()
+	c.session = session
+	c.clientMu.Unlock()
+
+	if c.Realtime != nil {
+		c.Realtime.SetSession(session)
+	}
+}
+
+func (c *Client) getSession() *Session {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	return c.session
+}
+
+// Login runs the configured login and updates the session credentials
+func (s *Session) Login(ctx context.Context) error {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+	return s.doLogin(ctx, s.getCredentials().Token)
+}
+
+// Refresh runs the login again unless the session has already been refreshed by another request
+// since the given token was used
+func (s *Session) Refresh(ctx context.Context, staleToken string) error {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+	if current := s.getCredentials(); current.Token != "" && current.Token != staleToken {
+		return nil
+	}
+	return s.doLogin(ctx, staleToken)
+}
+
+// Credentials returns the session credentials. The session is refreshed first if the token is about to expire
+func (s *Session) Credentials(ctx context.Context) (SessionCredentials, error) {
+	credentials := s.getCredentials()
+	if credentials.Token != "" && !s.expiring(credentials) {
+		return credentials, nil
+	}
+	if err := s.Refresh(ctx, credentials.Token); err != nil {
+		return credentials, err
+	}
+	return s.getCredentials(), nil
+}
+
+// ExpiresAt returns the expiry time of the current token
+func (s *Session) ExpiresAt() time.Time {
+	return s.getCredentials().ExpiresAt
+}
+
+func (s *Session) getCredentials() SessionCredentials {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.credentials
+}
+
+func (s *Session) expiring(credentials SessionCredentials) bool {
+	return !credentials.ExpiresAt.IsZero() && time.Now().Add(s.margin).After(credentials.ExpiresAt)
+}
+
+// doLogin runs the login and reads the new token and cookies from the client. The login lock must be held by the caller
+func (s *Session) doLogin(ctx context.Context, staleToken string) error {
+	Logger.Infof("Logging in to refresh the session")
+	if err := s.login(withSessionLogin(ctx, s, staleToken), s.client); err != nil {
+		return err
+	}
+
+	s.client.clientMu.Lock()
+	token := s.client.Token
+	cookies := append([]*http.Cookie{}, s.client.Cookies...)
+	s.client.clientMu.Unlock()
+
+	if token == "" {
+		return ErrNoSessionToken
+	}
+
+	credentials := SessionCredentials{
+		Token:   token,
+		Cookies: cookies,
+	}
+	for _, cookie := range cookies {
+		if strings.EqualFold(cookie.Name, "XSRF-TOKEN") {
+			credentials.XSRFToken = cookie.Value
+		}
+	}
+
+	if claims, err := s.client.ParseToken(token); err == nil {
+		if claims.ExpiresAt != nil {
+			credentials.ExpiresAt = claims.ExpiresAt.Time
+		}
+
+		// The XSRF-TOKEN cookie is only set when the token is returned as a cookie,
+		// however the token also includes it
+		if credentials.XSRFToken == "" && claims.XSRFToken != "" {
+			credentials.XSRFToken = claims.XSRFToken
+			credentials.Cookies = append(credentials.Cookies, &http.Cookie{Name: "XSRF-TOKEN", Value: claims.XSRFToken})
+			s.client.SetCookies(credentials.Cookies)
+		}
+	} else {
+		Logger.Infof("Could not parse the session token expiry. The token will only be refreshed on 401 responses. %s", err)
+	}
+
+	s.mu.Lock()
+	s.previous = s.credentials.Token
+	s.credentials = credentials
+	s.mu.Unlock()
+
+	if s.onRefresh != nil {
+		s.onRefresh(credentials)
+	}
+	return nil
+}
+
+// requestToken returns the session token used by the request, or an empty string if
+// the request is not authorized by the session
+func (s *Session) requestToken(req *http.Request) string {
+	token, found := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return ""
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if token == s.credentials.Token || token == s.previous {
+		return token
+	}
+	return ""
+}
+
+// authorize refreshes the session if the token is about to expire, and sets the current
+// credentials on the request. Requests which are not authorized by the session are not changed
+func (s *Session) authorize(ctx context.Context, req *http.Request) {
+	if login, ok := ctx.Value(sessionLoginContextKey{}).(sessionLogin); ok && login.session == s {
+		// Don't send the expired session along with the login request
+		if token := s.requestToken(req); token != "" && token == login.staleToken {
+			clearSessionHeaders(req)
+		}
+		return
+	}
+
+	if s.requestToken(req) == "" {
+		return
+	}
+
+	credentials, err := s.Credentials(ctx)
+	if err != nil {
+		Logger.Infof("Failed to refresh the session. The existing token will be used. %s", err)
+	}
+	applySessionCredentials(req, credentials)
+}
+
+// refreshRequest refreshes the session after the request was rejected, and sets the new credentials on the request
+func (s *Session) refreshRequest(ctx context.Context, req *http.Request, staleToken string) error {
+	if err := s.Refresh(ctx, staleToken); err != nil {
+		return err
+	}
+	applySessionCredentials(req, s.getCredentials())
+	return nil
+}
+
+func clearSessionHeaders(req *http.Request) {
+	req.Header.Del("Authorization")
+	req.Header.Del("Cookie")
+	req.Header.Del("X-XSRF-TOKEN")
+}
+
+func applySessionCredentials(req *http.Request, credentials SessionCredentials) {
+	if credentials.Token == "" {
+		return
+	}
+	clearSessionHeaders(req)
+	setCookieHeaders(req, credentials.Cookies)
+	req.Header.Set("Authorization", "Bearer "+credentials.Token)
+}
+
+type sessionLoginContextKey struct{}
+
+type sessionLogin struct {
+	session    *Session
+	staleToken string
+}
+
+// withSessionLogin marks the requests sent by the login function so that they do not use the session being refreshed
+func withSessionLogin(ctx context.Context, session *Session, staleToken string) context.Context {
+	return context.WithValue(ctx, sessionLoginContextKey{}, sessionLogin{
+		session:    session,
+		staleToken: staleToken,
+	})
+}
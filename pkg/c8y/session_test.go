@@ -0,0 +1,169 @@
+package c8y
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// sessionTestServer issues OAI-Secure tokens and only accepts the most recently issued token
+type sessionTestServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	token    string
+	xsrf     string
+	lifetime time.Duration
+	logins   int32
+}
+
+func newSessionTestServer(t *testing.T, lifetime time.Duration) *sessionTestServer {
+	t.Helper()
+	s := &sessionTestServer{lifetime: lifetime}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /tenant/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		// An expired token must not be sent when logging in
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.ParseForm()
+		if r.Form.Get("username") != "user" || r.Form.Get("password") != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		token, xsrf := s.issue(t)
+		http.SetCookie(w, &http.Cookie{Name: "authorization", Value: token})
+		http.SetCookie(w, &http.Cookie{Name: "XSRF-TOKEN", Value: xsrf})
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		valid := r.Header.Get("Authorization") == "Bearer "+s.token && r.Header.Get("X-XSRF-TOKEN") == s.xsrf
+		s.mu.Unlock()
+		if !valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"12345","name":"t12345"}`))
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *sessionTestServer) issue(t *testing.T) (string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := atomic.AddInt32(&s.logins, 1)
+	s.xsrf = fmt.Sprintf("xsrf%d", n)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, CumulocityTokenClaim{
+		User:      "user",
+		Tenant:    "t12345",
+		XSRFToken: s.xsrf,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        fmt.Sprintf("%d", n),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.lifetime)),
+		},
+	}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Errorf("failed to sign token: %v", err)
+	}
+	s.token = token
+	return token, s.xsrf
+}
+
+// revoke invalidates the current token, e.g. the user logged out in another session
+func (s *sessionTestServer) revoke() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = "revoked"
+}
+
+func (s *sessionTestServer) startSession(t *testing.T) (*Client, *Session) {
+	t.Helper()
+	client := NewClient(nil, s.URL, "t12345", "user", "pass", true)
+	session, err := client.StartSession(context.Background(), SessionOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return client, session
+}
+
+func TestSession_RefreshOnUnauthorized(t *testing.T) {
+	srv := newSessionTestServer(t, time.Hour)
+	client, session := srv.startSession(t)
+	expiresAt := session.ExpiresAt()
+
+	srv.revoke()
+	if _, _, err := client.Inventory.GetManagedObject(context.Background(), "12345", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&srv.logins); got != 2 {
+		t.Errorf("logins: got %d, want %d", got, 2)
+	}
+	if client.Token != srv.token || client.GetXSRFToken() != srv.xsrf {
+		t.Errorf("client credentials were not updated")
+	}
+	if session.ExpiresAt().Before(expiresAt) {
+		t.Errorf("expiry: got %v, want after %v", session.ExpiresAt(), expiresAt)
+	}
+}
+
+func TestSession_ProactiveRefresh(t *testing.T) {
+	srv := newSessionTestServer(t, 30*time.Second)
+	client, session := srv.startSession(t)
+	firstToken := client.Token
+
+	if _, _, err := client.Inventory.GetManagedObject(context.Background(), "12345", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.Token == firstToken {
+		t.Errorf("token was not refreshed before it expired")
+	}
+
+	credentials, err := session.Credentials(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if credentials.XSRFToken != srv.xsrf {
+		t.Errorf("xsrf token: got %q, want %q", credentials.XSRFToken, srv.xsrf)
+	}
+}
+
+func TestSession_ConcurrentRefresh(t *testing.T) {
+	srv := newSessionTestServer(t, time.Hour)
+	client, _ := srv.startSession(t)
+	srv.revoke()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := client.Inventory.GetManagedObject(context.Background(), "12345", nil)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&srv.logins); got != 2 {
+		t.Errorf("logins: got %d, want %d", got, 2)
+	}
+}
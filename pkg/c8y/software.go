@@ -2,7 +2,6 @@ package c8y
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/reubenmiller/go-c8y/pkg/c8y/binary"
 )
@@ -65,7 +64,10 @@ func (s *InventorySoftwareService) GetSoftwareByName(ctx context.Context, name s
 	}
 
 	opt := &ManagedObjectOptions{
-		Query:             fmt.Sprintf("$filter=(name eq '%s') and type eq '%s' $orderby=name,creationTime", name, FragmentSoftware),
+		Query: NewInventoryQuery(QueryEq("name", name), QueryEq("type", FragmentSoftware)).
+			OrderByAsc("name").
+			OrderByAsc("creationTime").
+			String(),
 		PaginationOptions: *paging,
 	}
 	return s.client.Inventory.GetManagedObjects(ctx, opt)
@@ -93,7 +95,10 @@ func (s *InventorySoftwareService) GetSoftwareVersionsByName(ctx context.Context
 	}
 
 	opt := &ManagedObjectOptions{
-		Query:             fmt.Sprintf("$filter=(c8y_Software.version eq '%s') and bygroupid(%s) $orderby=c8y_Software.version,creationTime", name, software),
+		Query: NewInventoryQuery(QueryEq("c8y_Software.version", name), QueryByGroupID(software)).
+			OrderByAsc("c8y_Software.version").
+			OrderByAsc("creationTime").
+			String(),
 		PaginationOptions: *paging,
 		WithParents:       withParents,
 	}
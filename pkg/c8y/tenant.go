@@ -118,6 +118,7 @@ type TenantLoginOption struct {
 func (s *TenantService) GetTenantStatisticsSummary(ctx context.Context, opt *TenantSummaryOptions) (*TenantSummary, *Response, error) {
 	data := new(TenantSummary)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Tenant.GetTenantStatisticsSummary",
 		Method:       "GET",
 		Path:         "tenant/statistics/summary",
 		Query:        opt,
@@ -130,6 +131,7 @@ func (s *TenantService) GetTenantStatisticsSummary(ctx context.Context, opt *Ten
 func (s *TenantService) GetLoginOptions(ctx context.Context) (*TenantLoginOptions, *Response, error) {
 	data := new(TenantLoginOptions)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Tenant.GetLoginOptions",
 		Method:       "GET",
 		Path:         "tenant/loginOptions",
 		AuthFunc:     WithNoAuthorization(),
@@ -142,6 +144,7 @@ func (s *TenantService) GetLoginOptions(ctx context.Context) (*TenantLoginOption
 func (s *TenantService) GetTenantStatistics(ctx context.Context, opt *TenantStatisticsOptions) (*TenantUsageStatisticsCollection, *Response, error) {
 	data := new(TenantUsageStatisticsCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Tenant.GetTenantStatistics",
 		Method:       "GET",
 		Path:         "tenant/statistics",
 		Query:        opt,
@@ -155,6 +158,7 @@ func (s *TenantService) GetTenantStatistics(ctx context.Context, opt *TenantStat
 func (s *TenantService) GetAllTenantsStatisticsSummary(ctx context.Context, opt *TenantStatisticsOptions) ([]TenantUsageStatisticsSummaryExtended, *Response, error) {
 	data := make([]TenantUsageStatisticsSummaryExtended, 0)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Tenant.GetAllTenantsStatisticsSummary",
 		Method:       "GET",
 		Path:         "tenant/statistics/allTenantsSummary",
 		Query:        opt,
@@ -167,6 +171,7 @@ func (s *TenantService) GetAllTenantsStatisticsSummary(ctx context.Context, opt
 func (s *TenantService) GetCurrentTenant(ctx context.Context) (*CurrentTenant, *Response, error) {
 	data := new(CurrentTenant)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Tenant.GetCurrentTenant",
 		Method:       "GET",
 		Path:         "tenant/currentTenant",
 		ResponseData: data,
@@ -225,6 +230,7 @@ type ApplicationReference struct {
 func (s *TenantService) GetTenants(ctx context.Context, opt *PaginationOptions) (*TenantCollection, *Response, error) {
 	data := new(TenantCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Tenant.GetTenants",
 		Method:       "GET",
 		Path:         "tenant/tenants",
 		Query:        opt,
@@ -237,6 +243,7 @@ func (s *TenantService) GetTenants(ctx context.Context, opt *PaginationOptions)
 func (s *TenantService) GetTenant(ctx context.Context, ID string) (*Tenant, *Response, error) {
 	data := new(Tenant)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Tenant.GetTenant",
 		Method:       "GET",
 		Path:         "tenant/tenants/" + ID,
 		ResponseData: data,
@@ -248,6 +255,7 @@ func (s *TenantService) GetTenant(ctx context.Context, ID string) (*Tenant, *Res
 func (s *TenantService) Create(ctx context.Context, body *Tenant) (*Tenant, *Response, error) {
 	data := new(Tenant)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Tenant.Create",
 		Method:       "POST",
 		Path:         "tenant/tenants",
 		Body:         body,
@@ -260,6 +268,7 @@ func (s *TenantService) Create(ctx context.Context, body *Tenant) (*Tenant, *Res
 func (s *TenantService) Update(ctx context.Context, ID string, body *Tenant) (*Tenant, *Response, error) {
 	data := new(Tenant)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Tenant.Update",
 		Method:       "PUT",
 		Path:         "tenant/tenants/" + ID,
 		Body:         body,
@@ -271,8 +280,9 @@ func (s *TenantService) Update(ctx context.Context, ID string, body *Tenant) (*T
 // Delete removes a tenant and all of its data
 func (s *TenantService) Delete(ctx context.Context, ID string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "tenant/tenants/" + ID,
+		Operation: "Tenant.Delete",
+		Method:    "DELETE",
+		Path:      "tenant/tenants/" + ID,
 	})
 }
 
@@ -290,6 +300,7 @@ func (s *TenantService) AddApplicationReference(ctx context.Context, tenantID st
 		},
 	}
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Tenant.AddApplicationReference",
 		Method:       "POST",
 		Path:         "tenant/tenants/" + tenantID + "/applications",
 		Body:         body,
@@ -303,6 +314,7 @@ func (s *TenantService) AddApplicationReference(ctx context.Context, tenantID st
 func (s *TenantService) GetApplicationReferences(ctx context.Context, tenantID string, opts *PaginationOptions) (*ApplicationReferenceCollection, *Response, error) {
 	data := new(ApplicationReferenceCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "Tenant.GetApplicationReferences",
 		Method:       "GET",
 		Path:         "tenant/tenants/" + tenantID + "/applications",
 		Query:        opts,
@@ -315,8 +327,9 @@ func (s *TenantService) GetApplicationReferences(ctx context.Context, tenantID s
 // Note: Can only be called from the management tenant
 func (s *TenantService) DeleteApplicationReference(ctx context.Context, tenantID string, applicationID string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "tenant/tenants/" + tenantID + "/applications/" + applicationID,
+		Operation: "Tenant.DeleteApplicationReference",
+		Method:    "DELETE",
+		Path:      "tenant/tenants/" + tenantID + "/applications/" + applicationID,
 	})
 }
 
@@ -2,6 +2,7 @@ package c8y
 
 import (
 	"context"
+	"iter"
 
 	"github.com/tidwall/gjson"
 )
@@ -31,6 +32,7 @@ type TenantOptionCollection struct {
 func (s *TenantOptionsService) GetOptions(ctx context.Context, opt *PaginationOptions) (*TenantOptionCollection, *Response, error) {
 	data := new(TenantOptionCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "TenantOptions.GetOptions",
 		Method:       "GET",
 		Path:         "tenant/options",
 		Accept:       "application/vnd.com.nsn.cumulocity.optionCollection+json",
@@ -40,10 +42,23 @@ func (s *TenantOptionsService) GetOptions(ctx context.Context, opt *PaginationOp
 	return data, resp, err
 }
 
+// IterOptions returns an iterator over all tenant options matching the given options. Pages are fetched
+// lazily by following the .next links. See Paginate for more details
+func (s *TenantOptionsService) IterOptions(ctx context.Context, opt *PaginationOptions, limits PaginateLimits) iter.Seq2[TenantOption, error] {
+	return Paginate[TenantOption](ctx, s.client, RequestOptions{
+		Operation: "TenantOptions.IterOptions",
+		Method:    "GET",
+		Path:      "tenant/options",
+		Accept:    "application/vnd.com.nsn.cumulocity.optionCollection+json",
+		Query:     opt,
+	}, "options", limits)
+}
+
 // GetOptionsForCategory returns collection of tenant options for the specified category
 func (s *TenantOptionsService) GetOptionsForCategory(ctx context.Context, category string) (map[string]string, *Response, error) {
 	data := make(map[string]string)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "TenantOptions.GetOptionsForCategory",
 		Method:       "GET",
 		Path:         "tenant/options/" + category,
 		ResponseData: &data,
@@ -55,6 +70,7 @@ func (s *TenantOptionsService) GetOptionsForCategory(ctx context.Context, catego
 func (s *TenantOptionsService) UpdateOptions(ctx context.Context, category string, body map[string]string) (map[string]string, *Response, error) {
 	data := make(map[string]string)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "TenantOptions.UpdateOptions",
 		Method:       "PUT",
 		Path:         "tenant/options/" + category,
 		Body:         body,
@@ -67,8 +83,9 @@ func (s *TenantOptionsService) UpdateOptions(ctx context.Context, category strin
 func (s *TenantOptionsService) UpdateEditability(ctx context.Context, category, key string, editable bool) (*TenantOption, *Response, error) {
 	data := new(TenantOption)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: "PUT",
-		Path:   "tenant/options/" + category + "/" + key + "/editable",
+		Operation: "TenantOptions.UpdateEditability",
+		Method:    "PUT",
+		Path:      "tenant/options/" + category + "/" + key + "/editable",
 		Body: map[string]bool{
 			"editable": editable,
 		},
@@ -81,6 +98,7 @@ func (s *TenantOptionsService) UpdateEditability(ctx context.Context, category,
 func (s *TenantOptionsService) GetOption(ctx context.Context, category, key string) (*TenantOption, *Response, error) {
 	data := new(TenantOption)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "TenantOptions.GetOption",
 		Method:       "GET",
 		Path:         "tenant/options/" + category + "/" + key,
 		ResponseData: data,
@@ -91,8 +109,9 @@ func (s *TenantOptionsService) GetOption(ctx context.Context, category, key stri
 // Delete removes an existing tenant option by category and key
 func (s *TenantOptionsService) Delete(ctx context.Context, category, key string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "tenant/options/" + category + "/" + key,
+		Operation: "TenantOptions.Delete",
+		Method:    "DELETE",
+		Path:      "tenant/options/" + category + "/" + key,
 	})
 }
 
@@ -100,6 +119,7 @@ func (s *TenantOptionsService) Delete(ctx context.Context, category, key string)
 func (s *TenantOptionsService) Create(ctx context.Context, body *TenantOption) (*TenantOption, *Response, error) {
 	data := new(TenantOption)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "TenantOptions.Create",
 		Method:       "POST",
 		Path:         "tenant/options",
 		Body:         body,
@@ -113,8 +133,9 @@ func (s *TenantOptionsService) Update(ctx context.Context, category, key string,
 	data := new(TenantOption)
 
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
-		Method: "PUT",
-		Path:   "tenant/options/" + category + "/" + key,
+		Operation: "TenantOptions.Update",
+		Method:    "PUT",
+		Path:      "tenant/options/" + category + "/" + key,
 		Body: TenantOption{
 			Value: value,
 		},
@@ -127,6 +148,7 @@ func (s *TenantOptionsService) Update(ctx context.Context, category, key string,
 func (s *TenantOptionsService) GetSystemOptions(ctx context.Context, opt *PaginationOptions) (*TenantOptionCollection, *Response, error) {
 	data := new(TenantOptionCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "TenantOptions.GetSystemOptions",
 		Method:       "GET",
 		Path:         "tenant/system/options",
 		Query:        opt,
@@ -139,6 +161,7 @@ func (s *TenantOptionsService) GetSystemOptions(ctx context.Context, opt *Pagina
 func (s *TenantOptionsService) GetSystemOption(ctx context.Context, category, key string) (*TenantOption, *Response, error) {
 	data := new(TenantOption)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "TenantOptions.GetSystemOption",
 		Method:       "GET",
 		Path:         "tenant/system/options/" + category + "/" + key,
 		ResponseData: data,
@@ -268,6 +268,7 @@ func (s *UIExtensionService) GetExtensions(ctx context.Context, opt *ExtensionOp
 	}
 	opt.HasVersions = true
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "UIExtension.GetExtensions",
 		Method:       "GET",
 		Path:         "application/applications",
 		Query:        opt,
@@ -3,6 +3,7 @@ package c8y
 import (
 	"context"
 	"fmt"
+	"iter"
 
 	"github.com/tidwall/gjson"
 )
@@ -136,6 +137,7 @@ type UserCollection struct {
 func (s *UserService) GetUsers(ctx context.Context, opt *UserOptions) (*UserCollection, *Response, error) {
 	data := new(UserCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.GetUsers",
 		Method:       "GET",
 		Path:         "user/" + s.client.TenantName + "/users",
 		Query:        opt,
@@ -144,10 +146,22 @@ func (s *UserService) GetUsers(ctx context.Context, opt *UserOptions) (*UserColl
 	return data, resp, err
 }
 
+// IterUsers returns an iterator over all users matching the given options. Pages are fetched
+// lazily by following the .next links. See Paginate for more details
+func (s *UserService) IterUsers(ctx context.Context, opt *UserOptions, limits PaginateLimits) iter.Seq2[User, error] {
+	return Paginate[User](ctx, s.client, RequestOptions{
+		Operation: "User.IterUsers",
+		Method:    "GET",
+		Path:      "user/" + s.client.TenantName + "/users",
+		Query:     opt,
+	}, "users", limits)
+}
+
 // GetUser returns a user by its ID
 func (s *UserService) GetUser(ctx context.Context, ID string) (*User, *Response, error) {
 	data := new(User)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.GetUser",
 		Method:       "GET",
 		Path:         "user/" + s.client.TenantName + "/users/" + ID,
 		ResponseData: data,
@@ -159,6 +173,7 @@ func (s *UserService) GetUser(ctx context.Context, ID string) (*User, *Response,
 func (s *UserService) GetUserByUsername(ctx context.Context, username string) (*User, *Response, error) {
 	data := new(User)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.GetUserByUsername",
 		Method:       "GET",
 		Path:         "user/" + s.client.TenantName + "/userByName/" + username,
 		ResponseData: data,
@@ -170,6 +185,7 @@ func (s *UserService) GetUserByUsername(ctx context.Context, username string) (*
 func (s *UserService) Create(ctx context.Context, body *User) (*User, *Response, error) {
 	data := new(User)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.Create",
 		Method:       "POST",
 		Path:         "user/" + s.client.TenantName + "/users",
 		Body:         body,
@@ -182,6 +198,7 @@ func (s *UserService) Create(ctx context.Context, body *User) (*User, *Response,
 func (s *UserService) Update(ctx context.Context, ID string, body *User) (*User, *Response, error) {
 	data := new(User)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.Update",
 		Method:       "PUT",
 		Path:         "user/" + s.client.TenantName + "/users/" + ID,
 		Body:         body,
@@ -193,8 +210,9 @@ func (s *UserService) Update(ctx context.Context, ID string, body *User) (*User,
 // Delete removes an existing user
 func (s *UserService) Delete(ctx context.Context, ID string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "user/" + s.client.TenantName + "/users/" + ID,
+		Operation: "User.Delete",
+		Method:    "DELETE",
+		Path:      "user/" + s.client.TenantName + "/users/" + ID,
 	})
 }
 
@@ -202,6 +220,7 @@ func (s *UserService) Delete(ctx context.Context, ID string) (*Response, error)
 func (s *UserService) GetCurrentUser(ctx context.Context) (*User, *Response, error) {
 	data := new(User)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.GetCurrentUser",
 		Method:       "GET",
 		Path:         "user/currentUser",
 		ResponseData: data,
@@ -213,6 +232,7 @@ func (s *UserService) GetCurrentUser(ctx context.Context) (*User, *Response, err
 func (s *UserService) UpdateCurrentUser(ctx context.Context, body *User) (*User, *Response, error) {
 	data := new(User)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.UpdateCurrentUser",
 		Method:       "PUT",
 		Path:         "user/currentUser",
 		Body:         body,
@@ -251,6 +271,7 @@ func (s *UserService) AddUserToGroup(ctx context.Context, user *User, groupID st
 	}
 
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.AddUserToGroup",
 		Method:       "POST",
 		Path:         "user/" + s.client.TenantName + "/groups/" + groupID + "/users",
 		Body:         body,
@@ -262,8 +283,9 @@ func (s *UserService) AddUserToGroup(ctx context.Context, user *User, groupID st
 // RemoveUserFromGroup removes a user from a group
 func (s *UserService) RemoveUserFromGroup(ctx context.Context, username string, groupID string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "user/" + s.client.TenantName + "/groups/" + groupID + "/users/" + username,
+		Operation: "User.RemoveUserFromGroup",
+		Method:    "DELETE",
+		Path:      "user/" + s.client.TenantName + "/groups/" + groupID + "/users/" + username,
 	})
 }
 
@@ -271,6 +293,7 @@ func (s *UserService) RemoveUserFromGroup(ctx context.Context, username string,
 func (s *UserService) GetUsersByGroup(ctx context.Context, groupID string, opt *UserOptions) (*UserReferenceCollection, *Response, error) {
 	data := new(UserReferenceCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.GetUsersByGroup",
 		Method:       "GET",
 		Path:         "user/" + s.client.TenantName + "/groups/" + groupID + "/users",
 		Query:        opt,
@@ -297,6 +320,7 @@ type GroupOptions struct {
 func (s *UserService) GetGroups(ctx context.Context, opt *GroupOptions) (*GroupCollection, *Response, error) {
 	data := new(GroupCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.GetGroups",
 		Method:       "GET",
 		Path:         "user/" + s.client.TenantName + "/groups",
 		Query:        opt,
@@ -310,6 +334,7 @@ func (s *UserService) CreateGroup(ctx context.Context, body *Group) (*Group, *Re
 	data := new(Group)
 
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.CreateGroup",
 		Method:       "POST",
 		Path:         "user/" + s.client.TenantName + "/groups",
 		Body:         body,
@@ -322,6 +347,7 @@ func (s *UserService) CreateGroup(ctx context.Context, body *Group) (*Group, *Re
 func (s *UserService) GetGroup(ctx context.Context, ID string) (*Group, *Response, error) {
 	data := new(Group)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.GetGroup",
 		Method:       "GET",
 		Path:         "user/" + s.client.TenantName + "/groups/" + ID,
 		ResponseData: data,
@@ -333,6 +359,7 @@ func (s *UserService) GetGroup(ctx context.Context, ID string) (*Group, *Respons
 func (s *UserService) GetGroupByName(ctx context.Context, name string) (*Group, *Response, error) {
 	data := new(Group)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.GetGroupByName",
 		Method:       "GET",
 		Path:         "user/" + s.client.TenantName + "/groupByName/" + name,
 		ResponseData: data,
@@ -344,8 +371,9 @@ func (s *UserService) GetGroupByName(ctx context.Context, name string) (*Group,
 // Info: ADMINS and DEVICES groups can not be deleted
 func (s *UserService) DeleteGroup(ctx context.Context, ID string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "user/" + s.client.TenantName + "/groups/" + ID,
+		Operation: "User.DeleteGroup",
+		Method:    "DELETE",
+		Path:      "user/" + s.client.TenantName + "/groups/" + ID,
 	})
 }
 
@@ -353,6 +381,7 @@ func (s *UserService) DeleteGroup(ctx context.Context, ID string) (*Response, er
 func (s *UserService) UpdateGroup(ctx context.Context, ID string, body *Group) (*Group, *Response, error) {
 	data := new(Group)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.UpdateGroup",
 		Method:       "PUT",
 		Path:         "user/" + s.client.TenantName + "/groups/" + ID,
 		Body:         body,
@@ -365,6 +394,7 @@ func (s *UserService) UpdateGroup(ctx context.Context, ID string, body *Group) (
 func (s *UserService) GetGroupsByUser(ctx context.Context, username string, opt *GroupOptions) (*GroupReferenceCollection, *Response, error) {
 	data := new(GroupReferenceCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.GetGroupsByUser",
 		Method:       "GET",
 		Path:         "user/" + s.client.TenantName + "/users/" + username + "/groups",
 		Query:        opt,
@@ -394,6 +424,7 @@ type RoleOptions struct {
 func (s *UserService) GetRoles(ctx context.Context, opt *RoleOptions) (*RoleCollection, *Response, error) {
 	data := new(RoleCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.GetRoles",
 		Method:       "GET",
 		Path:         "user/roles",
 		Query:        opt,
@@ -406,6 +437,7 @@ func (s *UserService) GetRoles(ctx context.Context, opt *RoleOptions) (*RoleColl
 func (s *UserService) GetRole(ctx context.Context, ID string) (*Role, *Response, error) {
 	data := new(Role)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.GetRole",
 		Method:       "GET",
 		Path:         "user/roles/" + ID,
 		ResponseData: data,
@@ -422,6 +454,7 @@ func (s *UserService) AssignRoleToUser(ctx context.Context, username string, rol
 		},
 	}
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.AssignRoleToUser",
 		Method:       "POST",
 		Path:         "user/" + s.client.TenantName + "/users/" + username + "/roles",
 		Body:         body,
@@ -433,8 +466,9 @@ func (s *UserService) AssignRoleToUser(ctx context.Context, username string, rol
 // UnassignRoleFromUser removes a role from an existing user
 func (s *UserService) UnassignRoleFromUser(ctx context.Context, username string, roleName string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "user/" + s.client.TenantName + "/users/" + username + "/roles/" + roleName,
+		Operation: "User.UnassignRoleFromUser",
+		Method:    "DELETE",
+		Path:      "user/" + s.client.TenantName + "/users/" + username + "/roles/" + roleName,
 	})
 }
 
@@ -442,6 +476,7 @@ func (s *UserService) UnassignRoleFromUser(ctx context.Context, username string,
 func (s *UserService) GetRolesByUser(ctx context.Context, username string, opt *RoleOptions) (*RoleReferenceCollection, *Response, error) {
 	data := new(RoleReferenceCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.GetRolesByUser",
 		Method:       "GET",
 		Path:         "user/" + s.client.TenantName + "/users/" + username + "/roles",
 		Query:        opt,
@@ -459,6 +494,7 @@ func (s *UserService) AssignRoleToGroup(ctx context.Context, groupID string, rol
 		},
 	}
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.AssignRoleToGroup",
 		Method:       "POST",
 		Path:         "user/" + s.client.TenantName + "/groups/" + groupID + "/roles",
 		Body:         body,
@@ -470,8 +506,9 @@ func (s *UserService) AssignRoleToGroup(ctx context.Context, groupID string, rol
 // UnassignRoleFromGroup removes a role from an existing user
 func (s *UserService) UnassignRoleFromGroup(ctx context.Context, groupID string, roleName string) (*Response, error) {
 	return s.client.SendRequest(ctx, RequestOptions{
-		Method: "DELETE",
-		Path:   "user/" + s.client.TenantName + "/groups/" + groupID + "/roles/" + roleName,
+		Operation: "User.UnassignRoleFromGroup",
+		Method:    "DELETE",
+		Path:      "user/" + s.client.TenantName + "/groups/" + groupID + "/roles/" + roleName,
 	})
 }
 
@@ -479,6 +516,7 @@ func (s *UserService) UnassignRoleFromGroup(ctx context.Context, groupID string,
 func (s *UserService) GetRolesByGroup(ctx context.Context, groupID string, opt *RoleOptions) (*RoleReferenceCollection, *Response, error) {
 	data := new(RoleReferenceCollection)
 	resp, err := s.client.SendRequest(ctx, RequestOptions{
+		Operation:    "User.GetRolesByGroup",
 		Method:       "GET",
 		Path:         "user/" + s.client.TenantName + "/groups/" + groupID + "/roles",
 		Query:        opt,
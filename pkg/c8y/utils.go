@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 )
 
 var multipartQuoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
@@ -43,93 +44,219 @@ func detectContentType(filename string, r io.Reader) (string, io.Reader) {
 	return strings.Split(contentType, ";")[0], io.MultiReader(bytes.NewReader(buf[:n]), r)
 }
 
-// Prepare multipart form-data request which uses io.Pipe to buffer reading the message to ensure files won't be read entirely into memory
-func prepareMultipartRequest(method string, url string, values map[string]io.Reader) (*http.Request, error) {
+// multipartBody is a streamed multipart/form-data request body. The body can be
+// regenerated (e.g. when retrying a request) as long as all of the form values are seekable
+type multipartBody struct {
+	*io.PipeReader
+
+	contentType string
+	form        *multipartForm
+	done        chan struct{}
+}
+
+// multipartForm holds the form values, which are shared by all of the bodies created when rewinding
+type multipartForm struct {
+	boundary string
+	keys     []string
+	values   map[string]io.Reader
+	offsets  map[string]int64
+
+	mu sync.Mutex
+
+	// current is the most recently created body. Its writer must be stopped before the values are reset or closed
+	current *multipartBody
+	closed  bool
+}
+
+// newMultipartBody starts streaming the form values into a new multipart body. The caller must hold form.mu
+func newMultipartBody(form *multipartForm) (*multipartBody, error) {
 	pr, pw := io.Pipe()
 
 	// Prepare a form that you will submit to that URL.
 	w := multipart.NewWriter(pw)
-
-	// Sort form data keys
-	keys := make([]string, 0, len(values))
-	for key := range values {
-		keys = append(keys, key)
+	if form.boundary != "" {
+		if err := w.SetBoundary(form.boundary); err != nil {
+			return nil, err
+		}
 	}
-	sort.Strings(keys)
+	form.boundary = w.Boundary()
 
+	done := make(chan struct{})
 	go func() {
-		var err error
-		for _, key := range keys {
-			r := values[key]
-			if key == "filename" || key == "contentType" {
-				// Ignore filename and contentType as they are used as metadata
-				// for the uploaded file rather than as standalone form fields
-				continue
-			}
+		defer close(done)
+		writeMultipartValues(pw, w, form.keys, form.values)
+	}()
 
-			var fw io.Writer
-			if x, ok := r.(io.Closer); ok {
-				defer x.Close()
-			}
-			// Add an image file
-			if x, ok := r.(*os.File); ok {
-
-				// Check if manual filename field was provided, otherwise use the basename
-				filename := filepath.Base(x.Name())
-				if manual_filename, ok := values["filename"]; ok {
-					if b, rErr := io.ReadAll(manual_filename); rErr == nil {
-						filename = string(b)
-					} else {
-						pw.CloseWithError(rErr)
-						return
-					}
-				}
-				// Check if a manual content type was provided, otherwise detect it
-				// from the filename, falling back to sniffing the content, so files
-				// such as log files are viewable in the Cumulocity UI (which
-				// requires a text/* content type)
-				contentType := ""
-				if manualContentType, ok := values["contentType"]; ok {
-					if b, rErr := io.ReadAll(manualContentType); rErr == nil {
-						contentType = string(b)
-					} else {
-						pw.CloseWithError(rErr)
-						return
-					}
-				}
-				if contentType == "" {
-					var contents io.Reader
-					contentType, contents = detectContentType(filename, r)
-					r = contents
-				}
-				if fw, err = createFormFile(w, key, filename, contentType); err != nil {
-					pw.CloseWithError(err)
+	body := &multipartBody{
+		PipeReader:  pr,
+		contentType: w.FormDataContentType(),
+		form:        form,
+		done:        done,
+	}
+	form.current = body
+	return body, nil
+}
+
+// stopCurrent stops the writer of the most recent body. The caller must hold form.mu
+func (f *multipartForm) stopCurrent() {
+	if f.current != nil {
+		f.current.PipeReader.CloseWithError(ErrBodyNotRewindable)
+		<-f.current.done
+	}
+}
+
+// rewind resets all of the form values to their initial position and returns a new body
+// using the same boundary, so the request's Content-Type header is still valid
+func (b *multipartBody) rewind() (io.ReadCloser, error) {
+	if !b.canRewind() {
+		return nil, ErrBodyNotRewindable
+	}
+
+	form := b.form
+	form.mu.Lock()
+	defer form.mu.Unlock()
+	if form.closed {
+		return nil, ErrBodyNotRewindable
+	}
+
+	// Stop the previous writer (which may belong to an earlier rewind) before the values are reset
+	form.stopCurrent()
+
+	for key, offset := range form.offsets {
+		if _, err := form.values[key].(io.Seeker).Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	return newMultipartBody(form)
+}
+
+// canRewind checks if all of the form values can be reset to their initial position
+func (b *multipartBody) canRewind() bool {
+	return len(b.form.offsets) == len(b.form.values)
+}
+
+// closeValues stops the writer and closes all form values which implement io.Closer.
+// It is safe to call it more than once
+func (b *multipartBody) closeValues() {
+	form := b.form
+	form.mu.Lock()
+	defer form.mu.Unlock()
+	if form.closed {
+		return
+	}
+	form.closed = true
+	form.stopCurrent()
+	for _, r := range form.values {
+		if x, ok := r.(io.Closer); ok {
+			x.Close()
+		}
+	}
+}
+
+func writeMultipartValues(pw *io.PipeWriter, w *multipart.Writer, keys []string, values map[string]io.Reader) {
+	var err error
+	for _, key := range keys {
+		r := values[key]
+		if key == "filename" || key == "contentType" {
+			// Ignore filename and contentType as they are used as metadata
+			// for the uploaded file rather than as standalone form fields
+			continue
+		}
+
+		var fw io.Writer
+		// Add an image file
+		if x, ok := r.(*os.File); ok {
+
+			// Check if manual filename field was provided, otherwise use the basename
+			filename := filepath.Base(x.Name())
+			if manual_filename, ok := values["filename"]; ok {
+				if b, rErr := io.ReadAll(manual_filename); rErr == nil {
+					filename = string(b)
+				} else {
+					pw.CloseWithError(rErr)
 					return
 				}
-			} else {
-				// Add other fields
-				if fw, err = w.CreateFormField(key); err != nil {
-					pw.CloseWithError(err)
+			}
+			// Check if a manual content type was provided, otherwise detect it
+			// from the filename, falling back to sniffing the content, so files
+			// such as log files are viewable in the Cumulocity UI (which
+			// requires a text/* content type)
+			contentType := ""
+			if manualContentType, ok := values["contentType"]; ok {
+				if b, rErr := io.ReadAll(manualContentType); rErr == nil {
+					contentType = string(b)
+				} else {
+					pw.CloseWithError(rErr)
 					return
 				}
 			}
-			if _, err = io.Copy(fw, r); err != nil {
+			if contentType == "" {
+				var contents io.Reader
+				contentType, contents = detectContentType(filename, r)
+				r = contents
+			}
+			if fw, err = createFormFile(w, key, filename, contentType); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		} else {
+			// Add other fields
+			if fw, err = w.CreateFormField(key); err != nil {
 				pw.CloseWithError(err)
 				return
 			}
 		}
-		// Don't forget to close the multipart writer.
-		// If you don't close it, your request will be missing the terminating boundary.
-		pw.CloseWithError(w.Close())
-	}()
+		if _, err = io.Copy(fw, r); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+	}
+	// Don't forget to close the multipart writer.
+	// If you don't close it, your request will be missing the terminating boundary.
+	pw.CloseWithError(w.Close())
+}
+
+// Prepare multipart form-data request which uses io.Pipe to buffer reading the message to ensure files won't be read entirely into memory.
+// The caller must close the form values by calling closeValues on the body once the request is no longer
+// needed, i.e. after all attempts have been sent, or when the request is not sent at all (e.g. dry run)
+func prepareMultipartRequest(method string, url string, values map[string]io.Reader) (*http.Request, error) {
+	// Sort form data keys
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Remember the initial position of each value so the body can be rewound
+	offsets := make(map[string]int64, len(values))
+	for key, r := range values {
+		if s, ok := r.(io.Seeker); ok {
+			if offset, err := s.Seek(0, io.SeekCurrent); err == nil {
+				offsets[key] = offset
+			}
+		}
+	}
+
+	form := &multipartForm{
+		keys:    keys,
+		values:  values,
+		offsets: offsets,
+	}
+	form.mu.Lock()
+	body, err := newMultipartBody(form)
+	form.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
 
 	// Now that you have a form, you can submit it to your handler.
-	req, rErr := http.NewRequest(method, url, pr)
+	req, rErr := http.NewRequest(method, url, body)
 	if rErr != nil {
+		body.closeValues()
 		return req, rErr
 	}
 	// Don't forget to set the content type, this will contain the boundary.
-	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Content-Type", body.contentType)
 	req.Header.Set("Accept", "application/json")
 
 	return req, nil
@@ -0,0 +1,128 @@
+package c8ytest
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func (s *Server) registerApplications(mux *http.ServeMux) {
+	mux.HandleFunc("GET /application/applications", s.getApplications)
+	mux.HandleFunc("POST /application/applications", s.createApplication)
+	mux.HandleFunc("GET /application/applications/{id}", s.getDocumentHandler(collectionApplications, "application", "application"))
+	mux.HandleFunc("PUT /application/applications/{id}", s.updateDocumentHandler(collectionApplications, "application", "application", "owner", "type"))
+	mux.HandleFunc("DELETE /application/applications/{id}", s.deleteDocumentHandler(collectionApplications, "application"))
+	mux.HandleFunc("POST /application/applications/{id}/clone", s.cloneApplication)
+	mux.HandleFunc("GET /application/applicationsByName/{name}", s.getApplicationsByName)
+	mux.HandleFunc("GET /application/applicationsByOwner/{tenant}", s.getApplicationsByOwner)
+	mux.HandleFunc("GET /application/applicationsByTenant/{tenant}", s.getApplicationsByTenant)
+}
+
+func applicationFilters(r *http.Request) []filter {
+	query := r.URL.Query()
+	filters := make([]filter, 0)
+	filters = equalsFilter(filters, query, "name", "name")
+	filters = equalsFilter(filters, query, "type", "type")
+	filters = equalsFilter(filters, query, "owner", "owner.tenant.id")
+	filters = equalsFilter(filters, query, "availability", "availability")
+	return filters
+}
+
+func (s *Server) getApplications(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := s.getCollection(collectionApplications).find(applicationFilters(r)...)
+	writeCollection(w, r, mediaType("applicationCollection"), "applications", items)
+}
+
+func (s *Server) getApplicationsByName(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := r.PathValue("name")
+	items := s.getCollection(collectionApplications).find(func(doc document) bool {
+		return doc["name"] == name
+	})
+	writeCollection(w, r, mediaType("applicationCollection"), "applications", items)
+}
+
+func (s *Server) getApplicationsByOwner(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tenant := r.PathValue("tenant")
+	items := s.getCollection(collectionApplications).find(func(doc document) bool {
+		return lookupString(doc, "owner.tenant.id") == tenant
+	})
+	writeCollection(w, r, mediaType("applicationCollection"), "applications", items)
+}
+
+// getApplicationsByTenant returns the applications which are available to the tenant. Subscriptions are not
+// emulated, so these are the applications owned by the tenant and the market applications
+func (s *Server) getApplicationsByTenant(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tenant := r.PathValue("tenant")
+	items := s.getCollection(collectionApplications).find(func(doc document) bool {
+		return lookupString(doc, "owner.tenant.id") == tenant || doc["availability"] == "MARKET"
+	})
+	writeCollection(w, r, mediaType("applicationCollection"), "applications", items)
+}
+
+func (s *Server) createApplication(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodeBody(w, r)
+	if !ok || !requireFields(w, "application", body, "name", "type") {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addApplication(w, r, body)
+}
+
+// cloneApplication creates a copy of the application owned by the current tenant. The name, key and
+// context path of the copy are prefixed with "clone"
+func (s *Server) cloneApplication(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	app, ok := s.getCollection(collectionApplications).get(id)
+	if !ok {
+		writeNotFound(w, "application", id)
+		return
+	}
+	clone := copyDocument(app)
+	delete(clone, "owner")
+	for _, key := range []string{"name", "key", "contextPath"} {
+		if value := lookupString(app, key); value != "" {
+			clone[key] = "clone" + value
+		}
+	}
+	s.addApplication(w, r, clone)
+}
+
+// addApplication stores a new application owned by the current tenant. The lock must be held by the caller
+func (s *Server) addApplication(w http.ResponseWriter, r *http.Request, body document) {
+	name := lookupString(body, "name")
+	applications := s.getCollection(collectionApplications)
+	if existing := applications.find(func(doc document) bool { return doc["name"] == name }); len(existing) > 0 {
+		writeError(w, http.StatusConflict, "applications/Duplicate", fmt.Sprintf("Application with name '%s' already exists.", name))
+		return
+	}
+
+	id := s.newID()
+	body["id"] = id
+	body["self"] = "/application/applications/" + id
+	body["owner"] = document{
+		"self": "/tenant/tenants/" + s.Tenant,
+		"tenant": document{
+			"id": s.Tenant,
+		},
+	}
+	if _, ok := body["key"]; !ok {
+		body["key"] = name + "-key"
+	}
+	if _, ok := body["availability"]; !ok {
+		body["availability"] = "PRIVATE"
+	}
+	doc := applications.add(body)
+	writeJSON(w, http.StatusCreated, mediaType("application"), absolute(r, doc))
+}
@@ -0,0 +1,672 @@
+package c8ytest
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Measurements, events, alarms and operations
+
+func (s *Server) registerMeasurements(mux *http.ServeMux) {
+	mux.HandleFunc("GET /measurement/measurements", s.getMeasurements)
+	mux.HandleFunc("POST /measurement/measurements", s.createMeasurements)
+	mux.HandleFunc("DELETE /measurement/measurements", s.deleteMeasurements)
+	mux.HandleFunc("GET /measurement/measurements/series", s.getMeasurementSeries)
+	mux.HandleFunc("GET /measurement/measurements/{id}", s.getDocumentHandler(collectionMeasurements, "measurement", "measurement"))
+	mux.HandleFunc("DELETE /measurement/measurements/{id}", s.deleteDocumentHandler(collectionMeasurements, "measurement"))
+}
+
+func (s *Server) registerEvents(mux *http.ServeMux) {
+	mux.HandleFunc("GET /event/events", s.getEvents)
+	mux.HandleFunc("POST /event/events", s.createEvent)
+	mux.HandleFunc("DELETE /event/events", s.deleteEvents)
+	mux.HandleFunc("GET /event/events/{id}", s.getDocumentHandler(collectionEvents, "event", "event"))
+	mux.HandleFunc("PUT /event/events/{id}", s.updateDocumentHandler(collectionEvents, "event", "event", "source", "creationTime", "time", "type"))
+	mux.HandleFunc("DELETE /event/events/{id}", s.deleteDocumentHandler(collectionEvents, "event"))
+	mux.HandleFunc("GET /event/events/{id}/binaries", s.downloadEventBinary)
+	mux.HandleFunc("POST /event/events/{id}/binaries", s.createEventBinary)
+	mux.HandleFunc("PUT /event/events/{id}/binaries", s.updateEventBinary)
+	mux.HandleFunc("DELETE /event/events/{id}/binaries", s.deleteEventBinary)
+}
+
+func (s *Server) registerAlarms(mux *http.ServeMux) {
+	mux.HandleFunc("GET /alarm/alarms", s.getAlarms)
+	mux.HandleFunc("POST /alarm/alarms", s.createAlarm)
+	mux.HandleFunc("PUT /alarm/alarms", s.updateAlarms)
+	mux.HandleFunc("DELETE /alarm/alarms", s.deleteAlarms)
+	mux.HandleFunc("GET /alarm/alarms/count", s.countAlarms)
+	mux.HandleFunc("GET /alarm/alarms/{id}", s.getDocumentHandler(collectionAlarms, "alarm", "alarm"))
+	mux.HandleFunc("PUT /alarm/alarms/{id}", s.updateDocumentHandler(collectionAlarms, "alarm", "alarm", "source", "creationTime", "type", "count", "firstOccurrenceTime"))
+	mux.HandleFunc("DELETE /alarm/alarms/{id}", s.deleteDocumentHandler(collectionAlarms, "alarm"))
+}
+
+func (s *Server) registerOperations(mux *http.ServeMux) {
+	mux.HandleFunc("GET /devicecontrol/operations", s.getOperations)
+	mux.HandleFunc("POST /devicecontrol/operations", s.createOperation)
+	mux.HandleFunc("DELETE /devicecontrol/operations", s.deleteOperations)
+	mux.HandleFunc("GET /devicecontrol/operations/{id}", s.getDocumentHandler(collectionOperations, "operation", "operation"))
+	mux.HandleFunc("PUT /devicecontrol/operations/{id}", s.updateDocumentHandler(collectionOperations, "operation", "operation", "deviceId", "creationTime"))
+}
+
+// Generic handlers for documents which are identified by their id
+
+func (s *Server) getDocumentHandler(name string, resource string, media string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		id := r.PathValue("id")
+		doc, ok := s.getCollection(name).get(id)
+		if !ok {
+			writeNotFound(w, resource, id)
+			return
+		}
+		writeJSON(w, http.StatusOK, mediaType(media), absolute(r, doc))
+	}
+}
+
+func (s *Server) updateDocumentHandler(name string, resource string, media string, readOnly ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		update, ok := decodeBody(w, r)
+		if !ok {
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		id := r.PathValue("id")
+		doc, ok := s.getCollection(name).get(id)
+		if !ok {
+			writeNotFound(w, resource, id)
+			return
+		}
+		merge(doc, update, append([]string{"id", "self", "lastUpdated"}, readOnly...)...)
+		doc["lastUpdated"] = timestamp()
+		writeJSON(w, http.StatusOK, mediaType(media), absolute(r, doc))
+	}
+}
+
+func (s *Server) deleteDocumentHandler(name string, resource string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		id := r.PathValue("id")
+		if !s.getCollection(name).remove(id) {
+			writeNotFound(w, resource, id)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// newSourceDocument stores a new document which belongs to a source managed object.
+// An error response is written if the source does not exist. The lock must be held by the caller
+func (s *Server) newSourceDocument(w http.ResponseWriter, name string, path string, doc document) (document, bool) {
+	sourceID := lookupString(doc, "source.id")
+	source, ok := s.getCollection(collectionManagedObjects).get(sourceID)
+	if !ok {
+		writeNotFound(w, "inventory", sourceID)
+		return nil, false
+	}
+	id := s.newID()
+	now := timestamp()
+	doc["id"] = id
+	doc["self"] = path + "/" + id
+	doc["source"] = document{
+		"id":   sourceID,
+		"name": source["name"],
+		"self": source["self"],
+	}
+	doc["creationTime"] = now
+	if _, ok := doc["time"]; !ok {
+		doc["time"] = now
+	}
+	if name != collectionMeasurements {
+		doc["lastUpdated"] = now
+	}
+	return s.getCollection(name).add(doc), true
+}
+
+// sourceFilters returns the filters which are shared by the measurement, event and alarm collections.
+// An error response is written if a filter is invalid
+func sourceFilters(w http.ResponseWriter, r *http.Request, resource string) ([]filter, bool) {
+	query := r.URL.Query()
+	filters := make([]filter, 0)
+	filters = equalsFilter(filters, query, "source", "source.id")
+	filters = equalsFilter(filters, query, "type", "type")
+	filters, err := dateFilter(filters, query, "time")
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, resource+"/Unprocessable Entity", err.Error())
+		return nil, false
+	}
+	return filters, true
+}
+
+// findByTime returns the sorted documents. Documents are sorted by time, where the order can be reversed using the revert query parameter
+func (s *Server) findByTime(r *http.Request, name string, descending bool, filters ...filter) []document {
+	items := s.getCollection(name).find(filters...)
+	if r.URL.Query().Get("revert") == "true" {
+		descending = !descending
+	}
+	sortByTime(items, "time", descending)
+	return items
+}
+
+// Measurements
+
+func measurementFilters(w http.ResponseWriter, r *http.Request) ([]filter, bool) {
+	filters, ok := sourceFilters(w, r, "measurement")
+	if !ok {
+		return nil, false
+	}
+	query := r.URL.Query()
+	filters = fragmentFilter(filters, query, "valueFragmentType")
+	if series := query.Get("valueFragmentSeries"); series != "" {
+		fragment := query.Get("valueFragmentType")
+		filters = append(filters, func(doc document) bool {
+			if fragment != "" {
+				_, ok := lookup(doc, fragment+"."+series)
+				return ok
+			}
+			for _, value := range doc {
+				if obj, ok := value.(map[string]any); ok {
+					if _, ok := obj[series]; ok {
+						return true
+					}
+				}
+			}
+			return false
+		})
+	}
+	return filters, true
+}
+
+func (s *Server) getMeasurements(w http.ResponseWriter, r *http.Request) {
+	filters, ok := measurementFilters(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := s.findByTime(r, collectionMeasurements, false, filters...)
+	writeCollection(w, r, mediaType("measurementCollection"), "measurements", items)
+}
+
+// getMeasurementSeries returns the values of the series given by the series query parameter (<fragment>.<series>),
+// or of all series of the matching measurements. The values are not aggregated, so min and max are the same
+func (s *Server) getMeasurementSeries(w http.ResponseWriter, r *http.Request) {
+	filters, ok := sourceFilters(w, r, "measurement")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := s.findByTime(r, collectionMeasurements, false, filters...)
+
+	names := queryValues(r.URL.Query(), "series")
+	if len(names) == 0 {
+		names = measurementSeriesNames(items)
+	}
+
+	series := make([]any, 0, len(names))
+	for _, name := range names {
+		fragment, seriesName, _ := strings.Cut(name, ".")
+		definition := document{"type": fragment, "name": seriesName, "unit": ""}
+		for _, doc := range items {
+			if unit, ok := lookup(doc, name+".unit"); ok {
+				definition["unit"] = unit
+				break
+			}
+		}
+		series = append(series, definition)
+	}
+
+	values := document{}
+	for _, doc := range items {
+		key := lookupString(doc, "time")
+		row, ok := values[key].([]any)
+		if !ok {
+			row = make([]any, len(names))
+			values[key] = row
+		}
+		for i, name := range names {
+			if value, ok := lookup(doc, name+".value"); ok {
+				row[i] = document{"min": value, "max": value}
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, "application/json", document{
+		"series":    series,
+		"values":    values,
+		"truncated": false,
+	})
+}
+
+// measurementSeriesNames returns the sorted names (<fragment>.<series>) of the series of the measurements
+func measurementSeriesNames(items []document) []string {
+	names := make([]string, 0)
+	for _, doc := range items {
+		for fragment, value := range doc {
+			obj, ok := value.(map[string]any)
+			if !ok {
+				continue
+			}
+			for name, item := range obj {
+				if _, ok := lookup(document{"v": item}, "v.value"); ok && !slices.Contains(names, fragment+"."+name) {
+					names = append(names, fragment+"."+name)
+				}
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (s *Server) createMeasurements(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodeBody(w, r)
+	if !ok {
+		return
+	}
+
+	// Measurements can be created one at a time, or as a collection
+	measurements := []any{body}
+	items, isCollection := body["measurements"].([]any)
+	if isCollection {
+		measurements = items
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	created := make([]any, 0, len(measurements))
+	for _, item := range measurements {
+		doc, ok := item.(map[string]any)
+		if !ok || !requireFields(w, "measurement", doc, "source.id", "type") {
+			if !ok {
+				writeError(w, http.StatusUnprocessableEntity, "measurement/Unprocessable Entity", "Invalid measurement")
+			}
+			return
+		}
+		doc, ok = s.newSourceDocument(w, collectionMeasurements, "/measurement/measurements", doc)
+		if !ok {
+			return
+		}
+		created = append(created, absolute(r, doc))
+	}
+
+	if isCollection {
+		writeJSON(w, http.StatusCreated, mediaType("measurementCollection"), document{
+			"measurements": created,
+		})
+		return
+	}
+	writeJSON(w, http.StatusCreated, mediaType("measurement"), created[0])
+}
+
+func (s *Server) deleteMeasurements(w http.ResponseWriter, r *http.Request) {
+	filters, ok := measurementFilters(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.getCollection(collectionMeasurements).removeAll(filters...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Events
+
+func eventFilters(w http.ResponseWriter, r *http.Request) ([]filter, bool) {
+	filters, ok := sourceFilters(w, r, "event")
+	if !ok {
+		return nil, false
+	}
+	return fragmentFilter(filters, r.URL.Query(), "fragmentType"), true
+}
+
+func (s *Server) getEvents(w http.ResponseWriter, r *http.Request) {
+	filters, ok := eventFilters(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := s.findByTime(r, collectionEvents, true, filters...)
+	writeCollection(w, r, mediaType("eventCollection"), "events", items)
+}
+
+func (s *Server) createEvent(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodeBody(w, r)
+	if !ok || !requireFields(w, "event", body, "source.id", "type", "text", "time") {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, ok := s.newSourceDocument(w, collectionEvents, "/event/events", body)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusCreated, mediaType("event"), absolute(r, doc))
+}
+
+func (s *Server) deleteEvents(w http.ResponseWriter, r *http.Request) {
+	filters, ok := eventFilters(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.getCollection(collectionEvents).removeAll(filters...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Event binaries. The binary's information is stored in the c8y_IsBinary fragment of the event
+
+func (s *Server) createEventBinary(w http.ResponseWriter, r *http.Request) {
+	data, filename, contentType, ok := readMultipartFile(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	event, ok := s.getCollection(collectionEvents).get(id)
+	if !ok {
+		writeNotFound(w, "event", id)
+		return
+	}
+	if _, exists := s.eventBinaries[id]; exists {
+		writeError(w, http.StatusConflict, "event/Conflict", fmt.Sprintf("Binary for event '%s' already exists", id))
+		return
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	s.setEventBinary(event, filename, binaryContent{ContentType: contentType, Data: data})
+	writeJSON(w, http.StatusCreated, "application/json", eventBinaryDocument(r, event))
+}
+
+func (s *Server) updateEventBinary(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "general/badRequest", fmt.Sprintf("Could not read body. %s", err))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	event, ok := s.getCollection(collectionEvents).get(id)
+	content, found := s.eventBinaries[id]
+	if !ok || !found {
+		writeNotFound(w, "event binary", id)
+		return
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		content.ContentType = contentType
+	}
+	content.Data = data
+	s.setEventBinary(event, lookupString(event, "c8y_IsBinary.name"), content)
+	writeJSON(w, http.StatusCreated, "application/json", eventBinaryDocument(r, event))
+}
+
+func (s *Server) downloadEventBinary(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	event, ok := s.getCollection(collectionEvents).get(id)
+	content, found := s.eventBinaries[id]
+	if !ok || !found {
+		writeNotFound(w, "event binary", id)
+		return
+	}
+	w.Header().Set("Content-Type", content.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content.Data)))
+	if name := lookupString(event, "c8y_IsBinary.name"); name != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(content.Data)
+}
+
+func (s *Server) deleteEventBinary(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	event, ok := s.getCollection(collectionEvents).get(id)
+	if _, found := s.eventBinaries[id]; !ok || !found {
+		writeNotFound(w, "event binary", id)
+		return
+	}
+	delete(s.eventBinaries, id)
+	delete(event, "c8y_IsBinary")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setEventBinary stores the binary of the event. The lock must be held by the caller
+func (s *Server) setEventBinary(event document, filename string, content binaryContent) {
+	s.eventBinaries[lookupString(event, "id")] = content
+	event["c8y_IsBinary"] = document{
+		"name":   filename,
+		"type":   content.ContentType,
+		"length": len(content.Data),
+	}
+	event["lastUpdated"] = timestamp()
+}
+
+func eventBinaryDocument(r *http.Request, event document) document {
+	id := lookupString(event, "id")
+	length, _ := lookup(event, "c8y_IsBinary.length")
+	return document{
+		"self":   baseURL(r) + "/event/events/" + id + "/binaries",
+		"source": id,
+		"name":   lookupString(event, "c8y_IsBinary.name"),
+		"type":   lookupString(event, "c8y_IsBinary.type"),
+		"length": length,
+	}
+}
+
+// Alarms
+
+func alarmFilters(w http.ResponseWriter, r *http.Request) ([]filter, bool) {
+	filters, ok := sourceFilters(w, r, "alarm")
+	if !ok {
+		return nil, false
+	}
+	query := r.URL.Query()
+	filters = equalsFilter(filters, query, "status", "status")
+	filters = equalsFilter(filters, query, "severity", "severity")
+	if resolved := query.Get("resolved"); resolved != "" {
+		filters = append(filters, func(doc document) bool {
+			return (lookupString(doc, "status") == "CLEARED") == (resolved == "true")
+		})
+	}
+	return filters, true
+}
+
+func (s *Server) getAlarms(w http.ResponseWriter, r *http.Request) {
+	filters, ok := alarmFilters(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := s.findByTime(r, collectionAlarms, true, filters...)
+	writeCollection(w, r, mediaType("alarmCollection"), "alarms", items)
+}
+
+func (s *Server) countAlarms(w http.ResponseWriter, r *http.Request) {
+	filters, ok := alarmFilters(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, "text/plain", len(s.getCollection(collectionAlarms).find(filters...)))
+}
+
+func (s *Server) createAlarm(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodeBody(w, r)
+	if !ok || !requireFields(w, "alarm", body, "source.id", "type", "text", "time", "severity") {
+		return
+	}
+	if _, ok := body["status"]; !ok {
+		body["status"] = "ACTIVE"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Alarms are de-duplicated, so an existing uncleared alarm of the same type is updated instead
+	if body["status"] != "CLEARED" {
+		existing := s.getCollection(collectionAlarms).find(func(doc document) bool {
+			return lookupString(doc, "source.id") == lookupString(body, "source.id") &&
+				doc["type"] == body["type"] &&
+				doc["status"] != "CLEARED"
+		})
+		if len(existing) > 0 {
+			doc := existing[0]
+			count, _ := doc["count"].(int)
+			doc["count"] = count + 1
+			doc["time"] = body["time"]
+			doc["text"] = body["text"]
+			doc["lastUpdated"] = timestamp()
+			writeJSON(w, http.StatusCreated, mediaType("alarm"), absolute(r, doc))
+			return
+		}
+	}
+
+	doc, ok := s.newSourceDocument(w, collectionAlarms, "/alarm/alarms", body)
+	if !ok {
+		return
+	}
+	doc["count"] = 1
+	doc["firstOccurrenceTime"] = doc["time"]
+	writeJSON(w, http.StatusCreated, mediaType("alarm"), absolute(r, doc))
+}
+
+func (s *Server) updateAlarms(w http.ResponseWriter, r *http.Request) {
+	filters, ok := alarmFilters(w, r)
+	if !ok {
+		return
+	}
+	update, ok := decodeBody(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := timestamp()
+	for _, doc := range s.getCollection(collectionAlarms).find(filters...) {
+		merge(doc, update, "id", "self", "source", "creationTime", "type", "count", "firstOccurrenceTime", "lastUpdated")
+		doc["lastUpdated"] = now
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) deleteAlarms(w http.ResponseWriter, r *http.Request) {
+	filters, ok := alarmFilters(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.getCollection(collectionAlarms).removeAll(filters...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Operations
+
+func operationFilters(r *http.Request) []filter {
+	query := r.URL.Query()
+	filters := make([]filter, 0)
+	filters = equalsFilter(filters, query, "deviceId", "deviceId")
+	filters = equalsFilter(filters, query, "status", "status")
+	filters = equalsFilter(filters, query, "bulkOperationId", "bulkOperationId")
+	filters = fragmentFilter(filters, query, "fragmentType")
+	return filters
+}
+
+func (s *Server) getOperations(w http.ResponseWriter, r *http.Request) {
+	filters := operationFilters(r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if agentID := r.URL.Query().Get("agentId"); agentID != "" {
+		// Operations of the agent's child devices are also included
+		deviceIDs := []string{agentID}
+		if agent, ok := s.getCollection(collectionManagedObjects).get(agentID); ok {
+			for _, ref := range references(agent, "childDevices") {
+				deviceIDs = append(deviceIDs, lookupString(ref.(map[string]any), "managedObject.id"))
+			}
+		}
+		filters = append(filters, func(doc document) bool {
+			return slices.Contains(deviceIDs, lookupString(doc, "deviceId"))
+		})
+	}
+
+	items := s.findByTime(r, collectionOperations, false, filters...)
+	writeCollection(w, r, mediaType("operationCollection"), "operations", items)
+}
+
+func (s *Server) createOperation(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodeBody(w, r)
+	if !ok || !requireFields(w, "operation", body, "deviceId") {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deviceID := lookupString(body, "deviceId")
+	device, ok := s.getCollection(collectionManagedObjects).get(deviceID)
+	if !ok {
+		writeNotFound(w, "inventory", deviceID)
+		return
+	}
+
+	id := s.newID()
+	now := timestamp()
+	body["id"] = id
+	body["self"] = "/devicecontrol/operations/" + id
+	body["deviceId"] = deviceID
+	body["deviceName"] = device["name"]
+	body["status"] = "PENDING"
+	body["creationTime"] = now
+	body["time"] = now
+	doc := s.getCollection(collectionOperations).add(body)
+	writeJSON(w, http.StatusCreated, mediaType("operation"), absolute(r, doc))
+}
+
+func (s *Server) deleteOperations(w http.ResponseWriter, r *http.Request) {
+	filters := operationFilters(r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.getCollection(collectionOperations).removeAll(filters...)
+	w.WriteHeader(http.StatusNoContent)
+}
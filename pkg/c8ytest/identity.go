@@ -0,0 +1,108 @@
+package c8ytest
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func (s *Server) registerIdentity(mux *http.ServeMux) {
+	mux.HandleFunc("GET /identity/globalIds/{id}/externalIds", s.getExternalIDs)
+	mux.HandleFunc("POST /identity/globalIds/{id}/externalIds", s.createExternalID)
+	mux.HandleFunc("GET /identity/externalIds/{type}/{externalId}", s.getExternalID)
+	mux.HandleFunc("DELETE /identity/externalIds/{type}/{externalId}", s.deleteExternalID)
+}
+
+func externalIDKey(externalIDType string, externalID string) string {
+	return externalIDType + "/" + externalID
+}
+
+func writeExternalIDNotFound(w http.ResponseWriter, externalIDType string, externalID string) {
+	writeError(w, http.StatusNotFound, "identity/Not Found", fmt.Sprintf("External id not found; external id = ID [type=%s, value=%s]", externalIDType, externalID))
+}
+
+func (s *Server) getExternalIDs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	if _, ok := s.getCollection(collectionManagedObjects).get(id); !ok {
+		writeNotFound(w, "inventory", id)
+		return
+	}
+	items := s.getCollection(collectionExternalIDs).find(func(doc document) bool {
+		return lookupString(doc, "managedObject.id") == id
+	})
+	writeCollection(w, r, mediaType("externalIdCollection"), "externalIds", items)
+}
+
+func (s *Server) createExternalID(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodeBody(w, r)
+	if !ok || !requireFields(w, "identity", body, "externalId", "type") {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	mo, ok := s.getCollection(collectionManagedObjects).get(id)
+	if !ok {
+		writeNotFound(w, "inventory", id)
+		return
+	}
+
+	externalIDType := lookupString(body, "type")
+	externalID := lookupString(body, "externalId")
+	key := externalIDKey(externalIDType, externalID)
+	externalIDs := s.getCollection(collectionExternalIDs)
+	if _, exists := externalIDs.get(key); exists {
+		writeError(w, http.StatusConflict, "identity/Conflict", fmt.Sprintf("External id already exists; external id = ID [type=%s, value=%s]", externalIDType, externalID))
+		return
+	}
+
+	doc := externalIDs.add(document{
+		"id":         key,
+		"externalId": externalID,
+		"type":       externalIDType,
+		"self":       "/identity/externalIds/" + key,
+		"managedObject": document{
+			"id":   id,
+			"self": mo["self"],
+		},
+	})
+	writeJSON(w, http.StatusCreated, mediaType("externalId"), externalIDResponse(r, doc))
+}
+
+func (s *Server) getExternalID(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	externalIDType := r.PathValue("type")
+	externalID := r.PathValue("externalId")
+	doc, ok := s.getCollection(collectionExternalIDs).get(externalIDKey(externalIDType, externalID))
+	if !ok {
+		writeExternalIDNotFound(w, externalIDType, externalID)
+		return
+	}
+	writeJSON(w, http.StatusOK, mediaType("externalId"), externalIDResponse(r, doc))
+}
+
+func (s *Server) deleteExternalID(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	externalIDType := r.PathValue("type")
+	externalID := r.PathValue("externalId")
+	if !s.getCollection(collectionExternalIDs).remove(externalIDKey(externalIDType, externalID)) {
+		writeExternalIDNotFound(w, externalIDType, externalID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// externalIDResponse removes the internal id which is not part of the external id representation
+func externalIDResponse(r *http.Request, doc document) document {
+	out := absolute(r, doc)
+	delete(out, "id")
+	return out
+}
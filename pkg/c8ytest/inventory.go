@@ -0,0 +1,544 @@
+package c8ytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Managed object reference fragments
+var referenceFragments = []string{
+	"childDevices",
+	"childAssets",
+	"childAdditions",
+	"deviceParents",
+	"assetParents",
+	"additionParents",
+}
+
+// Parent reference fragment for each of the child reference fragments
+var parentFragments = map[string]string{
+	"childDevices":   "deviceParents",
+	"childAssets":    "assetParents",
+	"childAdditions": "additionParents",
+}
+
+type binaryContent struct {
+	ContentType string
+	Data        []byte
+}
+
+func (s *Server) registerInventory(mux *http.ServeMux) {
+	mux.HandleFunc("GET /inventory/managedObjects", s.getManagedObjects)
+	mux.HandleFunc("POST /inventory/managedObjects", s.createManagedObject)
+	mux.HandleFunc("GET /inventory/managedObjects/{id}", s.getManagedObject)
+	mux.HandleFunc("PUT /inventory/managedObjects/{id}", s.updateManagedObject)
+	mux.HandleFunc("DELETE /inventory/managedObjects/{id}", s.deleteManagedObject)
+
+	mux.HandleFunc("GET /inventory/managedObjects/{id}/{reference}", s.getChildReferences)
+	mux.HandleFunc("POST /inventory/managedObjects/{id}/{reference}", s.addChildReference)
+	mux.HandleFunc("GET /inventory/managedObjects/{id}/{reference}/{childId}", s.getChildReference)
+	mux.HandleFunc("DELETE /inventory/managedObjects/{id}/{reference}/{childId}", s.deleteChildReference)
+
+	mux.HandleFunc("GET /inventory/binaries", s.getBinaries)
+	mux.HandleFunc("POST /inventory/binaries", s.createBinary)
+	mux.HandleFunc("GET /inventory/binaries/{id}", s.downloadBinary)
+	mux.HandleFunc("PUT /inventory/binaries/{id}", s.updateBinary)
+	mux.HandleFunc("DELETE /inventory/binaries/{id}", s.deleteBinary)
+}
+
+// newManagedObject stores a new managed object. The lock must be held by the caller
+func (s *Server) newManagedObject(doc document) document {
+	id := s.newID()
+	now := timestamp()
+	doc["id"] = id
+	doc["self"] = "/inventory/managedObjects/" + id
+	doc["owner"] = s.Username
+	doc["creationTime"] = now
+	doc["lastUpdated"] = now
+	for _, fragment := range referenceFragments {
+		doc[fragment] = document{
+			"self":       "/inventory/managedObjects/" + id + "/" + fragment,
+			"references": []any{},
+		}
+	}
+	return s.getCollection(collectionManagedObjects).add(doc)
+}
+
+// managedObjectFilters returns the filters given by the managed object query parameters.
+// An error response is written if the query is not supported
+func managedObjectFilters(w http.ResponseWriter, r *http.Request) ([]filter, bool) {
+	query := r.URL.Query()
+	filters := make([]filter, 0)
+	filters = equalsFilter(filters, query, "ids", "id")
+	filters = equalsFilter(filters, query, "type", "type")
+	filters = equalsFilter(filters, query, "owner", "owner")
+	filters = fragmentFilter(filters, query, "fragmentType")
+
+	if text := query.Get("text"); text != "" {
+		filters = append(filters, func(doc document) bool {
+			return strings.Contains(strings.ToLower(lookupString(doc, "name")), strings.ToLower(text))
+		})
+	}
+	for _, param := range []string{"query", "q"} {
+		if value := query.Get(param); value != "" {
+			f, err := parseInventoryQuery(value)
+			if err != nil {
+				writeError(w, http.StatusUnprocessableEntity, "inventory/Unprocessable Entity", err.Error())
+				return nil, false
+			}
+			filters = append(filters, f)
+		}
+	}
+	return filters, true
+}
+
+func (s *Server) getManagedObjects(w http.ResponseWriter, r *http.Request) {
+	filters, ok := managedObjectFilters(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := s.getCollection(collectionManagedObjects).find(filters...)
+	writeCollection(w, r, mediaType("managedObjectCollection"), "managedObjects", items)
+}
+
+func (s *Server) createManagedObject(w http.ResponseWriter, r *http.Request) {
+	doc, ok := decodeBody(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc = s.newManagedObject(doc)
+	writeJSON(w, http.StatusCreated, mediaType("managedObject"), absolute(r, doc))
+}
+
+func (s *Server) getManagedObject(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	doc, ok := s.getCollection(collectionManagedObjects).get(id)
+	if !ok {
+		writeNotFound(w, "inventory", id)
+		return
+	}
+	writeJSON(w, http.StatusOK, mediaType("managedObject"), absolute(r, doc))
+}
+
+func (s *Server) updateManagedObject(w http.ResponseWriter, r *http.Request) {
+	update, ok := decodeBody(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	doc, ok := s.getCollection(collectionManagedObjects).get(id)
+	if !ok {
+		writeNotFound(w, "inventory", id)
+		return
+	}
+	merge(doc, update, append([]string{"id", "self", "owner", "creationTime", "lastUpdated"}, referenceFragments...)...)
+	doc["lastUpdated"] = timestamp()
+	writeJSON(w, http.StatusOK, mediaType("managedObject"), absolute(r, doc))
+}
+
+func (s *Server) deleteManagedObject(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	if !s.removeManagedObject(id) {
+		writeNotFound(w, "inventory", id)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeManagedObject removes a managed object and all of the references to it. The lock must be held by the caller
+func (s *Server) removeManagedObject(id string) bool {
+	if !s.getCollection(collectionManagedObjects).remove(id) {
+		return false
+	}
+	delete(s.binaries, id)
+	s.getCollection(collectionExternalIDs).removeAll(func(doc document) bool {
+		return lookupString(doc, "managedObject.id") == id
+	})
+	for _, doc := range s.getCollection(collectionManagedObjects).items {
+		for _, fragment := range referenceFragments {
+			removeReference(doc, fragment, id)
+		}
+	}
+	return true
+}
+
+func references(doc document, fragment string) []any {
+	if refs, ok := lookup(doc, fragment+".references"); ok {
+		if items, ok := refs.([]any); ok {
+			return items
+		}
+	}
+	return nil
+}
+
+func setReferences(doc document, fragment string, refs []any) {
+	obj, ok := doc[fragment].(map[string]any)
+	if !ok {
+		return
+	}
+	obj = copyDocument(obj)
+	obj["references"] = refs
+	doc[fragment] = obj
+}
+
+func addReference(doc document, fragment string, target document) {
+	refs := slices.Clone(references(doc, fragment))
+	for _, ref := range refs {
+		if lookupString(ref.(map[string]any), "managedObject.id") == target["id"] {
+			return
+		}
+	}
+	refs = append(refs, document{
+		"self": fmt.Sprintf("/inventory/managedObjects/%s/%s/%s", doc["id"], fragment, target["id"]),
+		"managedObject": document{
+			"id":   target["id"],
+			"name": target["name"],
+			"self": target["self"],
+		},
+	})
+	setReferences(doc, fragment, refs)
+}
+
+func removeReference(doc document, fragment string, id string) bool {
+	refs := references(doc, fragment)
+	i := slices.IndexFunc(refs, func(ref any) bool {
+		return lookupString(ref.(map[string]any), "managedObject.id") == id
+	})
+	if i == -1 {
+		return false
+	}
+	setReferences(doc, fragment, slices.Delete(slices.Clone(refs), i, i+1))
+	return true
+}
+
+// referenceParent returns the managed object and checks if the reference type is valid. An error response is written if not
+func (s *Server) referenceParent(w http.ResponseWriter, r *http.Request) (document, string, bool) {
+	id := r.PathValue("id")
+	fragment := r.PathValue("reference")
+	if !slices.Contains(referenceFragments, fragment) {
+		writeError(w, http.StatusNotFound, "general/notFound", fmt.Sprintf("Resource not found: %s", r.URL.Path))
+		return nil, "", false
+	}
+	doc, ok := s.getCollection(collectionManagedObjects).get(id)
+	if !ok {
+		writeNotFound(w, "inventory", id)
+		return nil, "", false
+	}
+	return doc, fragment, true
+}
+
+func (s *Server) getChildReferences(w http.ResponseWriter, r *http.Request) {
+	filters, ok := managedObjectFilters(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, fragment, ok := s.referenceParent(w, r)
+	if !ok {
+		return
+	}
+	items := make([]document, 0)
+	managedObjects := s.getCollection(collectionManagedObjects)
+	for _, ref := range references(doc, fragment) {
+		child, ok := managedObjects.get(lookupString(ref.(map[string]any), "managedObject.id"))
+		if ok && matchAll(child, filters...) {
+			items = append(items, ref.(map[string]any))
+		}
+	}
+	writeCollection(w, r, mediaType("managedObjectReferenceCollection"), "references", items)
+}
+
+func (s *Server) getChildReference(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, fragment, ok := s.referenceParent(w, r)
+	if !ok {
+		return
+	}
+	childID := r.PathValue("childId")
+	for _, ref := range references(doc, fragment) {
+		if lookupString(ref.(map[string]any), "managedObject.id") == childID {
+			writeJSON(w, http.StatusOK, mediaType("managedObjectReference"), absolute(r, ref.(map[string]any)))
+			return
+		}
+	}
+	writeNotFound(w, "inventory", childID)
+}
+
+func (s *Server) addChildReference(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodeBody(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, fragment, ok := s.referenceParent(w, r)
+	if !ok {
+		return
+	}
+
+	childID := lookupString(body, "managedObject.id")
+	if childID == "" {
+		// Create a new managed object as a child
+		child := s.newManagedObject(body)
+		addReference(doc, fragment, child)
+		addReference(child, parentFragments[fragment], doc)
+		writeJSON(w, http.StatusCreated, mediaType("managedObject"), absolute(r, child))
+		return
+	}
+
+	child, ok := s.getCollection(collectionManagedObjects).get(childID)
+	if !ok {
+		writeNotFound(w, "inventory", childID)
+		return
+	}
+	addReference(doc, fragment, child)
+	addReference(child, parentFragments[fragment], doc)
+
+	for _, ref := range references(doc, fragment) {
+		if lookupString(ref.(map[string]any), "managedObject.id") == child["id"] {
+			writeJSON(w, http.StatusCreated, mediaType("managedObjectReference"), absolute(r, ref.(map[string]any)))
+			return
+		}
+	}
+}
+
+func (s *Server) deleteChildReference(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, fragment, ok := s.referenceParent(w, r)
+	if !ok {
+		return
+	}
+	childID := r.PathValue("childId")
+	if !removeReference(doc, fragment, childID) {
+		writeNotFound(w, "inventory", childID)
+		return
+	}
+	if child, ok := s.getCollection(collectionManagedObjects).get(childID); ok {
+		if parent, ok := parentFragments[fragment]; ok {
+			removeReference(child, parent, lookupString(doc, "id"))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Binaries
+
+func (s *Server) getBinaries(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := r.URL.Query()
+	filters := []filter{
+		func(doc document) bool {
+			_, ok := doc["c8y_IsBinary"]
+			return ok
+		},
+	}
+	filters = equalsFilter(filters, query, "ids", "id")
+	filters = equalsFilter(filters, query, "type", "type")
+	filters = equalsFilter(filters, query, "owner", "owner")
+	items := s.getCollection(collectionManagedObjects).find(filters...)
+	writeCollection(w, r, mediaType("managedObjectCollection"), "managedObjects", items)
+}
+
+func (s *Server) createBinary(w http.ResponseWriter, r *http.Request) {
+	data, filename, contentType, ok := readMultipartFile(w, r)
+	if !ok {
+		return
+	}
+
+	doc := document{}
+	if object := r.FormValue("object"); object != "" {
+		if err := json.Unmarshal([]byte(object), &doc); err != nil {
+			writeError(w, http.StatusBadRequest, "general/badRequest", fmt.Sprintf("Could not parse the object. %s", err))
+			return
+		}
+	}
+	if _, ok := doc["name"]; !ok {
+		doc["name"] = filename
+	}
+	if v, ok := doc["type"].(string); ok && v != "" {
+		contentType = v
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	doc["type"] = contentType
+	doc["contentType"] = contentType
+	doc["length"] = len(data)
+	doc["c8y_IsBinary"] = document{}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc = s.newManagedObject(doc)
+	s.binaries[doc["id"].(string)] = binaryContent{ContentType: contentType, Data: data}
+
+	// The binary's self link points to the binary contents
+	out := absolute(r, doc)
+	out["self"] = baseURL(r) + "/inventory/binaries/" + doc["id"].(string)
+	writeJSON(w, http.StatusCreated, mediaType("managedObject"), out)
+}
+
+func (s *Server) downloadBinary(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	content, ok := s.binaries[id]
+	if !ok {
+		writeNotFound(w, "binaries", id)
+		return
+	}
+	w.Header().Set("Content-Type", content.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content.Data)))
+	if doc, ok := s.getCollection(collectionManagedObjects).get(id); ok {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": lookupString(doc, "name")}))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(content.Data)
+}
+
+func (s *Server) updateBinary(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "general/badRequest", fmt.Sprintf("Could not read body. %s", err))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	content, ok := s.binaries[id]
+	doc, found := s.getCollection(collectionManagedObjects).get(id)
+	if !ok || !found {
+		writeNotFound(w, "binaries", id)
+		return
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		content.ContentType = contentType
+	}
+	content.Data = data
+	s.binaries[id] = content
+
+	doc["length"] = len(data)
+	doc["contentType"] = content.ContentType
+	doc["lastUpdated"] = timestamp()
+	writeJSON(w, http.StatusCreated, mediaType("managedObject"), absolute(r, doc))
+}
+
+func (s *Server) deleteBinary(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	if _, ok := s.binaries[id]; !ok {
+		writeNotFound(w, "binaries", id)
+		return
+	}
+	s.removeManagedObject(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readMultipartFile returns the contents, filename and content type of the file field of a multipart request.
+// An error response is written if the file is missing
+func readMultipartFile(w http.ResponseWriter, r *http.Request) (data []byte, filename string, contentType string, ok bool) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, "general/badRequest", fmt.Sprintf("Invalid multipart request. %s", err))
+		return nil, "", "", false
+	}
+
+	if file, header, err := r.FormFile("file"); err == nil {
+		defer file.Close()
+		if data, err = io.ReadAll(file); err != nil {
+			writeError(w, http.StatusBadRequest, "general/badRequest", fmt.Sprintf("Could not read file. %s", err))
+			return nil, "", "", false
+		}
+		return data, header.Filename, header.Header.Get("Content-Type"), true
+	}
+	if values, ok := r.MultipartForm.Value["file"]; ok && len(values) > 0 {
+		// The file was sent as a plain form field
+		return []byte(values[0]), "", "", true
+	}
+	writeError(w, http.StatusUnprocessableEntity, "binaries/Unprocessable Entity", "Following mandatory fields should be included: file")
+	return nil, "", "", false
+}
+
+// Inventory query language. Only a subset is supported: has(<fragment>) and
+// <property> eq '<value>' expressions (wildcards are supported) combined with "and"
+
+var (
+	queryFilterPattern  = regexp.MustCompile(`^\$filter=\((.*)\)(?:\s+\$orderby=.*)?$`)
+	queryOrderByPattern = regexp.MustCompile(`\s*\$orderby=.*$`)
+	queryClausePattern  = regexp.MustCompile(`has\(([^)\s]+)\)|([\w.]+)\s+eq\s+'((?:[^']|'')*)'`)
+	queryRemainder      = regexp.MustCompile(`(?i)^[\s()]*(?:and[\s()]+)*$`)
+)
+
+func parseInventoryQuery(query string) (filter, error) {
+	query = strings.TrimSpace(query)
+	if m := queryFilterPattern.FindStringSubmatch(query); m != nil {
+		query = m[1]
+	}
+	query = queryOrderByPattern.ReplaceAllString(query, "")
+
+	filters := make([]filter, 0)
+	for _, m := range queryClausePattern.FindAllStringSubmatch(query, -1) {
+		if fragment := m[1]; fragment != "" {
+			filters = append(filters, func(doc document) bool {
+				_, ok := lookup(doc, fragment)
+				return ok
+			})
+			continue
+		}
+		property := m[2]
+		pattern := "^" + strings.ReplaceAll(regexp.QuoteMeta(strings.ReplaceAll(m[3], "''", "'")), `\*`, ".*") + "$"
+		matcher, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, func(doc document) bool {
+			value, ok := lookup(doc, property)
+			return ok && matcher.MatchString(fmt.Sprintf("%v", value))
+		})
+	}
+
+	if remainder := queryClausePattern.ReplaceAllString(query, ""); !queryRemainder.MatchString(remainder) {
+		return nil, fmt.Errorf("unsupported inventory query: %s", query)
+	}
+
+	return func(doc document) bool {
+		return matchAll(doc, filters...)
+	}, nil
+}
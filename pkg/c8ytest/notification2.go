@@ -0,0 +1,268 @@
+package c8ytest
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"github.com/reubenmiller/go-c8y/pkg/c8y"
+)
+
+// Notification2TokenSecret is the key used to sign the notification2 tokens issued by the server
+var Notification2TokenSecret = []byte("c8ytest")
+
+// notification2SendBuffer is the number of notifications which can be queued for a consumer.
+// Notifications are dropped if the consumer does not read them
+const notification2SendBuffer = 100
+
+// Notification2Consumer is a consumer which connected to the notification2 websocket endpoint
+type Notification2Consumer struct {
+	Token        string
+	Subscriber   string
+	Subscription string
+	Consumer     string
+	Shared       bool
+}
+
+type notification2Connection struct {
+	Notification2Consumer
+	ws   *websocket.Conn
+	send chan []byte
+}
+
+func (s *Server) registerNotification2(mux *http.ServeMux) {
+	mux.HandleFunc("GET /notification2/subscriptions", s.getNotification2Subscriptions)
+	mux.HandleFunc("POST /notification2/subscriptions", s.createNotification2Subscription)
+	mux.HandleFunc("DELETE /notification2/subscriptions", s.deleteNotification2Subscriptions)
+	mux.HandleFunc("GET /notification2/subscriptions/{id}", s.getDocumentHandler(collectionNotification2Subscriptions, "subscription", "subscription"))
+	mux.HandleFunc("DELETE /notification2/subscriptions/{id}", s.deleteDocumentHandler(collectionNotification2Subscriptions, "subscription"))
+	mux.HandleFunc("POST /notification2/token", s.createNotification2Token)
+	mux.HandleFunc("POST /notification2/unsubscribe", s.unsubscribeNotification2Subscriber)
+	mux.HandleFunc("GET /notification2/consumer/", s.consumeNotifications)
+}
+
+// NewNotification2Token returns a token for the subscriber and subscription which expires after the given duration
+func (s *Server) NewNotification2Token(subscriber string, subscription string, shared bool, expiresIn time.Duration) string {
+	claims := c8y.Notification2TokenClaim{
+		Subscriber: subscriber,
+		Topic:      s.Tenant + "/relnotif/" + subscription,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		},
+	}
+	if shared {
+		claims.Shared = "true"
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(Notification2TokenSecret)
+	if err != nil {
+		panic(fmt.Sprintf("failed to sign token. %s", err))
+	}
+	return token
+}
+
+// Notification2Consumers returns the consumers which have connected to the server, in the order they connected
+func (s *Server) Notification2Consumers() []Notification2Consumer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.notification2Consumers)
+}
+
+// Notification2Unsubscribed returns the tokens which were used to unsubscribe a subscriber
+func (s *Server) Notification2Unsubscribed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.notification2Unsubscribed)
+}
+
+// PublishNotification2 sends a notification to the consumers of the subscription which are currently connected,
+// and returns the number of consumers the notification was sent to. Each subscriber receives the notification once,
+// so the consumers of a shared subscriber take turns
+func (s *Server) PublishNotification2(subscription string, api string, sourceID string, action string, body string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	frame := []byte(fmt.Sprintf("%s\n/%s/%s/%s\n%s\n\n%s", s.newID(), s.Tenant, api, sourceID, action, body))
+
+	subscribers := map[string][]*notification2Connection{}
+	order := []string{}
+	for _, conn := range s.notification2Connections {
+		if conn.Subscription != subscription {
+			continue
+		}
+		if _, ok := subscribers[conn.Subscriber]; !ok {
+			order = append(order, conn.Subscriber)
+		}
+		subscribers[conn.Subscriber] = append(subscribers[conn.Subscriber], conn)
+	}
+
+	sent := 0
+	for _, subscriber := range order {
+		connections := subscribers[subscriber]
+		if connections[0].Shared {
+			key := subscription + "/" + subscriber
+			connections = connections[s.notification2Turns[key]%len(connections) : s.notification2Turns[key]%len(connections)+1]
+			s.notification2Turns[key]++
+		}
+		for _, conn := range connections {
+			select {
+			case conn.send <- frame:
+				sent++
+			default:
+			}
+		}
+	}
+	return sent
+}
+
+func notification2SubscriptionFilters(r *http.Request) []filter {
+	query := r.URL.Query()
+	filters := make([]filter, 0)
+	filters = equalsFilter(filters, query, "context", "context")
+	filters = equalsFilter(filters, query, "source", "source.id")
+	return filters
+}
+
+func (s *Server) getNotification2Subscriptions(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := s.getCollection(collectionNotification2Subscriptions).find(notification2SubscriptionFilters(r)...)
+	writeCollection(w, r, mediaType("subscriptionCollection"), "subscriptions", items)
+}
+
+func (s *Server) createNotification2Subscription(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodeBody(w, r)
+	if !ok || !requireFields(w, "subscription", body, "context", "subscription") {
+		return
+	}
+
+	context := lookupString(body, "context")
+	switch context {
+	case c8y.Notification2ContextTenant:
+	case c8y.Notification2ContextManagedObject:
+		if !requireFields(w, "subscription", body, "source.id") {
+			return
+		}
+	default:
+		writeError(w, http.StatusUnprocessableEntity, "subscription/Unprocessable Entity", fmt.Sprintf("Unsupported context: %s", context))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscriptions := s.getCollection(collectionNotification2Subscriptions)
+	existing := subscriptions.find(func(doc document) bool {
+		return doc["context"] == context &&
+			doc["subscription"] == body["subscription"] &&
+			lookupString(doc, "source.id") == lookupString(body, "source.id")
+	})
+	if len(existing) > 0 {
+		writeError(w, http.StatusConflict, "subscription/Conflict", fmt.Sprintf("Subscription '%s' already exists", lookupString(body, "subscription")))
+		return
+	}
+
+	id := s.newID()
+	body["id"] = id
+	body["self"] = "/notification2/subscriptions/" + id
+	doc := subscriptions.add(body)
+	writeJSON(w, http.StatusCreated, mediaType("subscription"), absolute(r, doc))
+}
+
+func (s *Server) deleteNotification2Subscriptions(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.getCollection(collectionNotification2Subscriptions).removeAll(notification2SubscriptionFilters(r)...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) createNotification2Token(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodeBody(w, r)
+	if !ok || !requireFields(w, "token", body, "subscriber", "subscription") {
+		return
+	}
+	expiresIn := 24 * time.Hour
+	if minutes, ok := body["expiresInMinutes"].(float64); ok && minutes > 0 {
+		expiresIn = time.Duration(minutes) * time.Minute
+	}
+	shared, _ := body["shared"].(bool)
+	token := s.NewNotification2Token(lookupString(body, "subscriber"), lookupString(body, "subscription"), shared, expiresIn)
+	writeJSON(w, http.StatusOK, "application/json", document{"token": token})
+}
+
+func (s *Server) unsubscribeNotification2Subscriber(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		writeError(w, http.StatusUnprocessableEntity, "token/Unprocessable Entity", "Following mandatory fields should be included: token")
+		return
+	}
+	s.mu.Lock()
+	s.notification2Unsubscribed = append(s.notification2Unsubscribed, token)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, "application/json", document{"result": "DONE"})
+}
+
+// consumeNotifications sends the published notifications to the consumer. The acknowledgements are ignored
+func (s *Server) consumeNotifications(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	claims := c8y.Notification2TokenClaim{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil {
+		writeError(w, http.StatusUnauthorized, "security/Unauthorized", fmt.Sprintf("Invalid token. %s", err))
+		return
+	}
+
+	upgrader := websocket.Upgrader{}
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	conn := &notification2Connection{
+		Notification2Consumer: Notification2Consumer{
+			Token:        token,
+			Subscriber:   claims.Subscriber,
+			Subscription: claims.Subscription(),
+			Consumer:     r.URL.Query().Get("consumer"),
+			Shared:       claims.IsShared(),
+		},
+		ws:   ws,
+		send: make(chan []byte, notification2SendBuffer),
+	}
+	s.mu.Lock()
+	s.notification2Consumers = append(s.notification2Consumers, conn.Notification2Consumer)
+	s.notification2Connections = append(s.notification2Connections, conn)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.notification2Connections = slices.DeleteFunc(s.notification2Connections, func(c *notification2Connection) bool {
+			return c == conn
+		})
+	}()
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case frame := <-conn.send:
+			if err := ws.WriteMessage(websocket.TextMessage, frame); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// Package c8ytest provides an in-memory fake Cumulocity server which can be used to unit test code
+// which uses the go-c8y client without requiring a Cumulocity tenant.
+//
+// The server emulates the core REST APIs (inventory, identity, measurements and measurement series, events,
+// alarms, operations, tenant options, users, applications, inventory and event binaries and notification2
+// subscriptions) including the pagination statistics and the error responses returned by the platform. Notifications can be sent to the
+// notification2 consumers which are connected to the server using PublishNotification2.
+//
+// Example:
+//
+//	srv := c8ytest.NewServer(c8ytest.Options{})
+//	defer srv.Close()
+//
+//	client := srv.NewClient()
+//	mo, _, err := client.Inventory.Create(ctx, c8y.NewDevice("device01"))
+package c8ytest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reubenmiller/go-c8y/pkg/c8y"
+)
+
+// Default credentials used by the server
+const (
+	DefaultTenant   = "t12345"
+	DefaultUsername = "testuser"
+	DefaultPassword = "testpassword"
+)
+
+// Pagination limits used by the server (same as the platform)
+const (
+	DefaultPageSize = 5
+	MaxPageSize     = 2000
+)
+
+// ErrorInfo link included in all error responses
+const ErrorInfo = "https://cumulocity.com/guides/reference/rest-implementation/#a-name-error-reporting-a-error-reporting"
+
+// Options fake server options
+type Options struct {
+	// Tenant name. Defaults to DefaultTenant
+	Tenant string
+
+	// Username of the user which is allowed to access the server. Defaults to DefaultUsername
+	Username string
+
+	// Password of the user. Defaults to DefaultPassword
+	Password string
+
+	// Token bearer token which is accepted by the server in addition to the basic auth credentials
+	Token string
+
+	// DisableAuth disable the authorization checks
+	DisableAuth bool
+}
+
+// Server in-memory fake Cumulocity server
+type Server struct {
+	*httptest.Server
+
+	Tenant   string
+	Username string
+	Password string
+	Token    string
+
+	disableAuth bool
+
+	mu          sync.Mutex
+	nextID      int
+	collections map[string]*collection
+	binaries    map[string]binaryContent
+
+	// eventBinaries binaries attached to events, by event id
+	eventBinaries map[string]binaryContent
+
+	// notification2 consumers
+	notification2Consumers    []Notification2Consumer
+	notification2Connections  []*notification2Connection
+	notification2Unsubscribed []string
+	notification2Turns        map[string]int
+}
+
+// NewServer starts a new fake Cumulocity server. The server should be closed by
+// the caller when it is no longer needed
+func NewServer(opts Options) *Server {
+	s := &Server{
+		Tenant:      opts.Tenant,
+		Username:    opts.Username,
+		Password:    opts.Password,
+		Token:       opts.Token,
+		disableAuth: opts.DisableAuth,
+	}
+	if s.Tenant == "" {
+		s.Tenant = DefaultTenant
+	}
+	if s.Username == "" {
+		s.Username = DefaultUsername
+	}
+	if s.Password == "" {
+		s.Password = DefaultPassword
+	}
+	s.Reset()
+	s.Server = httptest.NewServer(s.Handler())
+	return s
+}
+
+// NewClient returns a new client which is configured to use the server
+func (s *Server) NewClient() *c8y.Client {
+	client := c8y.NewClient(nil, s.URL, s.Tenant, s.Username, s.Password, true)
+	if s.Token != "" {
+		client.SetToken(s.Token)
+	}
+	return client
+}
+
+// Reset removes all of the data stored in the server
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID = 10000
+	s.collections = map[string]*collection{}
+	s.binaries = map[string]binaryContent{}
+	s.eventBinaries = map[string]binaryContent{}
+	// Disconnect the consumers so that they do not receive notifications published after the reset
+	for _, conn := range s.notification2Connections {
+		conn.ws.Close()
+	}
+	s.notification2Connections = nil
+	s.notification2Consumers = nil
+	s.notification2Unsubscribed = nil
+	s.notification2Turns = map[string]int{}
+
+	// The current user always exists
+	s.getCollection(collectionUsers).add(document{
+		"id":       s.Username,
+		"userName": s.Username,
+		"enabled":  true,
+		"self":     "/user/" + s.Tenant + "/users/" + s.Username,
+	})
+
+	// Default applications which are available in all tenants
+	for _, name := range []string{"administration", "cockpit", "devicemanagement"} {
+		id := s.newID()
+		s.getCollection(collectionApplications).add(document{
+			"id":           id,
+			"self":         "/application/applications/" + id,
+			"name":         name,
+			"key":          name + "-application-key",
+			"contextPath":  name,
+			"type":         "HOSTED",
+			"availability": "MARKET",
+			"owner": document{
+				"self":   "/tenant/tenants/management",
+				"tenant": document{"id": "management"},
+			},
+		})
+	}
+}
+
+// Handler returns the http handler which implements the fake REST API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	s.registerInventory(mux)
+	s.registerIdentity(mux)
+	s.registerMeasurements(mux)
+	s.registerEvents(mux)
+	s.registerAlarms(mux)
+	s.registerOperations(mux)
+	s.registerTenant(mux)
+	s.registerUsers(mux)
+	s.registerApplications(mux)
+	s.registerNotification2(mux)
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "general/notFound", fmt.Sprintf("Resource not found: %s", r.URL.Path))
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Notification2 consumers are authorized using the token in the query parameters
+		if !strings.HasPrefix(r.URL.Path, "/notification2/consumer/") && !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, "security/Unauthorized", "Invalid credentials! : Bad credentials")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.disableAuth {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	if token, found := strings.CutPrefix(auth, "Bearer "); found {
+		return s.Token != "" && token == s.Token
+	}
+	encoded, found := strings.CutPrefix(auth, "Basic ")
+	if !found {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+	username, password, _ := strings.Cut(string(decoded), ":")
+	if tenant, name, found := strings.Cut(username, "/"); found {
+		if tenant != s.Tenant {
+			return false
+		}
+		username = name
+	}
+	return username == s.Username && password == s.Password
+}
+
+// newID returns a new unique id. The lock must be held by the caller
+func (s *Server) newID() string {
+	s.nextID++
+	return strconv.Itoa(s.nextID)
+}
+
+// getCollection returns the collection with the given name, creating it if it does not exist.
+// The lock must be held by the caller
+func (s *Server) getCollection(name string) *collection {
+	if c, ok := s.collections[name]; ok {
+		return c
+	}
+	c := &collection{}
+	s.collections[name] = c
+	return c
+}
+
+func baseURL(r *http.Request) string {
+	if r.TLS != nil {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func mediaType(name string) string {
+	return "application/vnd.com.nsn.cumulocity." + name + "+json;charset=UTF-8;ver=0.9"
+}
+
+func writeJSON(w http.ResponseWriter, status int, contentType string, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response in the same format as the platform
+func writeError(w http.ResponseWriter, status int, errorType string, message string) {
+	writeJSON(w, status, mediaType("error"), c8y.ErrorResponse{
+		ErrorType: errorType,
+		Message:   message,
+		Info:      ErrorInfo,
+	})
+}
+
+func writeNotFound(w http.ResponseWriter, resource string, id string) {
+	writeError(w, http.StatusNotFound, resource+"/Not Found", fmt.Sprintf("Finding %s from database failed : No %s for id '%s'!", resource, resource, id))
+}
+
+// decodeBody decodes the json request body. An error response is written if the body is invalid
+func decodeBody(w http.ResponseWriter, r *http.Request) (document, bool) {
+	doc := document{}
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		writeError(w, http.StatusBadRequest, "general/badRequest", fmt.Sprintf("Could not parse the request body. %s", err))
+		return nil, false
+	}
+	return doc, true
+}
+
+// requireFields checks if the document contains all of the given fields. An error response is written if a field is missing
+func requireFields(w http.ResponseWriter, resource string, doc document, fields ...string) bool {
+	for _, field := range fields {
+		if value, ok := lookup(doc, field); !ok || value == nil || value == "" {
+			writeError(w, http.StatusUnprocessableEntity, resource+"/Unprocessable Entity", fmt.Sprintf("Following mandatory fields should be included: %s", field))
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,322 @@
+package c8ytest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reubenmiller/go-c8y/pkg/c8y"
+	"github.com/reubenmiller/go-c8y/pkg/c8y/binary"
+	"github.com/reubenmiller/go-c8y/pkg/c8y/notification2"
+)
+
+func TestServer_Inventory(t *testing.T) {
+	srv := NewServer(Options{})
+	defer srv.Close()
+	client := srv.NewClient()
+	ctx := context.Background()
+
+	for i := 0; i < 7; i++ {
+		if _, _, err := client.Inventory.Create(ctx, c8y.NewDevice("device01")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, _, err := client.Inventory.Create(ctx, map[string]any{"name": "group01"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	col, _, err := client.Inventory.GetManagedObjects(ctx, &c8y.ManagedObjectOptions{
+		Query: "$filter=(has(c8y_IsDevice) and name eq 'device*') $orderby=name",
+		PaginationOptions: c8y.PaginationOptions{
+			PageSize:       5,
+			WithTotalPages: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := len(col.ManagedObjects); got != 5 {
+		t.Errorf("page size: got %d, want %d", got, 5)
+	}
+	if col.Statistics == nil || col.Statistics.TotalPages == nil || *col.Statistics.TotalPages != 2 {
+		t.Errorf("total pages: got %v, want %d", col.Statistics, 2)
+	}
+	if col.Next == nil || !strings.Contains(*col.Next, "currentPage=2") {
+		t.Errorf("next link: got %v, want link to page 2", col.Next)
+	}
+
+	total := 0
+	for _, err := range c8y.Paginate[c8y.ManagedObject](ctx, client, c8y.RequestOptions{
+		Path:  "inventory/managedObjects",
+		Query: &c8y.ManagedObjectOptions{FragmentType: "c8y_IsDevice"},
+	}, "managedObjects", c8y.PaginateLimits{}) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		total++
+	}
+	if total != 7 {
+		t.Errorf("paginated items: got %d, want %d", total, 7)
+	}
+
+	_, _, err = client.Inventory.GetManagedObject(ctx, "0", nil)
+	if !errors.Is(err, c8y.ErrNotFound) {
+		t.Errorf("missing managed object: got %v, want %v", err, c8y.ErrNotFound)
+	}
+}
+
+func TestServer_DeviceData(t *testing.T) {
+	srv := NewServer(Options{})
+	defer srv.Close()
+	client := srv.NewClient()
+	ctx := context.Background()
+
+	device, _, err := client.Inventory.Create(ctx, c8y.NewDevice("device01"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, _, err := client.Identity.Create(ctx, device.ID, "c8y_Serial", "serial01"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	identity, _, err := client.Identity.GetExternalID(ctx, "c8y_Serial", "serial01")
+	if err != nil || identity.ManagedObject.ID != device.ID {
+		t.Errorf("external id: got %v (err=%v), want %s", identity, err, device.ID)
+	}
+	if _, _, err := client.Identity.Create(ctx, device.ID, "c8y_Serial", "serial01"); !errors.Is(err, c8y.ErrConflict) {
+		t.Errorf("duplicate external id: got %v, want %v", err, c8y.ErrConflict)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, _, err := client.Alarm.Create(ctx, c8y.Alarm{
+			Source:   c8y.NewSource(device.ID),
+			Type:     "c8y_TestAlarm",
+			Text:     "Test alarm",
+			Severity: c8y.AlarmSeverityMajor,
+			Time:     c8y.NewTimestamp(),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	alarms, _, err := client.Alarm.GetAlarms(ctx, &c8y.AlarmCollectionOptions{Source: device.ID, Status: "ACTIVE"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(alarms.Alarms) != 1 || alarms.Alarms[0].Count != 2 {
+		t.Errorf("alarm de-duplication: got %d alarms, want 1 alarm with count 2", len(alarms.Alarms))
+	}
+
+	_, resp, err := client.Event.Create(ctx, c8y.Event{Source: c8y.NewSource(device.ID), Type: "c8y_TestEvent"})
+	if !errors.Is(err, c8y.ErrValidation) || resp.StatusCode() != http.StatusUnprocessableEntity {
+		t.Errorf("invalid event: got %v, want %v", err, c8y.ErrValidation)
+	}
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i, value := range []float64{1.5, 2.5} {
+		timestamp := start.Add(time.Duration(i) * time.Minute)
+		measurement, err := c8y.NewSimpleMeasurementRepresentation(c8y.SimpleMeasurementOptions{
+			SourceID:            device.ID,
+			Timestamp:           &timestamp,
+			Type:                "c8y_Temperature",
+			ValueFragmentType:   "c8y_Temperature",
+			ValueFragmentSeries: "T",
+			Unit:                "C",
+			Value:               value,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, _, err := client.Measurement.Create(ctx, *measurement); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	series, _, err := client.Measurement.GetMeasurementSeries(ctx, &c8y.MeasurementSeriesOptions{
+		Source:    device.ID,
+		Variables: []string{"c8y_Temperature.T"},
+		DateFrom:  start.Add(-time.Minute).Format(time.RFC3339),
+		DateTo:    time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(series.Series) != 1 || series.Series[0].Unit != "C" || len(series.Values) != 2 || series.Values[1].Values[0].SimpleFloat64() != 2.5 {
+		t.Errorf("measurement series: got %+v", series)
+	}
+}
+
+func TestServer_EventBinaries(t *testing.T) {
+	srv := NewServer(Options{})
+	defer srv.Close()
+	client := srv.NewClient()
+	ctx := context.Background()
+
+	device, _, err := client.Inventory.Create(ctx, c8y.NewDevice("device01"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	event, _, err := client.Event.Create(ctx, c8y.Event{
+		Source: c8y.NewSource(device.ID),
+		Type:   "c8y_TestEvent",
+		Text:   "Test event",
+		Time:   c8y.NewTimestamp(),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(file, []byte("file contents"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	binary, _, err := client.Event.CreateBinary(ctx, file, event.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if binary.Source != event.ID || binary.Length != int64(len("file contents")) {
+		t.Errorf("event binary: got %+v", binary)
+	}
+	if _, _, err := client.Event.CreateBinary(ctx, file, event.ID); !errors.Is(err, c8y.ErrConflict) {
+		t.Errorf("duplicate event binary: got %v, want %v", err, c8y.ErrConflict)
+	}
+
+	downloaded, err := client.Event.DownloadBinary(ctx, event.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if contents, _ := os.ReadFile(downloaded); string(contents) != "file contents" {
+		t.Errorf("event binary contents: got %q, want %q", contents, "file contents")
+	}
+
+	if _, err := client.Event.DeleteBinary(ctx, event.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.Event.DownloadBinary(ctx, event.ID); !errors.Is(err, c8y.ErrNotFound) {
+		t.Errorf("deleted event binary: got %v, want %v", err, c8y.ErrNotFound)
+	}
+}
+
+func TestServer_Binaries(t *testing.T) {
+	srv := NewServer(Options{})
+	defer srv.Close()
+	client := srv.NewClient()
+	ctx := context.Background()
+
+	file, err := binary.NewBinaryFile(
+		binary.WithReader(strings.NewReader("file contents")),
+		binary.WithFileProperties("file.txt"),
+		binary.WithGlobal(),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mo, _, err := client.Inventory.CreateBinary(ctx, file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resp, err := client.SendRequest(ctx, c8y.RequestOptions{
+		Method: http.MethodGet,
+		Path:   "inventory/binaries/" + mo.ID,
+		Accept: "*/*",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := string(resp.Body()); got != "file contents" {
+		t.Errorf("binary contents: got %q, want %q", got, "file contents")
+	}
+}
+
+func TestServer_Unauthorized(t *testing.T) {
+	srv := NewServer(Options{})
+	defer srv.Close()
+
+	client := c8y.NewClient(nil, srv.URL, srv.Tenant, srv.Username, "wrong", true)
+	_, _, err := client.Inventory.GetManagedObjects(context.Background(), nil)
+	if !errors.Is(err, c8y.ErrUnauthorized) {
+		t.Errorf("invalid credentials: got %v, want %v", err, c8y.ErrUnauthorized)
+	}
+}
+
+func TestServer_Notification2(t *testing.T) {
+	srv := NewServer(Options{})
+	defer srv.Close()
+	client := srv.NewClient()
+	ctx := context.Background()
+
+	subscription := c8y.Notification2Subscription{
+		Context:      c8y.Notification2ContextManagedObject,
+		Source:       &c8y.Source{ID: "12345"},
+		Subscription: "device12345",
+	}
+	if _, _, err := client.Notification2.CreateSubscription(ctx, "", subscription); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := client.Notification2.CreateSubscription(ctx, "", subscription); !errors.Is(err, c8y.ErrConflict) {
+		t.Errorf("duplicate subscription: got %v, want %v", err, c8y.ErrConflict)
+	}
+
+	token, _, err := client.Notification2.CreateToken(ctx, c8y.Notification2TokenOptions{
+		Subscriber:   "service",
+		Subscription: "device12345",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	claims, err := client.Notification2.ParseToken(token.Token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Subscriber != "service" || claims.Subscription() != "device12345" || claims.Tenant() != srv.Tenant {
+		t.Errorf("token claims: got %+v", claims)
+	}
+
+	notifications, err := client.Notification2.CreateClient(ctx, c8y.Notification2ClientOptions{
+		Token:    token.Token,
+		Consumer: "consumer01",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	messages := make(chan notification2.Message, 1)
+	notifications.Register("*", messages)
+	if err := notifications.Connect(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer notifications.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(srv.Notification2Consumers()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the consumer to connect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := srv.Notification2Consumers()[0]; got.Consumer != "consumer01" || got.Subscriber != "service" {
+		t.Errorf("consumer: got %+v", got)
+	}
+
+	if sent := srv.PublishNotification2("device12345", "measurements", "12345", "CREATE", `{"type":"c8y_Test"}`); sent != 1 {
+		t.Errorf("sent: got %d, want 1", sent)
+	}
+	select {
+	case message := <-messages:
+		if message.SourceID != "12345" || string(message.Payload) != `{"type":"c8y_Test"}` {
+			t.Errorf("message: got %+v", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the notification")
+	}
+
+	// Consumers connected before a reset do not receive any more notifications
+	srv.Reset()
+	if sent := srv.PublishNotification2("device12345", "measurements", "12345", "CREATE", "{}"); sent != 0 {
+		t.Errorf("sent after reset: got %d, want 0", sent)
+	}
+}
@@ -0,0 +1,327 @@
+package c8ytest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Collection names
+const (
+	collectionManagedObjects = "managedObjects"
+	collectionExternalIDs    = "externalIds"
+	collectionMeasurements   = "measurements"
+	collectionEvents         = "events"
+	collectionAlarms         = "alarms"
+	collectionOperations     = "operations"
+	collectionOptions        = "options"
+	collectionUsers          = "users"
+	collectionApplications   = "applications"
+
+	collectionNotification2Subscriptions = "notification2Subscriptions"
+)
+
+// document json object stored by the server
+type document = map[string]any
+
+// filter returns true if the document should be included in the results
+type filter func(document) bool
+
+// collection ordered list of documents
+type collection struct {
+	items []document
+}
+
+func (c *collection) add(doc document) document {
+	c.items = append(c.items, doc)
+	return doc
+}
+
+func (c *collection) index(id string) int {
+	return slices.IndexFunc(c.items, func(doc document) bool {
+		return doc["id"] == id
+	})
+}
+
+func (c *collection) get(id string) (document, bool) {
+	if i := c.index(id); i > -1 {
+		return c.items[i], true
+	}
+	return nil, false
+}
+
+func (c *collection) remove(id string) bool {
+	if i := c.index(id); i > -1 {
+		c.items = slices.Delete(c.items, i, i+1)
+		return true
+	}
+	return false
+}
+
+// removeAll removes all documents matching the filters, and returns the removed documents
+func (c *collection) removeAll(filters ...filter) []document {
+	removed := c.find(filters...)
+	c.items = slices.DeleteFunc(c.items, func(doc document) bool {
+		return matchAll(doc, filters...)
+	})
+	return removed
+}
+
+// find returns all of the documents matching the filters
+func (c *collection) find(filters ...filter) []document {
+	items := make([]document, 0)
+	for _, doc := range c.items {
+		if matchAll(doc, filters...) {
+			items = append(items, doc)
+		}
+	}
+	return items
+}
+
+func matchAll(doc document, filters ...filter) bool {
+	for _, f := range filters {
+		if !f(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns a value using a dot notation path, e.g. source.id
+func lookup(doc document, key string) (any, bool) {
+	var current any = doc
+	for _, part := range strings.Split(key, ".") {
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func lookupString(doc document, key string) string {
+	value, _ := lookup(doc, key)
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// merge sets the top level fragments of the document. Fragments set to null are removed
+func merge(doc document, update document, readOnly ...string) {
+	for key, value := range update {
+		if slices.Contains(readOnly, key) {
+			continue
+		}
+		if value == nil {
+			delete(doc, key)
+			continue
+		}
+		doc[key] = value
+	}
+}
+
+// copyDocument returns a shallow copy of the document so it can be encoded without holding the lock
+func copyDocument(doc document) document {
+	out := make(document, len(doc))
+	for key, value := range doc {
+		out[key] = value
+	}
+	return out
+}
+
+// absolute converts the relative self links of the documents to absolute urls
+func absolute(r *http.Request, doc document) document {
+	out := copyDocument(doc)
+	for key, value := range out {
+		switch v := value.(type) {
+		case string:
+			if key == "self" && strings.HasPrefix(v, "/") {
+				out[key] = baseURL(r) + v
+			}
+		case map[string]any:
+			out[key] = absolute(r, v)
+		case []any:
+			items := make([]any, 0, len(v))
+			for _, item := range v {
+				if obj, ok := item.(map[string]any); ok {
+					items = append(items, absolute(r, obj))
+				} else {
+					items = append(items, item)
+				}
+			}
+			out[key] = items
+		}
+	}
+	return out
+}
+
+// Query parameter filters
+
+// queryValues returns all of the values of a query parameter. Comma separated values are split
+func queryValues(query url.Values, key string) []string {
+	values := make([]string, 0)
+	for _, value := range query[key] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+// equalsFilter adds a filter which checks if the document's property matches one of the values of the query parameter
+func equalsFilter(filters []filter, query url.Values, param string, property string) []filter {
+	values := queryValues(query, param)
+	if len(values) == 0 {
+		return filters
+	}
+	return append(filters, func(doc document) bool {
+		value := lookupString(doc, property)
+		return slices.ContainsFunc(values, func(v string) bool {
+			return strings.EqualFold(v, value)
+		})
+	})
+}
+
+// fragmentFilter adds a filter which checks if the document has the fragment given by the query parameter
+func fragmentFilter(filters []filter, query url.Values, param string) []filter {
+	fragment := query.Get(param)
+	if fragment == "" {
+		return filters
+	}
+	return append(filters, func(doc document) bool {
+		_, ok := doc[fragment]
+		return ok
+	})
+}
+
+// dateFilter adds a filter which checks if the document's time is within the dateFrom and dateTo query parameters
+func dateFilter(filters []filter, query url.Values, property string) ([]filter, error) {
+	for _, param := range []string{"dateFrom", "dateTo"} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		limit, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s. %w", param, err)
+		}
+		after := param == "dateFrom"
+		filters = append(filters, func(doc document) bool {
+			t, err := time.Parse(time.RFC3339, lookupString(doc, property))
+			if err != nil {
+				return false
+			}
+			if after {
+				return !t.Before(limit)
+			}
+			return t.Before(limit)
+		})
+	}
+	return filters, nil
+}
+
+// sortByTime sorts the documents by the given time property. Documents with the same time are sorted by creation order
+func sortByTime(items []document, property string, descending bool) {
+	slices.SortStableFunc(items, func(a, b document) int {
+		ta, _ := time.Parse(time.RFC3339, lookupString(a, property))
+		tb, _ := time.Parse(time.RFC3339, lookupString(b, property))
+		c := ta.Compare(tb)
+		if c == 0 {
+			ia, _ := strconv.Atoi(lookupString(a, "id"))
+			ib, _ := strconv.Atoi(lookupString(b, "id"))
+			c = ia - ib
+		}
+		if descending {
+			return -c
+		}
+		return c
+	})
+}
+
+// writeCollection writes a page of the documents using the pagination query parameters
+// (pageSize, currentPage, withTotalPages and withTotalElements)
+func writeCollection(w http.ResponseWriter, r *http.Request, contentType string, property string, items []document) {
+	query := r.URL.Query()
+
+	pageSize := DefaultPageSize
+	if v := query.Get("pageSize"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 0 {
+			writeError(w, http.StatusUnprocessableEntity, "general/Unprocessable Entity", fmt.Sprintf("Invalid pageSize: %s", v))
+			return
+		}
+		if size > MaxPageSize {
+			writeError(w, http.StatusUnprocessableEntity, "general/Unprocessable Entity", fmt.Sprintf("The pageSize must be less than or equal to %d", MaxPageSize))
+			return
+		}
+		pageSize = size
+	}
+
+	currentPage := 1
+	if v := query.Get("currentPage"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			writeError(w, http.StatusUnprocessableEntity, "general/Unprocessable Entity", fmt.Sprintf("Invalid currentPage: %s", v))
+			return
+		}
+		currentPage = page
+	}
+
+	start := min((currentPage-1)*pageSize, len(items))
+	end := min(start+pageSize, len(items))
+
+	page := make([]any, 0, end-start)
+	for _, doc := range items[start:end] {
+		page = append(page, absolute(r, doc))
+	}
+
+	statistics := document{
+		"pageSize":    pageSize,
+		"currentPage": currentPage,
+	}
+	if query.Get("withTotalPages") == "true" {
+		totalPages := 0
+		if pageSize > 0 {
+			totalPages = (len(items) + pageSize - 1) / pageSize
+		}
+		statistics["totalPages"] = totalPages
+	}
+	if query.Get("withTotalElements") == "true" {
+		statistics["totalElements"] = len(items)
+	}
+
+	pageURL := func(page int) string {
+		q := r.URL.Query()
+		q.Set("pageSize", strconv.Itoa(pageSize))
+		q.Set("currentPage", strconv.Itoa(page))
+		return baseURL(r) + path.Clean(r.URL.Path) + "?" + q.Encode()
+	}
+
+	body := document{
+		"self":       pageURL(currentPage),
+		"statistics": statistics,
+		property:     page,
+	}
+	if pageSize > 0 && len(page) == pageSize {
+		body["next"] = pageURL(currentPage + 1)
+	}
+	if currentPage > 1 {
+		body["prev"] = pageURL(currentPage - 1)
+	}
+	writeJSON(w, http.StatusOK, contentType, body)
+}
@@ -0,0 +1,167 @@
+package c8ytest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Tenant options with a key starting with this prefix are encrypted, and the value is not returned
+const encryptedOptionPrefix = "credentials."
+
+func (s *Server) registerTenant(mux *http.ServeMux) {
+	mux.HandleFunc("GET /tenant/currentTenant", s.getCurrentTenant)
+
+	mux.HandleFunc("GET /tenant/options", s.getTenantOptions)
+	mux.HandleFunc("POST /tenant/options", s.createTenantOption)
+	mux.HandleFunc("GET /tenant/options/{category}", s.getTenantOptionsForCategory)
+	mux.HandleFunc("PUT /tenant/options/{category}", s.updateTenantOptionsForCategory)
+	mux.HandleFunc("GET /tenant/options/{category}/{key}", s.getTenantOption)
+	mux.HandleFunc("PUT /tenant/options/{category}/{key}", s.updateTenantOption)
+	mux.HandleFunc("DELETE /tenant/options/{category}/{key}", s.deleteTenantOption)
+}
+
+func (s *Server) getCurrentTenant(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, mediaType("currentTenant"), document{
+		"name":               s.Tenant,
+		"domainName":         r.Host,
+		"allowCreateTenants": false,
+		"customProperties":   document{},
+		"applications": document{
+			"self":       baseURL(r) + "/tenant/tenants/" + s.Tenant + "/applications",
+			"references": []any{},
+		},
+	})
+}
+
+func tenantOptionKey(category string, key string) string {
+	return category + "/" + key
+}
+
+// tenantOptionResponse returns the tenant option representation. The value of encrypted options is not returned
+func tenantOptionResponse(r *http.Request, doc document) document {
+	out := absolute(r, doc)
+	delete(out, "id")
+	if strings.HasPrefix(lookupString(doc, "key"), encryptedOptionPrefix) {
+		out["value"] = "<<Encrypted>>"
+	}
+	return out
+}
+
+// setTenantOption creates or updates a tenant option. The lock must be held by the caller
+func (s *Server) setTenantOption(category string, key string, value string) document {
+	options := s.getCollection(collectionOptions)
+	id := tenantOptionKey(category, key)
+	if doc, ok := options.get(id); ok {
+		doc["value"] = value
+		return doc
+	}
+	return options.add(document{
+		"id":       id,
+		"category": category,
+		"key":      key,
+		"value":    value,
+		"self":     "/tenant/options/" + id,
+	})
+}
+
+func writeTenantOptionNotFound(w http.ResponseWriter, category string, key string) {
+	writeError(w, http.StatusNotFound, "options/Not Found", fmt.Sprintf("Unable to find option by given key: %s/%s", category, key))
+}
+
+func (s *Server) getTenantOptions(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make([]document, 0)
+	for _, doc := range s.getCollection(collectionOptions).items {
+		items = append(items, tenantOptionResponse(r, doc))
+	}
+	writeCollection(w, r, mediaType("optionCollection"), "options", items)
+}
+
+func (s *Server) createTenantOption(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodeBody(w, r)
+	if !ok || !requireFields(w, "options", body, "category", "key", "value") {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc := s.setTenantOption(lookupString(body, "category"), lookupString(body, "key"), lookupString(body, "value"))
+	writeJSON(w, http.StatusOK, mediaType("option"), tenantOptionResponse(r, doc))
+}
+
+// categoryOptions returns the options of a category as a key/value map. The lock must be held by the caller
+func (s *Server) categoryOptions(category string) document {
+	out := document{}
+	for _, doc := range s.getCollection(collectionOptions).find(func(doc document) bool {
+		return doc["category"] == category
+	}) {
+		key := lookupString(doc, "key")
+		if strings.HasPrefix(key, encryptedOptionPrefix) {
+			out[key] = "<<Encrypted>>"
+		} else {
+			out[key] = doc["value"]
+		}
+	}
+	return out
+}
+
+func (s *Server) getTenantOptionsForCategory(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, "application/json", s.categoryOptions(r.PathValue("category")))
+}
+
+func (s *Server) updateTenantOptionsForCategory(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodeBody(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	category := r.PathValue("category")
+	for key, value := range body {
+		s.setTenantOption(category, key, fmt.Sprintf("%v", value))
+	}
+	writeJSON(w, http.StatusOK, "application/json", s.categoryOptions(category))
+}
+
+func (s *Server) getTenantOption(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	category, key := r.PathValue("category"), r.PathValue("key")
+	doc, ok := s.getCollection(collectionOptions).get(tenantOptionKey(category, key))
+	if !ok {
+		writeTenantOptionNotFound(w, category, key)
+		return
+	}
+	writeJSON(w, http.StatusOK, mediaType("option"), tenantOptionResponse(r, doc))
+}
+
+func (s *Server) updateTenantOption(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodeBody(w, r)
+	if !ok || !requireFields(w, "options", body, "value") {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc := s.setTenantOption(r.PathValue("category"), r.PathValue("key"), lookupString(body, "value"))
+	writeJSON(w, http.StatusOK, mediaType("option"), tenantOptionResponse(r, doc))
+}
+
+func (s *Server) deleteTenantOption(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	category, key := r.PathValue("category"), r.PathValue("key")
+	if !s.getCollection(collectionOptions).remove(tenantOptionKey(category, key)) {
+		writeTenantOptionNotFound(w, category, key)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
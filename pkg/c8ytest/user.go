@@ -0,0 +1,171 @@
+package c8ytest
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func (s *Server) registerUsers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /user/currentUser", s.getCurrentUser)
+	mux.HandleFunc("PUT /user/currentUser", s.updateCurrentUser)
+	mux.HandleFunc("GET /user/{tenant}/users", s.getUsers)
+	mux.HandleFunc("POST /user/{tenant}/users", s.createUser)
+	mux.HandleFunc("GET /user/{tenant}/users/{id}", s.getUser)
+	mux.HandleFunc("PUT /user/{tenant}/users/{id}", s.updateUser)
+	mux.HandleFunc("DELETE /user/{tenant}/users/{id}", s.deleteUser)
+	mux.HandleFunc("GET /user/{tenant}/userByName/{id}", s.getUser)
+}
+
+// userResponse returns the user representation. The password is never returned
+func userResponse(r *http.Request, doc document) document {
+	out := absolute(r, doc)
+	delete(out, "password")
+	return out
+}
+
+func writeUserNotFound(w http.ResponseWriter, id string) {
+	writeError(w, http.StatusNotFound, "user/Not Found", fmt.Sprintf("User with id = %s not found.", id))
+}
+
+// checkTenant checks if the tenant in the path is the current tenant. An error response is written if not
+func (s *Server) checkTenant(w http.ResponseWriter, r *http.Request) bool {
+	if tenant := r.PathValue("tenant"); tenant != s.Tenant {
+		writeError(w, http.StatusNotFound, "tenant/Not Found", fmt.Sprintf("Tenant with id = %s not found.", tenant))
+		return false
+	}
+	return true
+}
+
+func (s *Server) getCurrentUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.getCollection(collectionUsers).get(s.Username)
+	if !ok {
+		writeUserNotFound(w, s.Username)
+		return
+	}
+	out := userResponse(r, doc)
+	out["self"] = baseURL(r) + "/user/currentUser"
+	writeJSON(w, http.StatusOK, mediaType("currentUser"), out)
+}
+
+func (s *Server) updateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	update, ok := decodeBody(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.getCollection(collectionUsers).get(s.Username)
+	if !ok {
+		writeUserNotFound(w, s.Username)
+		return
+	}
+	merge(doc, update, "id", "self", "userName")
+	out := userResponse(r, doc)
+	out["self"] = baseURL(r) + "/user/currentUser"
+	writeJSON(w, http.StatusOK, mediaType("currentUser"), out)
+}
+
+func (s *Server) getUsers(w http.ResponseWriter, r *http.Request) {
+	if !s.checkTenant(w, r) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := r.URL.Query()
+	filters := make([]filter, 0)
+	filters = equalsFilter(filters, query, "username", "userName")
+	items := make([]document, 0)
+	for _, doc := range s.getCollection(collectionUsers).find(filters...) {
+		items = append(items, userResponse(r, doc))
+	}
+	writeCollection(w, r, mediaType("userCollection"), "users", items)
+}
+
+func (s *Server) createUser(w http.ResponseWriter, r *http.Request) {
+	if !s.checkTenant(w, r) {
+		return
+	}
+	body, ok := decodeBody(w, r)
+	if !ok || !requireFields(w, "user", body, "userName") {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	username := lookupString(body, "userName")
+	users := s.getCollection(collectionUsers)
+	if _, exists := users.get(username); exists {
+		writeError(w, http.StatusConflict, "user/Duplicate", fmt.Sprintf("User with username '%s' already exists.", username))
+		return
+	}
+	body["id"] = username
+	body["self"] = "/user/" + s.Tenant + "/users/" + username
+	if _, ok := body["enabled"]; !ok {
+		body["enabled"] = true
+	}
+	doc := users.add(body)
+	writeJSON(w, http.StatusCreated, mediaType("user"), userResponse(r, doc))
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request) {
+	if !s.checkTenant(w, r) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	doc, ok := s.getCollection(collectionUsers).get(id)
+	if !ok {
+		writeUserNotFound(w, id)
+		return
+	}
+	writeJSON(w, http.StatusOK, mediaType("user"), userResponse(r, doc))
+}
+
+func (s *Server) updateUser(w http.ResponseWriter, r *http.Request) {
+	if !s.checkTenant(w, r) {
+		return
+	}
+	update, ok := decodeBody(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	doc, ok := s.getCollection(collectionUsers).get(id)
+	if !ok {
+		writeUserNotFound(w, id)
+		return
+	}
+	merge(doc, update, "id", "self", "userName")
+	writeJSON(w, http.StatusOK, mediaType("user"), userResponse(r, doc))
+}
+
+func (s *Server) deleteUser(w http.ResponseWriter, r *http.Request) {
+	if !s.checkTenant(w, r) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	if !s.getCollection(collectionUsers).remove(id) {
+		writeUserNotFound(w, id)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
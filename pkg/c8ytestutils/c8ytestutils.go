@@ -9,28 +9,61 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/reubenmiller/go-c8y/internal/pkg/testingutils"
 	"github.com/reubenmiller/go-c8y/pkg/c8y"
+	"github.com/reubenmiller/go-c8y/pkg/c8ytest"
 	"github.com/reubenmiller/go-c8y/pkg/microservice"
 	"github.com/spf13/viper"
 )
 
 var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 
+var (
+	randomMu sync.Mutex
+	random   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
 func randSeq(n int) string {
+	randomMu.Lock()
+	defer randomMu.Unlock()
 	b := make([]rune, n)
 	for i := range b {
-		b[i] = letters[rand.Intn(len(letters))]
+		b[i] = letters[random.Intn(len(letters))]
 	}
 	return string(b)
 }
 
+// Environment variables used to record and replay the requests of the test clients
+const (
+	// EnvRecorderMode recorder mode: record, replay or replay-only. The recorder is disabled if not set
+	EnvRecorderMode = "C8Y_RECORDER_MODE"
+
+	// EnvRecorderCassette path to the cassette file. Defaults to testdata/cassette.json
+	EnvRecorderCassette = "C8Y_RECORDER_CASSETTE"
+
+	// EnvFakeServer use an in-memory fake server (see the c8ytest package) instead of a Cumulocity tenant when set to true
+	EnvFakeServer = "C8Y_FAKE_SERVER"
+)
+
 // NewTestSetup return a new setup environment
 func NewTestSetup() *SetupConfiguration {
 	setup := &SetupConfiguration{}
 	setup.Devices = make([]c8y.ManagedObject, 0)
 	setup.Microservices = make([]*microservice.Microservice, 0)
+
+	if os.Getenv(EnvRecorderMode) != "" {
+		// Random values (e.g. device names) must be the same when recording and replaying
+		randomMu.Lock()
+		random = rand.New(rand.NewSource(1))
+		randomMu.Unlock()
+		testingutils.SetSeed(1)
+	}
+
+	if strings.EqualFold(os.Getenv(EnvFakeServer), "true") {
+		setup.server = c8ytest.NewServer(c8ytest.Options{})
+	}
 	return setup
 
 }
@@ -41,6 +74,14 @@ type SetupConfiguration struct {
 	Devices         []c8y.ManagedObject
 	Microservices   []*microservice.Microservice
 	BootstrapClient *c8y.Client
+
+	recorder *c8y.Recorder
+	server   *c8ytest.Server
+}
+
+// FakeServer returns the in-memory fake server used by the test clients, or nil if a Cumulocity tenant is used
+func (s *SetupConfiguration) FakeServer() *c8ytest.Server {
+	return s.server
 }
 
 func WithCompression(enable bool) c8y.ClientOption {
@@ -52,6 +93,10 @@ func WithCompression(enable bool) c8y.ClientOption {
 
 // NewClient returns a new test client
 func (s *SetupConfiguration) NewClient() *c8y.Client {
+	if s.server != nil {
+		return s.server.NewClient()
+	}
+
 	config := readConfig()
 
 	host := config.GetString("c8y.host")
@@ -62,9 +107,13 @@ func (s *SetupConfiguration) NewClient() *c8y.Client {
 
 	log.Printf("Host=%s, Tenant=%s, Username=%s, Password=%s\n", host, tenant, username, password)
 
-	httpClient := c8y.NewHTTPClient(
+	opts := []c8y.ClientOption{
 		WithCompression(false),
-	)
+	}
+	if recorder := s.getRecorder(config); recorder != nil {
+		opts = append(opts, recorder.ClientOption())
+	}
+	httpClient := c8y.NewHTTPClient(opts...)
 	client := c8y.NewClient(httpClient, host, tenant, username, password, false)
 
 	if token != "" {
@@ -73,6 +122,42 @@ func (s *SetupConfiguration) NewClient() *c8y.Client {
 	return client
 }
 
+// getRecorder returns the recorder shared by all test clients, or nil if recording is not enabled
+func (s *SetupConfiguration) getRecorder(config *viper.Viper) *c8y.Recorder {
+	value := os.Getenv(EnvRecorderMode)
+	if value == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.recorder != nil {
+		return s.recorder
+	}
+
+	mode, err := c8y.ParseRecorderMode(value)
+	if err != nil {
+		log.Fatalf("Invalid recorder mode. %s", err)
+	}
+	cassette := os.Getenv(EnvRecorderCassette)
+	if cassette == "" {
+		cassette = "testdata/cassette.json"
+	}
+
+	sensitiveValues := c8y.NewClient(nil, config.GetString("c8y.host"), config.GetString("c8y.tenant"), config.GetString("c8y.username"), config.GetString("c8y.password"), false)
+	sensitiveValues.Token = config.GetString("c8y.token")
+
+	recorder, err := c8y.NewRecorder(cassette, c8y.RecorderOptions{
+		Mode:            mode,
+		SensitiveValues: sensitiveValues.SensitiveValues,
+	})
+	if err != nil {
+		log.Fatalf("Could not create recorder. %s", err)
+	}
+	s.recorder = recorder
+	return recorder
+}
+
 func readConfig() *viper.Viper {
 	// Read configuration
 	config := viper.New()
@@ -88,6 +173,14 @@ func readConfig() *viper.Viper {
 	config.SetDefault("report.concurrency", 20)
 	config.SetDefault("log.file", "application.log")
 
+	// No server or credentials are required when only replaying recorded requests
+	if mode, err := c8y.ParseRecorderMode(os.Getenv(EnvRecorderMode)); err == nil && mode == c8y.RecorderModeReplayOnly {
+		config.SetDefault("c8y.host", "https://replay.c8y.invalid")
+		config.SetDefault("c8y.tenant", "t0")
+		config.SetDefault("c8y.username", "replay")
+		config.SetDefault("c8y.password", "replay")
+	}
+
 	// Enable all variables to be defined as (case-sensitive) environment variables in the form of
 	config.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	config.AutomaticEnv()
@@ -261,6 +354,10 @@ func (s *SetupConfiguration) Cleanup() {
 			log.Printf("Failed to delete microservice application. %s", err)
 		}
 	}
+
+	if s.server != nil {
+		s.server.Close()
+	}
 }
 
 // NewRandomTestDevice create a new random test device to be used in a test
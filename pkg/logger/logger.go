@@ -69,10 +69,15 @@ func NewDummyLogger(name string) *Log {
 	}
 }
 
+// NewLogger returns a new named logger. The logger set via SetDefault is used if present,
+// otherwise the messages are written using go-logging
 func NewLogger(name string) Logger {
 	goLogger := logging.MustGetLogger(name)
-	return &Log{
-		Logger: goLogger,
+	return &namedLogger{
+		name: name,
+		fallback: &Log{
+			Logger: goLogger,
+		},
 	}
 }
 
@@ -0,0 +1,211 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LevelFatal is the slog level used for fatal log messages
+const LevelFatal = slog.LevelError + 4
+
+// StructuredLogger is implemented by loggers which support structured attributes
+type StructuredLogger interface {
+	LogAttrs(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr)
+}
+
+// SlogLogger is a Logger backed by a log/slog logger
+type SlogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a new Logger which writes to the given slog logger.
+// If l is nil, then slog.Default() is used
+func NewSlogLogger(l *slog.Logger) *SlogLogger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &SlogLogger{
+		logger: l,
+	}
+}
+
+// Slog returns the underlying slog logger
+func (l *SlogLogger) Slog() *slog.Logger {
+	return l.logger
+}
+
+// With returns a new logger which includes the given attributes in each log message
+func (l *SlogLogger) With(args ...any) *SlogLogger {
+	return &SlogLogger{
+		logger: l.logger.With(args...),
+	}
+}
+
+// Named returns a new logger which includes the logger name in each log message
+func (l *SlogLogger) Named(name string) Logger {
+	return l.With(slog.String("logger", name))
+}
+
+// LogAttrs writes a structured log message
+func (l *SlogLogger) LogAttrs(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	record := slog.NewRecord(time.Now(), level, msg, 0)
+	record.AddAttrs(attrs...)
+	_ = l.logger.Handler().Handle(ctx, record)
+}
+
+func (l *SlogLogger) Debugf(format string, args ...interface{}) {
+	l.LogAttrs(context.Background(), slog.LevelDebug, fmt.Sprintf(format, args...))
+}
+
+func (l *SlogLogger) Debug(args ...interface{}) {
+	l.LogAttrs(context.Background(), slog.LevelDebug, fmt.Sprint(args...))
+}
+
+func (l *SlogLogger) Infof(format string, args ...interface{}) {
+	l.LogAttrs(context.Background(), slog.LevelInfo, fmt.Sprintf(format, args...))
+}
+
+func (l *SlogLogger) Info(args ...interface{}) {
+	l.LogAttrs(context.Background(), slog.LevelInfo, fmt.Sprint(args...))
+}
+
+func (l *SlogLogger) Warnf(format string, args ...interface{}) {
+	l.LogAttrs(context.Background(), slog.LevelWarn, fmt.Sprintf(format, args...))
+}
+
+func (l *SlogLogger) Warn(args ...interface{}) {
+	l.LogAttrs(context.Background(), slog.LevelWarn, fmt.Sprint(args...))
+}
+
+func (l *SlogLogger) Errorf(format string, args ...interface{}) {
+	l.LogAttrs(context.Background(), slog.LevelError, fmt.Sprintf(format, args...))
+}
+
+func (l *SlogLogger) Error(args ...interface{}) {
+	l.LogAttrs(context.Background(), slog.LevelError, fmt.Sprint(args...))
+}
+
+// Fatalf logs the message and exits the process with exit code 1
+func (l *SlogLogger) Fatalf(format string, args ...interface{}) {
+	l.LogAttrs(context.Background(), LevelFatal, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// Fatal logs the message and exits the process with exit code 1
+func (l *SlogLogger) Fatal(args ...interface{}) {
+	l.LogAttrs(context.Background(), LevelFatal, fmt.Sprint(args...))
+	os.Exit(1)
+}
+
+// LogAttrs writes a structured log message to the given logger. If the logger does
+// not support structured attributes, then the attributes are appended to the message
+// as key=value pairs. Fatal messages are logged as errors and never exit the process
+func LogAttrs(l Logger, ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if l == nil {
+		return
+	}
+	if sl, ok := l.(StructuredLogger); ok {
+		sl.LogAttrs(ctx, level, msg, attrs...)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, attr := range attrs {
+		b.WriteByte(' ')
+		b.WriteString(attr.String())
+	}
+	switch {
+	case level >= slog.LevelError:
+		l.Error(b.String())
+	case level >= slog.LevelWarn:
+		l.Warn(b.String())
+	case level >= slog.LevelInfo:
+		l.Info(b.String())
+	default:
+		l.Debug(b.String())
+	}
+}
+
+type defaultHolder struct {
+	logger Logger
+}
+
+var defaultLogger atomic.Pointer[defaultHolder]
+
+// SetDefault sets the logger used by all packages (c8y, realtime, notification2 and microservice) which
+// use a logger created with NewLogger. Use nil to restore the default go-logging loggers
+//
+// Example:
+//
+//	logger.SetDefault(logger.NewSlogLogger(slog.Default()))
+func SetDefault(l Logger) {
+	if l == nil {
+		defaultLogger.Store(nil)
+		return
+	}
+	defaultLogger.Store(&defaultHolder{logger: l})
+}
+
+// Default returns the logger set by SetDefault, or nil if no logger has been set
+func Default() Logger {
+	if v := defaultLogger.Load(); v != nil {
+		return v.logger
+	}
+	return nil
+}
+
+// namedLogger uses the default logger (see SetDefault) if set, otherwise it uses its own go-logging logger
+type namedLogger struct {
+	name     string
+	fallback Logger
+
+	mu      sync.Mutex
+	parent  *defaultHolder
+	derived Logger
+}
+
+func (n *namedLogger) get() Logger {
+	holder := defaultLogger.Load()
+	if holder == nil {
+		return n.fallback
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.parent != holder {
+		n.parent = holder
+		n.derived = holder.logger
+		if named, ok := holder.logger.(interface{ Named(string) Logger }); ok {
+			n.derived = named.Named(n.name)
+		}
+	}
+	return n.derived
+}
+
+func (n *namedLogger) LogAttrs(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	LogAttrs(n.get(), ctx, level, msg, attrs...)
+}
+
+func (n *namedLogger) Debugf(format string, args ...interface{}) { n.get().Debugf(format, args...) }
+func (n *namedLogger) Debug(args ...interface{})                 { n.get().Debug(args...) }
+func (n *namedLogger) Infof(format string, args ...interface{})  { n.get().Infof(format, args...) }
+func (n *namedLogger) Info(args ...interface{})                  { n.get().Info(args...) }
+func (n *namedLogger) Warnf(format string, args ...interface{})  { n.get().Warnf(format, args...) }
+func (n *namedLogger) Warn(args ...interface{})                  { n.get().Warn(args...) }
+func (n *namedLogger) Errorf(format string, args ...interface{}) { n.get().Errorf(format, args...) }
+func (n *namedLogger) Error(args ...interface{})                 { n.get().Error(args...) }
+func (n *namedLogger) Fatalf(format string, args ...interface{}) { n.get().Fatalf(format, args...) }
+func (n *namedLogger) Fatal(args ...interface{})                 { n.get().Fatal(args...) }
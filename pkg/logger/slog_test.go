@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func newTestSlogLogger(buf *bytes.Buffer) *SlogLogger {
+	return NewSlogLogger(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+}
+
+func TestSlogLogger_StructuredAttributes(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := newTestSlogLogger(buf)
+
+	LogAttrs(l, context.Background(), slog.LevelInfo, "Received response", slog.String("method", "GET"), slog.Int("status", 200))
+
+	entry := map[string]any{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if entry["msg"] != "Received response" || entry["method"] != "GET" || entry["status"] != float64(200) {
+		t.Errorf("entry: got %v", entry)
+	}
+}
+
+func TestSetDefault_NamedLoggers(t *testing.T) {
+	buf := &bytes.Buffer{}
+	named := NewLogger("c8y")
+
+	SetDefault(newTestSlogLogger(buf))
+	defer SetDefault(nil)
+
+	named.Infof("Sending request %d", 1)
+	if !strings.Contains(buf.String(), `"msg":"Sending request 1"`) || !strings.Contains(buf.String(), `"logger":"c8y"`) {
+		t.Errorf("named logger should use the default logger: got %s", buf.String())
+	}
+
+	buf.Reset()
+	SetDefault(nil)
+	named.Infof("Not written to the default logger")
+	if buf.Len() != 0 {
+		t.Errorf("default logger should not be used after it has been reset: got %s", buf.String())
+	}
+}
+
+type recordingLogger struct {
+	*Log
+	messages []string
+}
+
+func (l *recordingLogger) Warn(args ...interface{}) {
+	l.messages = append(l.messages, args[0].(string))
+}
+
+func TestLogAttrs_FallbackFormatting(t *testing.T) {
+	l := &recordingLogger{Log: NewDummyLogger("test")}
+	LogAttrs(l, context.Background(), slog.LevelWarn, "Request failed", slog.String("method", "GET"), slog.Int("attempts", 3))
+
+	if len(l.messages) != 1 || l.messages[0] != "Request failed method=GET attempts=3" {
+		t.Errorf("messages: got %v", l.messages)
+	}
+}
@@ -1,16 +1,22 @@
 package microservice
 
 import (
+	"context"
 	"io"
+	"log/slog"
 	"os"
+	"sort"
 
+	"github.com/reubenmiller/go-c8y/pkg/logger"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	lumberjack "gopkg.in/natefinch/lumberjack.v2"
 )
 
-// ConfigureLogger setups the logger with log rotation
-func ConfigureLogger(logger *zap.Logger, logPath string) {
+// ConfigureLogger setups the logger with log rotation.
+// If no zap logger is provided and a default logger has been set using logger.SetDefault, then
+// all log messages are forwarded to the default logger instead.
+func ConfigureLogger(zapLogger *zap.Logger, logPath string) {
 	if logPath == "" {
 		logPath = "microservice_bootstrap.log"
 	}
@@ -64,8 +70,12 @@ func ConfigureLogger(logger *zap.Logger, logPath string) {
 		),
 	)
 
-	if logger == nil {
-		logger = zap.New(core)
+	if zapLogger == nil {
+		if defaultLogger := logger.Default(); defaultLogger != nil {
+			zapLogger = zap.New(newLoggerCore(defaultLogger, zap.DebugLevel))
+		} else {
+			zapLogger = zap.New(core)
+		}
 	}
 
 	//
@@ -75,8 +85,79 @@ func ConfigureLogger(logger *zap.Logger, logPath string) {
 	// zap.L().Infof("Example output %s", "1")
 	//
 	// Redirect log messages
-	zap.RedirectStdLog(logger)
-	zap.ReplaceGlobals(logger)
+	zap.RedirectStdLog(zapLogger)
+	zap.ReplaceGlobals(zapLogger)
 
-	defer logger.Sync() // flushes buffer, if any
+	defer zapLogger.Sync() // flushes buffer, if any
+}
+
+// loggerCore is a zap core which forwards all entries to a logger.Logger
+type loggerCore struct {
+	zapcore.LevelEnabler
+	logger logger.Logger
+	fields []zapcore.Field
+}
+
+func newLoggerCore(l logger.Logger, level zapcore.LevelEnabler) zapcore.Core {
+	return &loggerCore{
+		LevelEnabler: level,
+		logger:       l,
+	}
+}
+
+func (c *loggerCore) With(fields []zapcore.Field) zapcore.Core {
+	return &loggerCore{
+		LevelEnabler: c.LevelEnabler,
+		logger:       c.logger,
+		fields:       append(append([]zapcore.Field{}, c.fields...), fields...),
+	}
+}
+
+func (c *loggerCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *loggerCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range c.fields {
+		field.AddTo(enc)
+	}
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+
+	keys := make([]string, 0, len(enc.Fields))
+	for key := range enc.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]slog.Attr, 0, len(keys)+1)
+	if entry.LoggerName != "" {
+		attrs = append(attrs, slog.String("logger", entry.LoggerName))
+	}
+	for _, key := range keys {
+		attrs = append(attrs, slog.Any(key, enc.Fields[key]))
+	}
+
+	level := slog.LevelError
+	switch entry.Level {
+	case zapcore.DebugLevel:
+		level = slog.LevelDebug
+	case zapcore.InfoLevel:
+		level = slog.LevelInfo
+	case zapcore.WarnLevel:
+		level = slog.LevelWarn
+	case zapcore.FatalLevel:
+		level = logger.LevelFatal
+	}
+	logger.LogAttrs(c.logger, context.Background(), level, entry.Message, attrs...)
+	return nil
+}
+
+func (c *loggerCore) Sync() error {
+	return nil
 }
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
 
@@ -159,8 +158,8 @@ func (s *RealtimeClientCache) LoadOrNewClient(user c8y.ServiceUser) (*c8y.Realti
 
 // GetClient returns a realtime client if it already exists in the cache. If no realtime client already exists for the service user, then an error is returned
 func (s *RealtimeClientCache) GetClient(user c8y.ServiceUser) (*c8y.RealtimeClient, error) {
-	log.Printf("Get realtime client for tenant %s", user.Tenant)
-	log.Printf("Total realtime clients in cache %d", len(s.clients))
+	zap.S().Debugf("Get realtime client for tenant %s", user.Tenant)
+	zap.S().Debugf("Total realtime clients in cache %d", len(s.clients))
 	if v, ok := s.clients[user.Tenant]; ok {
 		return v, nil
 	}
@@ -2,7 +2,6 @@ package microservice
 
 import (
 	"fmt"
-	"log"
 	"strings"
 	"time"
 
@@ -177,7 +176,7 @@ func (m *Microservice) RegisterMicroserviceAgent() error {
 
 		for _, key := range m.Config.viper.AllKeys() {
 			value := m.Config.viper.GetString(key)
-			log.Printf("property: %s=%s", key, value)
+			zap.S().Debugf("property: %s=%s", key, value)
 		}
 
 		m.StartOperationPolling()
@@ -281,7 +280,7 @@ func (m *Microservice) CheckForNewConfiguration() {
 	data, _, err := m.GetOperations(c8y.OperationStatusPending)
 
 	if err != nil {
-		log.Printf("Error getting operations. %s", err)
+		zap.S().Errorf("Error getting operations. %s", err)
 		return
 	}
 
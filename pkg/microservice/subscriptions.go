@@ -1,6 +1,7 @@
 package microservice
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -24,7 +25,7 @@ func (m *Microservice) SubscribeToNotifications(user c8y.ServiceUser, realtimeCh
 		return errors.New("failed to retrieve valid realtime client")
 	}
 
-	if connErr := realtime.Connect(); connErr != nil {
+	if connErr := realtime.Connect(context.Background()); connErr != nil {
 		return fmt.Errorf("failed to connect. %s", connErr)
 	}
 	ch := make(chan *c8y.Message)
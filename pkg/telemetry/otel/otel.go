@@ -0,0 +1,230 @@
+// Package otel implements the client instrumentation using OpenTelemetry.
+//
+// Example:
+//
+//	instrumentation, err := otel.NewInstrumentation(tracerProvider, meterProvider)
+//	if err != nil {
+//		return err
+//	}
+//	client := c8y.NewClientFromOptions(nil, c8y.ClientOptions{
+//		BaseURL:         "https://example.cumulocity.com",
+//		Instrumentation: instrumentation,
+//	})
+package otel
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/reubenmiller/go-c8y/pkg/telemetry"
+	otelapi "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the tracer and meter
+const InstrumentationName = "github.com/reubenmiller/go-c8y"
+
+// NewInstrumentation returns the client instrumentation using the tracer and meter providers.
+// The global providers are used if a provider is nil
+func NewInstrumentation(tracerProvider trace.TracerProvider, meterProvider metric.MeterProvider) (*telemetry.Instrumentation, error) {
+	metrics, err := NewMetrics(meterProvider)
+	if err != nil {
+		return nil, err
+	}
+	return &telemetry.Instrumentation{
+		Tracer:  NewTracer(tracerProvider),
+		Metrics: metrics,
+	}, nil
+}
+
+// Tracer creates OpenTelemetry spans
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns a tracer using the provider. The global provider is used if it is nil
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = otelapi.GetTracerProvider()
+	}
+	return &Tracer{
+		tracer: provider.Tracer(InstrumentationName),
+	}
+}
+
+// Start creates a new client span as a child of any span in the context
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...telemetry.Attribute) (context.Context, telemetry.Span) {
+	ctx, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(toAttributes(attrs)...),
+	)
+	return ctx, &Span{span: span}
+}
+
+// Span wraps an OpenTelemetry span
+type Span struct {
+	span trace.Span
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...telemetry.Attribute) {
+	s.span.SetAttributes(toAttributes(attrs)...)
+}
+
+// RecordError records the error and sets the span status to error
+func (s *Span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// SpanContext returns the span's context which is propagated to the server
+func (s *Span) SpanContext() telemetry.SpanContext {
+	sc := s.span.SpanContext()
+	return telemetry.SpanContext{
+		TraceID:    sc.TraceID(),
+		SpanID:     sc.SpanID(),
+		Sampled:    sc.IsSampled(),
+		TraceState: sc.TraceState().String(),
+	}
+}
+
+// End completes the span
+func (s *Span) End() {
+	s.span.End()
+}
+
+func toAttributes(attrs []telemetry.Attribute) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		switch v := attr.Value.(type) {
+		case string:
+			out = append(out, attribute.String(attr.Key, v))
+		case int:
+			out = append(out, attribute.Int(attr.Key, v))
+		case int64:
+			out = append(out, attribute.Int64(attr.Key, v))
+		case float64:
+			out = append(out, attribute.Float64(attr.Key, v))
+		case bool:
+			out = append(out, attribute.Bool(attr.Key, v))
+		case time.Duration:
+			out = append(out, attribute.Int64(attr.Key, v.Milliseconds()))
+		default:
+			out = append(out, attribute.String(attr.Key, fmt.Sprint(v)))
+		}
+	}
+	return out
+}
+
+// Metrics records the client metrics using OpenTelemetry instruments
+type Metrics struct {
+	requests           metric.Int64Counter
+	requestDuration    metric.Float64Histogram
+	retries            metric.Int64Counter
+	connections        metric.Int64Counter
+	connectionDuration metric.Float64Histogram
+	messages           metric.Int64Counter
+	messageBytes       metric.Int64Counter
+}
+
+// NewMetrics creates the client metrics using the provider. The global provider is used if it is nil.
+//
+// The following instruments are created:
+//   - c8y.client.requests
+//   - c8y.client.request.duration
+//   - c8y.client.request.retries
+//   - c8y.client.websocket.connections
+//   - c8y.client.websocket.connection.duration
+//   - c8y.client.websocket.messages
+//   - c8y.client.websocket.message.size
+func NewMetrics(provider metric.MeterProvider) (*Metrics, error) {
+	if provider == nil {
+		provider = otelapi.GetMeterProvider()
+	}
+	meter := provider.Meter(InstrumentationName)
+
+	m := &Metrics{}
+	var err error
+	if m.requests, err = meter.Int64Counter("c8y.client.requests",
+		metric.WithDescription("Total number of requests sent to Cumulocity")); err != nil {
+		return nil, err
+	}
+	if m.requestDuration, err = meter.Float64Histogram("c8y.client.request.duration",
+		metric.WithDescription("Request latency including any retries"), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if m.retries, err = meter.Int64Counter("c8y.client.request.retries",
+		metric.WithDescription("Total number of retried requests")); err != nil {
+		return nil, err
+	}
+	if m.connections, err = meter.Int64Counter("c8y.client.websocket.connections",
+		metric.WithDescription("Total number of websocket connection attempts")); err != nil {
+		return nil, err
+	}
+	if m.connectionDuration, err = meter.Float64Histogram("c8y.client.websocket.connection.duration",
+		metric.WithDescription("Time taken to establish a websocket connection"), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if m.messages, err = meter.Int64Counter("c8y.client.websocket.messages",
+		metric.WithDescription("Total number of websocket messages")); err != nil {
+		return nil, err
+	}
+	if m.messageBytes, err = meter.Int64Counter("c8y.client.websocket.message.size",
+		metric.WithDescription("Total size of the websocket messages"), metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RecordRequest records a completed request. The status code is set to "error"
+// if no response was received
+func (m *Metrics) RecordRequest(ctx context.Context, r telemetry.RequestMetric) {
+	code := "error"
+	if r.StatusCode > 0 {
+		code = strconv.Itoa(r.StatusCode)
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("operation", r.Operation),
+		attribute.String(telemetry.AttributeHTTPMethod, r.Method),
+	}
+	m.requests.Add(ctx, 1, metric.WithAttributes(append(attrs, attribute.String(telemetry.AttributeHTTPStatusCode, code))...))
+	m.requestDuration.Record(ctx, r.Duration.Seconds(), metric.WithAttributes(attrs...))
+	if r.Retries > 0 {
+		m.retries.Add(ctx, int64(r.Retries), metric.WithAttributes(attrs...))
+	}
+}
+
+// RecordConnection records a websocket connection attempt
+func (m *Metrics) RecordConnection(ctx context.Context, c telemetry.ConnectionMetric) {
+	result := "success"
+	if c.Err != nil {
+		result = "error"
+	}
+	m.connections.Add(ctx, 1, metric.WithAttributes(
+		attribute.String(telemetry.AttributeClient, c.Client),
+		attribute.Bool(telemetry.AttributeReconnect, c.Reconnect),
+		attribute.String("result", result),
+	))
+	if c.Err == nil {
+		m.connectionDuration.Record(ctx, c.Duration.Seconds(), metric.WithAttributes(
+			attribute.String(telemetry.AttributeClient, c.Client),
+		))
+	}
+}
+
+// RecordMessage records a websocket message
+func (m *Metrics) RecordMessage(ctx context.Context, msg telemetry.MessageMetric) {
+	attrs := metric.WithAttributes(
+		attribute.String(telemetry.AttributeClient, msg.Client),
+		attribute.String("direction", msg.Direction),
+	)
+	m.messages.Add(ctx, 1, attrs)
+	if msg.Bytes > 0 {
+		m.messageBytes.Add(ctx, int64(msg.Bytes), attrs)
+	}
+}
@@ -0,0 +1,229 @@
+package otel
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/reubenmiller/go-c8y/pkg/c8y"
+	"github.com/reubenmiller/go-c8y/pkg/telemetry"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// spanRecorder is an in-memory tracer provider which records the ended spans
+type spanRecorder struct {
+	tracenoop.TracerProvider
+
+	mu     sync.Mutex
+	lastID uint64
+	ended  []*recordedSpan
+}
+
+func (r *spanRecorder) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return &recordingTracer{recorder: r}
+}
+
+func (r *spanRecorder) Ended() []*recordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*recordedSpan(nil), r.ended...)
+}
+
+type recordingTracer struct {
+	tracenoop.Tracer
+	recorder *spanRecorder
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	t.recorder.mu.Lock()
+	t.recorder.lastID++
+	id := t.recorder.lastID
+	t.recorder.mu.Unlock()
+
+	parent := trace.SpanContextFromContext(ctx)
+	config := trace.SpanContextConfig{
+		TraceID:    parent.TraceID(),
+		TraceFlags: trace.FlagsSampled,
+	}
+	binary.BigEndian.PutUint64(config.SpanID[:], id)
+	if !parent.IsValid() {
+		binary.BigEndian.PutUint64(config.TraceID[8:], id)
+	}
+	span := &recordedSpan{
+		name:     name,
+		parent:   parent,
+		sc:       trace.NewSpanContext(config),
+		recorder: t.recorder,
+	}
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type recordedSpan struct {
+	tracenoop.Span
+
+	name     string
+	parent   trace.SpanContext
+	sc       trace.SpanContext
+	status   codes.Code
+	recorder *spanRecorder
+}
+
+func (s *recordedSpan) SpanContext() trace.SpanContext      { return s.sc }
+func (s *recordedSpan) IsRecording() bool                   { return true }
+func (s *recordedSpan) SetStatus(code codes.Code, _ string) { s.status = code }
+func (s *recordedSpan) Name() string                        { return s.name }
+func (s *recordedSpan) Parent() trace.SpanContext           { return s.parent }
+func (s *recordedSpan) End(...trace.SpanEndOption) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.recorder.ended = append(s.recorder.ended, s)
+}
+
+// metricRecorder is an in-memory meter provider which records the names of the instruments which have been used
+type metricRecorder struct {
+	metricnoop.MeterProvider
+
+	mu       sync.Mutex
+	recorded map[string]bool
+}
+
+func (r *metricRecorder) Meter(string, ...metric.MeterOption) metric.Meter {
+	return &recordingMeter{recorder: r}
+}
+
+func (r *metricRecorder) record(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recorded[name] = true
+}
+
+func (r *metricRecorder) Recorded() map[string]bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]bool, len(r.recorded))
+	for name := range r.recorded {
+		out[name] = true
+	}
+	return out
+}
+
+type recordingMeter struct {
+	metricnoop.Meter
+	recorder *metricRecorder
+}
+
+func (m *recordingMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return &recordingInt64Counter{name: name, recorder: m.recorder}, nil
+}
+
+func (m *recordingMeter) Float64Histogram(name string, _ ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return &recordingFloat64Histogram{name: name, recorder: m.recorder}, nil
+}
+
+type recordingInt64Counter struct {
+	metricnoop.Int64Counter
+	name     string
+	recorder *metricRecorder
+}
+
+func (c *recordingInt64Counter) Add(context.Context, int64, ...metric.AddOption) {
+	c.recorder.record(c.name)
+}
+
+type recordingFloat64Histogram struct {
+	metricnoop.Float64Histogram
+	name     string
+	recorder *metricRecorder
+}
+
+func (h *recordingFloat64Histogram) Record(context.Context, float64, ...metric.RecordOption) {
+	h.recorder.record(h.name)
+}
+
+func newTestInstrumentation(t *testing.T) (*telemetry.Instrumentation, *spanRecorder, *metricRecorder) {
+	t.Helper()
+	spans := &spanRecorder{}
+	metrics := &metricRecorder{recorded: map[string]bool{}}
+	instrumentation, err := NewInstrumentation(spans, metrics)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return instrumentation, spans, metrics
+}
+
+func TestInstrumentation_RequestSpan(t *testing.T) {
+	var traceParent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceParent = r.Header.Get(telemetry.HeaderTraceParent)
+		w.Write([]byte(`{"id":"12345"}`))
+	}))
+	defer srv.Close()
+
+	instrumentation, recorder, metrics := newTestInstrumentation(t)
+	client := c8y.NewClientFromOptions(nil, c8y.ClientOptions{
+		BaseURL:         srv.URL,
+		Tenant:          "t12345",
+		Username:        "user",
+		Password:        "pass",
+		Instrumentation: instrumentation,
+	})
+
+	ctx, parent := instrumentation.Tracer.Start(context.Background(), "parent")
+	if _, _, err := client.Inventory.GetManagedObject(ctx, "12345", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("spans: got %d, want 2", len(spans))
+	}
+	request := spans[0]
+	if request.Name() != "Inventory.GetManagedObject" {
+		t.Errorf("name: got %q, want %q", request.Name(), "Inventory.GetManagedObject")
+	}
+	if request.Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Errorf("request span should be a child of the parent span")
+	}
+	if want := (telemetry.SpanContext{TraceID: request.SpanContext().TraceID(), SpanID: request.SpanContext().SpanID(), Sampled: true}).TraceParent(); traceParent != want {
+		t.Errorf("traceparent: got %q, want %q", traceParent, want)
+	}
+
+	found := metrics.Recorded()
+	for _, name := range []string{"c8y.client.requests", "c8y.client.request.duration"} {
+		if !found[name] {
+			t.Errorf("metric %s was not recorded. got %v", name, found)
+		}
+	}
+}
+
+func TestInstrumentation_ConnectionSpan(t *testing.T) {
+	instrumentation, recorder, _ := newTestInstrumentation(t)
+
+	ctx, parent := instrumentation.Tracer.Start(context.Background(), "parent")
+	instrumentation.StartConnection(ctx, telemetry.ClientNotification2, true)(errors.New("connection refused"))
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("spans: got %d, want 2", len(spans))
+	}
+	connection := spans[0]
+	if connection.Name() != "notification2.Reconnect" {
+		t.Errorf("name: got %q, want %q", connection.Name(), "notification2.Reconnect")
+	}
+	if connection.Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Errorf("connection span should be a child of the span in the context")
+	}
+	if connection.status != codes.Error {
+		t.Errorf("status: got %v, want %v", connection.status, codes.Error)
+	}
+}
@@ -0,0 +1,112 @@
+package telemetry
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusMetrics records the client metrics using prometheus collectors
+type PrometheusMetrics struct {
+	requests           *prometheus.CounterVec
+	requestDuration    *prometheus.HistogramVec
+	retries            *prometheus.CounterVec
+	connections        *prometheus.CounterVec
+	connectionDuration *prometheus.HistogramVec
+	messages           *prometheus.CounterVec
+	messageBytes       *prometheus.CounterVec
+}
+
+// NewPrometheusMetrics creates and registers the client metrics. If the registerer is nil,
+// then the default prometheus registerer is used.
+//
+// The following metrics are registered:
+//   - c8y_client_requests_total
+//   - c8y_client_request_duration_seconds
+//   - c8y_client_request_retries_total
+//   - c8y_client_websocket_connections_total
+//   - c8y_client_websocket_connection_duration_seconds
+//   - c8y_client_websocket_messages_total
+//   - c8y_client_websocket_message_bytes_total
+func NewPrometheusMetrics(registerer prometheus.Registerer) (*PrometheusMetrics, error) {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	m := &PrometheusMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "c8y_client_requests_total",
+			Help: "Total number of requests sent to Cumulocity",
+		}, []string{"operation", "method", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "c8y_client_request_duration_seconds",
+			Help:    "Request latency including any retries",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation", "method"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "c8y_client_request_retries_total",
+			Help: "Total number of retried requests",
+		}, []string{"operation", "method"}),
+		connections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "c8y_client_websocket_connections_total",
+			Help: "Total number of websocket connection attempts",
+		}, []string{"client", "reconnect", "result"}),
+		connectionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "c8y_client_websocket_connection_duration_seconds",
+			Help:    "Time taken to establish a websocket connection",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"client"}),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "c8y_client_websocket_messages_total",
+			Help: "Total number of websocket messages",
+		}, []string{"client", "direction"}),
+		messageBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "c8y_client_websocket_message_bytes_total",
+			Help: "Total size of the websocket messages in bytes",
+		}, []string{"client", "direction"}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.requests, m.requestDuration, m.retries,
+		m.connections, m.connectionDuration, m.messages, m.messageBytes,
+	} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// RecordRequest records a completed request. The status code is set to "error"
+// if no response was received
+func (m *PrometheusMetrics) RecordRequest(ctx context.Context, r RequestMetric) {
+	code := "error"
+	if r.StatusCode > 0 {
+		code = strconv.Itoa(r.StatusCode)
+	}
+	m.requests.WithLabelValues(r.Operation, r.Method, code).Inc()
+	m.requestDuration.WithLabelValues(r.Operation, r.Method).Observe(r.Duration.Seconds())
+	if r.Retries > 0 {
+		m.retries.WithLabelValues(r.Operation, r.Method).Add(float64(r.Retries))
+	}
+}
+
+// RecordConnection records a websocket connection attempt
+func (m *PrometheusMetrics) RecordConnection(ctx context.Context, c ConnectionMetric) {
+	result := "success"
+	if c.Err != nil {
+		result = "error"
+	}
+	m.connections.WithLabelValues(c.Client, strconv.FormatBool(c.Reconnect), result).Inc()
+	if c.Err == nil {
+		m.connectionDuration.WithLabelValues(c.Client).Observe(c.Duration.Seconds())
+	}
+}
+
+// RecordMessage records a websocket message
+func (m *PrometheusMetrics) RecordMessage(ctx context.Context, msg MessageMetric) {
+	m.messages.WithLabelValues(msg.Client, msg.Direction).Inc()
+	if msg.Bytes > 0 {
+		m.messageBytes.WithLabelValues(msg.Client, msg.Direction).Add(float64(msg.Bytes))
+	}
+}
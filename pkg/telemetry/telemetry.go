@@ -0,0 +1,295 @@
+// Package telemetry provides the tracing and metrics hooks used to instrument the REST, realtime
+// and notification2 clients.
+//
+// The package does not depend on a specific tracing library. Tracing is enabled by providing a Tracer,
+// and metrics are enabled by providing a Metrics implementation such as the included Prometheus metrics.
+// The telemetry/otel package provides both using OpenTelemetry.
+package telemetry
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Header names used to propagate the W3C trace context
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+// Client names used for the websocket metrics and spans
+const (
+	ClientRealtime      = "realtime"
+	ClientNotification2 = "notification2"
+)
+
+// Message directions
+const (
+	DirectionReceived = "received"
+	DirectionSent     = "sent"
+
+	// DirectionDropped is a received message which was dropped because the consumer was too slow
+	DirectionDropped = "dropped"
+
+	// DirectionBlocked is a received message which had to wait for the consumer to catch up
+	DirectionBlocked = "blocked"
+)
+
+// Common attribute keys
+const (
+	AttributeHTTPMethod     = "http.request.method"
+	AttributeHTTPStatusCode = "http.response.status_code"
+	AttributeURL            = "url.full"
+	AttributeTenant         = "c8y.tenant"
+	AttributeRetryCount     = "http.request.resend_count"
+	AttributeDuration       = "c8y.duration_ms"
+	AttributeClient         = "c8y.client"
+	AttributeReconnect      = "c8y.reconnect"
+)
+
+// Attribute key/value pair which is attached to a span
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String creates a string attribute
+func String(key string, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int creates an integer attribute
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool creates a boolean attribute
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// SpanContext identifies a span. It is used to propagate the trace context to the server
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Sampled    bool
+	TraceState string
+}
+
+// IsValid returns true if both the trace and span id are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent returns the W3C traceparent header value, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), flags)
+}
+
+// ParseTraceParent parses a W3C traceparent header value
+func ParseTraceParent(v string) (SpanContext, error) {
+	sc := SpanContext{}
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, fmt.Errorf("invalid traceparent. value=%s", v)
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, fmt.Errorf("invalid traceparent. value=%s", v)
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, fmt.Errorf("invalid traceparent. value=%s", v)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, fmt.Errorf("invalid trace id. %w", err)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, fmt.Errorf("invalid span id. %w", err)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, fmt.Errorf("invalid trace flags. %w", err)
+	}
+	sc.Sampled = flags[0]&0x01 == 0x01
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("invalid traceparent. trace id and span id must not be zero")
+	}
+	return sc, nil
+}
+
+// Span a single unit of work
+type Span interface {
+	// SetAttributes adds attributes to the span
+	SetAttributes(attrs ...Attribute)
+
+	// RecordError records an error and marks the span as failed
+	RecordError(err error)
+
+	// SpanContext returns the span's context which is propagated to the server
+	SpanContext() SpanContext
+
+	// End completes the span
+	End()
+}
+
+// Tracer creates spans
+type Tracer interface {
+	// Start creates a new span as a child of any span in the context
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// RequestMetric information about a completed REST request
+type RequestMetric struct {
+	// Operation name, e.g. Inventory.GetManagedObject
+	Operation  string
+	Method     string
+	StatusCode int
+	Tenant     string
+	Duration   time.Duration
+	Retries    int
+	Err        error
+}
+
+// ConnectionMetric information about a websocket connection attempt
+type ConnectionMetric struct {
+	// Client name, e.g. realtime or notification2
+	Client    string
+	Reconnect bool
+	Duration  time.Duration
+	Err       error
+}
+
+// MessageMetric information about a websocket message
+type MessageMetric struct {
+	// Client name, e.g. realtime or notification2
+	Client    string
+	Direction string
+	Bytes     int
+}
+
+// Metrics records client metrics
+type Metrics interface {
+	RecordRequest(ctx context.Context, m RequestMetric)
+	RecordConnection(ctx context.Context, m ConnectionMetric)
+	RecordMessage(ctx context.Context, m MessageMetric)
+}
+
+// Instrumentation groups the tracer and metrics. Both are optional,
+// and all methods are safe to call on a nil Instrumentation
+type Instrumentation struct {
+	Tracer  Tracer
+	Metrics Metrics
+
+	// DisablePropagation disables sending the traceparent and tracestate headers
+	DisablePropagation bool
+}
+
+// Enabled returns true if tracing or metrics are enabled
+func (i *Instrumentation) Enabled() bool {
+	return i != nil && (i.Tracer != nil || i.Metrics != nil)
+}
+
+// Start starts a new span. A no-op span is returned if tracing is not enabled
+func (i *Instrumentation) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	if i == nil || i.Tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return i.Tracer.Start(ctx, name, attrs...)
+}
+
+// Propagate returns the trace context headers which should be sent with a request
+func (i *Instrumentation) Propagate(span Span) map[string]string {
+	if i == nil || i.DisablePropagation || span == nil {
+		return nil
+	}
+	sc := span.SpanContext()
+	if !sc.IsValid() {
+		return nil
+	}
+	headers := map[string]string{
+		HeaderTraceParent: sc.TraceParent(),
+	}
+	if sc.TraceState != "" {
+		headers[HeaderTraceState] = sc.TraceState
+	}
+	return headers
+}
+
+// RecordRequest records the request metrics
+func (i *Instrumentation) RecordRequest(ctx context.Context, m RequestMetric) {
+	if i != nil && i.Metrics != nil {
+		i.Metrics.RecordRequest(ctx, m)
+	}
+}
+
+// RecordConnection records the websocket connection metrics
+func (i *Instrumentation) RecordConnection(ctx context.Context, m ConnectionMetric) {
+	if i != nil && i.Metrics != nil {
+		i.Metrics.RecordConnection(ctx, m)
+	}
+}
+
+// RecordMessage records the websocket message metrics
+func (i *Instrumentation) RecordMessage(ctx context.Context, m MessageMetric) {
+	if i != nil && i.Metrics != nil {
+		i.Metrics.RecordMessage(ctx, m)
+	}
+}
+
+// StartConnection starts a span for a websocket connection attempt as a child of any span in the context.
+// The returned function must be called with the result of the connection attempt
+func (i *Instrumentation) StartConnection(ctx context.Context, client string, reconnect bool) func(err error) {
+	if !i.Enabled() {
+		return func(error) {}
+	}
+	name := client + ".Connect"
+	if reconnect {
+		name = client + ".Reconnect"
+	}
+	ctx, span := i.Start(ctx, name, String(AttributeClient, client), Bool(AttributeReconnect, reconnect))
+	start := time.Now()
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+		i.RecordConnection(ctx, ConnectionMetric{
+			Client:    client,
+			Reconnect: reconnect,
+			Duration:  time.Since(start),
+			Err:       err,
+		})
+	}
+}
+
+type contextOperationKey string
+
+func getOperationContextKey() contextOperationKey {
+	return contextOperationKey("operation")
+}
+
+// WithOperation returns a context which overrides the operation (span) name used for requests
+func WithOperation(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, getOperationContextKey(), name)
+}
+
+// OperationFromContext returns the operation name stored in the context
+func OperationFromContext(ctx context.Context) string {
+	if v, ok := ctx.Value(getOperationContextKey()).(string); ok {
+		return v
+	}
+	return ""
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) SpanContext() SpanContext   { return SpanContext{} }
+func (noopSpan) End()                       {}
@@ -0,0 +1,96 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTraceParent(t *testing.T) {
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceParent(value)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !sc.Sampled {
+		t.Errorf("sampled: got false, want true")
+	}
+	if got := sc.TraceParent(); got != value {
+		t.Errorf("traceparent: got %q, want %q", got, value)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceParent(invalid); err == nil {
+			t.Errorf("ParseTraceParent(%q): expected an error", invalid)
+		}
+	}
+}
+
+func TestInstrumentation_NilIsSafe(t *testing.T) {
+	var instrumentation *Instrumentation
+	if instrumentation.Enabled() {
+		t.Errorf("nil instrumentation should not be enabled")
+	}
+	_, span := instrumentation.Start(context.Background(), "test")
+	span.End()
+	if headers := instrumentation.Propagate(span); headers != nil {
+		t.Errorf("headers: got %v, want nil", headers)
+	}
+	instrumentation.RecordRequest(context.Background(), RequestMetric{})
+	instrumentation.StartConnection(context.Background(), ClientRealtime, false)(nil)
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewPrometheusMetrics(registry)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	instrumentation := &Instrumentation{Metrics: metrics}
+
+	ctx := context.Background()
+	instrumentation.RecordRequest(ctx, RequestMetric{Operation: "Inventory.GetManagedObject", Method: "GET", StatusCode: 200, Duration: time.Millisecond, Retries: 2})
+	instrumentation.RecordRequest(ctx, RequestMetric{Operation: "Inventory.GetManagedObject", Method: "GET", Err: errors.New("failed")})
+	instrumentation.StartConnection(ctx, ClientNotification2, true)(nil)
+	instrumentation.RecordMessage(ctx, MessageMetric{Client: ClientNotification2, Direction: DirectionReceived, Bytes: 10})
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			switch {
+			case m.GetCounter() != nil:
+				values[family.GetName()] += m.GetCounter().GetValue()
+			case m.GetHistogram() != nil:
+				values[family.GetName()] += float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	expected := map[string]float64{
+		"c8y_client_requests_total":                        2,
+		"c8y_client_request_duration_seconds":              2,
+		"c8y_client_request_retries_total":                 2,
+		"c8y_client_websocket_connections_total":           1,
+		"c8y_client_websocket_connection_duration_seconds": 1,
+		"c8y_client_websocket_messages_total":              1,
+		"c8y_client_websocket_message_bytes_total":         10,
+	}
+	for name, want := range expected {
+		if got := values[name]; got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+}
@@ -53,6 +53,7 @@ func CreateTempFile(t *testing.T, name string) *os.File {
 }
 
 func TestApplicationVersionsService_GetVersions(t *testing.T) {
+	skipIfFakeServer(t, "The application versions api is not emulated")
 	client := createTestClient()
 	app := createTestExtension(t, client, &c8y.ApplicationVersion{
 		Version: "1.0.0",
@@ -77,6 +78,7 @@ func TestApplicationVersionsService_GetVersions(t *testing.T) {
 }
 
 func TestApplicationVersionsService_GetVersionByTag(t *testing.T) {
+	skipIfFakeServer(t, "The application versions api is not emulated")
 	client := createTestClient()
 	app := createTestExtension(t, client, &c8y.ApplicationVersion{
 		Version: "1.0.1",
@@ -97,6 +99,7 @@ func TestApplicationVersionsService_GetVersionByTag(t *testing.T) {
 }
 
 func TestApplicationVersionsService_GetVersionByName(t *testing.T) {
+	skipIfFakeServer(t, "The application versions api is not emulated")
 	client := createTestClient()
 	app := createTestExtension(t, client, &c8y.ApplicationVersion{
 		Version: "1.0.2",
@@ -117,6 +120,7 @@ func TestApplicationVersionsService_GetVersionByName(t *testing.T) {
 }
 
 func TestApplicationVersionsService_CRUD_Extension(t *testing.T) {
+	skipIfFakeServer(t, "The application versions api is not emulated")
 	client := createTestClient()
 
 	file := CreateTempFile(t, "exampleExtension.zip")
@@ -32,6 +32,7 @@ func auditRecordFactory(client *c8y.Client, recordType string, application strin
 }
 
 func TestAuditService_CreateAuditRecord(t *testing.T) {
+	skipIfFakeServer(t, "The audit api is not emulated")
 	client := createTestClient()
 
 	recordInput := c8y.AuditRecord{
@@ -66,6 +67,7 @@ func TestAuditService_CreateAuditRecord(t *testing.T) {
 }
 
 func TestAuditService_GetAuditRecords(t *testing.T) {
+	skipIfFakeServer(t, "The audit api is not emulated")
 	client := createTestClient()
 	testDevice, err := createRandomTestDevice("auditLogs")
 
@@ -31,6 +31,9 @@ func createCachedClient(keys []string) *c8y.Client {
 	), cacheDir, 100*time.Second, isCacheableRequest, c8y.CacheOptions{
 		BodyKeys: keys,
 	})
+	if srv := TestEnvironment.FakeServer(); srv != nil {
+		return c8y.NewClient(httpClient, srv.URL, srv.Tenant, srv.Username, srv.Password, true)
+	}
 	client := c8y.NewClientFromEnvironment(httpClient, false)
 	return client
 }
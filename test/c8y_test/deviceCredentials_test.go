@@ -13,6 +13,7 @@ import (
 )
 
 func TestDeviceCredentialsService_PollNewDeviceRequest_CreateGetDelete(t *testing.T) {
+	skipIfFakeServer(t, "Device registration requests are not emulated")
 	client := createTestClient()
 
 	deviceID := "TEST_DEVICE" + testingutils.RandomString(7)
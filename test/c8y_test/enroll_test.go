@@ -54,6 +54,7 @@ func TestSimpleEnrollment_PollEnroll(t *testing.T) {
 }
 
 func TestSimpleEnrollment_Register(t *testing.T) {
+	skipIfFakeServer(t, "The certificate authority api is not emulated")
 	client := createTestClient()
 
 	// Ensure there is a Cumulocity CA Certificate
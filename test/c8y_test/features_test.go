@@ -9,6 +9,7 @@ import (
 )
 
 func TestFeaturesService_GetFeatures(t *testing.T) {
+	skipIfFakeServer(t, "The features api is not emulated")
 	client := createTestClient()
 
 	ctx := context.Background()
@@ -19,6 +19,14 @@ func TestMain(m *testing.M) {
 	os.Exit(res)
 }
 
+// skipIfFakeServer skips a test which uses an api or resource that the fake server does not provide
+func skipIfFakeServer(t *testing.T, reason string) {
+	t.Helper()
+	if TestEnvironment.FakeServer() != nil {
+		t.Skipf("not supported by the fake server. %s", reason)
+	}
+}
+
 func createTestClient() *c8y.Client {
 	return TestEnvironment.NewClient()
 }
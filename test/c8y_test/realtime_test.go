@@ -32,14 +32,16 @@ func OperationSenderFactory(client *c8y.Client, deviceID string, t *testing.T) f
 }
 
 func TestRealtimeClient(t *testing.T) {
+	skipIfFakeServer(t, "The realtime notification api is not emulated")
 	client := createTestClient()
 	realtime := client.Realtime
 
-	err := realtime.Connect()
+	err := realtime.Connect(context.Background())
 	testingutils.Ok(t, err)
 }
 
 func TestRealtimeSubscriptions_SubscribeToOperations(t *testing.T) {
+	skipIfFakeServer(t, "The realtime notification api is not emulated")
 	device, err := createRandomTestDevice()
 
 	if err != nil {
@@ -48,7 +50,7 @@ func TestRealtimeSubscriptions_SubscribeToOperations(t *testing.T) {
 
 	client := createTestClient()
 	realtime := client.Realtime
-	err = realtime.Connect()
+	err = realtime.Connect(context.Background())
 	testingutils.Ok(t, err)
 
 	time.Sleep(5 * time.Second)
@@ -128,6 +130,7 @@ func TestRealtimeSubscriptions_SubscribeToOperations(t *testing.T) {
 }
 
 func TestRealtimeSubscriptions_SubscribeToMeasurements(t *testing.T) {
+	skipIfFakeServer(t, "The realtime notification api is not emulated")
 	device, err := createRandomTestDevice()
 
 	if err != nil {
@@ -137,7 +140,7 @@ func TestRealtimeSubscriptions_SubscribeToMeasurements(t *testing.T) {
 	client := createTestClient()
 	realtime := client.Realtime
 
-	err = realtime.Connect()
+	err = realtime.Connect(context.Background())
 	testingutils.Ok(t, err)
 
 	ch := make(chan *c8y.Message)
@@ -227,6 +230,7 @@ func TestRealtimeSubscriptions_SubscribeToMeasurements(t *testing.T) {
 }
 
 func TestRealtimeSubscriptions_Unsubscribe(t *testing.T) {
+	skipIfFakeServer(t, "The realtime notification api is not emulated")
 	// Issue #2: https://github.com/reubenmiller/go-c8y/issues/2
 	// A subscribe -> unsubscribe -> subscribe should not result in duplicate
 	// items on the channel
@@ -243,7 +247,7 @@ func TestRealtimeSubscriptions_Unsubscribe(t *testing.T) {
 	// Create a dummy operation
 	sendOperation := OperationSenderFactory(client, device.ID, t)
 
-	err = realtime.Connect()
+	err = realtime.Connect(context.Background())
 	testingutils.Ok(t, err)
 
 	ch := make(chan *c8y.Message)
@@ -10,6 +10,7 @@ import (
 )
 
 func TestRetentionRuleService_CRUDRetentionRule(t *testing.T) {
+	skipIfFakeServer(t, "The retention rule api is not emulated")
 	client := createTestClient()
 
 	//
@@ -11,6 +11,7 @@ import (
 )
 
 func TestTenantService_GetTenantStatisticsSummary(t *testing.T) {
+	skipIfFakeServer(t, "Tenant statistics are not emulated")
 	client := createTestClient()
 
 	dateFrom, dateTo := c8y.GetDateRange("10d")
@@ -29,6 +30,7 @@ func TestTenantService_GetTenantStatisticsSummary(t *testing.T) {
 }
 
 func TestTenantService_GetTenantStatistics(t *testing.T) {
+	skipIfFakeServer(t, "Tenant statistics are not emulated")
 	client := createTestClient()
 
 	dateFrom, dateTo := c8y.GetDateRange("10d")
@@ -173,6 +175,7 @@ func TestTenantService_GetApplicationReferences(t *testing.T) {
 }
 
 func TestTenantService_GetTenantLoginOptions(t *testing.T) {
+	skipIfFakeServer(t, "Login options are not emulated")
 	client := createTestClient()
 	loginOptions, resp, err := client.Tenant.GetLoginOptions(context.Background())
 
@@ -12,6 +12,7 @@ var uiExtensionURLApp1Version1 = "https://github.com/SoftwareAG/cumulocity-remot
 var uiExtensionURLApp1Version2 = "https://github.com/SoftwareAG/cumulocity-remote-access-cloud-http-proxy/releases/download/v2.5.0/cloud-http-proxy-ui.zip"
 
 func TestUIExtensionService_CreateExtension(t *testing.T) {
+	skipIfFakeServer(t, "The ui extension api is not emulated")
 	client := createTestClient()
 
 	var err error
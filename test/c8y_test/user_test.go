@@ -99,6 +99,7 @@ func TestUserService_CRUD(t *testing.T) {
 }
 
 func TestUserService_GetGroupByName(t *testing.T) {
+	skipIfFakeServer(t, "User groups are not emulated")
 	client := createTestClient()
 
 	group, resp, err := client.User.GetGroupByName(
@@ -151,6 +152,7 @@ func TestUserService_UpdateCurrentUser(t *testing.T) {
 }
 
 func TestUserService_AddUserToGroup(t *testing.T) {
+	skipIfFakeServer(t, "User groups are not emulated")
 	client := createTestClient()
 
 	// Get user
@@ -221,6 +223,7 @@ func TestUserService_AddUserToGroup(t *testing.T) {
 }
 
 func TestUserService_GetUsersByGroup(t *testing.T) {
+	skipIfFakeServer(t, "User groups are not emulated")
 	client := createTestClient()
 
 	// Get current user
@@ -289,6 +292,7 @@ func TestUserService_GetUsersByGroup(t *testing.T) {
 }
 
 func TestUserService_GetGroups(t *testing.T) {
+	skipIfFakeServer(t, "User groups are not emulated")
 	client := createTestClient()
 
 	groupCollection, resp, err := client.User.GetGroups(
@@ -304,6 +308,7 @@ func TestUserService_GetGroups(t *testing.T) {
 }
 
 func TestUserService_GetGroupsByUser(t *testing.T) {
+	skipIfFakeServer(t, "User groups are not emulated")
 	client := createTestClient()
 
 	groupCollection, resp, err := client.User.GetGroupsByUser(
@@ -321,6 +326,7 @@ func TestUserService_GetGroupsByUser(t *testing.T) {
 
 /* ROLES */
 func TestUserService_GetRoles(t *testing.T) {
+	skipIfFakeServer(t, "User roles are not emulated")
 	client := createTestClient()
 	roleCollection, resp, err := client.User.GetRoles(
 		context.Background(),
@@ -337,6 +343,7 @@ func TestUserService_GetRoles(t *testing.T) {
 }
 
 func TestUserService_AssignRoleToUser(t *testing.T) {
+	skipIfFakeServer(t, "User roles are not emulated")
 	client := createTestClient()
 
 	roleCollection, _, err := client.User.GetRoles(
@@ -388,6 +395,7 @@ func TestUserService_AssignRoleToUser(t *testing.T) {
 }
 
 func TestUserService_AssignRoleToGroup(t *testing.T) {
+	skipIfFakeServer(t, "User roles are not emulated")
 	client := createTestClient()
 
 	roleCollection, _, err := client.User.GetRoles(